@@ -10,10 +10,13 @@ import (
 	"time"
 
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/app"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/database"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/mailer"
 	repositories "github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/scheduler"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
-	"github.com/go-co-op/gocron/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg/logs"
 	"github.com/joho/godotenv"
 )
 
@@ -26,24 +29,44 @@ func main() {
 	dbMain := database.InitDB()
 	defer dbMain.Close()
 
+	logs.InitializeLogger(dbMain)
+
+	auditLogger := audit.NewLogger(repositories.NewRepoAudit(dbMain), audit.DefaultBufferSize)
+
+	mail, err := mailer.NewFromEnv()
+	if err != nil {
+		log.Fatal("Mailer error:", err)
+	}
+
 	dbCron := database.InitDB()
 	defer dbCron.Close()
 
 	kunjunganRepo := repositories.NewRepoKunjungan(dbCron)
 	kasusRepo := repositories.NewRepoKasus(dbCron)
+	retentionPolicyRepo := repositories.NewRepoRetentionPolicy(dbCron)
+	pasienRepo := repositories.NewRepoPasien(dbCron)
 	alihMediaRepo := repositories.NewRepoAlihMedia(dbCron)
-
-	app := app.NewApplication(dbMain)
-
-	cronService := services.NewCronService(kunjunganRepo, kasusRepo, alihMediaRepo)
-
-	scheduler := startCronScheduler(cronService)
+	retensiRepo := repositories.NewRepoRetensi(dbCron)
+	pemusnahanRepo := repositories.NewRepoPemusnahan(dbCron)
+	cronRunRepo := repositories.NewRepoCronRun(dbCron)
+	cronJobRepo := repositories.NewRepoCronJob(dbCron)
+	dokumenRepo := repositories.NewRepoDokumen(dbCron)
+	lockRepo := repositories.NewRepoLock(dbCron)
+	transactor := repositories.NewTransactor(dbCron)
+	legalHoldRepo := repositories.NewRepoLegalHold(dbCron)
+	userRepo := repositories.NewRepoUser(dbCron)
+
+	cronService := services.NewCronService(kunjunganRepo, kasusRepo, retentionPolicyRepo, pasienRepo, alihMediaRepo, retensiRepo, pemusnahanRepo, cronRunRepo, dokumenRepo, lockRepo, transactor, legalHoldRepo, userRepo, auditLogger)
+
+	registry := startCronScheduler(cronService, cronJobRepo)
 	defer func() {
-		if err := scheduler.Shutdown(); err != nil {
+		if err := registry.Shutdown(); err != nil {
 			log.Printf("Error shutting down scheduler: %v", err)
 		}
 	}()
 
+	app := app.NewApplication(dbMain, registry, auditLogger, mail)
+
 	port := os.Getenv("APP_PORT")
 	if port == "" {
 		port = "8000"
@@ -64,93 +87,102 @@ func main() {
 		}
 	}()
 
-	waitForShutdown(server, scheduler)
+	waitForShutdown(server, registry, auditLogger)
 }
 
-func startCronScheduler(cronService services.CronService) gocron.Scheduler {
-	scheduler, err := gocron.NewScheduler(gocron.WithLocation(time.UTC))
+func startCronScheduler(cronService services.CronService, cronJobRepo repositories.CronJobRepository) *scheduler.Registry {
+	registry, err := scheduler.NewRegistry(cronJobRepo)
 	if err != nil {
 		log.Fatalf("Failed to create scheduler: %v", err)
 	}
 
-	job, err := scheduler.NewJob(
-		gocron.DailyJob(
-			1,
-			gocron.NewAtTimes(
-				gocron.NewAtTime(8, 0, 0),
-			),
-		),
-		gocron.NewTask(func() {
-			log.Println("Starting scheduled cron job...")
-			ctx := context.Background()
-			startTime := time.Now()
-
-			if err := cronService.CheckAndProcessKunjungan(ctx); err != nil {
-				log.Printf("Cron job failed: %v", err)
-			} else {
-				log.Printf("Cron job completed successfully in %v", time.Since(startTime))
-			}
-		}),
-	)
-
-	if err != nil {
-		log.Printf("Failed to schedule cron job: %v", err)
-	} else {
-
-		nextRun, err := job.NextRun()
-		if err == nil {
-			log.Printf("Cron job scheduled. Next run at: %v", nextRun.Format("2006-01-02 15:04:05"))
-		} else {
-			log.Printf("Failed to get next run time: %v", err)
-		}
+	registry.Register(services.CronJobInactivation, func(ctx context.Context, trigger string) error {
+		_, err := cronService.CheckAndProcessKunjungan(ctx, trigger)
+		return err
+	})
+	registry.Register(services.CronJobLifecycle, func(ctx context.Context, trigger string) error {
+		_, err := cronService.AdvanceLifecycle(ctx, trigger)
+		return err
+	})
+	registry.Register(services.CronJobReport, func(ctx context.Context, trigger string) error {
+		_, err := cronService.GenerateReport(ctx, trigger)
+		return err
+	})
+	registry.Register(services.CronJobUploadCleanup, func(ctx context.Context, trigger string) error {
+		_, err := cronService.CleanupUploads(ctx, trigger)
+		return err
+	})
+	registry.Register(services.CronJobRegistrationPurge, func(ctx context.Context, trigger string) error {
+		_, err := cronService.PurgeUnverifiedUsers(ctx, trigger)
+		return err
+	})
+
+	if err := registry.Sync(context.Background()); err != nil {
+		log.Printf("Failed to load cron jobs: %v", err)
 	}
 
 	runInitialCheck := os.Getenv("RUN_INITIAL_CRON")
 	if runInitialCheck == "true" || runInitialCheck == "1" {
 		log.Println("🔍 Running initial cron job check...")
 		ctx := context.Background()
-		startTime := time.Now()
 
-		if err := cronService.CheckAndProcessKunjungan(ctx); err != nil {
-			log.Printf("Initial cron job failed: %v", err)
-		} else {
-			log.Printf("Initial cron job completed successfully in %v", time.Since(startTime))
+		for _, name := range []string{services.CronJobInactivation, services.CronJobLifecycle} {
+			startTime := time.Now()
+			if err := registry.RunNow(ctx, name, services.CronTriggerInitial); err != nil {
+				log.Printf("Initial %s job failed: %v", name, err)
+			} else {
+				log.Printf("Initial %s job completed successfully in %v", name, time.Since(startTime))
+			}
 		}
 	}
 
-	scheduler.Start()
+	registry.Start()
 	log.Println("Cron job scheduler started")
 
+	// Pick up schedule edits made through another instance of the API.
+	go func() {
+		ticker := time.NewTicker(1 * time.Minute)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := registry.Sync(context.Background()); err != nil {
+				log.Printf("Failed to reload cron jobs: %v", err)
+			}
+		}
+	}()
+
 	go func() {
 		ticker := time.NewTicker(1 * time.Hour)
 		defer ticker.Stop()
 
 		for range ticker.C {
+			names := registry.Names()
+			if len(names) == 0 {
+				log.Printf("Cron service heartbeat - No jobs scheduled")
+				continue
+			}
 
-			if job != nil {
-				nextRun, err := job.NextRun()
-				if err == nil {
-					log.Printf("Cron service heartbeat - Next run: %v", nextRun.Format("2006-01-02 15:04:05"))
+			for _, name := range names {
+				if nextRun := registry.NextRun(name); nextRun != nil {
+					log.Printf("Cron service heartbeat - %s next run: %v", name, nextRun.Format("2006-01-02 15:04:05"))
 				} else {
-					log.Printf("Cron service heartbeat - Failed to get next run: %v", err)
+					log.Printf("Cron service heartbeat - %s: failed to get next run", name)
 				}
-			} else {
-				log.Printf("Cron service heartbeat - Job not initialized")
 			}
 		}
 	}()
 
-	return scheduler
+	return registry
 }
 
-func waitForShutdown(server *http.Server, scheduler gocron.Scheduler) {
+func waitForShutdown(server *http.Server, registry *scheduler.Registry, auditLogger *audit.Logger) {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	<-sigChan
 	log.Println("Shutdown signal received. Gracefully shutting down...")
 
-	if err := scheduler.Shutdown(); err != nil {
+	if err := registry.Shutdown(); err != nil {
 		log.Printf("Scheduler shutdown error: %v", err)
 	}
 
@@ -161,150 +193,9 @@ func waitForShutdown(server *http.Server, scheduler gocron.Scheduler) {
 		log.Printf("Server shutdown error: %v", err)
 	}
 
+	if err := auditLogger.Close(ctx); err != nil {
+		log.Printf("Audit log shutdown error: %v", err)
+	}
+
 	log.Println("Server stopped gracefully")
 }
-
-// func main() {
-// 	err := godotenv.Load()
-// 	if err != nil {
-// 		log.Fatal("Error loading .env file")
-// 	}
-// 	db := database.InitDB()
-// 	defer db.Close()
-
-// 	app := app.NewApplication(db)
-
-// 	startCronScheduler(app.CronService)
-
-// 	port := os.Getenv("APP_PORT")
-// 	if port == "" {
-// 		port = "8000"
-// 	}
-
-// 	log.Printf("Server started on :%s", port)
-
-// 	server := &http.Server{
-// 		Addr:         ":" + port,
-// 		Handler:      app.Router,
-// 		ReadTimeout:  15 * time.Second,
-// 		WriteTimeout: 15 * time.Second,
-// 		IdleTimeout:  60 * time.Second,
-// 	}
-
-// 	go func() {
-// 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-// 			log.Fatal("Server error:", err)
-// 		}
-// 	}()
-
-// 	waitForShutdown(server)
-// }
-
-// func startCronScheduler(cronService services.CronService) {
-// 	scheduler, err := gocron.NewScheduler(
-// 		gocron.WithLocation(time.UTC),
-// 	)
-// 	if err != nil {
-// 		log.Printf("Failed to create scheduler: %v", err)
-// 		return
-// 	}
-
-// 	cronSchedule := os.Getenv("CRON_SCHEDULE")
-// 	if cronSchedule == "" {
-// 		cronSchedule = "08:00"
-// 	}
-
-// 	log.Printf("Setting up cron job to run daily at %s", cronSchedule)
-
-// 	_, err = scheduler.NewJob(
-// 		gocron.DailyJob(
-// 			1,
-// 			gocron.NewAtTimes(
-// 				gocron.NewAtTime(8, 0, 0),
-// 			),
-// 		),
-// 		gocron.NewTask(
-// 			func() {
-// 				log.Println("Starting scheduled cron job...")
-// 				ctx := context.Background()
-// 				startTime := time.Now()
-
-// 				if err := cronService.CheckAndProcessKunjungan(ctx); err != nil {
-// 					log.Printf("Cron job failed: %v", err)
-// 				} else {
-// 					duration := time.Since(startTime)
-// 					log.Printf("Cron job completed successfully in %v", duration)
-// 				}
-// 			},
-// 		),
-// 	)
-
-// 	if err != nil {
-// 		log.Printf("Failed to schedule cron job: %v", err)
-// 		return
-// 	}
-
-// 	runInitialCheck := os.Getenv("RUN_INITIAL_CRON")
-// 	if runInitialCheck == "true" || runInitialCheck == "1" {
-// 		log.Println("🔍 Running initial cron job check...")
-// 		ctx := context.Background()
-// 		startTime := time.Now()
-
-// 		if err := cronService.CheckAndProcessKunjungan(ctx); err != nil {
-// 			log.Printf("Initial cron job failed: %v", err)
-// 		} else {
-// 			duration := time.Since(startTime)
-// 			log.Printf("Initial cron job completed successfully in %v", duration)
-// 		}
-// 	}
-
-// 	scheduler.Start()
-// 	log.Printf("Cron job scheduler started")
-
-// 	jobs := scheduler.Jobs()
-// 	if len(jobs) > 0 {
-// 		nextRun, err := jobs[0].NextRun()
-// 		if err == nil {
-// 			log.Printf("Next run at: %v", nextRun.Format("2006-01-02 15:04:05"))
-// 		} else {
-// 			log.Printf("Failed to get next run time: %v", err)
-// 		}
-// 	}
-
-// 	go func() {
-// 		ticker := time.NewTicker(1 * time.Hour)
-// 		defer ticker.Stop()
-
-// 		for range ticker.C {
-// 			// Get jobs - only one return value in v2
-// 			jobs := scheduler.Jobs()
-// 			if len(jobs) > 0 {
-// 				nextRun, err := jobs[0].NextRun()
-// 				if err == nil {
-// 					log.Printf("Cron service heartbeat - Next run: %v", nextRun.Format("2006-01-02 15:04:05"))
-// 				} else {
-// 					log.Printf("Cron service heartbeat - Failed to get next run: %v", err)
-// 				}
-// 			} else {
-// 				log.Printf("Cron service heartbeat - No jobs scheduled")
-// 			}
-// 		}
-// 	}()
-// }
-
-// func waitForShutdown(server *http.Server) {
-// 	sigChan := make(chan os.Signal, 1)
-// 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-// 	<-sigChan
-// 	log.Println("Shutdown signal received. Gracefully shutting down...")
-
-// 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-// 	defer cancel()
-
-// 	if err := server.Shutdown(ctx); err != nil {
-// 		log.Printf("Server shutdown error: %v", err)
-// 	}
-
-// 	log.Println("Server stopped gracefully")
-// }
@@ -3,8 +3,13 @@ package app
 import (
 	"database/sql"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/handler/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/mailer"
 	customMiddleware "github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
@@ -20,10 +25,11 @@ type App struct {
 	CronService services.CronService
 }
 
-func NewApplication(db *sql.DB) *App {
+func NewApplication(db *sql.DB, scheduler services.CronJobScheduler, auditRecorder audit.Recorder, mail mailer.Mailer) *App {
 	kasusRepo := repositories.NewRepoKasus(db)
 	dokumenRepo := repositories.NewRepoDokumen(db)
 	userRepo := repositories.NewRepoUser(db)
+	loginChallengeRepo := repositories.NewRepoLoginChallenge(db)
 	pasienRepo := repositories.NewRepoPasien(db)
 	kunjunganRepo := repositories.NewRepoKunjungan(db)
 	infoSistemRepo := repositories.NewRepoInfoSistem(db)
@@ -31,20 +37,68 @@ func NewApplication(db *sql.DB) *App {
 	retensiRepo := repositories.NewRepoRetensi(db)
 	pemusnahanRepo := repositories.NewRepoPemusnahan(db)
 	generalRepo := repositories.NewRepoGeneral(db)
+	cronRunRepo := repositories.NewRepoCronRun(db)
+	cronJobRepo := repositories.NewRepoCronJob(db)
+	lockRepo := repositories.NewRepoLock(db)
+	transactor := repositories.NewTransactor(db)
+	retentionPolicyRepo := repositories.NewRepoRetentionPolicy(db)
+	legalHoldRepo := repositories.NewRepoLegalHold(db)
+	destructionBatchRepo := repositories.NewRepoDestructionBatch(db)
+	beritaAcaraRepo := repositories.NewRepoBeritaAcara(db)
+	auditRepo := repositories.NewRepoAudit(db)
+	accessLogRepo := repositories.NewRepoAccessLog(db)
+	sessionRepo := repositories.NewRepoSession(db)
+	roleRepo := repositories.NewRepoRole(db)
+	passwordResetRepo := repositories.NewRepoPasswordReset(db)
+	emailVerificationRepo := repositories.NewRepoEmailVerification(db)
+	loginAttemptRepo := repositories.NewRepoLoginAttempt(db)
+	twoFactorRepo := repositories.NewRepoTwoFactor(db)
 
-	kasusService := services.NewServiceKasus(kasusRepo)
-	userService := services.NewServiceUser(userRepo)
-	pasienService := services.NewServicePasien(pasienRepo)
-	kunjunganService := services.NewServiceKunjungan(kunjunganRepo, pasienRepo, kasusRepo)
-	dokumenService := services.NewServiceDokumen(dokumenRepo)
-	infoSistemService := services.InfoSistemService(infoSistemRepo)
-	alihMediaService := services.NewServiceAlihMedia(aliMediaRepo, kunjunganRepo, kasusRepo)
-	retensiService := services.NewServiceRetensi(retensiRepo)
-	pemusnahanService := services.NewServicePemusnahan(pemusnahanRepo)
+	kasusService := services.NewServiceKasus(kasusRepo, retentionPolicyRepo, auditRecorder)
+	accessTTL, _ := time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL"))
+	refreshTTL, _ := time.ParseDuration(os.Getenv("REFRESH_TOKEN_TTL"))
+	sessionService := services.NewServiceSession(sessionRepo, userRepo, auditRecorder, accessTTL, refreshTTL)
+	customMiddleware.InitializeSessions(sessionService)
+	customMiddleware.InitializeAccessLog(auditRecorder)
+
+	roleService := services.NewServiceRole(roleRepo, auditRecorder)
+	customMiddleware.InitializePermissions(roleService)
+
+	loginAccountLimit, _ := strconv.Atoi(os.Getenv("LOGIN_MAX_FAILURES"))
+	loginIPLimit, _ := strconv.Atoi(os.Getenv("LOGIN_IP_MAX_FAILURES"))
+	loginLockout, _ := time.ParseDuration(os.Getenv("LOGIN_LOCKOUT"))
+	loginThrottleService := services.NewServiceLoginThrottle(loginAttemptRepo, userRepo, auditRecorder, loginAccountLimit, loginIPLimit, loginLockout)
+
+	twoFactorService := services.NewServiceTwoFactor(twoFactorRepo, userRepo, roleService, sessionService, auditRecorder, os.Getenv("TOTP_ISSUER"))
+
+	userService := services.NewServiceUser(userRepo, loginChallengeRepo, sessionService, roleService, loginThrottleService, twoFactorService, auditRecorder)
+
+	resetTTL, _ := time.ParseDuration(os.Getenv("PASSWORD_RESET_TTL"))
+	passwordResetService := services.NewServicePasswordReset(passwordResetRepo, userRepo, sessionService, mail, transactor, auditRecorder, resetTTL, os.Getenv("PASSWORD_RESET_URL"))
+
+	verificationTTL, _ := time.ParseDuration(os.Getenv("EMAIL_VERIFICATION_TTL"))
+	registrationService := services.NewServiceRegistration(userRepo, emailVerificationRepo, mail, auditRecorder, verificationTTL, os.Getenv("EMAIL_VERIFICATION_URL"))
+
+	pasienService := services.NewServicePasien(pasienRepo, legalHoldRepo, auditRecorder)
+	kunjunganService := services.NewServiceKunjungan(kunjunganRepo, pasienRepo, kasusRepo, dokumenRepo, legalHoldRepo, destructionBatchRepo, transactor, auditRecorder)
+	dokumenService := services.NewServiceDokumen(dokumenRepo, auditRecorder)
+	infoSistemService := services.NewServiceInfoSistem(infoSistemRepo, auditRecorder)
+	alihMediaService := services.NewServiceAlihMedia(aliMediaRepo, kunjunganRepo, kasusRepo, retentionPolicyRepo, pasienRepo, legalHoldRepo, transactor, auditRecorder)
+	retensiService := services.NewServiceRetensi(retensiRepo, kunjunganRepo, legalHoldRepo, auditRecorder)
+	pemusnahanService := services.NewServicePemusnahan(pemusnahanRepo, kunjunganRepo, legalHoldRepo, destructionBatchRepo, transactor, auditRecorder)
 	generalService := services.NewServiceGeneral(generalRepo)
+	legalHoldService := services.NewServiceLegalHold(legalHoldRepo, pasienRepo, kunjunganRepo, auditRecorder)
+
+	retentionScheduleService := services.NewServiceRetentionSchedule(kunjunganRepo, kasusRepo, retentionPolicyRepo, pasienRepo)
+	beritaAcaraService := services.NewServiceBeritaAcara(beritaAcaraRepo, destructionBatchRepo, pemusnahanRepo, userRepo, infoSistemRepo, transactor, auditRecorder)
+
+	minApprovals, _ := strconv.Atoi(os.Getenv("PEMUSNAHAN_MIN_APPROVALS"))
+	auditService := services.NewServiceAudit(auditRepo, accessLogRepo)
+
+	destructionBatchService := services.NewServiceDestructionBatch(destructionBatchRepo, pemusnahanRepo, kunjunganRepo, legalHoldRepo, transactor, beritaAcaraService, auditRecorder, minApprovals)
 
 	kasusHandler := handler.NewKasusHandler(kasusService)
-	userHandler := handler.NewUserHandler(userService)
+	userHandler := handler.NewUserHandler(userService, sessionService, loginThrottleService)
 	PasienHandler := handler.NewPasienHandler(pasienService)
 	kunjunganHandler := handler.NewKunjunganHandler(kunjunganService, dokumenService, alihMediaService)
 	infoSistemHandler := handler.NewInfoSistemHandler(infoSistemService)
@@ -52,35 +106,49 @@ func NewApplication(db *sql.DB) *App {
 	retensiHandler := handler.NewRetensiHandler(retensiService)
 	pemusnahanHandler := handler.NewPemusnahanHandler(pemusnahanService)
 	generalHandler := handler.NewGeneralHandler(generalService)
+	legalHoldHandler := handler.NewLegalHoldHandler(legalHoldService)
+	retentionScheduleHandler := handler.NewRetentionScheduleHandler(retentionScheduleService)
+	destructionBatchHandler := handler.NewDestructionBatchHandler(destructionBatchService, beritaAcaraService)
+	auditHandler := handler.NewAuditHandler(auditService)
+	roleHandler := handler.NewRoleHandler(roleService)
+	passwordResetHandler := handler.NewPasswordResetHandler(passwordResetService)
+	registrationHandler := handler.NewRegistrationHandler(registrationService)
+	twoFactorHandler := handler.NewTwoFactorHandler(twoFactorService, userService)
 
-	cronService := services.NewCronService(kunjunganRepo, kasusRepo, aliMediaRepo)
-	cronHandler := handler.NewCronHandler(cronService)
+	downloadTTL, _ := time.ParseDuration(os.Getenv("DOWNLOAD_LINK_TTL"))
+	downloadHandler := handler.NewDownloadHandler(downloadTTL)
+
+	cronService := services.NewCronService(kunjunganRepo, kasusRepo, retentionPolicyRepo, pasienRepo, aliMediaRepo, retensiRepo, pemusnahanRepo, cronRunRepo, dokumenRepo, lockRepo, transactor, legalHoldRepo, userRepo, auditRecorder)
+	cronJobService := services.NewServiceCronJob(cronJobRepo, scheduler, auditRecorder)
+	cronHandler := handler.NewCronHandler(cronService, cronJobService)
 
 	router := chi.NewRouter()
 
-	limiter := rate.NewLimiter(rate.Limit(1), 5)
+	rateLimitMaxClients, _ := strconv.Atoi(os.Getenv("RATE_LIMIT_MAX_CLIENTS"))
+	rateLimiter := customMiddleware.NewRateLimiter(customMiddleware.RateLimits{
+		Login:   customMiddleware.RateLimitPolicy{Limit: rate.Every(6 * time.Second), Burst: 10},
+		Bulk:    customMiddleware.RateLimitPolicy{Limit: rate.Every(10 * time.Second), Burst: 3},
+		Default: customMiddleware.RateLimitPolicy{Limit: rate.Limit(10), Burst: 30},
+	}, 10*time.Minute, rateLimitMaxClients)
+
+	// Forwarded client addresses are only believed from these proxies.
+	trustedProxies := customMiddleware.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
 
 	router.Use(
 		middleware.Logger,
-		middleware.RealIP,
+		middleware.RequestID,
+		customMiddleware.ClientIP(trustedProxies),
 		middleware.Recoverer,
 		customMiddleware.SecurityHeaders,
-		func(next http.Handler) http.Handler {
-			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				if !limiter.Allow() {
-					pkg.Error(w, http.StatusTooManyRequests, "Too many request")
-					return
-				}
-				next.ServeHTTP(w, r)
-			})
-		},
+		// CORS goes before the limiter so preflights are answered without
+		// using the budget and a 429 still carries the CORS headers.
+		cors.Handler(cors.Options{
+			AllowedOrigins: []string{"http://localhost:5173"},
+		}),
+		rateLimiter.Handler,
 	)
 
-	router.Use(cors.Handler(cors.Options{
-		AllowedOrigins: []string{"http://localhost:5173"},
-	}))
-
-	router.Handle("/uploads/*", http.StripPrefix("/uploads", http.FileServer(http.Dir("uploads"))))
+	kunjunganHandler.UploadRoutes(router)
 
 	router.Route("/api/v2", func(r chi.Router) {
 		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
@@ -89,6 +157,11 @@ func NewApplication(db *sql.DB) *App {
 		generalHandler.GeneralRoutes(r)
 		userHandler.UserRoutes(r)
 		userHandler.UserAdminRoutes(r)
+		roleHandler.RoleRoutes(r)
+		passwordResetHandler.PasswordResetRoutes(r)
+		registrationHandler.RegistrationRoutes(r)
+		twoFactorHandler.TwoFactorRoutes(r)
+		downloadHandler.DownloadRoutes(r)
 		kasusHandler.KasusRoutes(r)
 		PasienHandler.PasienRoutes(r)
 		kunjunganHandler.KunjunganRoutes(r)
@@ -97,6 +170,10 @@ func NewApplication(db *sql.DB) *App {
 		retensiHandler.RetensiRoutes(r)
 		pemusnahanHandler.PemusnahanRoutes(r)
 		cronHandler.CronRoutes(r)
+		legalHoldHandler.LegalHoldRoutes(r)
+		destructionBatchHandler.DestructionBatchRoutes(r)
+		retentionScheduleHandler.RetentionScheduleRoutes(r)
+		auditHandler.AuditRoutes(r)
 	})
 
 	return &App{
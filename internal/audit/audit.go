@@ -0,0 +1,240 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+)
+
+type Action string
+
+const (
+	Create Action = "create"
+	Update Action = "update"
+	Delete Action = "delete"
+)
+
+const (
+	DefaultBufferSize    = 1024
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = 2 * time.Second
+)
+
+// Recorder is what services use to add to the audit trail. Record never
+// fails the caller; problems are logged. RecordTx is for changes that must not
+// happen without their audit row: it writes inside tx and returns the error,
+// so the caller rolls back instead.
+type Recorder interface {
+	Record(ctx context.Context, action Action, entity string, entityID interface{}, before, after interface{})
+	RecordTx(ctx context.Context, tx *sql.Tx, action Action, entity string, entityID interface{}, before, after interface{}) error
+}
+
+// Logger is a Recorder that queues entries in memory and writes them in
+// batches from a background goroutine, so requests do not wait on the
+// audit_log insert. Actor, IP and request ID are taken from ctx at the time
+// Record is called.
+type Logger struct {
+	repo          repositories.AuditRepository
+	entries       chan *models.AuditLog
+	batchSize     int
+	flushInterval time.Duration
+
+	closeOnce sync.Once
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+func NewLogger(repo repositories.AuditRepository, bufferSize int) *Logger {
+	if bufferSize < 1 {
+		bufferSize = DefaultBufferSize
+	}
+
+	l := &Logger{
+		repo:          repo,
+		entries:       make(chan *models.AuditLog, bufferSize),
+		batchSize:     DefaultBatchSize,
+		flushInterval: DefaultFlushInterval,
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+
+	go l.run()
+	return l
+}
+
+func (l *Logger) Record(ctx context.Context, action Action, entity string, entityID interface{}, before, after interface{}) {
+	entry, err := NewEntry(ctx, action, entity, entityID, before, after)
+	if err != nil {
+		log.Printf("Audit: failed to build %s %s entry: %v", action, entity, err)
+		return
+	}
+
+	select {
+	case <-l.done:
+		log.Printf("Audit: logger closed, dropping %s %s %s", action, entity, entry.EntityID)
+		return
+	default:
+	}
+
+	select {
+	case l.entries <- entry:
+	default:
+		// The buffer is full: wait rather than lose part of the trail.
+		log.Printf("Audit: buffer full, waiting to queue %s %s %s", action, entity, entry.EntityID)
+		select {
+		case l.entries <- entry:
+		case <-l.done:
+			log.Printf("Audit: logger closed, dropping %s %s %s", action, entity, entry.EntityID)
+		}
+	}
+}
+
+// RecordTx appends the entry to the hash chain inside tx, bypassing the queue.
+func (l *Logger) RecordTx(ctx context.Context, tx *sql.Tx, action Action, entity string, entityID interface{}, before, after interface{}) error {
+	entry, err := NewEntry(ctx, action, entity, entityID, before, after)
+	if err != nil {
+		return fmt.Errorf("audit %s %s: %w", action, entity, err)
+	}
+
+	return l.repo.InsertAuditLogsTx(ctx, tx, []*models.AuditLog{entry})
+}
+
+// Close stops accepting entries and waits until everything queued has been
+// written, or ctx is done.
+func (l *Logger) Close(ctx context.Context) error {
+	l.closeOnce.Do(func() { close(l.done) })
+
+	select {
+	case <-l.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *Logger) run() {
+	defer close(l.stopped)
+
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*models.AuditLog, 0, l.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		l.write(batch)
+		batch = make([]*models.AuditLog, 0, l.batchSize)
+	}
+
+	for {
+		select {
+		case entry := <-l.entries:
+			batch = append(batch, entry)
+			if len(batch) >= l.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-l.done:
+			for {
+				select {
+				case entry := <-l.entries:
+					batch = append(batch, entry)
+					if len(batch) >= l.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (l *Logger) write(batch []*models.AuditLog) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := l.repo.InsertAuditLogs(ctx, batch); err != nil {
+		log.Printf("Audit: failed to write %d entries: %v", len(batch), err)
+		for _, entry := range batch {
+			log.Printf("Audit: unwritten entry %s %s %s by %v", entry.Action, entry.Entity, entry.EntityID, entry.ActorID)
+		}
+	}
+}
+
+// NewEntry builds an audit row for a change to entity, reading the actor,
+// client IP and request ID from ctx. before is nil for a create and after is
+// nil for a delete.
+func NewEntry(ctx context.Context, action Action, entity string, entityID interface{}, before, after interface{}) (*models.AuditLog, error) {
+	beforeJSON, err := snapshot(before)
+	if err != nil {
+		return nil, err
+	}
+
+	afterJSON, err := snapshot(after)
+	if err != nil {
+		return nil, err
+	}
+
+	// Diff before redacting so a changed secret still shows up as changed.
+	diff, err := Diff(beforeJSON, afterJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, raw := range []*json.RawMessage{&beforeJSON, &afterJSON, &diff} {
+		if *raw == nil {
+			continue
+		}
+		if *raw, err = redact(*raw); err != nil {
+			return nil, err
+		}
+	}
+
+	entry := &models.AuditLog{
+		ActorRole: pkg.GetUserRoleFromCtx(ctx),
+		Action:    string(action),
+		Entity:    entity,
+		EntityID:  fmt.Sprint(entityID),
+		Before:    string(beforeJSON),
+		After:     string(afterJSON),
+		Diff:      string(diff),
+		IP:        pkg.GetClientIPFromCtx(ctx),
+		RequestID: pkg.GetRequestIDFromCtx(ctx),
+		CreatedAt: time.Now(),
+	}
+
+	if actorID := pkg.GetUserIDFromCtx(ctx); actorID != 0 {
+		entry.ActorID = &actorID
+	}
+
+	return entry, nil
+}
+
+func snapshot(v interface{}) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(raw) == "null" {
+		return nil, nil
+	}
+
+	return raw, nil
+}
@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Values longer than this (base64 logos, for example) are replaced by their
+// size and hash so a change is still visible without copying the content.
+const maxValueLength = 1024
+
+var sensitiveKeys = []string{"password", "secret", "token", "otp"}
+
+type change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// Diff returns the top-level fields that differ between two JSON objects as
+// {"Field": {"from": ..., "to": ...}}. A missing side is treated as an empty
+// object, so a create lists every field with a null "from".
+func Diff(before, after json.RawMessage) (json.RawMessage, error) {
+	from, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool)
+	for k := range from {
+		keys[k] = true
+	}
+	for k := range to {
+		keys[k] = true
+	}
+
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	changes := make(map[string]change)
+	for _, k := range names {
+		if !reflect.DeepEqual(from[k], to[k]) {
+			changes[k] = change{From: from[k], To: to[k]}
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	return json.Marshal(changes)
+}
+
+func fields(raw json.RawMessage) (map[string]interface{}, error) {
+	out := make(map[string]interface{})
+	if len(raw) == 0 {
+		return out, nil
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+
+	if obj, ok := v.(map[string]interface{}); ok {
+		return obj, nil
+	}
+
+	// Scalars and lists are compared as a whole.
+	out["value"] = v
+	return out, nil
+}
+
+// redact masks credentials and shortens oversized values anywhere in the
+// document.
+func redact(raw json.RawMessage) (json.RawMessage, error) {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(redactValue("", v))
+}
+
+func redactValue(key string, v interface{}) interface{} {
+	lower := strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(lower, sensitive) {
+			if v == nil || v == "" {
+				return v
+			}
+			return "[REDACTED]"
+		}
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			val[k] = redactValue(k, child)
+		}
+		return val
+	case []interface{}:
+		for i, child := range val {
+			val[i] = redactValue(key, child)
+		}
+		return val
+	case string:
+		if len(val) > maxValueLength {
+			return fmt.Sprintf("[%d bytes, sha256:%x]", len(val), sha256.Sum256([]byte(val)))
+		}
+		return val
+	}
+
+	return v
+}
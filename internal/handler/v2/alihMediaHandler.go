@@ -8,6 +8,7 @@ import (
 
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
 	"github.com/go-chi/chi/v5"
@@ -24,15 +25,28 @@ func NewAlihMediaHandler(service services.AlihMediaService) *AlihMediaHandler {
 func (hdl *AlihMediaHandler) AlihMediaRoutes(router chi.Router) {
 	router.Group(func(r chi.Router) {
 		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.AlihMediaRead))
 
 		r.Get("/alih-media", hdl.GetAll)
 		r.Get("/alih-media/search", hdl.Search)
 		r.Get("/alih-media/{id}", hdl.GetByID)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.AlihMediaWrite))
+
 		r.Post("/alih-media", hdl.Create)
 		r.Put("/alih-media/{id}", hdl.Update)
 		r.Delete("/alih-media/{id}", hdl.Delete)
 	})
-	router.Get("/alih-media/export", hdl.Export)
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyTokenOrSignedURL)
+		r.Use(middleware.RequirePermission(rbac.AlihMediaRead, rbac.DataExport))
+
+		r.Get("/alih-media/export", hdl.Export)
+	})
 }
 
 func (hdl *AlihMediaHandler) GetAll(w http.ResponseWriter, r *http.Request) {
@@ -114,7 +128,7 @@ func (hdl *AlihMediaHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	newAlihMedia, err := hdl.service.Create(r.Context(), alihMedia)
 	if err != nil {
-		pkg.Error(w, http.StatusBadRequest, err.Error())
+		pkg.Error(w, lifecycleErrorStatus(err, http.StatusBadRequest), err.Error())
 		return
 	}
 
@@ -149,7 +163,7 @@ func (hdl *AlihMediaHandler) Update(w http.ResponseWriter, r *http.Request) {
 
 	updatedAlihMedia, err := hdl.service.Update(r.Context(), alihMedia)
 	if err != nil {
-		pkg.Error(w, http.StatusInternalServerError, err.Error())
+		pkg.Error(w, lifecycleErrorStatus(err, http.StatusInternalServerError), err.Error())
 		return
 	}
 
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+	"github.com/go-chi/chi/v5"
+)
+
+type AuditHandler struct {
+	service services.AuditService
+}
+
+func NewAuditHandler(service services.AuditService) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+func (hdl *AuditHandler) AuditRoutes(router chi.Router) {
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.AuditRead))
+
+		r.Get("/audit", hdl.Search)
+		r.Get("/audit/verify", hdl.Verify)
+		r.Get("/audit/pasien/{id}", hdl.SearchPasien)
+		r.Get("/audit/pasien/{id}/viewers", hdl.GetViewers)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyTokenOrSignedURL)
+		r.Use(middleware.RequirePermission(rbac.AuditRead))
+
+		r.Get("/audit/export", hdl.Export)
+	})
+}
+
+func (hdl *AuditHandler) Search(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilterFromQuery(r)
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := hdl.service.Search(r.Context(), filter)
+	if err != nil {
+		pkg.Error(w, auditErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Data fetched successfully", page)
+}
+
+// SearchPasien answers "who changed this patient's record": the pasien row
+// itself plus its kunjungan, dokumen, lifecycle rows and legal holds.
+func (hdl *AuditHandler) SearchPasien(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 1 {
+		pkg.Error(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	filter, err := auditFilterFromQuery(r)
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.IDPasien = id
+
+	page, err := hdl.service.Search(r.Context(), filter)
+	if err != nil {
+		pkg.Error(w, auditErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Data fetched successfully", page)
+}
+
+func (hdl *AuditHandler) GetViewers(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 1 {
+		pkg.Error(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+
+	page, err := hdl.service.GetViewers(r.Context(), id, query.Get("cursor"), limit)
+	if err != nil {
+		pkg.Error(w, auditErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Data fetched successfully", page)
+}
+
+func (hdl *AuditHandler) Export(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilterFromQuery(r)
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	data, err := hdl.service.Export(r.Context(), filter, format)
+	if err != nil {
+		pkg.Error(w, auditErrorStatus(err), err.Error())
+		return
+	}
+
+	if format == services.AuditExportCSV {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=audit-log.csv")
+	} else {
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		w.Header().Set("Content-Disposition", "attachment; filename=audit-log.xlsx")
+	}
+	w.Write(data)
+}
+
+func (hdl *AuditHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	report, err := hdl.service.Verify(r.Context())
+	if err != nil {
+		pkg.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	message := "Audit chain is intact"
+	if !report.Valid {
+		message = "Audit chain is broken"
+	}
+
+	pkg.Success(w, message, report)
+}
+
+func auditFilterFromQuery(r *http.Request) (services.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := services.AuditFilter{
+		UserID:   query.Get("user"),
+		Entity:   query.Get("entity"),
+		EntityID: query.Get("entity_id"),
+		Action:   query.Get("action"),
+		From:     query.Get("from"),
+		To:       query.Get("to"),
+		Cursor:   query.Get("cursor"),
+	}
+
+	if pasien := query.Get("pasien"); pasien != "" {
+		id, err := strconv.Atoi(pasien)
+		if err != nil || id < 1 {
+			return filter, errors.New("Invalid pasien ID")
+		}
+		filter.IDPasien = id
+	}
+
+	filter.Limit, _ = strconv.Atoi(query.Get("limit"))
+	return filter, nil
+}
+
+func auditErrorStatus(err error) int {
+	if errors.Is(err, services.ErrInvalidAuditFilter) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
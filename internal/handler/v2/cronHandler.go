@@ -1,38 +1,73 @@
 package handler
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
 	"github.com/go-chi/chi/v5"
 )
 
 type CronHandler struct {
-	cronService services.CronService
+	cronService    services.CronService
+	cronJobService services.CronJobService
 }
 
-func NewCronHandler(cronService services.CronService) *CronHandler {
-	return &CronHandler{cronService: cronService}
+func NewCronHandler(cronService services.CronService, cronJobService services.CronJobService) *CronHandler {
+	return &CronHandler{cronService: cronService, cronJobService: cronJobService}
 }
 
 func (hdl *CronHandler) CronRoutes(router chi.Router) {
 	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.CronRead))
+
+		r.Get("/cron/preview", hdl.Preview)
+		r.Get("/cron/runs", hdl.GetRuns)
+		r.Get("/cron/runs/{id}", hdl.GetRunByID)
+		r.Get("/cron/runs/kunjungan/{id}", hdl.GetRunItemsByKunjungan)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyTokenOrSignedURL)
+		r.Use(middleware.RequirePermission(rbac.CronRead, rbac.DataExport))
+
+		r.Get("/cron/preview/export", hdl.ExportPreview)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.CronRun))
+
 		r.Post("/cron/check-inactive", hdl.CheckInactiveKunjungen)
 		r.Post("/cron/process-kunjungan/{id}", hdl.ProcessSingleKunjungan)
+		r.Post("/cron/advance-lifecycle", hdl.AdvanceLifecycle)
 		r.Post("/cron/run-now", hdl.RunCronNow)
 	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.CronManage))
+		r.Get("/cron/jobs", hdl.GetJobs)
+		r.Get("/cron/jobs/{name}", hdl.GetJobByName)
+		r.Put("/cron/jobs/{name}", hdl.UpdateJob)
+	})
 }
 
 func (hdl *CronHandler) CheckInactiveKunjungen(w http.ResponseWriter, r *http.Request) {
-	err := hdl.cronService.CheckAndProcessKunjungan(r.Context())
+	run, err := hdl.cronService.CheckAndProcessKunjungan(r.Context(), services.CronTriggerManual)
 	if err != nil {
-		pkg.Error(w, http.StatusInternalServerError, "Failed to process inactive kunjungen: "+err.Error())
+		pkg.Error(w, cronErrorStatus(err), "Failed to process inactive kunjungen: "+err.Error())
 		return
 	}
 
-	pkg.Success(w, "Inactive kunjungen check completed successfully", nil)
+	pkg.Success(w, "Inactive kunjungen check completed successfully", run)
 }
 
 func (hdl *CronHandler) ProcessSingleKunjungan(w http.ResponseWriter, r *http.Request) {
@@ -45,19 +80,176 @@ func (hdl *CronHandler) ProcessSingleKunjungan(w http.ResponseWriter, r *http.Re
 
 	err = hdl.cronService.ProcessKunjungan(r.Context(), id)
 	if err != nil {
-		pkg.Error(w, http.StatusInternalServerError, "Failed to process kunjungan: "+err.Error())
+		pkg.Error(w, cronErrorStatus(err), "Failed to process kunjungan: "+err.Error())
 		return
 	}
 
 	pkg.Success(w, "Kunjungan processed successfully", nil)
 }
 
+func (hdl *CronHandler) AdvanceLifecycle(w http.ResponseWriter, r *http.Request) {
+	run, err := hdl.cronService.AdvanceLifecycle(r.Context(), services.CronTriggerManual)
+	if err != nil {
+		pkg.Error(w, cronErrorStatus(err), "Failed to advance lifecycle: "+err.Error())
+		return
+	}
+
+	pkg.Success(w, "Lifecycle advanced successfully", run)
+}
+
 func (hdl *CronHandler) RunCronNow(w http.ResponseWriter, r *http.Request) {
-	err := hdl.cronService.CheckAndProcessKunjungan(r.Context())
+	inactivation, err := hdl.cronService.CheckAndProcessKunjungan(r.Context(), services.CronTriggerManual)
+	if err != nil {
+		pkg.Error(w, cronErrorStatus(err), "Failed to run cron job: "+err.Error())
+		return
+	}
+
+	lifecycle, err := hdl.cronService.AdvanceLifecycle(r.Context(), services.CronTriggerManual)
+	if err != nil {
+		pkg.Error(w, cronErrorStatus(err), "Failed to advance lifecycle: "+err.Error())
+		return
+	}
+
+	pkg.Success(w, "Cron job executed successfully", []*models.CronRun{inactivation, lifecycle})
+}
+
+func (hdl *CronHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	preview, err := hdl.cronService.Preview(r.Context())
+	if err != nil {
+		pkg.Error(w, http.StatusInternalServerError, "Failed to build cron preview: "+err.Error())
+		return
+	}
+
+	pkg.Success(w, "Cron preview generated successfully", preview)
+}
+
+func (hdl *CronHandler) ExportPreview(w http.ResponseWriter, r *http.Request) {
+	data, err := hdl.cronService.ExportPreview(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", "attachment; filename=cron-preview.xlsx")
+	w.Write(data)
+}
+
+func (hdl *CronHandler) GetRuns(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+
+	runs, err := hdl.cronService.GetRuns(r.Context(), page, perPage)
+	if err != nil {
+		pkg.Error(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	pkg.Success(w, "Data fetched successfully", runs)
+}
+
+func (hdl *CronHandler) GetRunByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	run, err := hdl.cronService.GetRunByID(r.Context(), id)
+	if err != nil {
+		if err.Error() == "Cron run not found" {
+			pkg.Error(w, http.StatusNotFound, err.Error())
+		} else {
+			pkg.Error(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	pkg.Success(w, "Data found", run)
+}
+
+func (hdl *CronHandler) GetRunItemsByKunjungan(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	items, err := hdl.cronService.GetRunItemsByKunjungan(r.Context(), id)
+	if err != nil {
+		pkg.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	pkg.Success(w, "Data found", items)
+}
+
+func (hdl *CronHandler) GetJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := hdl.cronJobService.GetAll(r.Context())
+	if err != nil {
+		pkg.Error(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	pkg.Success(w, "Data fetched successfully", jobs)
+}
+
+func (hdl *CronHandler) GetJobByName(w http.ResponseWriter, r *http.Request) {
+	job, err := hdl.cronJobService.GetByName(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		if err.Error() == "Cron job not found" {
+			pkg.Error(w, http.StatusNotFound, err.Error())
+		} else {
+			pkg.Error(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	pkg.Success(w, "Data found", job)
+}
+
+func (hdl *CronHandler) UpdateJob(w http.ResponseWriter, r *http.Request) {
+	type UpdateCronJob struct {
+		Expression string `json:"Expression"`
+		Timezone   string `json:"Timezone"`
+		Enabled    *bool  `json:"Enabled"`
+	}
+
+	var req UpdateCronJob
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	existing, err := hdl.cronJobService.GetByName(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		if err.Error() == "Cron job not found" {
+			pkg.Error(w, http.StatusNotFound, err.Error())
+		} else {
+			pkg.Error(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	job := models.CronJob{
+		Name:       existing.Name,
+		Expression: req.Expression,
+		Timezone:   req.Timezone,
+		Enabled:    existing.Enabled,
+	}
+	if req.Enabled != nil {
+		job.Enabled = *req.Enabled
+	}
+
+	updated, err := hdl.cronJobService.Update(r.Context(), job)
 	if err != nil {
-		pkg.Error(w, http.StatusInternalServerError, "Failed to run cron job: "+err.Error())
+		if strings.HasPrefix(err.Error(), "Invalid schedule") {
+			pkg.Error(w, http.StatusBadRequest, err.Error())
+		} else {
+			pkg.Error(w, http.StatusInternalServerError, err.Error())
+		}
 		return
 	}
 
-	pkg.Success(w, "Cron job executed successfully", nil)
+	pkg.Success(w, "Data updated", updated)
 }
@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+	"github.com/go-chi/chi/v5"
+)
+
+type DestructionBatchHandler struct {
+	service            services.DestructionBatchService
+	beritaAcaraService services.BeritaAcaraService
+}
+
+func NewDestructionBatchHandler(service services.DestructionBatchService, beritaAcaraService services.BeritaAcaraService) *DestructionBatchHandler {
+	return &DestructionBatchHandler{service: service, beritaAcaraService: beritaAcaraService}
+}
+
+func (hdl *DestructionBatchHandler) DestructionBatchRoutes(router chi.Router) {
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.PemusnahanRead))
+
+		r.Get("/pemusnahan/batches", hdl.GetAll)
+		r.Get("/pemusnahan/batches/{id}", hdl.GetByID)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyTokenOrSignedURL)
+		r.Use(middleware.RequirePermission(rbac.PemusnahanRead))
+
+		r.Get("/pemusnahan/batches/{id}/berita-acara", hdl.DownloadBeritaAcara)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.PemusnahanWrite))
+
+		r.Post("/pemusnahan/batches", hdl.Create)
+		r.Post("/pemusnahan/batches/{id}/items", hdl.AddItems)
+		r.Delete("/pemusnahan/batches/{id}/items/{idKunjungan}", hdl.RemoveItem)
+		r.Post("/pemusnahan/batches/{id}/submit", hdl.Submit)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.PemusnahanApprove))
+
+		r.Post("/pemusnahan/batches/{id}/approve", hdl.Approve)
+		r.Post("/pemusnahan/batches/{id}/reject", hdl.Reject)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.PemusnahanExecute))
+
+		r.Post("/pemusnahan/batches/{id}/execute", hdl.Execute)
+	})
+}
+
+func (hdl *DestructionBatchHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+
+	batches, err := hdl.service.GetAll(r.Context(), page, perPage)
+	if err != nil {
+		pkg.Error(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	pkg.Success(w, "Data fetched successfully", batches)
+}
+
+func (hdl *DestructionBatchHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	batch, err := hdl.service.GetByID(r.Context(), id)
+	if err != nil {
+		pkg.Error(w, batchErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Data found", batch)
+}
+
+func (hdl *DestructionBatchHandler) Create(w http.ResponseWriter, r *http.Request) {
+	type CreateDestructionBatch struct {
+		Nama       string `json:"Nama"`
+		Keterangan string `json:"Keterangan"`
+	}
+
+	var req CreateDestructionBatch
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	batch, err := hdl.service.Create(r.Context(), models.DestructionBatch{
+		Nama:       req.Nama,
+		Keterangan: req.Keterangan,
+	})
+	if err != nil {
+		pkg.Error(w, batchErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Destruction batch created", batch)
+}
+
+func (hdl *DestructionBatchHandler) AddItems(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	type AddItems struct {
+		IDKunjungan []int `json:"IdKunjungan"`
+	}
+
+	var req AddItems
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	batch, err := hdl.service.AddItems(r.Context(), id, req.IDKunjungan)
+	if err != nil {
+		pkg.Error(w, batchErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Records added to batch", batch)
+}
+
+func (hdl *DestructionBatchHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	idKunjungan, err := strconv.Atoi(chi.URLParam(r, "idKunjungan"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	batch, err := hdl.service.RemoveItem(r.Context(), id, idKunjungan)
+	if err != nil {
+		pkg.Error(w, batchErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Record removed from batch", batch)
+}
+
+func (hdl *DestructionBatchHandler) Submit(w http.ResponseWriter, r *http.Request) {
+	hdl.transition(w, r, hdl.service.Submit, "Destruction batch submitted")
+}
+
+func (hdl *DestructionBatchHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	type ApproveBatch struct {
+		Catatan string `json:"Catatan"`
+	}
+
+	// The note is optional, so an empty body is accepted.
+	var req ApproveBatch
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	batch, err := hdl.service.Approve(r.Context(), id, req.Catatan)
+	if err != nil {
+		pkg.Error(w, batchErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Destruction batch approved", batch)
+}
+
+func (hdl *DestructionBatchHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	hdl.transition(w, r, hdl.service.Reject, "Destruction batch returned to draft")
+}
+
+func (hdl *DestructionBatchHandler) Execute(w http.ResponseWriter, r *http.Request) {
+	hdl.transition(w, r, hdl.service.Execute, "Destruction batch executed")
+}
+
+func (hdl *DestructionBatchHandler) DownloadBeritaAcara(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	beritaAcara, data, err := hdl.beritaAcaraService.Download(r.Context(), id)
+	if err != nil {
+		pkg.Error(w, batchErrorStatus(err), err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "attachment; filename="+filepath.Base(beritaAcara.FilePath))
+	w.Write(data)
+}
+
+func (hdl *DestructionBatchHandler) transition(
+	w http.ResponseWriter,
+	r *http.Request,
+	action func(ctx context.Context, id int) (*models.DestructionBatch, error),
+	message string,
+) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	batch, err := action(r.Context(), id)
+	if err != nil {
+		pkg.Error(w, batchErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, message, batch)
+}
+
+func batchErrorStatus(err error) int {
+	switch {
+	case err.Error() == "Destruction batch not found":
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrBatchState), errors.Is(err, repositories.ErrBatchStateChanged):
+		return http.StatusConflict
+	}
+	return lifecycleErrorStatus(err, http.StatusBadRequest)
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+	"github.com/go-chi/chi/v5"
+)
+
+const DefaultDownloadLinkTTL = 5 * time.Minute
+
+// DownloadHandler issues signed links for export and file routes so the
+// frontend can hand them to the browser, which cannot send a Bearer token.
+type DownloadHandler struct {
+	ttl time.Duration
+}
+
+func NewDownloadHandler(ttl time.Duration) *DownloadHandler {
+	if ttl <= 0 {
+		ttl = DefaultDownloadLinkTTL
+	}
+	return &DownloadHandler{ttl: ttl}
+}
+
+func (hdl *DownloadHandler) DownloadRoutes(router chi.Router) {
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+
+		r.Post("/downloads/sign", hdl.Sign)
+	})
+}
+
+// Sign returns url signed for the caller. Whether the link is usable is
+// decided when it is opened: the route must accept signed links and the
+// caller's role must have the route's permissions.
+func (hdl *DownloadHandler) Sign(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL string `json:"url"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx := r.Context()
+	expiresAt := time.Now().Add(hdl.ttl)
+	signed, err := pkg.SignURL(req.URL, pkg.SignedLink{
+		UserID:    pkg.GetUserIDFromCtx(ctx),
+		SessionID: pkg.GetSessionIDFromCtx(ctx),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.Success(w, "Download link created", map[string]interface{}{
+		"url":        signed,
+		"expires_at": expiresAt,
+	})
+}
@@ -3,6 +3,8 @@ package handler
 import (
 	"net/http"
 
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
 	"github.com/go-chi/chi/v5"
@@ -17,7 +19,12 @@ func NewGeneralHandler(service services.GeneralService) *GeneralHandler {
 }
 
 func (h *GeneralHandler) GeneralRoutes(r chi.Router) {
-	r.Get("/general/statistik", h.GetStatistik)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.ReportRead))
+
+		r.Get("/general/statistik", h.GetStatistik)
+	})
 }
 
 func (h *GeneralHandler) GetStatistik(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/lifecycle"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
+)
+
+func lifecycleErrorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, lifecycle.ErrInvalidTransition):
+		return http.StatusConflict
+	case errors.Is(err, lifecycle.ErrUnknownStatus):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrLegalHold):
+		return http.StatusConflict
+	}
+	return fallback
+}
+
+func cronErrorStatus(err error) int {
+	if errors.Is(err, repositories.ErrLockNotAcquired) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
 	"github.com/go-chi/chi/v5"
@@ -23,9 +24,16 @@ func NewInfoSistemHandler(service services.InfoSistemService) *InfoSistemHandler
 func (hdl *InfoSistemHandler) InfoSistemRoutes(router chi.Router) {
 	router.Group(func(r chi.Router) {
 		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.InfoSistemRead))
 
 		r.Get("/info-sistem", hdl.GetAll)
 		r.Get("/info-sistem/{id}", hdl.GetByID)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.InfoSistemWrite))
+
 		r.Post("/info-sistem", hdl.Create)
 		r.Put("/info-sistem/{id}", hdl.Update)
 	})
@@ -1,7 +1,9 @@
 package handler
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"os"
@@ -10,6 +12,8 @@ import (
 
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/retention"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
 	"github.com/go-chi/chi/v5"
@@ -26,16 +30,31 @@ func NewKasusHandler(service services.KasusService) *KasusHandler {
 func (hdl *KasusHandler) KasusRoutes(router chi.Router) {
 	router.Group(func(r chi.Router) {
 		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.KasusRead))
 
 		r.Get("/kasus", hdl.GetAll)
 		r.Get("/kasus/search", hdl.Search)
 		r.Get("/kasus/{id}", hdl.GetByID)
+		r.Get("/kasus/{id}/policy", hdl.GetPolicy)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.KasusWrite))
+
 		r.Post("/kasus", hdl.Create)
 		r.Put("/kasus/{id}", hdl.Update)
 		r.Delete("/kasus/{id}", hdl.Delete)
+		r.Put("/kasus/{id}/policy", hdl.UpdatePolicy)
 		r.Post("/kasus/import", hdl.Import)
 	})
-	router.Get("/kasus/export", hdl.Export)
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyTokenOrSignedURL)
+		r.Use(middleware.RequirePermission(rbac.KasusRead, rbac.DataExport))
+
+		r.Get("/kasus/export", hdl.Export)
+	})
 }
 
 func (hdl *KasusHandler) GetAll(w http.ResponseWriter, r *http.Request) {
@@ -256,3 +275,67 @@ func (hdl *KasusHandler) Export(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+func (hdl *KasusHandler) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	policy, err := hdl.service.GetPolicy(r.Context(), id)
+	if err != nil {
+		if err.Error() == "Kasus not found" || errors.Is(err, sql.ErrNoRows) {
+			pkg.Error(w, http.StatusNotFound, "Kasus not found")
+		} else {
+			pkg.Error(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	pkg.Success(w, "Data found", policy)
+}
+
+func (hdl *KasusHandler) UpdatePolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	type UpdatePolicy struct {
+		PeriodUnit       string `json:"PeriodUnit"`
+		Permanent        bool   `json:"Permanent"`
+		AdultAge         int    `json:"AdultAge"`
+		MinorRetainYears int    `json:"MinorRetainYears"`
+	}
+
+	var req UpdatePolicy
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	policy := models.RetentionPolicy{
+		IDKasus:          id,
+		PeriodUnit:       req.PeriodUnit,
+		Permanent:        req.Permanent,
+		AdultAge:         req.AdultAge,
+		MinorRetainYears: req.MinorRetainYears,
+	}
+
+	updated, err := hdl.service.UpdatePolicy(r.Context(), policy)
+	if err != nil {
+		switch {
+		case errors.Is(err, retention.ErrInvalidPolicy):
+			pkg.Error(w, http.StatusBadRequest, err.Error())
+		case err.Error() == "Kasus not found" || errors.Is(err, sql.ErrNoRows):
+			pkg.Error(w, http.StatusNotFound, "Kasus not found")
+		default:
+			pkg.Error(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	pkg.Success(w, "Data updated", updated)
+}
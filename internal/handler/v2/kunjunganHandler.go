@@ -7,10 +7,12 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
 	"github.com/go-chi/chi/v5"
@@ -29,10 +31,17 @@ func NewKunjunganHandler(service services.KunjunganService, dokumenService servi
 func (hdl *KunjunganHandler) KunjunganRoutes(router chi.Router) {
 	router.Group(func(r chi.Router) {
 		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.KunjunganRead))
 
 		r.Get("/kunjungan", hdl.GetAll)
 		r.Get("/kunjungan/search", hdl.Search)
-		r.Get("/kunjungan/{id}", hdl.GetByID)
+		r.With(middleware.LogRecordAccess(nil)).Get("/kunjungan/{id}", hdl.GetByID)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.KunjunganWrite))
+
 		r.Post("/kunjungan", hdl.Create)
 		r.Post("/kunjungan/import", hdl.Import)
 		r.Put("/kunjungan/{id}", hdl.Update)
@@ -40,6 +49,24 @@ func (hdl *KunjunganHandler) KunjunganRoutes(router chi.Router) {
 	})
 }
 
+// UploadRoutes serves the uploaded dokumen files. Every download is tied to a
+// user and logged against the file's pasien.
+func (hdl *KunjunganHandler) UploadRoutes(router chi.Router) {
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyTokenOrSignedURL)
+		r.Use(middleware.RequirePermission(rbac.DokumenRead))
+		r.Use(middleware.LogRecordAccess(hdl.pasienOfUpload))
+
+		r.Handle("/uploads/*", http.StripPrefix("/uploads", http.FileServer(http.Dir("uploads"))))
+	})
+}
+
+// pasienOfUpload maps /uploads/<date>/<file> to the dokumen stored under
+// uploads/<date>/<file>.
+func (hdl *KunjunganHandler) pasienOfUpload(r *http.Request) (int, error) {
+	return hdl.dokumenService.GetPasienIDByPath(r.Context(), strings.TrimPrefix(r.URL.Path, "/"))
+}
+
 func (hdl *KunjunganHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
 	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
@@ -99,6 +126,7 @@ func (hdl *KunjunganHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	middleware.SetAccessedPasien(r, kunjungan.IDPasien)
 	pkg.Success(w, "Data found", kunjungan)
 }
 
@@ -237,13 +265,8 @@ func (hdl *KunjunganHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := hdl.dokumenService.DeleteDokumen(r.Context(), id); err != nil {
-		pkg.Error(w, http.StatusInternalServerError, "Failed to delete dokumen: "+err.Error())
-		return
-	}
-
 	if err := hdl.service.Delete(r.Context(), id); err != nil {
-		pkg.Error(w, http.StatusInternalServerError, err.Error())
+		pkg.Error(w, lifecycleErrorStatus(err, http.StatusInternalServerError), err.Error())
 		return
 	}
 
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+	"github.com/go-chi/chi/v5"
+)
+
+type LegalHoldHandler struct {
+	service services.LegalHoldService
+}
+
+func NewLegalHoldHandler(service services.LegalHoldService) *LegalHoldHandler {
+	return &LegalHoldHandler{service: service}
+}
+
+func (hdl *LegalHoldHandler) LegalHoldRoutes(router chi.Router) {
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.LegalHoldRead))
+
+		r.Get("/legal-holds", hdl.GetAll)
+		r.Get("/legal-holds/{id}", hdl.GetByID)
+		r.Get("/legal-holds/kunjungan/{id}", hdl.GetByKunjungan)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.LegalHoldWrite))
+
+		r.Post("/legal-holds", hdl.Create)
+		r.Post("/legal-holds/{id}/release", hdl.Release)
+	})
+}
+
+func (hdl *LegalHoldHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	activeOnly := r.URL.Query().Get("active") == "true"
+
+	holds, err := hdl.service.GetAll(r.Context(), activeOnly)
+	if err != nil {
+		pkg.Error(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	pkg.Success(w, "Data fetched successfully", holds)
+}
+
+func (hdl *LegalHoldHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	hold, err := hdl.service.GetByID(r.Context(), id)
+	if err != nil {
+		if err.Error() == "Legal hold not found" {
+			pkg.Error(w, http.StatusNotFound, err.Error())
+		} else {
+			pkg.Error(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	pkg.Success(w, "Data found", hold)
+}
+
+func (hdl *LegalHoldHandler) GetByKunjungan(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	holds, err := hdl.service.GetByKunjungan(r.Context(), id)
+	if err != nil {
+		pkg.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	pkg.Success(w, "Data found", holds)
+}
+
+func (hdl *LegalHoldHandler) Create(w http.ResponseWriter, r *http.Request) {
+	type CreateLegalHold struct {
+		IDPasien    *int       `json:"IdPasien"`
+		IDKunjungan *int       `json:"IdKunjungan"`
+		Reason      string     `json:"Reason"`
+		ExpiresAt   *time.Time `json:"ExpiresAt"`
+	}
+
+	var req CreateLegalHold
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	hold := models.LegalHold{
+		IDPasien:    req.IDPasien,
+		IDKunjungan: req.IDKunjungan,
+		Reason:      req.Reason,
+		ExpiresAt:   req.ExpiresAt,
+	}
+
+	newHold, err := hdl.service.Create(r.Context(), hold)
+	if err != nil {
+		switch err.Error() {
+		case "Pasien not found", "Kunjungan not found":
+			pkg.Error(w, http.StatusNotFound, err.Error())
+		default:
+			pkg.Error(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	pkg.Success(w, "Legal hold placed", newHold)
+}
+
+func (hdl *LegalHoldHandler) Release(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	hold, err := hdl.service.Release(r.Context(), id)
+	if err != nil {
+		switch err.Error() {
+		case "Legal hold not found":
+			pkg.Error(w, http.StatusNotFound, err.Error())
+		case "Legal hold already released":
+			pkg.Error(w, http.StatusConflict, err.Error())
+		default:
+			pkg.Error(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	pkg.Success(w, "Legal hold released", hold)
+}
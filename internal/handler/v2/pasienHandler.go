@@ -10,6 +10,7 @@ import (
 
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
 	"github.com/go-chi/chi/v5"
@@ -24,18 +25,31 @@ func NewPasienHandler(service services.PasienService) *PasienHandler {
 }
 
 func (hdl *PasienHandler) PasienRoutes(router chi.Router) {
-	router.Get("/pasien/export", hdl.Export)
 	router.Group(func(r chi.Router) {
 		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.PasienRead))
 
 		r.Get("/pasien", hdl.GetAll)
 		r.Get("/pasien/search", hdl.Search)
-		r.Get("/pasien/{id}", hdl.GetByID)
+		r.With(middleware.LogRecordAccess(pasienFromURL)).Get("/pasien/{id}", hdl.GetByID)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.PasienWrite))
+
 		r.Post("/pasien", hdl.Create)
 		r.Put("/pasien/{id}", hdl.Update)
 		r.Delete("/pasien/{id}", hdl.Delete)
 		r.Post("/pasien/import", hdl.Import)
 	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyTokenOrSignedURL)
+		r.Use(middleware.RequirePermission(rbac.PasienRead, rbac.DataExport))
+
+		r.Get("/pasien/export", hdl.Export)
+	})
 }
 
 func (hdl *PasienHandler) GetAll(w http.ResponseWriter, r *http.Request) {
@@ -187,7 +201,7 @@ func (hdl *PasienHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := hdl.service.Delete(r.Context(), id); err != nil {
-		pkg.Error(w, http.StatusInternalServerError, err.Error())
+		pkg.Error(w, lifecycleErrorStatus(err, http.StatusInternalServerError), err.Error())
 		return
 	}
 
@@ -261,3 +275,7 @@ func (hdl *PasienHandler) Export(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+func pasienFromURL(r *http.Request) (int, error) {
+	return strconv.Atoi(chi.URLParam(r, "id"))
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+	"github.com/go-chi/chi/v5"
+)
+
+type PasswordResetHandler struct {
+	service services.PasswordResetService
+}
+
+func NewPasswordResetHandler(service services.PasswordResetService) *PasswordResetHandler {
+	return &PasswordResetHandler{service: service}
+}
+
+func (hdl *PasswordResetHandler) PasswordResetRoutes(router chi.Router) {
+	router.Post("/password/forgot", hdl.Forgot)
+	router.Post("/password/reset", hdl.Reset)
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.UserManage))
+
+		r.Post("/users/{id}/password-reset", hdl.SendReset)
+	})
+}
+
+func (hdl *PasswordResetHandler) Forgot(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := hdl.service.Forgot(r.Context(), req.Email); err != nil {
+		pkg.Error(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	pkg.Success(w, "If the email is registered, a reset link has been sent", nil)
+}
+
+func (hdl *PasswordResetHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := hdl.service.Reset(r.Context(), req.Token, req.NewPassword); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			status = http.StatusUnauthorized
+		}
+		pkg.Error(w, status, err.Error())
+		return
+	}
+
+	pkg.Success(w, "Password has been reset", nil)
+}
+
+func (hdl *PasswordResetHandler) SendReset(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := hdl.service.SendReset(r.Context(), id); err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "User not found" {
+			status = http.StatusNotFound
+		}
+		pkg.Error(w, status, err.Error())
+		return
+	}
+
+	pkg.Success(w, "Reset link sent", nil)
+}
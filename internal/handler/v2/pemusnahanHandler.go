@@ -8,6 +8,7 @@ import (
 
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
 	"github.com/go-chi/chi/v5"
@@ -24,15 +25,28 @@ func NewPemusnahanHandler(service services.PemusnahanService) *PemusnahanHandler
 func (hdl *PemusnahanHandler) PemusnahanRoutes(router chi.Router) {
 	router.Group(func(r chi.Router) {
 		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.PemusnahanRead))
 
 		r.Get("/pemusnahan", hdl.GetAll)
 		r.Get("/pemusnahan/search", hdl.Search)
 		r.Get("/pemusnahan/{id}", hdl.GetByID)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.PemusnahanWrite))
+
 		r.Post("/pemusnahan", hdl.Create)
 		r.Put("/pemusnahan/{id}", hdl.Update)
 		r.Delete("/pemusnahan/{id}", hdl.Delete)
 	})
-	router.Get("/pemusnahan/export", hdl.Export)
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyTokenOrSignedURL)
+		r.Use(middleware.RequirePermission(rbac.PemusnahanRead, rbac.DataExport))
+
+		r.Get("/pemusnahan/export", hdl.Export)
+	})
 }
 
 func (hdl *PemusnahanHandler) GetAll(w http.ResponseWriter, r *http.Request) {
@@ -114,7 +128,7 @@ func (hdl *PemusnahanHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	newPemusnahan, err := hdl.service.Create(r.Context(), pemusnahan)
 	if err != nil {
-		pkg.Error(w, http.StatusBadRequest, err.Error())
+		pkg.Error(w, lifecycleErrorStatus(err, http.StatusBadRequest), err.Error())
 		return
 	}
 
@@ -159,7 +173,7 @@ func (hdl *PemusnahanHandler) Update(w http.ResponseWriter, r *http.Request) {
 
 	updatedPemusnahan, err := hdl.service.Update(r.Context(), pemusnahan)
 	if err != nil {
-		pkg.Error(w, http.StatusInternalServerError, err.Error())
+		pkg.Error(w, lifecycleErrorStatus(err, http.StatusInternalServerError), err.Error())
 		return
 	}
 
@@ -175,7 +189,11 @@ func (hdl *PemusnahanHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := hdl.service.Delete(r.Context(), id); err != nil {
-		pkg.Error(w, http.StatusInternalServerError, err.Error())
+		status := http.StatusInternalServerError
+		if err.Error() == "Pemusnahan not found" {
+			status = http.StatusNotFound
+		}
+		pkg.Error(w, lifecycleErrorStatus(err, status), err.Error())
 		return
 	}
 
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+	"github.com/go-chi/chi/v5"
+)
+
+type RegistrationHandler struct {
+	service services.RegistrationService
+}
+
+func NewRegistrationHandler(service services.RegistrationService) *RegistrationHandler {
+	return &RegistrationHandler{service: service}
+}
+
+func (hdl *RegistrationHandler) RegistrationRoutes(router chi.Router) {
+	router.Post("/register", hdl.Register)
+	router.Post("/register/verify", hdl.Verify)
+	router.Post("/register/resend", hdl.Resend)
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.UserManage))
+
+		r.Get("/users/pending", hdl.GetPending)
+		r.Post("/users/{id}/approve", hdl.Approve)
+		r.Post("/users/{id}/reject", hdl.Reject)
+	})
+}
+
+func (hdl *RegistrationHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	user := models.User{
+		Name:     req.Name,
+		Email:    req.Email,
+		Password: req.Password,
+		Role:     rbac.DefaultRole,
+		Status:   "tidak aktif",
+	}
+
+	newUser, err := hdl.service.Register(r.Context(), user)
+	if err != nil {
+		status := http.StatusBadRequest
+		if err.Error() == "Email already used" {
+			status = http.StatusConflict
+		}
+		pkg.Error(w, status, err.Error())
+		return
+	}
+
+	pkg.Success(w, "User registered, check your email to verify it", newUser)
+}
+
+func (hdl *RegistrationHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := hdl.service.Verify(r.Context(), req.Token); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			status = http.StatusBadRequest
+		}
+		pkg.Error(w, status, err.Error())
+		return
+	}
+
+	pkg.Success(w, "Email verified, your registration is waiting for approval", nil)
+}
+
+func (hdl *RegistrationHandler) Resend(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := hdl.service.ResendVerification(r.Context(), req.Email); err != nil {
+		pkg.Error(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	pkg.Success(w, "If the email is waiting for verification, a new link has been sent", nil)
+}
+
+func (hdl *RegistrationHandler) GetPending(w http.ResponseWriter, r *http.Request) {
+	users, err := hdl.service.GetPending(r.Context())
+	if err != nil {
+		pkg.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	pkg.Success(w, "Pending registrations", users)
+}
+
+func (hdl *RegistrationHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	user, err := hdl.service.Approve(r.Context(), id)
+	if err != nil {
+		pkg.Error(w, registrationErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Registration approved", user)
+}
+
+func (hdl *RegistrationHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	if err := hdl.service.Reject(r.Context(), id, req.Reason); err != nil {
+		pkg.Error(w, registrationErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Registration rejected", nil)
+}
+
+func registrationErrorStatus(err error) int {
+	switch {
+	case err.Error() == "User not found":
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrNotPendingApproval):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
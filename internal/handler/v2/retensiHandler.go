@@ -8,6 +8,7 @@ import (
 
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
 	"github.com/go-chi/chi/v5"
@@ -24,15 +25,28 @@ func NewRetensiHandler(service services.RetensiService) *RetensiHandler {
 func (hdl *RetensiHandler) RetensiRoutes(router chi.Router) {
 	router.Group(func(r chi.Router) {
 		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.RetensiRead))
 
 		r.Get("/retensi", hdl.GetAll)
 		r.Get("/retensi/{id}", hdl.GetByID)
 		r.Get("/retensi/search", hdl.Search)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.RetensiWrite))
+
 		r.Post("/retensi", hdl.Create)
 		r.Put("/retensi/{id}", hdl.Update)
 		r.Delete("/retensi/{id}", hdl.Delete)
 	})
-	router.Get("/retensi/export", hdl.Export)
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyTokenOrSignedURL)
+		r.Use(middleware.RequirePermission(rbac.RetensiRead, rbac.DataExport))
+
+		r.Get("/retensi/export", hdl.Export)
+	})
 }
 
 func (hdl *RetensiHandler) GetAll(w http.ResponseWriter, r *http.Request) {
@@ -114,7 +128,7 @@ func (hdl *RetensiHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	newRetensi, err := hdl.service.Create(r.Context(), retensi)
 	if err != nil {
-		pkg.Error(w, http.StatusBadRequest, err.Error())
+		pkg.Error(w, lifecycleErrorStatus(err, http.StatusBadRequest), err.Error())
 		return
 	}
 
@@ -149,7 +163,7 @@ func (hdl *RetensiHandler) Update(w http.ResponseWriter, r *http.Request) {
 
 	updatedRetensi, err := hdl.service.Update(r.Context(), retensi)
 	if err != nil {
-		pkg.Error(w, http.StatusInternalServerError, err.Error())
+		pkg.Error(w, lifecycleErrorStatus(err, http.StatusInternalServerError), err.Error())
 		return
 	}
 
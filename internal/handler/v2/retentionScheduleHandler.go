@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+	"github.com/go-chi/chi/v5"
+)
+
+type RetentionScheduleHandler struct {
+	service services.RetentionScheduleService
+}
+
+func NewRetentionScheduleHandler(service services.RetentionScheduleService) *RetentionScheduleHandler {
+	return &RetentionScheduleHandler{service: service}
+}
+
+func (hdl *RetentionScheduleHandler) RetentionScheduleRoutes(router chi.Router) {
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.ReportRead))
+
+		r.Get("/reports/retention-schedule", hdl.Project)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyTokenOrSignedURL)
+		r.Use(middleware.RequirePermission(rbac.ReportRead, rbac.DataExport))
+
+		r.Get("/reports/retention-schedule/export", hdl.Export)
+	})
+}
+
+func (hdl *RetentionScheduleHandler) Project(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	report, err := hdl.service.Project(r.Context(), query.Get("from"), query.Get("to"))
+	if err != nil {
+		pkg.Error(w, scheduleErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Data fetched successfully", report)
+}
+
+func (hdl *RetentionScheduleHandler) Export(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	data, err := hdl.service.Export(r.Context(), query.Get("from"), query.Get("to"))
+	if err != nil {
+		pkg.Error(w, scheduleErrorStatus(err), err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", "attachment; filename=jadwal-retensi.xlsx")
+	w.Write(data)
+}
+
+func scheduleErrorStatus(err error) int {
+	if errors.Is(err, services.ErrInvalidScheduleRange) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+	"github.com/go-chi/chi/v5"
+)
+
+type RoleHandler struct {
+	service services.RoleService
+}
+
+func NewRoleHandler(service services.RoleService) *RoleHandler {
+	return &RoleHandler{service: service}
+}
+
+func (hdl *RoleHandler) RoleRoutes(router chi.Router) {
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.RoleManage))
+
+		r.Get("/permissions", hdl.GetPermissions)
+		r.Get("/roles", hdl.GetAll)
+		r.Get("/roles/{name}", hdl.GetByName)
+		r.Post("/roles", hdl.Create)
+		r.Put("/roles/{name}", hdl.Update)
+		r.Put("/roles/{name}/two-factor", hdl.SetTwoFactor)
+		r.Delete("/roles/{name}", hdl.Delete)
+	})
+}
+
+func (hdl *RoleHandler) GetPermissions(w http.ResponseWriter, r *http.Request) {
+	pkg.Success(w, "Data fetched successfully", hdl.service.GetPermissions())
+}
+
+func (hdl *RoleHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	roles, err := hdl.service.GetAll(r.Context())
+	if err != nil {
+		pkg.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	pkg.Success(w, "Data fetched successfully", roles)
+}
+
+func (hdl *RoleHandler) GetByName(w http.ResponseWriter, r *http.Request) {
+	role, err := hdl.service.GetByName(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		pkg.Error(w, roleErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Data found", role)
+}
+
+func (hdl *RoleHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name             string   `json:"name"`
+		Description      string   `json:"description"`
+		Permissions      []string `json:"permissions"`
+		RequireTwoFactor bool     `json:"require_two_factor"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	role, err := hdl.service.Create(r.Context(), models.Role{
+		Name:             req.Name,
+		Description:      req.Description,
+		Permissions:      req.Permissions,
+		RequireTwoFactor: req.RequireTwoFactor,
+	})
+	if err != nil {
+		pkg.Error(w, roleErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Role created", role)
+}
+
+func (hdl *RoleHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	role, err := hdl.service.Update(r.Context(), models.Role{
+		Name:        chi.URLParam(r, "name"),
+		Description: req.Description,
+		Permissions: req.Permissions,
+	})
+	if err != nil {
+		pkg.Error(w, roleErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Role updated", role)
+}
+
+func (hdl *RoleHandler) SetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Required bool `json:"required"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	role, err := hdl.service.SetRequireTwoFactor(r.Context(), chi.URLParam(r, "name"), req.Required)
+	if err != nil {
+		pkg.Error(w, roleErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Role updated", role)
+}
+
+func (hdl *RoleHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := hdl.service.Delete(r.Context(), chi.URLParam(r, "name")); err != nil {
+		pkg.Error(w, roleErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Role deleted", nil)
+}
+
+func roleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRoleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidRole):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrRoleInUse):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+	"github.com/go-chi/chi/v5"
+)
+
+type TwoFactorHandler struct {
+	service services.TwoFactorService
+	users   services.UserService
+}
+
+func NewTwoFactorHandler(service services.TwoFactorService, users services.UserService) *TwoFactorHandler {
+	return &TwoFactorHandler{service: service, users: users}
+}
+
+func (hdl *TwoFactorHandler) TwoFactorRoutes(router chi.Router) {
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+
+		r.Get("/2fa", hdl.Status)
+		r.Post("/2fa/enroll", hdl.Enroll)
+		r.Post("/2fa/enable", hdl.Enable)
+		r.Post("/2fa/disable", hdl.Disable)
+		r.Post("/2fa/recovery-codes", hdl.RegenerateRecoveryCodes)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.VerifyToken)
+		r.Use(middleware.RequirePermission(rbac.UserManage))
+
+		r.Delete("/users/{id}/2fa", hdl.Reset)
+	})
+}
+
+func (hdl *TwoFactorHandler) Status(w http.ResponseWriter, r *http.Request) {
+	user, err := hdl.users.GetProfile(r.Context(), pkg.GetUserIDFromCtx(r.Context()))
+	if err != nil {
+		pkg.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	status, err := hdl.service.Status(r.Context(), user)
+	if err != nil {
+		pkg.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	pkg.Success(w, "Data fetched successfully", status)
+}
+
+func (hdl *TwoFactorHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	user, err := hdl.users.GetProfile(r.Context(), pkg.GetUserIDFromCtx(r.Context()))
+	if err != nil {
+		pkg.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	enrollment, err := hdl.service.Enroll(r.Context(), user)
+	if err != nil {
+		pkg.Error(w, twoFactorErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Add the secret to an authenticator app, then confirm it with POST /2fa/enable", enrollment)
+}
+
+func (hdl *TwoFactorHandler) Enable(w http.ResponseWriter, r *http.Request) {
+	code, ok := decodeTwoFactorCode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := hdl.service.Enable(r.Context(), pkg.GetUserIDFromCtx(r.Context()), code)
+	if err != nil {
+		pkg.Error(w, twoFactorErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Two-factor authentication enabled, store the recovery codes safely", map[string][]string{"recovery_codes": codes})
+}
+
+func (hdl *TwoFactorHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	code, ok := decodeTwoFactorCode(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := hdl.users.GetProfile(r.Context(), pkg.GetUserIDFromCtx(r.Context()))
+	if err != nil {
+		pkg.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if err := hdl.service.Disable(r.Context(), user, code); err != nil {
+		pkg.Error(w, twoFactorErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Two-factor authentication disabled", nil)
+}
+
+func (hdl *TwoFactorHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	code, ok := decodeTwoFactorCode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := hdl.service.RegenerateRecoveryCodes(r.Context(), pkg.GetUserIDFromCtx(r.Context()), code)
+	if err != nil {
+		pkg.Error(w, twoFactorErrorStatus(err), err.Error())
+		return
+	}
+
+	pkg.Success(w, "Recovery codes replaced", map[string][]string{"recovery_codes": codes})
+}
+
+func (hdl *TwoFactorHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := hdl.service.Reset(r.Context(), id); err != nil {
+		status := twoFactorErrorStatus(err)
+		if err.Error() == "User not found" {
+			status = http.StatusNotFound
+		}
+		pkg.Error(w, status, err.Error())
+		return
+	}
+
+	pkg.Success(w, "Two-factor authentication reset", nil)
+}
+
+func decodeTwoFactorCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+		return "", false
+	}
+
+	return req.Code, true
+}
+
+func twoFactorErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidTwoFactorCode):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrTwoFactorRequired):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrTwoFactorNotEnabled),
+		errors.Is(err, services.ErrTwoFactorNotEnrolled),
+		errors.Is(err, services.ErrTwoFactorAlreadyEnabled):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
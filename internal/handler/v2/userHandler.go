@@ -2,31 +2,39 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/middleware"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/services/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
 	"github.com/go-chi/chi/v5"
 )
 
 type UserHandler struct {
-	service services.UserService
+	service  services.UserService
+	sessions services.SessionService
+	throttle services.LoginThrottleService
 }
 
-func NewUserHandler(service services.UserService) *UserHandler {
-	return &UserHandler{service: service}
+func NewUserHandler(service services.UserService, sessions services.SessionService, throttle services.LoginThrottleService) *UserHandler {
+	return &UserHandler{service: service, sessions: sessions, throttle: throttle}
 }
 
 func (hdl *UserHandler) UserRoutes(router chi.Router) {
 	router.Post("/login", hdl.Login)
-	router.Post("/register", hdl.Register)
+	router.Post("/login/2fa", hdl.LoginTwoFactor)
+	router.Post("/login/2fa/enroll", hdl.EnrollTwoFactor)
+	router.Post("/token/refresh", hdl.RefreshToken)
 
 	router.Group(func(r chi.Router) {
 		r.Use(middleware.VerifyToken)
 
+		r.Post("/logout", hdl.Logout)
+
 		r.Put("/activate", hdl.ActivateUser)
 		r.Get("/profile", hdl.GetProfile)
 		r.Put("/profile", hdl.UpdateProfile)
@@ -37,11 +45,12 @@ func (hdl *UserHandler) UserRoutes(router chi.Router) {
 func (hdl *UserHandler) UserAdminRoutes(router chi.Router) {
 	router.Group(func(r chi.Router) {
 		r.Use(middleware.VerifyToken)
-		r.Use(middleware.VerifyAdmin)
+		r.Use(middleware.RequirePermission(rbac.UserManage))
 		r.Get("/users", hdl.GetAllUsers)
 		r.Put("/users/{id}", hdl.UpdateUser)
 		r.Patch("/users/{id}/status", hdl.ToggleStatus)
 		r.Put("/users/{id}/activate", hdl.ActivateUser)
+		r.Post("/users/{id}/unlock", hdl.UnlockUser)
 	})
 }
 
@@ -56,29 +65,38 @@ func (hdl *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := hdl.service.Login(r.Context(), req.Email, req.Password)
+	result, err := hdl.service.Login(r.Context(), req.Email, req.Password)
 	if err != nil {
-		pkg.Error(w, http.StatusUnauthorized, err.Error())
+		loginError(w, err)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    token,
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteStrictMode,
-		Path:     "/",
-	})
+	writeLoginResult(w, result)
+}
+
+func (hdl *UserHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
 
-	pkg.Success(w, "Login success", token)
+	result, err := hdl.service.LoginTwoFactor(r.Context(), req.ChallengeToken, req.Code)
+	if err != nil {
+		loginError(w, err)
+		return
+	}
+
+	writeLoginResult(w, result)
 }
 
-func (hdl *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
+func (hdl *UserHandler) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name     string `json:"name"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		ChallengeToken string `json:"challenge_token"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -86,25 +104,90 @@ func (hdl *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := models.User{
-		Name:     req.Name,
-		Email:    req.Email,
-		Password: req.Password,
-		Role:     "user",
-		Status:   "tidak aktif",
+	enrollment, err := hdl.service.EnrollTwoFactor(r.Context(), req.ChallengeToken)
+	if err != nil {
+		loginError(w, err)
+		return
+	}
+
+	pkg.Success(w, "Add the secret to an authenticator app, then confirm it with POST /login/2fa", enrollment)
+}
+
+// writeLoginResult answers with the tokens of a finished login, or with the
+// challenge when a second factor is still needed.
+func writeLoginResult(w http.ResponseWriter, result *services.LoginResult) {
+	if result.Challenge != nil {
+		pkg.Success(w, "Two-factor authentication required", struct {
+			TwoFactorRequired bool `json:"two_factor_required"`
+			*services.TwoFactorChallenge
+		}{true, result.Challenge})
+		return
+	}
+
+	setTokenCookie(w, result.Tokens.AccessToken, result.Tokens.ExpiresIn)
+	pkg.Success(w, "Login success", struct {
+		*services.AuthTokens
+		RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	}{result.Tokens, result.RecoveryCodes})
+}
+
+func loginError(w http.ResponseWriter, err error) {
+	var locked *services.LoginLockedError
+	switch {
+	case errors.As(err, &locked):
+		w.Header().Set("Retry-After", strconv.Itoa(int(locked.RetryAfter().Seconds())))
+		pkg.Error(w, http.StatusTooManyRequests, err.Error())
+	case errors.Is(err, services.ErrTwoFactorNotEnrolled), errors.Is(err, services.ErrTwoFactorAlreadyEnabled):
+		pkg.Error(w, http.StatusBadRequest, err.Error())
+	default:
+		pkg.Error(w, http.StatusUnauthorized, err.Error())
+	}
+}
+
+func (hdl *UserHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
 	}
 
-	newUser, err := hdl.service.Register(r.Context(), user)
+	tokens, err := hdl.sessions.Refresh(r.Context(), req.RefreshToken)
 	if err != nil {
-		status := http.StatusBadRequest
-		if err.Error() == "Email already used" {
-			status = http.StatusConflict
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidRefreshToken) {
+			status = http.StatusUnauthorized
 		}
 		pkg.Error(w, status, err.Error())
 		return
 	}
 
-	pkg.Success(w, "User registered", newUser)
+	setTokenCookie(w, tokens.AccessToken, tokens.ExpiresIn)
+	pkg.Success(w, "Token refreshed", tokens)
+}
+
+func (hdl *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if err := hdl.sessions.Revoke(r.Context(), pkg.GetSessionIDFromCtx(r.Context())); err != nil {
+		pkg.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	setTokenCookie(w, "", -1)
+	pkg.Success(w, "Logout success", nil)
+}
+
+func setTokenCookie(w http.ResponseWriter, token string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "token",
+		Value:    token,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+		Path:     "/",
+	})
 }
 
 // func (hdl *UserHandler) Activate(w http.ResponseWriter, r *http.Request) {
@@ -288,6 +371,25 @@ func (hdl *UserHandler) ActivateUser(w http.ResponseWriter, r *http.Request) {
 	pkg.Success(w, "User activated", activated)
 }
 
+func (hdl *UserHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Error(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := hdl.throttle.Unlock(r.Context(), id); err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "User not found" {
+			status = http.StatusNotFound
+		}
+		pkg.Error(w, status, err.Error())
+		return
+	}
+
+	pkg.Success(w, "User unlocked", nil)
+}
+
 // func (hdl *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 // 	idStr := chi.URLParam(r, "id")
 // 	// id, err := strconv.Atoi(idStr)
@@ -0,0 +1,163 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Stage string
+
+const (
+	StageAlihMedia  Stage = "alih media"
+	StageRetensi    Stage = "retensi"
+	StagePemusnahan Stage = "pemusnahan"
+)
+
+type State string
+
+const (
+	None State = ""
+
+	AlihMediaBelum State = "Belum dialih media"
+	AlihMediaSudah State = "Sudah dialih media"
+
+	RetensiBelum State = "Belum diretensi"
+	RetensiSudah State = "Sudah diretensi"
+
+	PemusnahanBelum State = "Belum dimusnahkan"
+	PemusnahanSudah State = "Sudah dimusnahkan"
+)
+
+var (
+	ErrInvalidTransition = errors.New("Invalid status transition")
+	ErrUnknownStatus     = errors.New("Unknown status")
+)
+
+var states = map[Stage][2]State{
+	StageAlihMedia:  {AlihMediaBelum, AlihMediaSudah},
+	StageRetensi:    {RetensiBelum, RetensiSudah},
+	StagePemusnahan: {PemusnahanBelum, PemusnahanSudah},
+}
+
+// Older rows and the column defaults use these spellings.
+var aliases = map[string]State{
+	"belum di alih media": AlihMediaBelum,
+	"sudah di alih media": AlihMediaSudah,
+	"belum di retensi":    RetensiBelum,
+	"sudah di retensi":    RetensiSudah,
+	"belum di musnahkan":  PemusnahanBelum,
+	"sudah di musnahkan":  PemusnahanSudah,
+}
+
+func Initial(stage Stage) State {
+	return states[stage][0]
+}
+
+func Done(stage Stage) State {
+	return states[stage][1]
+}
+
+// Parse maps a stored or submitted status onto the canonical state of stage.
+// An empty status is accepted and means "no row yet".
+func Parse(stage Stage, status string) (State, error) {
+	status = strings.TrimSpace(status)
+	if status == "" {
+		return None, nil
+	}
+
+	s, ok := states[stage]
+	if !ok {
+		return None, fmt.Errorf("%w: unknown stage %q", ErrUnknownStatus, stage)
+	}
+
+	for _, candidate := range s {
+		if strings.EqualFold(status, string(candidate)) {
+			return candidate, nil
+		}
+	}
+
+	if alias, ok := aliases[strings.ToLower(status)]; ok && (alias == s[0] || alias == s[1]) {
+		return alias, nil
+	}
+
+	return None, fmt.Errorf("%w: %q is not a valid %s status", ErrUnknownStatus, status, stage)
+}
+
+// Record is the lifecycle position of one kunjungan. A None field means the
+// stage has no row yet.
+type Record struct {
+	AlihMedia  State
+	Retensi    State
+	Pemusnahan State
+}
+
+func NewRecord(alihMedia, retensi, pemusnahan string) (Record, error) {
+	var rec Record
+	var err error
+
+	if rec.AlihMedia, err = Parse(StageAlihMedia, alihMedia); err != nil {
+		return Record{}, err
+	}
+	if rec.Retensi, err = Parse(StageRetensi, retensi); err != nil {
+		return Record{}, err
+	}
+	if rec.Pemusnahan, err = Parse(StagePemusnahan, pemusnahan); err != nil {
+		return Record{}, err
+	}
+
+	return rec, nil
+}
+
+func (rec Record) State(stage Stage) State {
+	switch stage {
+	case StageAlihMedia:
+		return rec.AlihMedia
+	case StageRetensi:
+		return rec.Retensi
+	case StagePemusnahan:
+		return rec.Pemusnahan
+	}
+	return None
+}
+
+// CanCreate reports whether a row for stage may be created with status to.
+// Every stage after alih media requires the previous one to be done.
+func (rec Record) CanCreate(stage Stage, to State) error {
+	if rec.State(stage) != None {
+		return fmt.Errorf("%w: %s already exists for this kunjungan", ErrInvalidTransition, stage)
+	}
+
+	return rec.CanTransition(stage, to)
+}
+
+// CanTransition reports whether stage may move from its current state to to.
+// Stages only move forward, and a stage can only be marked done once every
+// earlier stage is done.
+func (rec Record) CanTransition(stage Stage, to State) error {
+	s, ok := states[stage]
+	if !ok || (to != s[0] && to != s[1]) {
+		return fmt.Errorf("%w: %q is not a valid %s status", ErrUnknownStatus, to, stage)
+	}
+
+	from := rec.State(stage)
+	if from == s[1] && to == s[0] {
+		return fmt.Errorf("%w: %s cannot go back from %q to %q", ErrInvalidTransition, stage, from, to)
+	}
+
+	switch stage {
+	case StageRetensi:
+		if rec.AlihMedia != AlihMediaSudah {
+			return fmt.Errorf("%w: retensi requires alih media to be %q", ErrInvalidTransition, AlihMediaSudah)
+		}
+	case StagePemusnahan:
+		if rec.AlihMedia != AlihMediaSudah {
+			return fmt.Errorf("%w: record has not been digitised (alih media must be %q)", ErrInvalidTransition, AlihMediaSudah)
+		}
+		if rec.Retensi != RetensiSudah {
+			return fmt.Errorf("%w: pemusnahan requires retensi to be %q", ErrInvalidTransition, RetensiSudah)
+		}
+	}
+
+	return nil
+}
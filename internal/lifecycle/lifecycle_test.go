@@ -0,0 +1,150 @@
+package lifecycle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		stage   Stage
+		status  string
+		want    State
+		wantErr error
+	}{
+		{StageAlihMedia, "", None, nil},
+		{StageAlihMedia, "   ", None, nil},
+		{StageAlihMedia, "Belum dialih media", AlihMediaBelum, nil},
+		{StageAlihMedia, "sudah DIALIH media", AlihMediaSudah, nil},
+		{StageAlihMedia, " Sudah dialih media ", AlihMediaSudah, nil},
+		{StageAlihMedia, "belum di alih media", AlihMediaBelum, nil},
+		{StageAlihMedia, "Sudah di alih media", AlihMediaSudah, nil},
+		{StageRetensi, "Belum diretensi", RetensiBelum, nil},
+		{StageRetensi, "belum di retensi", RetensiBelum, nil},
+		{StageRetensi, "Sudah di retensi", RetensiSudah, nil},
+		{StagePemusnahan, "Sudah dimusnahkan", PemusnahanSudah, nil},
+		{StagePemusnahan, "belum di musnahkan", PemusnahanBelum, nil},
+		{StagePemusnahan, "Sudah di musnahkan", PemusnahanSudah, nil},
+
+		// A status, or an alias, of another stage is not accepted.
+		{StageAlihMedia, "Sudah diretensi", None, ErrUnknownStatus},
+		{StageRetensi, "sudah di alih media", None, ErrUnknownStatus},
+		{StagePemusnahan, "Sudah diretensi", None, ErrUnknownStatus},
+		{StageRetensi, "selesai", None, ErrUnknownStatus},
+		{Stage("arsip"), "Belum dialih media", None, ErrUnknownStatus},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.stage, tt.status)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Parse(%q, %q) err = %v, want %v", tt.stage, tt.status, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q, %q) = %q, want %q", tt.stage, tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestNewRecord(t *testing.T) {
+	rec, err := NewRecord("sudah di alih media", "Belum diretensi", "")
+	if err != nil {
+		t.Fatalf("NewRecord: %v", err)
+	}
+
+	want := Record{AlihMedia: AlihMediaSudah, Retensi: RetensiBelum, Pemusnahan: None}
+	if rec != want {
+		t.Errorf("NewRecord = %+v, want %+v", rec, want)
+	}
+
+	if _, err := NewRecord("Belum dialih media", "Sudah dimusnahkan", ""); !errors.Is(err, ErrUnknownStatus) {
+		t.Errorf("NewRecord with a pemusnahan status as retensi: err = %v, want %v", err, ErrUnknownStatus)
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		name    string
+		rec     Record
+		stage   Stage
+		to      State
+		wantErr error
+	}{
+		{"alih media stays pending", Record{AlihMedia: AlihMediaBelum}, StageAlihMedia, AlihMediaBelum, nil},
+		{"alih media done", Record{AlihMedia: AlihMediaBelum}, StageAlihMedia, AlihMediaSudah, nil},
+		{"alih media done again", Record{AlihMedia: AlihMediaSudah}, StageAlihMedia, AlihMediaSudah, nil},
+		{"alih media back to pending", Record{AlihMedia: AlihMediaSudah}, StageAlihMedia, AlihMediaBelum, ErrInvalidTransition},
+		{"alih media given a retensi status", Record{AlihMedia: AlihMediaBelum}, StageAlihMedia, RetensiSudah, ErrUnknownStatus},
+
+		{"retensi pending after alih media", Record{AlihMedia: AlihMediaSudah, Retensi: RetensiBelum}, StageRetensi, RetensiBelum, nil},
+		{"retensi done after alih media", Record{AlihMedia: AlihMediaSudah, Retensi: RetensiBelum}, StageRetensi, RetensiSudah, nil},
+		{"retensi back to pending", Record{AlihMedia: AlihMediaSudah, Retensi: RetensiSudah}, StageRetensi, RetensiBelum, ErrInvalidTransition},
+		{"retensi before alih media is done", Record{AlihMedia: AlihMediaBelum, Retensi: RetensiBelum}, StageRetensi, RetensiSudah, ErrInvalidTransition},
+		{"retensi without alih media", Record{}, StageRetensi, RetensiBelum, ErrInvalidTransition},
+
+		{"pemusnahan done after both stages", Record{AlihMedia: AlihMediaSudah, Retensi: RetensiSudah, Pemusnahan: PemusnahanBelum}, StagePemusnahan, PemusnahanSudah, nil},
+		{"pemusnahan back to pending", Record{AlihMedia: AlihMediaSudah, Retensi: RetensiSudah, Pemusnahan: PemusnahanSudah}, StagePemusnahan, PemusnahanBelum, ErrInvalidTransition},
+		{"pemusnahan before retensi is done", Record{AlihMedia: AlihMediaSudah, Retensi: RetensiBelum, Pemusnahan: PemusnahanBelum}, StagePemusnahan, PemusnahanSudah, ErrInvalidTransition},
+		{"pemusnahan before alih media is done", Record{AlihMedia: AlihMediaBelum, Retensi: RetensiSudah, Pemusnahan: PemusnahanBelum}, StagePemusnahan, PemusnahanBelum, ErrInvalidTransition},
+		{"pemusnahan given an empty status", Record{AlihMedia: AlihMediaSudah, Retensi: RetensiSudah}, StagePemusnahan, None, ErrUnknownStatus},
+
+		{"unknown stage", Record{}, Stage("arsip"), AlihMediaBelum, ErrUnknownStatus},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rec.CanTransition(tt.stage, tt.to)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("CanTransition(%q, %q) err = %v, want %v", tt.stage, tt.to, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCanCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rec     Record
+		stage   Stage
+		to      State
+		wantErr error
+	}{
+		{"first alih media row", Record{}, StageAlihMedia, AlihMediaBelum, nil},
+		{"alih media row already exists", Record{AlihMedia: AlihMediaBelum}, StageAlihMedia, AlihMediaBelum, ErrInvalidTransition},
+		{"retensi row after alih media", Record{AlihMedia: AlihMediaSudah}, StageRetensi, RetensiBelum, nil},
+		{"retensi row before alih media is done", Record{AlihMedia: AlihMediaBelum}, StageRetensi, RetensiBelum, ErrInvalidTransition},
+		{"retensi row already exists", Record{AlihMedia: AlihMediaSudah, Retensi: RetensiBelum}, StageRetensi, RetensiSudah, ErrInvalidTransition},
+		{"pemusnahan row after retensi", Record{AlihMedia: AlihMediaSudah, Retensi: RetensiSudah}, StagePemusnahan, PemusnahanBelum, nil},
+		{"pemusnahan row before retensi is done", Record{AlihMedia: AlihMediaSudah, Retensi: RetensiBelum}, StagePemusnahan, PemusnahanBelum, ErrInvalidTransition},
+		{"pemusnahan row with a retensi status", Record{AlihMedia: AlihMediaSudah, Retensi: RetensiSudah}, StagePemusnahan, RetensiSudah, ErrUnknownStatus},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rec.CanCreate(tt.stage, tt.to)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("CanCreate(%q, %q) err = %v, want %v", tt.stage, tt.to, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInitialAndDone(t *testing.T) {
+	tests := []struct {
+		stage   Stage
+		initial State
+		done    State
+	}{
+		{StageAlihMedia, AlihMediaBelum, AlihMediaSudah},
+		{StageRetensi, RetensiBelum, RetensiSudah},
+		{StagePemusnahan, PemusnahanBelum, PemusnahanSudah},
+	}
+
+	for _, tt := range tests {
+		if got := Initial(tt.stage); got != tt.initial {
+			t.Errorf("Initial(%q) = %q, want %q", tt.stage, got, tt.initial)
+		}
+		if got := Done(tt.stage); got != tt.done {
+			t.Errorf("Done(%q) = %q, want %q", tt.stage, got, tt.done)
+		}
+	}
+}
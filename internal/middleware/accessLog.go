@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg/logs"
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+// PasienResolver returns the pasien whose record a request reads, or 0 when
+// the request does not point at one.
+type PasienResolver func(r *http.Request) (int, error)
+
+// accessedPasien is where a handler reports the pasien it has just loaded, so
+// LogRecordAccess does not have to look the record up a second time.
+type accessedPasien struct {
+	id int
+}
+
+// SetAccessedPasien tells LogRecordAccess which pasien the request read.
+func SetAccessedPasien(r *http.Request, idPasien int) {
+	if accessed, ok := r.Context().Value("accessedPasien").(*accessedPasien); ok {
+		accessed.id = idPasien
+	}
+}
+
+var accessAudit audit.Recorder
+
+// InitializeAccessLog sets the recorder that keeps an access in the audit
+// trail when its akses_log row cannot be written.
+func InitializeAccessLog(recorder audit.Recorder) {
+	accessAudit = recorder
+}
+
+// At most this many akses_log writes run in the background; past that a
+// request writes its own row before it returns.
+var accessLogSlots = make(chan struct{}, 64)
+
+// LogRecordAccess writes an akses_log row for every successful read of a
+// patient record. It must run after VerifyToken. The pasien is the one the
+// handler reported with SetAccessedPasien, or else the one resolve returns;
+// resolve may be nil when the handler always reports it. The row is written
+// after the response, and an access whose row cannot be written is recorded
+// in the audit trail instead.
+func LogRecordAccess(resolve PasienResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accessed := &accessedPasien{}
+			r = r.WithContext(context.WithValue(r.Context(), "accessedPasien", accessed))
+
+			ww := chiMiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			if status := ww.Status(); status >= http.StatusMultipleChoices {
+				return
+			}
+
+			idPasien := accessed.id
+			if idPasien == 0 && resolve != nil {
+				var err error
+				if idPasien, err = resolve(r); err != nil {
+					log.Printf("Failed to resolve pasien for %s: %v", r.URL.Path, err)
+					return
+				}
+			}
+			if idPasien == 0 {
+				return
+			}
+
+			ctx := context.WithoutCancel(r.Context())
+			endpoint := r.Method + " " + r.URL.Path
+
+			select {
+			case accessLogSlots <- struct{}{}:
+				go func() {
+					defer func() { <-accessLogSlots }()
+					writeRecordAccess(ctx, idPasien, endpoint)
+				}()
+			default:
+				writeRecordAccess(ctx, idPasien, endpoint)
+			}
+		})
+	}
+}
+
+func writeRecordAccess(ctx context.Context, idPasien int, endpoint string) {
+	err := logs.LogRecordAccess(pkg.GetUserIDFromCtx(ctx), idPasien, endpoint, pkg.GetClientIPFromCtx(ctx))
+	if err == nil {
+		return
+	}
+
+	log.Printf("Failed to write access log, recording it in the audit trail: %v", err)
+	if accessAudit == nil {
+		log.Printf("Unrecorded access to pasien %d via %s by user %d", idPasien, endpoint, pkg.GetUserIDFromCtx(ctx))
+		return
+	}
+
+	accessAudit.Record(ctx, audit.Create, "akses_log", idPasien, nil, map[string]interface{}{
+		"IDPasien": idPasien,
+		"Endpoint": endpoint,
+		"Error":    err.Error(),
+	})
+}
@@ -40,6 +40,68 @@ import (
 // 	})
 // }
 
+// SessionChecker reports whether the login session an access token belongs
+// to is still valid.
+type SessionChecker interface {
+	IsActive(ctx context.Context, sessionID string, userID int) (bool, error)
+	// ActiveRole returns the user's current role, or "" if the session is
+	// no longer valid.
+	ActiveRole(ctx context.Context, sessionID string, userID int) (string, error)
+}
+
+// VerifyTokenOrSignedURL lets a browser download a file through a link from
+// POST /downloads/sign instead of an Authorization header. The link acts for
+// the user it was issued to, with the role they hold when it is opened, and
+// stops working when their session is revoked. Only GET and HEAD requests
+// accept a link.
+func VerifyTokenOrSignedURL(next http.Handler) http.Handler {
+	verifyToken := VerifyToken(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.Query().Has(pkg.SignedSigParam) || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			verifyToken.ServeHTTP(w, r)
+			return
+		}
+
+		_, creds := requestCredentials(r)
+		link, err := creds.verifySignedURL(r)
+		if err != nil {
+			pkg.Error(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		if sessions == nil {
+			pkg.Error(w, http.StatusInternalServerError, "Session store is not configured")
+			return
+		}
+
+		role, err := sessions.ActiveRole(r.Context(), link.SessionID, link.UserID)
+		if err != nil {
+			pkg.Error(w, http.StatusInternalServerError, "Failed to check session")
+			return
+		}
+		if role == "" {
+			pkg.Error(w, http.StatusUnauthorized, "Session has been revoked")
+			return
+		}
+
+		ctx := r.Context()
+		ctx = context.WithValue(ctx, "userID", link.UserID)
+		ctx = context.WithValue(ctx, "userRole", role)
+		ctx = pkg.SetSessionIDToCtx(ctx, link.SessionID)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+var sessions SessionChecker
+
+// InitializeSessions sets the checker VerifyToken uses to reject tokens of
+// revoked sessions. Until it is called every token is rejected.
+func InitializeSessions(checker SessionChecker) {
+	sessions = checker
+}
+
 func VerifyToken(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
@@ -54,7 +116,8 @@ func VerifyToken(next http.Handler) http.Handler {
 			return
 		}
 
-		claims, err := pkg.VerifyToken(parts[1])
+		_, creds := requestCredentials(r)
+		claims, err := creds.verifyToken(parts[1])
 		if err != nil {
 			pkg.Error(w, http.StatusUnauthorized, "Invalid token")
 			return
@@ -62,31 +125,37 @@ func VerifyToken(next http.Handler) http.Handler {
 
 		uidFloat, ok := claims["user_id"].(float64)
 		role, okRole := claims["role"].(string)
-		if !ok || !okRole {
+		sid, okSid := claims["sid"].(string)
+		if !ok || !okRole || !okSid {
 			pkg.Error(w, http.StatusUnauthorized, "Invalid token payload")
 			return
 		}
 		userID := int(uidFloat)
 
+		if sessions == nil {
+			pkg.Error(w, http.StatusInternalServerError, "Session store is not configured")
+			return
+		}
+
+		active, err := sessions.IsActive(r.Context(), sid, userID)
+		if err != nil {
+			pkg.Error(w, http.StatusInternalServerError, "Failed to check session")
+			return
+		}
+		if !active {
+			pkg.Error(w, http.StatusUnauthorized, "Session has been revoked")
+			return
+		}
+
 		ctx := r.Context()
 		ctx = context.WithValue(ctx, "userID", userID)
 		ctx = context.WithValue(ctx, "userRole", role)
+		ctx = pkg.SetSessionIDToCtx(ctx, sid)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func VerifyAdmin(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		role := pkg.GetUserRoleFromCtx(r.Context())
-		if role != "admin" {
-			pkg.Error(w, http.StatusForbidden, "Access denied")
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
-}
-
 // func VerifyToken(next http.Handler) http.Handler {
 // 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 // 		authHeader := r.Header.Get("Authorization")
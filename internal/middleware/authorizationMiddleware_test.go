@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+)
+
+// memorySessions knows the current role of each active session.
+type memorySessions struct {
+	roles map[string]string
+}
+
+func (s *memorySessions) IsActive(ctx context.Context, sessionID string, userID int) (bool, error) {
+	return s.roles[sessionID] != "", nil
+}
+
+func (s *memorySessions) ActiveRole(ctx context.Context, sessionID string, userID int) (string, error) {
+	return s.roles[sessionID], nil
+}
+
+func TestVerifyTokenOrSignedURL(t *testing.T) {
+	store := &memorySessions{roles: map[string]string{"sess-1": "admin"}}
+	InitializeSessions(store)
+	t.Cleanup(func() { InitializeSessions(nil) })
+
+	signed, err := pkg.SignURL("/exports/kunjungan?year=2024", pkg.SignedLink{
+		UserID:    7,
+		SessionID: "sess-1",
+		ExpiresAt: time.Now().Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("SignURL: %v", err)
+	}
+
+	var gotUser int
+	var gotRole string
+	handler := VerifyTokenOrSignedURL(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser = pkg.GetUserIDFromCtx(r.Context())
+		gotRole = pkg.GetUserRoleFromCtx(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		role     string
+		wantCode int
+	}{
+		{"GET with a link", http.MethodGet, signed, "admin", http.StatusOK},
+		{"HEAD with a link", http.MethodHead, signed, "admin", http.StatusOK},
+		{"role changed since signing", http.MethodGet, signed, "petugas", http.StatusOK},
+		{"session revoked", http.MethodGet, signed, "", http.StatusUnauthorized},
+		// Any other method needs a bearer token even with a valid link.
+		{"POST with a link", http.MethodPost, signed, "admin", http.StatusUnauthorized},
+		{"DELETE with a link", http.MethodDelete, signed, "admin", http.StatusUnauthorized},
+		{"tampered link", http.MethodGet, signed + "&year=2023", "admin", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store.roles["sess-1"] = tt.role
+			gotUser, gotRole = 0, ""
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d (%s), want %d", rec.Code, rec.Body, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			if gotUser != 7 || gotRole != tt.role {
+				t.Errorf("handler saw user %d, role %q; want user 7, role %q", gotUser, gotRole, tt.role)
+			}
+		})
+	}
+}
@@ -1,37 +1,51 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
 )
 
-func AuthorizeRole(allowedRoles ...string) func(http.Handler) http.Handler {
+// PermissionChecker reports whether a role grants a permission.
+type PermissionChecker interface {
+	HasPermission(ctx context.Context, role, permission string) (bool, error)
+}
+
+var permissions PermissionChecker
+
+// InitializePermissions sets the checker RequirePermission uses. Until it is
+// called every request is denied.
+func InitializePermissions(checker PermissionChecker) {
+	permissions = checker
+}
+
+// RequirePermission allows the request only if the caller's role has every
+// one of the given permissions. It must run after VerifyToken.
+func RequirePermission(required ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			role, ok := r.Context().Value("role").(string)
-			if !ok || role == "" {
+			role := pkg.GetUserRoleFromCtx(r.Context())
+			if role == "" {
 				pkg.Error(w, http.StatusForbidden, "Role not found in token")
 				return
 			}
 
-			status, ok := r.Context().Value("status").(string)
-			if !ok || status != "aktif" {
-				pkg.Error(w, http.StatusForbidden, "User is not active")
+			if permissions == nil {
+				pkg.Error(w, http.StatusInternalServerError, "Permissions are not configured")
 				return
 			}
 
-			authorized := false
-			for _, allowed := range allowedRoles {
-				if role == allowed {
-					authorized = true
-					break
+			for _, permission := range required {
+				allowed, err := permissions.HasPermission(r.Context(), role, permission)
+				if err != nil {
+					pkg.Error(w, http.StatusInternalServerError, "Failed to check permissions")
+					return
+				}
+				if !allowed {
+					pkg.Error(w, http.StatusForbidden, "You are not allowed to access this resource")
+					return
 				}
-			}
-
-			if !authorized {
-				pkg.Error(w, http.StatusForbidden, "You are not allowed to access this resource")
-				return
 			}
 
 			next.ServeHTTP(w, r)
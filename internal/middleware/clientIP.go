@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+)
+
+// ParseTrustedProxies reads a comma-separated list of CIDRs or single
+// addresses, such as the TRUSTED_PROXIES setting. Invalid entries are logged
+// and skipped.
+func ParseTrustedProxies(list string) []*net.IPNet {
+	var proxies []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil {
+				bits := 8 * net.IPv6len
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 8*net.IPv4len
+				}
+				proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("Ignoring invalid trusted proxy %q: %v", entry, err)
+			continue
+		}
+		proxies = append(proxies, network)
+	}
+
+	return proxies
+}
+
+// ClientIP stores the caller's address in the request context and in
+// r.RemoteAddr. X-Forwarded-For and X-Real-IP are only read when the direct
+// peer is one of trustedProxies; X-Forwarded-For is then walked from the
+// right, skipping trusted hops, so a client cannot pick its own address by
+// sending the header itself.
+func ClientIP(trustedProxies []*net.IPNet) func(http.Handler) http.Handler {
+	trusted := func(ip net.IP) bool {
+		for _, network := range trustedProxies {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := r.RemoteAddr
+			if host, _, err := net.SplitHostPort(ip); err == nil {
+				ip = host
+			}
+
+			if peer := net.ParseIP(ip); peer != nil && trusted(peer) {
+				ip = forwardedFor(r, ip, trusted)
+			}
+
+			r.RemoteAddr = ip
+			next.ServeHTTP(w, r.WithContext(pkg.SetClientIPToCtx(r.Context(), ip)))
+		})
+	}
+}
+
+// forwardedFor returns the nearest untrusted address in X-Forwarded-For, or
+// X-Real-IP when there is no such header. If the chain holds only trusted
+// hops, or an entry that is not an address, the last trusted hop is used.
+func forwardedFor(r *http.Request, peer string, trusted func(net.IP) bool) string {
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			peer = ip.String()
+			if !trusted(ip) {
+				break
+			}
+		}
+		return peer
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+
+	return peer
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// verifiedCredentials remembers the signature checks of a request's bearer
+// token and download link. The rate limiter runs them first; VerifyToken and
+// VerifyTokenOrSignedURL reuse the results instead of verifying again.
+type verifiedCredentials struct {
+	token    string
+	claims   jwt.MapClaims
+	tokenErr error
+
+	linkChecked bool
+	link        *pkg.SignedLink
+	linkErr     error
+}
+
+// requestCredentials returns the credentials cache of r, adding one to the
+// request context if there is none yet.
+func requestCredentials(r *http.Request) (*http.Request, *verifiedCredentials) {
+	if creds, ok := r.Context().Value("credentials").(*verifiedCredentials); ok {
+		return r, creds
+	}
+
+	creds := &verifiedCredentials{}
+	return r.WithContext(context.WithValue(r.Context(), "credentials", creds)), creds
+}
+
+func (c *verifiedCredentials) verifyToken(token string) (jwt.MapClaims, error) {
+	if c.token != token || (c.claims == nil && c.tokenErr == nil) {
+		c.token = token
+		c.claims, c.tokenErr = pkg.VerifyToken(token)
+	}
+	return c.claims, c.tokenErr
+}
+
+func (c *verifiedCredentials) verifySignedURL(r *http.Request) (*pkg.SignedLink, error) {
+	if !c.linkChecked {
+		c.linkChecked = true
+		c.link, c.linkErr = pkg.VerifySignedURL(r.URL)
+	}
+	return c.link, c.linkErr
+}
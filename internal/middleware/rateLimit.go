@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+	"golang.org/x/time/rate"
+)
+
+// RateLimitPolicy is a token bucket: Burst requests at once, refilled at
+// Limit per second.
+type RateLimitPolicy struct {
+	Limit rate.Limit
+	Burst int
+}
+
+// RateLimits holds the budget of each kind of request. Login covers the
+// unauthenticated account endpoints, Bulk the imports, exports and file
+// downloads, and Default everything else.
+type RateLimits struct {
+	Login   RateLimitPolicy
+	Bulk    RateLimitPolicy
+	Default RateLimitPolicy
+}
+
+const (
+	rateLimitLogin   = "login"
+	rateLimitBulk    = "bulk"
+	rateLimitDefault = "default"
+)
+
+// Paths under /api/v2 that get the login budget. They are always keyed by
+// client IP, since the caller is not signed in yet.
+var rateLimitLoginPaths = map[string]bool{
+	"/login":            true,
+	"/login/2fa":        true,
+	"/login/2fa/enroll": true,
+	"/token/refresh":    true,
+	"/password/forgot":  true,
+	"/password/reset":   true,
+	"/register":         true,
+	"/register/verify":  true,
+	"/register/resend":  true,
+}
+
+type rateLimitClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter keeps one bucket per client and kind of request. A client is
+// the signed-in user when the request carries a valid token or download link,
+// otherwise the client IP. Buckets not used for the idle period are dropped.
+// At most maxClients buckets are kept; once that many are in use, new clients
+// share one overflow bucket per kind of request until idle ones are dropped.
+type RateLimiter struct {
+	limits     RateLimits
+	idle       time.Duration
+	maxClients int
+
+	mu        sync.Mutex
+	clients   map[string]*rateLimitClient
+	overflow  map[string]*rateLimitClient
+	lastSweep time.Time
+}
+
+const DefaultRateLimitMaxClients = 100000
+
+func NewRateLimiter(limits RateLimits, idle time.Duration, maxClients int) *RateLimiter {
+	if idle <= 0 {
+		idle = 10 * time.Minute
+	}
+	if maxClients <= 0 {
+		maxClients = DefaultRateLimitMaxClients
+	}
+
+	return &RateLimiter{
+		limits:     limits,
+		idle:       idle,
+		maxClients: maxClients,
+		clients:    make(map[string]*rateLimitClient),
+		overflow:   make(map[string]*rateLimitClient),
+		lastSweep:  time.Now(),
+	}
+}
+
+// Handler must run after ClientIP. It sets X-RateLimit-Limit,
+// X-RateLimit-Remaining and X-RateLimit-Reset on every response, and
+// Retry-After when the request is refused.
+func (rl *RateLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class, policy := rl.classify(r)
+		r, creds := requestCredentials(r)
+
+		now := time.Now()
+		limiter := rl.limiter(class, rateLimitClientKey(r, class, creds), policy, now)
+		allowed := limiter.AllowN(now, 1)
+		tokens := limiter.TokensAt(now)
+
+		header := w.Header()
+		header.Set("X-RateLimit-Limit", strconv.Itoa(policy.Burst))
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(int(math.Max(0, math.Floor(tokens)))))
+		header.Set("X-RateLimit-Reset", strconv.Itoa(secondsUntil(float64(policy.Burst)-tokens, policy.Limit)))
+
+		if !allowed {
+			header.Set("Retry-After", strconv.Itoa(secondsUntil(1-tokens, policy.Limit)))
+			pkg.Error(w, http.StatusTooManyRequests, "Too many request")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (rl *RateLimiter) classify(r *http.Request) (string, RateLimitPolicy) {
+	path := r.URL.Path
+
+	switch {
+	case r.Method == http.MethodPost && rateLimitLoginPaths[strings.TrimPrefix(path, "/api/v2")]:
+		return rateLimitLogin, rl.limits.Login
+	case strings.HasSuffix(path, "/import"),
+		strings.HasSuffix(path, "/export"),
+		strings.HasSuffix(path, "/berita-acara"),
+		strings.HasPrefix(path, "/uploads/"):
+		return rateLimitBulk, rl.limits.Bulk
+	}
+	return rateLimitDefault, rl.limits.Default
+}
+
+// rateLimitClientKey only checks signatures, and leaves the result in creds
+// for the auth middleware. Whether the session is still active is left to
+// that middleware; a revoked token just keeps its user's budget until it
+// expires.
+func rateLimitClientKey(r *http.Request, class string, creds *verifiedCredentials) string {
+	if class != rateLimitLogin {
+		if parts := strings.Split(r.Header.Get("Authorization"), " "); len(parts) == 2 && parts[0] == "Bearer" {
+			if claims, err := creds.verifyToken(parts[1]); err == nil {
+				if uid, ok := claims["user_id"].(float64); ok {
+					return "user:" + strconv.Itoa(int(uid))
+				}
+			}
+		}
+
+		if r.URL.Query().Has(pkg.SignedSigParam) {
+			if link, err := creds.verifySignedURL(r); err == nil {
+				return "user:" + strconv.Itoa(link.UserID)
+			}
+		}
+	}
+
+	return "ip:" + pkg.GetClientIPFromCtx(r.Context())
+}
+
+func (rl *RateLimiter) limiter(class, clientKey string, policy RateLimitPolicy, now time.Time) *rate.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	key := class + ":" + clientKey
+	client, ok := rl.clients[key]
+	if !ok {
+		if len(rl.clients) >= rl.maxClients || now.Sub(rl.lastSweep) >= rl.idle {
+			rl.sweep(now)
+		}
+
+		buckets := rl.clients
+		if len(rl.clients) >= rl.maxClients {
+			buckets, key = rl.overflow, class
+		}
+
+		if client, ok = buckets[key]; !ok {
+			client = &rateLimitClient{limiter: rate.NewLimiter(policy.Limit, policy.Burst)}
+			buckets[key] = client
+		}
+	}
+	client.lastSeen = now
+
+	return client.limiter
+}
+
+// sweep drops idle buckets. A full map is swept at most once a second so a
+// flood of new clients does not scan it on every request.
+func (rl *RateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < time.Second {
+		return
+	}
+
+	for k, client := range rl.clients {
+		if now.Sub(client.lastSeen) >= rl.idle {
+			delete(rl.clients, k)
+		}
+	}
+	rl.lastSweep = now
+}
+
+// secondsUntil is how long, rounded up, it takes to refill the given number
+// of tokens.
+func secondsUntil(tokens float64, limit rate.Limit) int {
+	if tokens <= 0 || limit <= 0 {
+		return 0
+	}
+	return int(math.Ceil(tokens / float64(limit)))
+}
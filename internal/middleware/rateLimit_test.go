@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+	"golang.org/x/time/rate"
+)
+
+func rateLimitRequest(method, target, ip string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	return r.WithContext(pkg.SetClientIPToCtx(r.Context(), ip))
+}
+
+func TestRateLimiterHandler(t *testing.T) {
+	// Two requests at once, then one every 10 seconds.
+	policy := RateLimitPolicy{Limit: rate.Every(10 * time.Second), Burst: 2}
+	rl := NewRateLimiter(RateLimits{Login: policy, Bulk: policy, Default: policy}, time.Minute, 0)
+
+	served := 0
+	handler := rl.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { served++ }))
+
+	tests := []struct {
+		name           string
+		ip             string
+		method, path   string
+		wantCode       int
+		wantRemaining  string
+		wantReset      string
+		wantRetryAfter string
+	}{
+		{"first request", "10.0.0.1", http.MethodGet, "/api/v2/pasien", http.StatusOK, "1", "10", ""},
+		{"second request", "10.0.0.1", http.MethodGet, "/api/v2/pasien", http.StatusOK, "0", "20", ""},
+		{"bucket empty", "10.0.0.1", http.MethodGet, "/api/v2/pasien", http.StatusTooManyRequests, "0", "20", "10"},
+		{"other client", "10.0.0.2", http.MethodGet, "/api/v2/pasien", http.StatusOK, "1", "10", ""},
+		{"other kind of request", "10.0.0.1", http.MethodPost, "/api/v2/login", http.StatusOK, "1", "10", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, rateLimitRequest(tt.method, tt.path, tt.ip))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			header := rec.Header()
+			if got := header.Get("X-RateLimit-Limit"); got != "2" {
+				t.Errorf("X-RateLimit-Limit = %q, want %q", got, "2")
+			}
+			if got := header.Get("X-RateLimit-Remaining"); got != tt.wantRemaining {
+				t.Errorf("X-RateLimit-Remaining = %q, want %q", got, tt.wantRemaining)
+			}
+			if got := header.Get("X-RateLimit-Reset"); got != tt.wantReset {
+				t.Errorf("X-RateLimit-Reset = %q, want %q", got, tt.wantReset)
+			}
+			if got := header.Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+		})
+	}
+
+	if served != 4 {
+		t.Errorf("next handler ran %d times, want 4", served)
+	}
+}
+
+func TestRateLimiterClassify(t *testing.T) {
+	rl := NewRateLimiter(RateLimits{}, 0, 0)
+
+	tests := []struct {
+		method, path string
+		want         string
+	}{
+		{http.MethodPost, "/api/v2/login", rateLimitLogin},
+		{http.MethodPost, "/api/v2/password/reset", rateLimitLogin},
+		{http.MethodGet, "/api/v2/login", rateLimitDefault},
+		{http.MethodPost, "/api/v2/pasien/import", rateLimitBulk},
+		{http.MethodGet, "/api/v2/kunjungan/export", rateLimitBulk},
+		{http.MethodPost, "/api/v2/pemusnahan/batches/3/berita-acara", rateLimitBulk},
+		{http.MethodGet, "/uploads/dokumen/a.pdf", rateLimitBulk},
+		{http.MethodGet, "/api/v2/pasien", rateLimitDefault},
+	}
+
+	for _, tt := range tests {
+		if got, _ := rl.classify(httptest.NewRequest(tt.method, tt.path, nil)); got != tt.want {
+			t.Errorf("classify(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitClientKey(t *testing.T) {
+	signed, err := pkg.SignURL("/api/v2/kunjungan/export", pkg.SignedLink{UserID: 7, SessionID: "sess-1", ExpiresAt: time.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("SignURL: %v", err)
+	}
+
+	token, err := pkg.CreateToken(9, "a@example.com", "aktif", "admin", "sess-2", time.Minute)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		token  string
+		class  string
+		want   string
+	}{
+		{"anonymous", "/api/v2/kunjungan/export", "", rateLimitBulk, "ip:10.0.0.1"},
+		{"bearer token", "/api/v2/kunjungan/export", token, rateLimitBulk, "user:9"},
+		{"invalid token", "/api/v2/kunjungan/export", token + "x", rateLimitBulk, "ip:10.0.0.1"},
+		{"signed link", signed, "", rateLimitBulk, "user:7"},
+		{"tampered link", signed + "&year=2023", "", rateLimitBulk, "ip:10.0.0.1"},
+		{"login is always by ip", signed, token, rateLimitLogin, "ip:10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		r := rateLimitRequest(http.MethodGet, tt.target, "10.0.0.1")
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+
+		r, creds := requestCredentials(r)
+		if got := rateLimitClientKey(r, tt.class, creds); got != tt.want {
+			t.Errorf("%s: key = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiterEviction(t *testing.T) {
+	policy := RateLimitPolicy{Limit: 1, Burst: 1}
+	rl := NewRateLimiter(RateLimits{Default: policy}, time.Minute, 2)
+	start := rl.lastSweep
+
+	a := rl.limiter(rateLimitDefault, "ip:a", policy, start)
+	rl.limiter(rateLimitDefault, "ip:b", policy, start)
+
+	// The map is full and nothing is idle yet: new clients share the
+	// overflow bucket.
+	c := rl.limiter(rateLimitDefault, "ip:c", policy, start.Add(2*time.Second))
+	d := rl.limiter(rateLimitDefault, "ip:d", policy, start.Add(2*time.Second))
+	if c != d {
+		t.Error("clients over the limit got separate buckets, want the shared overflow bucket")
+	}
+	if c == a {
+		t.Error("an overflow client got the bucket of a tracked client")
+	}
+	if len(rl.clients) != 2 {
+		t.Fatalf("%d clients tracked, want 2", len(rl.clients))
+	}
+
+	// a stays in use; b goes idle and makes room for e.
+	if got := rl.limiter(rateLimitDefault, "ip:a", policy, start.Add(90*time.Second)); got != a {
+		t.Error("a known client got a new bucket")
+	}
+	e := rl.limiter(rateLimitDefault, "ip:e", policy, start.Add(2*time.Minute))
+	if e == c {
+		t.Error("a new client got the overflow bucket after an idle one was dropped")
+	}
+	if _, ok := rl.clients[rateLimitDefault+":ip:b"]; ok {
+		t.Error("the idle client b was kept")
+	}
+	if _, ok := rl.clients[rateLimitDefault+":ip:a"]; !ok {
+		t.Error("the active client a was dropped")
+	}
+}
+
+func TestRateLimiterPeriodicSweep(t *testing.T) {
+	policy := RateLimitPolicy{Limit: 1, Burst: 1}
+	rl := NewRateLimiter(RateLimits{Default: policy}, time.Minute, 0)
+	start := rl.lastSweep
+
+	rl.limiter(rateLimitDefault, "ip:a", policy, start)
+
+	// Before the map fills up, idle buckets go once an idle period has passed
+	// since the last sweep.
+	rl.limiter(rateLimitDefault, "ip:b", policy, start.Add(30*time.Second))
+	if len(rl.clients) != 2 {
+		t.Fatalf("%d clients tracked, want 2", len(rl.clients))
+	}
+
+	rl.limiter(rateLimitDefault, "ip:c", policy, start.Add(80*time.Second))
+	if _, ok := rl.clients[rateLimitDefault+":ip:a"]; ok {
+		t.Error("the idle client a was kept")
+	}
+	if len(rl.clients) != 2 {
+		t.Errorf("%d clients tracked, want b and c", len(rl.clients))
+	}
+}
+
+func TestSecondsUntil(t *testing.T) {
+	tests := []struct {
+		tokens float64
+		limit  rate.Limit
+		want   int
+	}{
+		{1, 1, 1},
+		{0.2, 1, 1},
+		{1, 0.1, 10},
+		{2.5, 2, 2},
+		{0, 1, 0},
+		{-1, 1, 0},
+		{1, 0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := secondsUntil(tt.tokens, tt.limit); got != tt.want {
+			t.Errorf("secondsUntil(%v, %v) = %d, want %d", tt.tokens, tt.limit, got, tt.want)
+		}
+	}
+}
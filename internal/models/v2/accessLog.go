@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// AccessLog is a patient record read logged in akses_log.
+type AccessLog struct {
+	ID        int
+	UserID    int
+	UserName  string
+	IDPasien  int
+	Endpoint  string
+	IP        string
+	CreatedAt time.Time
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+type AuditLog struct {
+	ID        int64
+	ActorID   *int
+	ActorRole string
+	Action    string
+	Entity    string
+	EntityID  string
+	Before    string
+	After     string
+	Diff      string
+	IP        string
+	RequestID string
+	CreatedAt time.Time
+	PrevHash  string
+	Hash      string
+	ActorName string // users.Name, filled when reading
+}
+
+// AuditChainHead is the hash of the newest chained audit_log row.
+type AuditChainHead struct {
+	LastID *int64
+	Hash   string
+}
+
+// AuditLogFilter narrows an audit_log query. Zero values are ignored. IDPasien
+// matches the pasien and everything recorded against its kunjungan. BeforeID
+// is the pagination cursor: only rows with a smaller Id are returned.
+type AuditLogFilter struct {
+	ActorID  *int
+	Entity   string
+	EntityID string
+	Action   string
+	From     *time.Time
+	To       *time.Time
+	IDPasien int
+	BeforeID int64
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type BeritaAcara struct {
+	ID        int
+	IDBatch   int
+	Tahun     int
+	Urutan    int
+	Nomor     string
+	FilePath  string
+	CreatedBy int
+	CreatedAt time.Time
+}
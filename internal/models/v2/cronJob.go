@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type CronJob struct {
+	Name       string
+	Expression string
+	Timezone   string
+	Enabled    bool
+	UpdatedAt  time.Time
+	NextRun    *time.Time
+}
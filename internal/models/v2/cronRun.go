@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+type CronRun struct {
+	ID          int
+	Job         string
+	TriggeredBy string
+	Status      string
+	StartedAt   time.Time
+	FinishedAt  *time.Time
+	Processed   int
+	Skipped     int
+	Failed      int
+	Message     string
+}
+
+type CronRunItem struct {
+	ID          int
+	IDRun       int
+	IDKunjungan int
+	Action      string
+	Outcome     string
+	Message     string
+	CreatedAt   time.Time
+}
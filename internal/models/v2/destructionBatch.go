@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+type DestructionBatch struct {
+	ID                int
+	Nama              string
+	Keterangan        string
+	State             string
+	ProposedBy        int
+	RequiredApprovals int
+	CreatedAt         time.Time
+	SubmittedAt       *time.Time
+	ApprovedAt        *time.Time
+	ExecutedAt        *time.Time
+	ExecutedBy        *int
+	Items             []int
+	Approvals         []*DestructionBatchApproval
+}
+
+type DestructionBatchApproval struct {
+	IDBatch   int
+	IDUser    int
+	Catatan   string
+	CreatedAt time.Time
+}
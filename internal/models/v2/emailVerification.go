@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type EmailVerification struct {
+	ID        int
+	IDUser    int
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
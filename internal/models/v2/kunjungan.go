@@ -32,3 +32,15 @@ type KunjunganJoin struct {
 	JenisKunjungan string // kunjungan
 	Dokumen        string // dokumen
 }
+
+type KunjunganLifecycle struct {
+	ID         int
+	AlihMedia  string
+	Retensi    string
+	Pemusnahan string
+}
+
+type KunjunganSchedule struct {
+	Kunjungan Kunjungan
+	Lifecycle KunjunganLifecycle
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type LegalHold struct {
+	ID          int
+	IDPasien    *int
+	IDKunjungan *int
+	Reason      string
+	PlacedBy    int
+	PlacedAt    time.Time
+	ExpiresAt   *time.Time
+	ReleasedBy  *int
+	ReleasedAt  *time.Time
+}
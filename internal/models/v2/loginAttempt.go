@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type LoginAttempt struct {
+	Scope        string
+	Identifier   string
+	Failures     int
+	LastFailedAt time.Time
+	LockedUntil  *time.Time
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type LoginChallenge struct {
+	ID        string
+	IDUser    int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
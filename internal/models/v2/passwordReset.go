@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type PasswordReset struct {
+	ID        int
+	IDUser    int
+	TokenHash string
+	IP        string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type RetentionPolicy struct {
+	IDKasus          int
+	PeriodUnit       string
+	Permanent        bool
+	AdultAge         int
+	MinorRetainYears int
+	UpdatedAt        time.Time
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type Role struct {
+	Name             string
+	Description      string
+	IsSystem         bool
+	RequireTwoFactor bool
+	Permissions      []string
+	Users            int
+	CreatedAt        time.Time
+}
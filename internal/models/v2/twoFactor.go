@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type TwoFactor struct {
+	IDUser       int
+	Secret       string
+	EnabledAt    *time.Time
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
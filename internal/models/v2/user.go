@@ -3,13 +3,16 @@ package models
 import "time"
 
 type User struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Password  string    `json:"password"`
-	Role      string    `json:"role"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
+	ID              int        `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	Password        string     `json:"password"`
+	Role            string     `json:"role"`
+	Status          string     `json:"status"`
+	SelfRegistered  bool       `json:"self_registered"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	ApprovedAt      *time.Time `json:"approved_at"`
+	CreatedAt       time.Time  `json:"created_at"`
 }
 
 type UserResponse struct {
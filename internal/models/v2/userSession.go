@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type UserSession struct {
+	ID         string
+	IDUser     int
+	TokenHash  string
+	IP         string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+}
@@ -0,0 +1,83 @@
+package rbac
+
+// AdminRole has every permission, including ones added after it was created,
+// and cannot be edited or deleted.
+const AdminRole = "admin"
+
+// DefaultRole is given to self-registered users.
+const DefaultRole = "viewer"
+
+const (
+	PasienRead        = "pasien:read"
+	PasienWrite       = "pasien:write"
+	KunjunganRead     = "kunjungan:read"
+	KunjunganWrite    = "kunjungan:write"
+	KasusRead         = "kasus:read"
+	KasusWrite        = "kasus:write"
+	DokumenRead       = "dokumen:read"
+	InfoSistemRead    = "info_sistem:read"
+	InfoSistemWrite   = "info_sistem:write"
+	AlihMediaRead     = "alih_media:read"
+	AlihMediaWrite    = "alih_media:write"
+	RetensiRead       = "retensi:read"
+	RetensiWrite      = "retensi:write"
+	PemusnahanRead    = "pemusnahan:read"
+	PemusnahanWrite   = "pemusnahan:write"
+	PemusnahanApprove = "pemusnahan:approve"
+	PemusnahanExecute = "pemusnahan:execute"
+	LegalHoldRead     = "legal_hold:read"
+	LegalHoldWrite    = "legal_hold:write"
+	ReportRead        = "report:read"
+	DataExport        = "data:export"
+	CronRead          = "cron:read"
+	CronRun           = "cron:run"
+	CronManage        = "cron:manage"
+	AuditRead         = "audit:read"
+	UserManage        = "user:manage"
+	RoleManage        = "role:manage"
+)
+
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Permissions lists every permission a route can require.
+var Permissions = []Permission{
+	{PasienRead, "View patients"},
+	{PasienWrite, "Create, update, delete and import patients"},
+	{KunjunganRead, "View visits"},
+	{KunjunganWrite, "Create, update, delete and import visits and their documents"},
+	{KasusRead, "View cases and their retention policies"},
+	{KasusWrite, "Create, update, delete and import cases and retention policies"},
+	{DokumenRead, "Open uploaded documents"},
+	{InfoSistemRead, "View system information"},
+	{InfoSistemWrite, "Update system information"},
+	{AlihMediaRead, "View media transfers"},
+	{AlihMediaWrite, "Create, update and delete media transfers"},
+	{RetensiRead, "View retention records"},
+	{RetensiWrite, "Create, update and delete retention records"},
+	{PemusnahanRead, "View destruction records, batches and berita acara"},
+	{PemusnahanWrite, "Create destruction records and propose batches"},
+	{PemusnahanApprove, "Approve or reject destruction batches"},
+	{PemusnahanExecute, "Execute approved destruction batches"},
+	{LegalHoldRead, "View legal holds"},
+	{LegalHoldWrite, "Place and release legal holds"},
+	{ReportRead, "View statistics and retention reports"},
+	{DataExport, "Download spreadsheet exports of records"},
+	{CronRead, "View scheduled job previews and run history"},
+	{CronRun, "Trigger scheduled jobs manually"},
+	{CronManage, "Change scheduled job settings"},
+	{AuditRead, "Search and export the audit trail"},
+	{UserManage, "Manage user accounts"},
+	{RoleManage, "Manage roles and their permissions"},
+}
+
+func IsPermission(name string) bool {
+	for _, p := range Permissions {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+)
+
+type AccessLogRepository interface {
+	GetPasienAccessLogs(ctx context.Context, idPasien, beforeID, limit int) ([]*models.AccessLog, error)
+}
+
+type accessLogRepository struct {
+	db *sql.DB
+}
+
+func NewRepoAccessLog(db *sql.DB) AccessLogRepository {
+	return &accessLogRepository{
+		db: db,
+	}
+}
+
+// GetPasienAccessLogs returns reads of a pasien's record, newest first. Only
+// rows with an Id below beforeID are returned when it is set.
+func (repo *accessLogRepository) GetPasienAccessLogs(ctx context.Context, idPasien, beforeID, limit int) ([]*models.AccessLog, error) {
+	query := `
+	SELECT a.Id, a.User, COALESCE(u.Name, ''), a.IdPasien, COALESCE(a.Endpoint, ''), COALESCE(a.Ip, ''), TIMESTAMP(a.Tanggal, a.Waktu)
+	FROM akses_log a
+	LEFT JOIN users u ON u.Id = a.User
+	WHERE a.IdPasien = ?
+	`
+	args := []interface{}{idPasien}
+
+	if beforeID > 0 {
+		query += " AND a.Id < ?"
+		args = append(args, beforeID)
+	}
+
+	query += " ORDER BY a.Id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := repo.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.AccessLog
+	for rows.Next() {
+		var entry models.AccessLog
+		err := rows.Scan(
+			&entry.ID,
+			&entry.UserID,
+			&entry.UserName,
+			&entry.IDPasien,
+			&entry.Endpoint,
+			&entry.IP,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/lifecycle"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
 )
 
@@ -18,6 +19,7 @@ type AlihMediaRepository interface {
 	GetAlihMediaByID(ctx context.Context, id int) (*models.AlihMedia, error)
 	GetTotalAlihMedia(ctx context.Context) (int, error)
 	CreateAlihMedia(ctx context.Context, alihMedia *models.AlihMedia) (*models.AlihMedia, error)
+	UpsertAlihMediaTx(ctx context.Context, tx *sql.Tx, alihMedia *models.AlihMedia) (*models.AlihMedia, error)
 	UpdateAlihMedia(ctx context.Context, alihMedia models.AlihMedia) (*models.AlihMedia, error)
 	DeleteAlihMedia(ctx context.Context, id int) error
 	GetAllAlihMediaForExport(ctx context.Context) ([]*models.AlihMediaJoin, error)
@@ -40,11 +42,11 @@ func (repo *alihMediaRepository) GetStatistikAlihMedia(ctx context.Context) (int
 		return 0, 0, 0, err
 	}
 
-	if err := repo.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM alih_media WHERE Status = 'Sudah dialih media'`).Scan(&sudah); err != nil {
+	if err := repo.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM alih_media WHERE Status = ?`, lifecycle.AlihMediaSudah).Scan(&sudah); err != nil {
 		return 0, 0, 0, err
 	}
 
-	if err := repo.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM alih_media WHERE Status = 'Belum dialih media'`).Scan(&belum); err != nil {
+	if err := repo.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM alih_media WHERE Status = ?`, lifecycle.AlihMediaBelum).Scan(&belum); err != nil {
 		return 0, 0, 0, err
 	}
 
@@ -366,6 +368,29 @@ func (repo *alihMediaRepository) CreateAlihMedia(ctx context.Context, alihMedia
 	return alihMedia, nil
 }
 
+// UpsertAlihMediaTx inserts the alih media row for a kunjungan, or leaves the
+// existing one untouched, so retrying an inactivation never duplicates it.
+func (repo *alihMediaRepository) UpsertAlihMediaTx(ctx context.Context, tx *sql.Tx, alihMedia *models.AlihMedia) (*models.AlihMedia, error) {
+	query := `
+	INSERT INTO alih_media(Id, TglLaporan, Status)
+	VALUES (?,?,?)
+	ON DUPLICATE KEY UPDATE Id = Id
+	`
+
+	_, err := tx.ExecContext(
+		ctx,
+		query,
+		alihMedia.ID,
+		alihMedia.TglLaporan,
+		alihMedia.Status,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return alihMedia, nil
+}
+
 func (repo *alihMediaRepository) UpdateAlihMedia(ctx context.Context, alihMedia models.AlihMedia) (*models.AlihMedia, error) {
 	query := `
 	UPDATE alih_media
@@ -0,0 +1,322 @@
+package repositories
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+)
+
+type AuditRepository interface {
+	InsertAuditLogs(ctx context.Context, entries []*models.AuditLog) error
+	InsertAuditLogsTx(ctx context.Context, tx *sql.Tx, entries []*models.AuditLog) error
+	FindAuditLogs(ctx context.Context, filter models.AuditLogFilter, limit int) ([]*models.AuditLog, error)
+	GetAuditChainHead(ctx context.Context) (*models.AuditChainHead, error)
+	GetAuditChainRows(ctx context.Context, afterID, maxID int64, limit int) ([]*models.AuditLog, error)
+}
+
+const auditChainName = "audit_log"
+
+type auditRepository struct {
+	db *sql.DB
+}
+
+func NewRepoAudit(db *sql.DB) AuditRepository {
+	return &auditRepository{
+		db: db,
+	}
+}
+
+// InsertAuditLogs appends entries to the hash chain with a single multi-row
+// insert. The chain head is locked for the duration, so concurrent writers
+// take turns and the chain follows Id order.
+func (repo *auditRepository) InsertAuditLogs(ctx context.Context, entries []*models.AuditLog) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := repo.InsertAuditLogsTx(ctx, tx, entries); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// InsertAuditLogsTx appends entries to the hash chain inside tx, so they are
+// only kept if tx commits. The chain head stays locked until tx ends.
+func (repo *auditRepository) InsertAuditLogsTx(ctx context.Context, tx *sql.Tx, entries []*models.AuditLog) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var prev string
+	err := tx.QueryRowContext(ctx, "SELECT Hash FROM audit_chain WHERE Name = ? FOR UPDATE", auditChainName).Scan(&prev)
+	if err != nil {
+		return err
+	}
+
+	prev = ChainAuditLogs(prev, entries)
+
+	placeholders := make([]string, 0, len(entries))
+	args := make([]interface{}, 0, len(entries)*13)
+	for _, entry := range entries {
+		placeholders = append(placeholders, "(?,?,?,?,?,?,?,?,?,?,?,?,?)")
+		args = append(args,
+			entry.ActorID,
+			nullString(entry.ActorRole),
+			entry.Action,
+			entry.Entity,
+			entry.EntityID,
+			nullString(entry.Before),
+			nullString(entry.After),
+			nullString(entry.Diff),
+			nullString(entry.IP),
+			nullString(entry.RequestID),
+			entry.CreatedAt,
+			nullString(entry.PrevHash),
+			entry.Hash,
+		)
+	}
+
+	query := "INSERT INTO audit_log(ActorId, ActorRole, Action, Entity, EntityId, `Before`, `After`, Diff, Ip, RequestId, CreatedAt, PrevHash, Hash) VALUES " +
+		strings.Join(placeholders, ",")
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	// The chain lock is still held, so the newest row is the last one inserted.
+	query = `
+	UPDATE audit_chain
+	SET LastId = (SELECT MAX(Id) FROM audit_log), Hash = ?
+	WHERE Name = ?
+	`
+	_, err = tx.ExecContext(ctx, query, prev, auditChainName)
+	return err
+}
+
+// ChainAuditLogs links entries, in order, onto the chain whose newest hash is
+// prev: it sets each entry's PrevHash and Hash and returns the new head hash.
+func ChainAuditLogs(prev string, entries []*models.AuditLog) string {
+	for _, entry := range entries {
+		// datetime(6) keeps microseconds; hash what will be read back.
+		entry.CreatedAt = entry.CreatedAt.Truncate(time.Microsecond)
+		entry.PrevHash = prev
+		entry.Hash = AuditHash(prev, entry)
+		prev = entry.Hash
+	}
+
+	return prev
+}
+
+// AuditHash is the SHA-256 of an audit row's content chained to the hash of
+// the row before it.
+func AuditHash(prev string, entry *models.AuditLog) string {
+	var actorID interface{}
+	if entry.ActorID != nil {
+		actorID = *entry.ActorID
+	}
+
+	content, _ := json.Marshal([]interface{}{
+		prev,
+		actorID,
+		entry.ActorRole,
+		entry.Action,
+		entry.Entity,
+		entry.EntityID,
+		entry.Before,
+		entry.After,
+		entry.Diff,
+		entry.IP,
+		entry.RequestID,
+		entry.CreatedAt.UTC().Format("2006-01-02T15:04:05.000000Z"),
+	})
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func (repo *auditRepository) GetAuditChainHead(ctx context.Context) (*models.AuditChainHead, error) {
+	var head models.AuditChainHead
+	var lastID sql.NullInt64
+
+	err := repo.db.QueryRowContext(ctx, "SELECT LastId, Hash FROM audit_chain WHERE Name = ?", auditChainName).Scan(&lastID, &head.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastID.Valid {
+		head.LastID = &lastID.Int64
+	}
+
+	return &head, nil
+}
+
+// GetAuditChainRows returns rows with afterID < Id <= maxID in Id order, with
+// the content exactly as it is hashed.
+func (repo *auditRepository) GetAuditChainRows(ctx context.Context, afterID, maxID int64, limit int) ([]*models.AuditLog, error) {
+	query := "SELECT Id, ActorId, COALESCE(ActorRole, ''), Action, Entity, EntityId, COALESCE(`Before`, ''), COALESCE(`After`, ''), " +
+		"COALESCE(Diff, ''), COALESCE(Ip, ''), COALESCE(RequestId, ''), CreatedAt, COALESCE(PrevHash, ''), COALESCE(Hash, '') " +
+		"FROM audit_log WHERE Id > ? AND Id <= ? ORDER BY Id LIMIT ?"
+
+	rows, err := repo.db.QueryContext(ctx, query, afterID, maxID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.AuditLog
+	for rows.Next() {
+		var entry models.AuditLog
+		var actorID sql.NullInt64
+		err := rows.Scan(
+			&entry.ID,
+			&actorID,
+			&entry.ActorRole,
+			&entry.Action,
+			&entry.Entity,
+			&entry.EntityID,
+			&entry.Before,
+			&entry.After,
+			&entry.Diff,
+			&entry.IP,
+			&entry.RequestID,
+			&entry.CreatedAt,
+			&entry.PrevHash,
+			&entry.Hash,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if actorID.Valid {
+			id := int(actorID.Int64)
+			entry.ActorID = &id
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// FindAuditLogs returns up to limit rows matching filter, newest first.
+func (repo *auditRepository) FindAuditLogs(ctx context.Context, filter models.AuditLogFilter, limit int) ([]*models.AuditLog, error) {
+	query := "SELECT a.Id, a.ActorId, COALESCE(u.Name, ''), COALESCE(a.ActorRole, ''), a.Action, a.Entity, a.EntityId, " +
+		"COALESCE(a.`Before`, ''), COALESCE(a.`After`, ''), COALESCE(a.Diff, ''), COALESCE(a.Ip, ''), COALESCE(a.RequestId, ''), a.CreatedAt " +
+		"FROM audit_log a LEFT JOIN users u ON u.Id = a.ActorId WHERE 1=1"
+
+	var args []interface{}
+
+	if filter.ActorID != nil {
+		query += " AND a.ActorId = ?"
+		args = append(args, *filter.ActorID)
+	}
+	if filter.Entity != "" {
+		query += " AND a.Entity = ?"
+		args = append(args, filter.Entity)
+	}
+	if filter.EntityID != "" {
+		query += " AND a.EntityId = ?"
+		args = append(args, filter.EntityID)
+	}
+	if filter.Action != "" {
+		query += " AND a.Action = ?"
+		args = append(args, filter.Action)
+	}
+	if filter.From != nil {
+		query += " AND a.CreatedAt >= ?"
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		query += " AND a.CreatedAt < ?"
+		args = append(args, *filter.To)
+	}
+	if filter.IDPasien > 0 {
+		query += " AND " + pasienAuditCondition
+		for i := 0; i < pasienAuditArgs; i++ {
+			args = append(args, filter.IDPasien)
+		}
+	}
+	if filter.BeforeID > 0 {
+		query += " AND a.Id < ?"
+		args = append(args, filter.BeforeID)
+	}
+
+	query += " ORDER BY a.Id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := repo.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.AuditLog
+	for rows.Next() {
+		var entry models.AuditLog
+		var actorID sql.NullInt64
+		err := rows.Scan(
+			&entry.ID,
+			&actorID,
+			&entry.ActorName,
+			&entry.ActorRole,
+			&entry.Action,
+			&entry.Entity,
+			&entry.EntityID,
+			&entry.Before,
+			&entry.After,
+			&entry.Diff,
+			&entry.IP,
+			&entry.RequestID,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if actorID.Valid {
+			id := int(actorID.Int64)
+			entry.ActorID = &id
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// pasienKunjunganIDs selects the ids of a pasien's kunjungan, both from the
+// kunjungan table and from the audit trail, so history survives a deleted
+// kunjungan.
+const pasienKunjunganIDs = "SELECT CAST(k.Id AS CHAR) FROM kunjungan k WHERE k.IdPasien = ?" +
+	" UNION SELECT ak.EntityId FROM audit_log ak WHERE ak.Entity = 'kunjungan'" +
+	" AND JSON_VALUE(COALESCE(ak.`After`, ak.`Before`), '$.IDPasien') = CAST(? AS CHAR)"
+
+// pasienAuditCondition matches rows about a pasien, its kunjungan and
+// everything recorded against those kunjungan, including reads whose akses_log
+// row could not be written. Every ? is the pasien id.
+const pasienAuditCondition = "(" +
+	"(a.Entity IN ('pasien', 'akses_log') AND a.EntityId = CAST(? AS CHAR))" +
+	" OR (a.Entity IN ('kunjungan', 'alih_media', 'retensi', 'pemusnahan') AND a.EntityId IN (" + pasienKunjunganIDs + "))" +
+	" OR (a.Entity = 'legal_hold' AND (JSON_VALUE(COALESCE(a.`After`, a.`Before`), '$.IDPasien') = CAST(? AS CHAR)" +
+	" OR JSON_VALUE(COALESCE(a.`After`, a.`Before`), '$.IDKunjungan') IN (" + pasienKunjunganIDs + ")))" +
+	" OR (a.Entity = 'dokumen' AND JSON_VALUE(COALESCE(a.`After`, a.`Before`), '$.IDKunjungan') IN (" + pasienKunjunganIDs + "))" +
+	")"
+
+const pasienAuditArgs = 8
@@ -0,0 +1,98 @@
+package repositories
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+)
+
+func auditEntry() *models.AuditLog {
+	actor := 7
+	return &models.AuditLog{
+		ActorID:   &actor,
+		ActorRole: "admin",
+		Action:    "update",
+		Entity:    "kunjungan",
+		EntityID:  "12",
+		Before:    `{"Status":"aktif"}`,
+		After:     `{"Status":"tidak aktif"}`,
+		Diff:      `{"Status":["aktif","tidak aktif"]}`,
+		IP:        "10.0.0.1",
+		RequestID: "req-1",
+		CreatedAt: time.Date(2025, time.May, 1, 8, 30, 0, 123456000, time.UTC),
+	}
+}
+
+func TestAuditHashCoversEveryField(t *testing.T) {
+	base := AuditHash("prev", auditEntry())
+	if base != AuditHash("prev", auditEntry()) {
+		t.Fatal("AuditHash is not deterministic")
+	}
+
+	otherActor := 8
+	edits := map[string]func(entry *models.AuditLog){
+		"ActorID":   func(entry *models.AuditLog) { entry.ActorID = &otherActor },
+		"no actor":  func(entry *models.AuditLog) { entry.ActorID = nil },
+		"ActorRole": func(entry *models.AuditLog) { entry.ActorRole = "viewer" },
+		"Action":    func(entry *models.AuditLog) { entry.Action = "delete" },
+		"Entity":    func(entry *models.AuditLog) { entry.Entity = "pasien" },
+		"EntityID":  func(entry *models.AuditLog) { entry.EntityID = "13" },
+		"Before":    func(entry *models.AuditLog) { entry.Before = `{"Status":"x"}` },
+		"After":     func(entry *models.AuditLog) { entry.After = `{"Status":"x"}` },
+		"Diff":      func(entry *models.AuditLog) { entry.Diff = "" },
+		"IP":        func(entry *models.AuditLog) { entry.IP = "10.0.0.2" },
+		"RequestID": func(entry *models.AuditLog) { entry.RequestID = "req-2" },
+		"CreatedAt": func(entry *models.AuditLog) { entry.CreatedAt = entry.CreatedAt.Add(time.Microsecond) },
+	}
+
+	for field, edit := range edits {
+		entry := auditEntry()
+		edit(entry)
+		if AuditHash("prev", entry) == base {
+			t.Errorf("changing %s does not change the hash", field)
+		}
+	}
+
+	if AuditHash("other", auditEntry()) == base {
+		t.Error("changing the previous hash does not change the hash")
+	}
+}
+
+func TestAuditHashIgnoresTimeZone(t *testing.T) {
+	entry := auditEntry()
+	local := auditEntry()
+	local.CreatedAt = local.CreatedAt.In(time.FixedZone("WIB", 7*60*60))
+
+	if AuditHash("", entry) != AuditHash("", local) {
+		t.Error("the same instant in another zone hashes differently")
+	}
+}
+
+func TestChainAuditLogs(t *testing.T) {
+	entries := []*models.AuditLog{auditEntry(), auditEntry(), auditEntry()}
+	entries[0].CreatedAt = entries[0].CreatedAt.Add(999) // below a microsecond
+
+	head := ChainAuditLogs("start", entries)
+
+	prev := "start"
+	for i, entry := range entries {
+		if entry.PrevHash != prev {
+			t.Errorf("entry %d PrevHash = %q, want %q", i, entry.PrevHash, prev)
+		}
+		if entry.Hash != AuditHash(prev, entry) {
+			t.Errorf("entry %d Hash does not match its content", i)
+		}
+		if entry.CreatedAt.Nanosecond()%1000 != 0 {
+			t.Errorf("entry %d CreatedAt = %s, want it truncated to microseconds", i, entry.CreatedAt)
+		}
+		prev = entry.Hash
+	}
+
+	if head != prev {
+		t.Errorf("head = %q, want the last entry's hash %q", head, prev)
+	}
+	if entries[1].Hash == entries[2].Hash {
+		t.Error("identical entries share a hash; the chain does not link them")
+	}
+}
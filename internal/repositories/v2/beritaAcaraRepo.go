@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+)
+
+type BeritaAcaraRepository interface {
+	GetBeritaAcaraByBatch(ctx context.Context, idBatch int) (*models.BeritaAcara, error)
+	NextBeritaAcaraUrutanTx(ctx context.Context, tx *sql.Tx, tahun int) (int, error)
+	CreateBeritaAcaraTx(ctx context.Context, tx *sql.Tx, beritaAcara *models.BeritaAcara) (*models.BeritaAcara, error)
+}
+
+type beritaAcaraRepository struct {
+	db *sql.DB
+}
+
+func NewRepoBeritaAcara(db *sql.DB) BeritaAcaraRepository {
+	return &beritaAcaraRepository{
+		db: db,
+	}
+}
+
+func (repo *beritaAcaraRepository) GetBeritaAcaraByBatch(ctx context.Context, idBatch int) (*models.BeritaAcara, error) {
+	query := `
+	SELECT Id, IdBatch, Tahun, Urutan, Nomor, FilePath, CreatedBy, CreatedAt
+	FROM berita_acara
+	WHERE IdBatch = ?
+	LIMIT 1
+	`
+
+	var ba models.BeritaAcara
+	err := repo.db.QueryRowContext(ctx, query, idBatch).Scan(
+		&ba.ID,
+		&ba.IDBatch,
+		&ba.Tahun,
+		&ba.Urutan,
+		&ba.Nomor,
+		&ba.FilePath,
+		&ba.CreatedBy,
+		&ba.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &ba, nil
+}
+
+// NextBeritaAcaraUrutanTx returns the next sequence number for the year and
+// locks the year's rows until tx ends, so concurrent callers cannot be handed
+// the same number.
+func (repo *beritaAcaraRepository) NextBeritaAcaraUrutanTx(ctx context.Context, tx *sql.Tx, tahun int) (int, error) {
+	query := `SELECT COALESCE(MAX(Urutan), 0) + 1 FROM berita_acara WHERE Tahun = ? FOR UPDATE`
+
+	var urutan int
+	err := tx.QueryRowContext(ctx, query, tahun).Scan(&urutan)
+	return urutan, err
+}
+
+func (repo *beritaAcaraRepository) CreateBeritaAcaraTx(ctx context.Context, tx *sql.Tx, beritaAcara *models.BeritaAcara) (*models.BeritaAcara, error) {
+	query := `
+	INSERT INTO berita_acara(IdBatch, Tahun, Urutan, Nomor, FilePath, CreatedBy, CreatedAt)
+	VALUES (?,?,?,?,?,?,?)
+	`
+
+	beritaAcara.CreatedAt = time.Now()
+	result, err := tx.ExecContext(
+		ctx,
+		query,
+		beritaAcara.IDBatch,
+		beritaAcara.Tahun,
+		beritaAcara.Urutan,
+		beritaAcara.Nomor,
+		beritaAcara.FilePath,
+		beritaAcara.CreatedBy,
+		beritaAcara.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	beritaAcara.ID = int(id)
+
+	return beritaAcara, nil
+}
@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+)
+
+type CronJobRepository interface {
+	GetAllCronJobs(ctx context.Context) ([]*models.CronJob, error)
+	GetCronJobByName(ctx context.Context, name string) (*models.CronJob, error)
+	UpdateCronJob(ctx context.Context, job models.CronJob) (*models.CronJob, error)
+}
+
+type cronJobRepository struct {
+	db *sql.DB
+}
+
+func NewRepoCronJob(db *sql.DB) CronJobRepository {
+	return &cronJobRepository{
+		db: db,
+	}
+}
+
+func (repo *cronJobRepository) GetAllCronJobs(ctx context.Context) ([]*models.CronJob, error) {
+	query := `
+	SELECT Name, Expression, Timezone, Enabled, UpdatedAt
+	FROM cron_jobs
+	ORDER BY Name ASC
+	`
+
+	rows, err := repo.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*models.CronJob
+	for rows.Next() {
+		var job models.CronJob
+		err := rows.Scan(
+			&job.Name,
+			&job.Expression,
+			&job.Timezone,
+			&job.Enabled,
+			&job.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+func (repo *cronJobRepository) GetCronJobByName(ctx context.Context, name string) (*models.CronJob, error) {
+	query := `
+	SELECT Name, Expression, Timezone, Enabled, UpdatedAt
+	FROM cron_jobs
+	WHERE Name = ?
+	LIMIT 1
+	`
+
+	var job models.CronJob
+	err := repo.db.QueryRowContext(ctx, query, name).Scan(
+		&job.Name,
+		&job.Expression,
+		&job.Timezone,
+		&job.Enabled,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (repo *cronJobRepository) UpdateCronJob(ctx context.Context, job models.CronJob) (*models.CronJob, error) {
+	query := `
+	UPDATE cron_jobs
+	SET Expression = ?, Timezone = ?, Enabled = ?
+	WHERE Name = ?
+	`
+
+	_, err := repo.db.ExecContext(ctx, query, job.Expression, job.Timezone, job.Enabled, job.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.GetCronJobByName(ctx, job.Name)
+}
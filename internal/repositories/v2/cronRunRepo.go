@@ -0,0 +1,232 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+)
+
+type CronRunRepository interface {
+	CreateCronRun(ctx context.Context, run *models.CronRun) (*models.CronRun, error)
+	FinishCronRun(ctx context.Context, run models.CronRun) error
+	CreateCronRunItem(ctx context.Context, item *models.CronRunItem) error
+	GetAllCronRuns(ctx context.Context, limit, offset int) ([]*models.CronRun, error)
+	GetTotalCronRuns(ctx context.Context) (int, error)
+	GetCronRunByID(ctx context.Context, id int) (*models.CronRun, error)
+	GetCronRunItems(ctx context.Context, idRun int) ([]*models.CronRunItem, error)
+	GetCronRunItemsByKunjungan(ctx context.Context, idKunjungan int) ([]*models.CronRunItem, error)
+}
+
+type cronRunRepository struct {
+	db *sql.DB
+}
+
+func NewRepoCronRun(db *sql.DB) CronRunRepository {
+	return &cronRunRepository{
+		db: db,
+	}
+}
+
+func (repo *cronRunRepository) CreateCronRun(ctx context.Context, run *models.CronRun) (*models.CronRun, error) {
+	query := `
+	INSERT INTO cron_runs(Job, TriggeredBy, Status, StartedAt)
+	VALUES (?,?,?,?)
+	`
+
+	result, err := repo.db.ExecContext(ctx, query, run.Job, run.TriggeredBy, run.Status, run.StartedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	run.ID = int(id)
+	return run, nil
+}
+
+func (repo *cronRunRepository) FinishCronRun(ctx context.Context, run models.CronRun) error {
+	query := `
+	UPDATE cron_runs
+	SET Status = ?, FinishedAt = ?, Processed = ?, Skipped = ?, Failed = ?, Message = ?
+	WHERE Id = ?
+	`
+
+	_, err := repo.db.ExecContext(ctx, query, run.Status, run.FinishedAt, run.Processed, run.Skipped, run.Failed, run.Message, run.ID)
+	return err
+}
+
+func (repo *cronRunRepository) CreateCronRunItem(ctx context.Context, item *models.CronRunItem) error {
+	query := `
+	INSERT INTO cron_run_items(IdRun, IdKunjungan, Action, Outcome, Message)
+	VALUES (?,?,?,?,?)
+	`
+
+	result, err := repo.db.ExecContext(ctx, query, item.IDRun, item.IDKunjungan, item.Action, item.Outcome, item.Message)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	item.ID = int(id)
+	return nil
+}
+
+func (repo *cronRunRepository) GetAllCronRuns(ctx context.Context, limit, offset int) ([]*models.CronRun, error) {
+	query := `
+	SELECT Id, Job, TriggeredBy, Status, StartedAt, FinishedAt, Processed, Skipped, Failed, Message
+	FROM cron_runs
+	ORDER BY StartedAt DESC, Id DESC
+	LIMIT ? OFFSET ?
+	`
+
+	rows, err := repo.db.QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []*models.CronRun
+	for rows.Next() {
+		run, err := scanCronRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+func (repo *cronRunRepository) GetTotalCronRuns(ctx context.Context) (int, error) {
+	query := `SELECT COUNT(*) FROM cron_runs`
+
+	var count int
+	err := repo.db.QueryRowContext(ctx, query).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (repo *cronRunRepository) GetCronRunByID(ctx context.Context, id int) (*models.CronRun, error) {
+	query := `
+	SELECT Id, Job, TriggeredBy, Status, StartedAt, FinishedAt, Processed, Skipped, Failed, Message
+	FROM cron_runs
+	WHERE Id = ?
+	LIMIT 1
+	`
+
+	run, err := scanCronRun(repo.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return run, nil
+}
+
+func (repo *cronRunRepository) GetCronRunItems(ctx context.Context, idRun int) ([]*models.CronRunItem, error) {
+	query := `
+	SELECT Id, IdRun, IdKunjungan, Action, Outcome, Message, CreatedAt
+	FROM cron_run_items
+	WHERE IdRun = ?
+	ORDER BY Id ASC
+	`
+
+	return repo.queryCronRunItems(ctx, query, idRun)
+}
+
+func (repo *cronRunRepository) GetCronRunItemsByKunjungan(ctx context.Context, idKunjungan int) ([]*models.CronRunItem, error) {
+	query := `
+	SELECT Id, IdRun, IdKunjungan, Action, Outcome, Message, CreatedAt
+	FROM cron_run_items
+	WHERE IdKunjungan = ?
+	ORDER BY CreatedAt ASC, Id ASC
+	`
+
+	return repo.queryCronRunItems(ctx, query, idKunjungan)
+}
+
+func (repo *cronRunRepository) queryCronRunItems(ctx context.Context, query string, args ...interface{}) ([]*models.CronRunItem, error) {
+	rows, err := repo.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*models.CronRunItem
+	for rows.Next() {
+		var item models.CronRunItem
+		var message sql.NullString
+
+		err := rows.Scan(
+			&item.ID,
+			&item.IDRun,
+			&item.IDKunjungan,
+			&item.Action,
+			&item.Outcome,
+			&message,
+			&item.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		item.Message = message.String
+		items = append(items, &item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCronRun(row rowScanner) (*models.CronRun, error) {
+	var run models.CronRun
+	var finishedAt sql.NullTime
+	var message sql.NullString
+
+	err := row.Scan(
+		&run.ID,
+		&run.Job,
+		&run.TriggeredBy,
+		&run.Status,
+		&run.StartedAt,
+		&finishedAt,
+		&run.Processed,
+		&run.Skipped,
+		&run.Failed,
+		&message,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if finishedAt.Valid {
+		run.FinishedAt = &finishedAt.Time
+	}
+	run.Message = message.String
+
+	return &run, nil
+}
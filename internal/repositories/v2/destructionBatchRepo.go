@@ -0,0 +1,378 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+)
+
+// ErrBatchStateChanged is returned by a state update when the batch is no
+// longer in the state the caller read it in.
+var ErrBatchStateChanged = errors.New("Destruction batch was changed by another request")
+
+type DestructionBatchRepository interface {
+	GetAllBatches(ctx context.Context, limit, offset int) ([]*models.DestructionBatch, error)
+	GetTotalBatches(ctx context.Context) (int, error)
+	GetBatchByID(ctx context.Context, id int) (*models.DestructionBatch, error)
+	LockBatchTx(ctx context.Context, tx *sql.Tx, id int) (*models.DestructionBatch, error)
+	CreateBatch(ctx context.Context, batch *models.DestructionBatch) (*models.DestructionBatch, error)
+	UpdateBatchState(ctx context.Context, batch models.DestructionBatch, from string) error
+	UpdateBatchStateTx(ctx context.Context, tx *sql.Tx, batch models.DestructionBatch, from string) error
+	GetBatchItems(ctx context.Context, id int) ([]int, error)
+	GetBatchItemsTx(ctx context.Context, tx *sql.Tx, id int) ([]int, error)
+	AddBatchItemTx(ctx context.Context, tx *sql.Tx, id, idKunjungan int) error
+	RemoveBatchItemTx(ctx context.Context, tx *sql.Tx, id, idKunjungan int) error
+	GetOpenBatchIDForKunjunganTx(ctx context.Context, tx *sql.Tx, idKunjungan int) (int, error)
+	GetClosedBatchIDForKunjunganTx(ctx context.Context, tx *sql.Tx, idKunjungan int) (int, error)
+	LockBatchesForKunjunganTx(ctx context.Context, tx *sql.Tx, idKunjungan int) ([]*models.DestructionBatch, error)
+	GetBatchApprovals(ctx context.Context, id int) ([]*models.DestructionBatchApproval, error)
+	GetBatchApprovalsTx(ctx context.Context, tx *sql.Tx, id int) ([]*models.DestructionBatchApproval, error)
+	AddBatchApprovalTx(ctx context.Context, tx *sql.Tx, approval models.DestructionBatchApproval) error
+	ClearBatchApprovalsTx(ctx context.Context, tx *sql.Tx, id int) error
+}
+
+type destructionBatchRepository struct {
+	db *sql.DB
+}
+
+func NewRepoDestructionBatch(db *sql.DB) DestructionBatchRepository {
+	return &destructionBatchRepository{
+		db: db,
+	}
+}
+
+const destructionBatchColumns = `Id, Nama, Keterangan, State, ProposedBy, RequiredApprovals, CreatedAt, SubmittedAt, ApprovedAt, ExecutedAt, ExecutedBy`
+
+func (repo *destructionBatchRepository) GetAllBatches(ctx context.Context, limit, offset int) ([]*models.DestructionBatch, error) {
+	query := `
+	SELECT ` + destructionBatchColumns + `
+	FROM destruction_batches
+	ORDER BY CreatedAt DESC
+	LIMIT ? OFFSET ?
+	`
+
+	rows, err := repo.db.QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batches []*models.DestructionBatch
+	for rows.Next() {
+		batch, err := scanDestructionBatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, batch)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return batches, nil
+}
+
+func (repo *destructionBatchRepository) GetTotalBatches(ctx context.Context) (int, error) {
+	var total int
+	err := repo.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM destruction_batches`).Scan(&total)
+	return total, err
+}
+
+func (repo *destructionBatchRepository) GetBatchByID(ctx context.Context, id int) (*models.DestructionBatch, error) {
+	query := `SELECT ` + destructionBatchColumns + ` FROM destruction_batches WHERE Id = ? LIMIT 1`
+
+	batch, err := scanDestructionBatch(repo.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+// LockBatchTx reads the batch and locks its row until tx ends, so state
+// checks made inside tx cannot be overtaken by a concurrent request.
+func (repo *destructionBatchRepository) LockBatchTx(ctx context.Context, tx *sql.Tx, id int) (*models.DestructionBatch, error) {
+	query := `SELECT ` + destructionBatchColumns + ` FROM destruction_batches WHERE Id = ? FOR UPDATE`
+
+	batch, err := scanDestructionBatch(tx.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+func (repo *destructionBatchRepository) CreateBatch(ctx context.Context, batch *models.DestructionBatch) (*models.DestructionBatch, error) {
+	query := `
+	INSERT INTO destruction_batches(Nama, Keterangan, State, ProposedBy, RequiredApprovals)
+	VALUES (?,?,?,?,?)
+	`
+
+	result, err := repo.db.ExecContext(ctx, query, batch.Nama, batch.Keterangan, batch.State, batch.ProposedBy, batch.RequiredApprovals)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.GetBatchByID(ctx, int(id))
+}
+
+// UpdateBatchState writes the batch's state only if it is still in the state
+// from, and returns ErrBatchStateChanged otherwise.
+func (repo *destructionBatchRepository) UpdateBatchState(ctx context.Context, batch models.DestructionBatch, from string) error {
+	return updateBatchState(ctx, repo.db, batch, from)
+}
+
+func (repo *destructionBatchRepository) UpdateBatchStateTx(ctx context.Context, tx *sql.Tx, batch models.DestructionBatch, from string) error {
+	return updateBatchState(ctx, tx, batch, from)
+}
+
+func updateBatchState(ctx context.Context, q queryer, batch models.DestructionBatch, from string) error {
+	query := `
+	UPDATE destruction_batches
+	SET State = ?, RequiredApprovals = ?, SubmittedAt = ?, ApprovedAt = ?, ExecutedAt = ?, ExecutedBy = ?
+	WHERE Id = ? AND State = ?
+	`
+
+	result, err := q.ExecContext(ctx, query,
+		batch.State,
+		batch.RequiredApprovals,
+		batch.SubmittedAt,
+		batch.ApprovedAt,
+		batch.ExecutedAt,
+		batch.ExecutedBy,
+		batch.ID,
+		from,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrBatchStateChanged
+	}
+
+	return nil
+}
+
+func (repo *destructionBatchRepository) GetBatchItems(ctx context.Context, id int) ([]int, error) {
+	return getBatchItems(ctx, repo.db, id)
+}
+
+func (repo *destructionBatchRepository) GetBatchItemsTx(ctx context.Context, tx *sql.Tx, id int) ([]int, error) {
+	return getBatchItems(ctx, tx, id)
+}
+
+func getBatchItems(ctx context.Context, q queryer, id int) ([]int, error) {
+	rows, err := q.QueryContext(ctx, `SELECT IdKunjungan FROM destruction_batch_items WHERE IdBatch = ? ORDER BY IdKunjungan ASC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []int
+	for rows.Next() {
+		var idKunjungan int
+		if err := rows.Scan(&idKunjungan); err != nil {
+			return nil, err
+		}
+		items = append(items, idKunjungan)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (repo *destructionBatchRepository) AddBatchItemTx(ctx context.Context, tx *sql.Tx, id, idKunjungan int) error {
+	_, err := tx.ExecContext(ctx, `INSERT IGNORE INTO destruction_batch_items(IdBatch, IdKunjungan) VALUES (?,?)`, id, idKunjungan)
+	return err
+}
+
+func (repo *destructionBatchRepository) RemoveBatchItemTx(ctx context.Context, tx *sql.Tx, id, idKunjungan int) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM destruction_batch_items WHERE IdBatch = ? AND IdKunjungan = ?`, id, idKunjungan)
+	return err
+}
+
+// GetOpenBatchIDForKunjunganTx returns the id of a batch that has not been
+// executed yet and already contains the kunjungan, or 0 if there is none. The
+// kunjungan's item rows stay locked until tx ends, so two drafts cannot both
+// take it.
+func (repo *destructionBatchRepository) GetOpenBatchIDForKunjunganTx(ctx context.Context, tx *sql.Tx, idKunjungan int) (int, error) {
+	return batchIDForKunjungan(ctx, tx, idKunjungan, `b.State <> 'executed'`)
+}
+
+// GetClosedBatchIDForKunjunganTx returns the id of an approved or executed
+// batch that contains the kunjungan, or 0 if there is none, and locks the
+// kunjungan's item rows until tx ends.
+func (repo *destructionBatchRepository) GetClosedBatchIDForKunjunganTx(ctx context.Context, tx *sql.Tx, idKunjungan int) (int, error) {
+	return batchIDForKunjungan(ctx, tx, idKunjungan, `b.State IN ('approved', 'executed')`)
+}
+
+// LockBatchesForKunjunganTx returns every batch that contains the kunjungan,
+// with the batch rows locked until tx ends.
+func (repo *destructionBatchRepository) LockBatchesForKunjunganTx(ctx context.Context, tx *sql.Tx, idKunjungan int) ([]*models.DestructionBatch, error) {
+	query := `
+	SELECT ` + destructionBatchColumns + `
+	FROM destruction_batches
+	WHERE Id IN (SELECT IdBatch FROM destruction_batch_items WHERE IdKunjungan = ?)
+	ORDER BY Id
+	FOR UPDATE
+	`
+
+	rows, err := tx.QueryContext(ctx, query, idKunjungan)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batches []*models.DestructionBatch
+	for rows.Next() {
+		batch, err := scanDestructionBatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, batch)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return batches, nil
+}
+
+func batchIDForKunjungan(ctx context.Context, tx *sql.Tx, idKunjungan int, stateCondition string) (int, error) {
+	query := `
+	SELECT b.Id
+	FROM destruction_batch_items i
+	JOIN destruction_batches b ON b.Id = i.IdBatch
+	WHERE i.IdKunjungan = ? AND ` + stateCondition + `
+	LIMIT 1
+	FOR UPDATE
+	`
+
+	var id int
+	err := tx.QueryRowContext(ctx, query, idKunjungan).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (repo *destructionBatchRepository) GetBatchApprovals(ctx context.Context, id int) ([]*models.DestructionBatchApproval, error) {
+	return getBatchApprovals(ctx, repo.db, id)
+}
+
+func (repo *destructionBatchRepository) GetBatchApprovalsTx(ctx context.Context, tx *sql.Tx, id int) ([]*models.DestructionBatchApproval, error) {
+	return getBatchApprovals(ctx, tx, id)
+}
+
+func getBatchApprovals(ctx context.Context, q queryer, id int) ([]*models.DestructionBatchApproval, error) {
+	query := `
+	SELECT IdBatch, IdUser, COALESCE(Catatan, ''), CreatedAt
+	FROM destruction_batch_approvals
+	WHERE IdBatch = ?
+	ORDER BY CreatedAt ASC
+	`
+
+	rows, err := q.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var approvals []*models.DestructionBatchApproval
+	for rows.Next() {
+		var approval models.DestructionBatchApproval
+		if err := rows.Scan(&approval.IDBatch, &approval.IDUser, &approval.Catatan, &approval.CreatedAt); err != nil {
+			return nil, err
+		}
+		approvals = append(approvals, &approval)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return approvals, nil
+}
+
+func (repo *destructionBatchRepository) AddBatchApprovalTx(ctx context.Context, tx *sql.Tx, approval models.DestructionBatchApproval) error {
+	query := `
+	INSERT INTO destruction_batch_approvals(IdBatch, IdUser, Catatan)
+	VALUES (?,?,?)
+	`
+
+	_, err := tx.ExecContext(ctx, query, approval.IDBatch, approval.IDUser, approval.Catatan)
+	return err
+}
+
+func (repo *destructionBatchRepository) ClearBatchApprovalsTx(ctx context.Context, tx *sql.Tx, id int) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM destruction_batch_approvals WHERE IdBatch = ?`, id)
+	return err
+}
+
+func scanDestructionBatch(row rowScanner) (*models.DestructionBatch, error) {
+	var batch models.DestructionBatch
+	var keterangan sql.NullString
+	var submittedAt, approvedAt, executedAt sql.NullTime
+	var executedBy sql.NullInt64
+
+	err := row.Scan(
+		&batch.ID,
+		&batch.Nama,
+		&keterangan,
+		&batch.State,
+		&batch.ProposedBy,
+		&batch.RequiredApprovals,
+		&batch.CreatedAt,
+		&submittedAt,
+		&approvedAt,
+		&executedAt,
+		&executedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	batch.Keterangan = keterangan.String
+	if submittedAt.Valid {
+		batch.SubmittedAt = &submittedAt.Time
+	}
+	if approvedAt.Valid {
+		batch.ApprovedAt = &approvedAt.Time
+	}
+	if executedAt.Valid {
+		batch.ExecutedAt = &executedAt.Time
+	}
+	if executedBy.Valid {
+		id := int(executedBy.Int64)
+		batch.ExecutedBy = &id
+	}
+
+	return &batch, nil
+}
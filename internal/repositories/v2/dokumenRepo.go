@@ -14,6 +14,8 @@ type DokumenRepository interface {
 	GetDokumenByID(ctx context.Context, id int) (*models.Dokumen, error)
 	UpdateDokumen(ctx context.Context, dokumen models.Dokumen) (*models.Dokumen, error)
 	DeleteDokumen(ctx context.Context, id int) error
+	GetAllDokumenPaths(ctx context.Context) ([]string, error)
+	GetPasienIDByDokumenPath(ctx context.Context, path string) (int, error)
 }
 
 type dokumenRepository struct {
@@ -101,3 +103,49 @@ func (repo *dokumenRepository) DeleteDokumen(ctx context.Context, id int) error
 
 	return err
 }
+
+func (repo *dokumenRepository) GetAllDokumenPaths(ctx context.Context) ([]string, error) {
+	rows, err := repo.db.QueryContext(ctx, `SELECT Path FROM dokumen WHERE Path IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+// GetPasienIDByDokumenPath returns the pasien an uploaded file belongs to, or
+// 0 when no dokumen has that path.
+func (repo *dokumenRepository) GetPasienIDByDokumenPath(ctx context.Context, path string) (int, error) {
+	query := `
+	SELECT k.IdPasien
+	FROM dokumen d
+	JOIN kunjungan k ON k.Id = d.IdKunjungan
+	WHERE d.Path = ?
+	LIMIT 1
+	`
+
+	var idPasien int
+	err := repo.db.QueryRowContext(ctx, query, path).Scan(&idPasien)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return idPasien, nil
+}
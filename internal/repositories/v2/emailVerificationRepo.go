@@ -0,0 +1,86 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+)
+
+type EmailVerificationRepository interface {
+	Create(ctx context.Context, verification models.EmailVerification) (int, error)
+	GetByTokenHash(ctx context.Context, tokenHash string) (*models.EmailVerification, error)
+	MarkUsed(ctx context.Context, id int) (bool, error)
+	InvalidateForUser(ctx context.Context, idUser int) error
+}
+
+type emailVerificationRepository struct {
+	db *sql.DB
+}
+
+func NewRepoEmailVerification(db *sql.DB) EmailVerificationRepository {
+	return &emailVerificationRepository{
+		db: db,
+	}
+}
+
+func (repo *emailVerificationRepository) Create(ctx context.Context, verification models.EmailVerification) (int, error) {
+	query := `
+	INSERT INTO email_verifications (IdUser, TokenHash, CreatedAt, ExpiresAt)
+	VALUES (?, ?, ?, ?)
+	`
+	result, err := repo.db.ExecContext(ctx, query, verification.IDUser, verification.TokenHash, verification.CreatedAt, verification.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+func (repo *emailVerificationRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*models.EmailVerification, error) {
+	query := `
+	SELECT Id, IdUser, TokenHash, CreatedAt, ExpiresAt, UsedAt
+	FROM email_verifications
+	WHERE TokenHash = ?
+	`
+
+	var verification models.EmailVerification
+	err := repo.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&verification.ID,
+		&verification.IDUser,
+		&verification.TokenHash,
+		&verification.CreatedAt,
+		&verification.ExpiresAt,
+		&verification.UsedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &verification, nil
+}
+
+func (repo *emailVerificationRepository) MarkUsed(ctx context.Context, id int) (bool, error) {
+	result, err := repo.db.ExecContext(ctx, `UPDATE email_verifications SET UsedAt = ? WHERE Id = ? AND UsedAt IS NULL`, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func (repo *emailVerificationRepository) InvalidateForUser(ctx context.Context, idUser int) error {
+	_, err := repo.db.ExecContext(ctx, `UPDATE email_verifications SET UsedAt = ? WHERE IdUser = ? AND UsedAt IS NULL`, time.Now(), idUser)
+	return err
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"log"
 
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/lifecycle"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
 )
 
@@ -16,10 +17,16 @@ type KunjunganRepository interface {
 	CreateKunjungan(ctx context.Context, kunjungan *models.Kunjungan) (*models.Kunjungan, error)
 	UpdateKunjungan(ctx context.Context, kunjungan models.Kunjungan) (*models.Kunjungan, error)
 	DeleteKunjungan(ctx context.Context, id int) error
-	GetPotentiallyExpiredKunjungan(ctx context.Context, monthsThreshold int, limit, offset int) ([]*models.Kunjungan, error)
+	DeleteKunjunganTx(ctx context.Context, tx *sql.Tx, id int) error
 	GetKunjunganBasicByID(ctx context.Context, id int) (*models.Kunjungan, error)
 	UpdateKunjunganStatus(ctx context.Context, id int, status string) error
+	UpdateKunjunganStatusTx(ctx context.Context, tx *sql.Tx, id int, status string) error
 	GetActiveKunjungan(ctx context.Context) ([]*models.Kunjungan, error)
+	GetKunjunganReadyForRetensi(ctx context.Context) ([]*models.Kunjungan, error)
+	GetKunjunganReadyForPemusnahan(ctx context.Context) ([]*models.Kunjungan, error)
+	GetKunjunganLifecycle(ctx context.Context, id int) (*models.KunjunganLifecycle, error)
+	GetKunjunganLifecycleTx(ctx context.Context, tx *sql.Tx, id int) (*models.KunjunganLifecycle, error)
+	GetUndestroyedKunjungan(ctx context.Context) ([]*models.KunjunganSchedule, error)
 	GetTotalActiveKunjungan(ctx context.Context) (int, error)
 	FindKunjungan(ctx context.Context, filter map[string]interface{}) ([]*models.KunjunganJoin, error)
 }
@@ -127,6 +134,7 @@ func (repo *kunjunganRepository) GetActiveKunjungan(ctx context.Context) ([]*mod
 		TglMasuk,
 		JenisKunjungan,
 		Status
+	FROM kunjungan
 	WHERE Status = 'aktif'
 	ORDER BY TglMasuk ASC
 	`
@@ -165,6 +173,185 @@ func (repo *kunjunganRepository) GetActiveKunjungan(ctx context.Context) ([]*mod
 	return kunjungan, nil
 }
 
+func (repo *kunjunganRepository) GetKunjunganReadyForRetensi(ctx context.Context) ([]*models.Kunjungan, error) {
+	query := `
+	SELECT
+		kunjungan.Id,
+		kunjungan.IdPasien,
+		kunjungan.IdKasus,
+		kunjungan.TglMasuk,
+		kunjungan.JenisKunjungan,
+		kunjungan.Status
+	FROM kunjungan
+	INNER JOIN alih_media ON alih_media.Id = kunjungan.Id
+	LEFT JOIN retensi ON retensi.Id = kunjungan.Id
+	WHERE alih_media.Status = ?
+		AND retensi.Id IS NULL
+	ORDER BY kunjungan.TglMasuk ASC
+	`
+
+	return repo.queryKunjunganBasic(ctx, query, lifecycle.AlihMediaSudah)
+}
+
+func (repo *kunjunganRepository) GetKunjunganReadyForPemusnahan(ctx context.Context) ([]*models.Kunjungan, error) {
+	query := `
+	SELECT
+		kunjungan.Id,
+		kunjungan.IdPasien,
+		kunjungan.IdKasus,
+		kunjungan.TglMasuk,
+		kunjungan.JenisKunjungan,
+		kunjungan.Status
+	FROM kunjungan
+	INNER JOIN retensi ON retensi.Id = kunjungan.Id
+	LEFT JOIN pemusnahan ON pemusnahan.Id = kunjungan.Id
+	WHERE retensi.Status = ?
+		AND pemusnahan.Id IS NULL
+	ORDER BY kunjungan.TglMasuk ASC
+	`
+
+	return repo.queryKunjunganBasic(ctx, query, lifecycle.RetensiSudah)
+}
+
+func (repo *kunjunganRepository) GetKunjunganLifecycle(ctx context.Context, id int) (*models.KunjunganLifecycle, error) {
+	return getKunjunganLifecycle(ctx, repo.db, id, "")
+}
+
+// GetKunjunganLifecycleTx reads the statuses with the rows locked until tx
+// ends, so they cannot change between a check and the write that follows it.
+func (repo *kunjunganRepository) GetKunjunganLifecycleTx(ctx context.Context, tx *sql.Tx, id int) (*models.KunjunganLifecycle, error) {
+	return getKunjunganLifecycle(ctx, tx, id, "FOR UPDATE")
+}
+
+func getKunjunganLifecycle(ctx context.Context, q queryer, id int, lock string) (*models.KunjunganLifecycle, error) {
+	query := `
+	SELECT
+		kunjungan.Id,
+		alih_media.Status,
+		retensi.Status,
+		pemusnahan.Status
+	FROM kunjungan
+	LEFT JOIN alih_media ON alih_media.Id = kunjungan.Id
+	LEFT JOIN retensi ON retensi.Id = kunjungan.Id
+	LEFT JOIN pemusnahan ON pemusnahan.Id = kunjungan.Id
+	WHERE kunjungan.Id = ?
+	LIMIT 1
+	` + lock
+
+	var lc models.KunjunganLifecycle
+	var alihMedia, retensi, pemusnahan sql.NullString
+
+	err := q.QueryRowContext(ctx, query, id).Scan(&lc.ID, &alihMedia, &retensi, &pemusnahan)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	lc.AlihMedia = alihMedia.String
+	lc.Retensi = retensi.String
+	lc.Pemusnahan = pemusnahan.String
+
+	return &lc, nil
+}
+
+// GetUndestroyedKunjungan returns every kunjungan that has not been destroyed
+// yet, together with its lifecycle statuses.
+func (repo *kunjunganRepository) GetUndestroyedKunjungan(ctx context.Context) ([]*models.KunjunganSchedule, error) {
+	query := `
+	SELECT
+		kunjungan.Id,
+		kunjungan.IdPasien,
+		kunjungan.IdKasus,
+		kunjungan.TglMasuk,
+		kunjungan.JenisKunjungan,
+		kunjungan.Status,
+		alih_media.Status,
+		retensi.Status,
+		pemusnahan.Status
+	FROM kunjungan
+	LEFT JOIN alih_media ON alih_media.Id = kunjungan.Id
+	LEFT JOIN retensi ON retensi.Id = kunjungan.Id
+	LEFT JOIN pemusnahan ON pemusnahan.Id = kunjungan.Id
+	WHERE pemusnahan.Id IS NULL OR pemusnahan.Status <> ?
+	ORDER BY kunjungan.TglMasuk ASC
+	`
+
+	rows, err := repo.db.QueryContext(ctx, query, lifecycle.PemusnahanSudah)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*models.KunjunganSchedule
+	for rows.Next() {
+		var ks models.KunjunganSchedule
+		var alihMedia, retensi, pemusnahan sql.NullString
+
+		err := rows.Scan(
+			&ks.Kunjungan.ID,
+			&ks.Kunjungan.IDPasien,
+			&ks.Kunjungan.IDKasus,
+			&ks.Kunjungan.TanggalMasuk,
+			&ks.Kunjungan.JenisKunjungan,
+			&ks.Kunjungan.Status,
+			&alihMedia,
+			&retensi,
+			&pemusnahan,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		ks.Lifecycle = models.KunjunganLifecycle{
+			ID:         ks.Kunjungan.ID,
+			AlihMedia:  alihMedia.String,
+			Retensi:    retensi.String,
+			Pemusnahan: pemusnahan.String,
+		}
+		result = append(result, &ks)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (repo *kunjunganRepository) queryKunjunganBasic(ctx context.Context, query string, args ...interface{}) ([]*models.Kunjungan, error) {
+	rows, err := repo.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var kunjungan []*models.Kunjungan
+	for rows.Next() {
+		var k models.Kunjungan
+
+		err := rows.Scan(
+			&k.ID,
+			&k.IDPasien,
+			&k.IDKasus,
+			&k.TanggalMasuk,
+			&k.JenisKunjungan,
+			&k.Status,
+		)
+		if err != nil {
+			return nil, err
+		}
+		kunjungan = append(kunjungan, &k)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return kunjungan, nil
+}
+
 func (repo *kunjunganRepository) GetTotalActiveKunjungan(ctx context.Context) (int, error) {
 	query := `SELECT COUNT(*) FROM kunjungan WHERE status = 'aktif'`
 
@@ -359,48 +546,6 @@ func (repo *kunjunganRepository) GetKunjunganByID(ctx context.Context, id int) (
 	return &k, nil
 }
 
-func (repo *kunjunganRepository) GetPotentiallyExpiredKunjungan(ctx context.Context, monthsThreshold int, limit, offset int) ([]*models.Kunjungan, error) {
-	query := `
-	SELECT k.Id, k.IdPasien, k.IdKasus, k.TglMasuk, k.JenisKunjungan, k.CreatedAt, k.UpdatedAt
-	FROM kunjungan k
-	INNER JOIN kasus ks ON k.IdKasus = ks.Id
-	WHERE 
-		(k.JenisKunjungan = 'RI' AND DATE_ADD(k.TglMasuk, INTERVAL ks.MasaInaktifRI YEAR) <= DATE_ADD(CURDATE(), INTERVAL ? MONTH))
-		OR 
-		(k.JenisKunjungan = 'RJ' AND DATE_ADD(k.TglMasuk, INTERVAL ks.MasaInaktifRJ YEAR) <= DATE_ADD(CURDATE(), INTERVAL ? MONTH))
-	ORDER BY k.TglMasuk ASC
-	LIMIT ? OFFSET ?
-	`
-
-	rows, err := repo.db.QueryContext(ctx, query, monthsThreshold, monthsThreshold, limit, offset)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var kunjunganList []*models.Kunjungan
-	for rows.Next() {
-		var k models.Kunjungan
-		err := rows.Scan(
-			&k.ID,
-			&k.IDPasien,
-			&k.IDKasus,
-			&k.TanggalMasuk,
-			&k.JenisKunjungan,
-		)
-		if err != nil {
-			return nil, err
-		}
-		kunjunganList = append(kunjunganList, &k)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return kunjunganList, nil
-}
-
 func (repo *kunjunganRepository) CreateKunjungan(ctx context.Context, kunjungan *models.Kunjungan) (*models.Kunjungan, error) {
 	query := `
 	INSERT INTO kunjungan(IdPasien, IdKasus, TglMasuk, JenisKunjungan)
@@ -445,6 +590,11 @@ func (repo *kunjunganRepository) UpdateKunjungan(ctx context.Context, kunjungan
 	return &kunjungan, nil
 }
 
+func (repo *kunjunganRepository) DeleteKunjunganTx(ctx context.Context, tx *sql.Tx, id int) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM kunjungan WHERE Id = ?`, id)
+	return err
+}
+
 func (repo *kunjunganRepository) DeleteKunjungan(ctx context.Context, id int) error {
 	query := `
 	DELETE FROM kunjungan
@@ -465,6 +615,12 @@ func (repo *kunjunganRepository) UpdateKunjunganStatus(ctx context.Context, id i
 	return err
 }
 
+func (repo *kunjunganRepository) UpdateKunjunganStatusTx(ctx context.Context, tx *sql.Tx, id int, status string) error {
+	query := `UPDATE kunjungan SET status = ? WHERE id = ?`
+	_, err := tx.ExecContext(ctx, query, status, id)
+	return err
+}
+
 func (repo *kunjunganRepository) GetKunjunganBasicByID(ctx context.Context, id int) (*models.Kunjungan, error) {
 	query := `SELECT Id, IdPasien, IdKasus, TglMasuk, JenisKunjungan, Status FROM kunjungan WHERE id = ?`
 
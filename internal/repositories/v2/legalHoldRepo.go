@@ -0,0 +1,262 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+)
+
+type LegalHoldRepository interface {
+	GetAllLegalHolds(ctx context.Context, activeOnly bool) ([]*models.LegalHold, error)
+	GetLegalHoldByID(ctx context.Context, id int) (*models.LegalHold, error)
+	GetActiveHoldsForKunjungan(ctx context.Context, idKunjungan int) ([]*models.LegalHold, error)
+	GetActiveHoldsForKunjunganTx(ctx context.Context, tx *sql.Tx, idKunjungan int) ([]*models.LegalHold, error)
+	GetActiveHoldsForPasien(ctx context.Context, idPasien int) ([]*models.LegalHold, error)
+	GetHeldKunjunganIDs(ctx context.Context) (map[int]bool, error)
+	CreateLegalHold(ctx context.Context, hold *models.LegalHold) (*models.LegalHold, error)
+	ReleaseLegalHold(ctx context.Context, id, releasedBy int) error
+}
+
+type legalHoldRepository struct {
+	db *sql.DB
+}
+
+func NewRepoLegalHold(db *sql.DB) LegalHoldRepository {
+	return &legalHoldRepository{
+		db: db,
+	}
+}
+
+// A hold is active until it is released or its expiry has passed.
+const activeLegalHold = `h.ReleasedAt IS NULL AND (h.ExpiresAt IS NULL OR h.ExpiresAt > NOW())`
+
+const legalHoldColumns = `h.Id, h.IdPasien, h.IdKunjungan, h.Reason, h.PlacedBy, h.PlacedAt, h.ExpiresAt, h.ReleasedBy, h.ReleasedAt`
+
+func (repo *legalHoldRepository) GetAllLegalHolds(ctx context.Context, activeOnly bool) ([]*models.LegalHold, error) {
+	query := `SELECT ` + legalHoldColumns + ` FROM legal_holds h`
+	if activeOnly {
+		query += ` WHERE ` + activeLegalHold
+	}
+	query += ` ORDER BY h.PlacedAt DESC`
+
+	return queryLegalHolds(ctx, repo.db, query)
+}
+
+func (repo *legalHoldRepository) GetLegalHoldByID(ctx context.Context, id int) (*models.LegalHold, error) {
+	query := `SELECT ` + legalHoldColumns + ` FROM legal_holds h WHERE h.Id = ? LIMIT 1`
+
+	hold, err := scanLegalHold(repo.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+// GetActiveHoldsForKunjungan returns the active holds placed on the kunjungan
+// itself or on its pasien.
+func (repo *legalHoldRepository) GetActiveHoldsForKunjungan(ctx context.Context, idKunjungan int) ([]*models.LegalHold, error) {
+	return activeHoldsForKunjungan(ctx, repo.db, idKunjungan, "")
+}
+
+// GetActiveHoldsForKunjunganTx is GetActiveHoldsForKunjungan as a locking read:
+// a hold placed on the kunjungan or its pasien while tx is open waits for tx
+// to end, so a check made inside tx stays true until it commits.
+func (repo *legalHoldRepository) GetActiveHoldsForKunjunganTx(ctx context.Context, tx *sql.Tx, idKunjungan int) ([]*models.LegalHold, error) {
+	return activeHoldsForKunjungan(ctx, tx, idKunjungan, " LOCK IN SHARE MODE")
+}
+
+// activeHoldsForKunjungan looks the holds up once by IdKunjungan and once by
+// IdPasien, so each lookup, and a locking read's range lock, stays on its own
+// index instead of spreading over the whole table.
+func activeHoldsForKunjungan(ctx context.Context, q queryer, idKunjungan int, lock string) ([]*models.LegalHold, error) {
+	// The kunjungan row is not locked here: callers that need it lock it
+	// FOR UPDATE themselves, and a shared lock taken first would turn two such
+	// callers into a deadlock.
+	var idPasien int
+	err := q.QueryRowContext(ctx, `SELECT IdPasien FROM kunjungan WHERE Id = ?`, idKunjungan).Scan(&idPasien)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	query := `SELECT ` + legalHoldColumns + ` FROM legal_holds h WHERE h.IdKunjungan = ? AND ` + activeLegalHold + lock
+	holds, err := queryLegalHolds(ctx, q, query, idKunjungan)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `SELECT ` + legalHoldColumns + ` FROM legal_holds h WHERE h.IdPasien = ? AND ` + activeLegalHold + lock
+	pasienHolds, err := queryLegalHolds(ctx, q, query, idPasien)
+	if err != nil {
+		return nil, err
+	}
+
+	holds = append(holds, pasienHolds...)
+	sort.SliceStable(holds, func(i, j int) bool {
+		return holds[i].PlacedAt.Before(holds[j].PlacedAt)
+	})
+
+	return holds, nil
+}
+
+// GetActiveHoldsForPasien returns the active holds placed on the pasien or on
+// any of its kunjungan.
+func (repo *legalHoldRepository) GetActiveHoldsForPasien(ctx context.Context, idPasien int) ([]*models.LegalHold, error) {
+	query := `SELECT ` + legalHoldColumns + ` FROM legal_holds h WHERE h.IdPasien = ? AND ` + activeLegalHold
+	holds, err := queryLegalHolds(ctx, repo.db, query, idPasien)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT ` + legalHoldColumns + `
+	FROM legal_holds h
+	JOIN kunjungan k ON k.Id = h.IdKunjungan
+	WHERE k.IdPasien = ? AND ` + activeLegalHold
+	kunjunganHolds, err := queryLegalHolds(ctx, repo.db, query, idPasien)
+	if err != nil {
+		return nil, err
+	}
+
+	holds = append(holds, kunjunganHolds...)
+	sort.SliceStable(holds, func(i, j int) bool {
+		return holds[i].PlacedAt.Before(holds[j].PlacedAt)
+	})
+
+	return holds, nil
+}
+
+func (repo *legalHoldRepository) GetHeldKunjunganIDs(ctx context.Context) (map[int]bool, error) {
+	query := `
+	SELECT h.IdKunjungan
+	FROM legal_holds h
+	WHERE h.IdKunjungan IS NOT NULL AND ` + activeLegalHold + `
+	UNION
+	SELECT k.Id
+	FROM legal_holds h
+	JOIN kunjungan k ON k.IdPasien = h.IdPasien
+	WHERE ` + activeLegalHold
+
+	rows, err := repo.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	held := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		held[id] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return held, nil
+}
+
+func (repo *legalHoldRepository) CreateLegalHold(ctx context.Context, hold *models.LegalHold) (*models.LegalHold, error) {
+	query := `
+	INSERT INTO legal_holds(IdPasien, IdKunjungan, Reason, PlacedBy, PlacedAt, ExpiresAt)
+	VALUES (?,?,?,?,?,?)
+	`
+
+	hold.PlacedAt = time.Now()
+	result, err := repo.db.ExecContext(ctx, query, hold.IDPasien, hold.IDKunjungan, hold.Reason, hold.PlacedBy, hold.PlacedAt, hold.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	hold.ID = int(id)
+
+	return hold, nil
+}
+
+func (repo *legalHoldRepository) ReleaseLegalHold(ctx context.Context, id, releasedBy int) error {
+	query := `UPDATE legal_holds SET ReleasedBy = ?, ReleasedAt = ? WHERE Id = ? AND ReleasedAt IS NULL`
+	_, err := repo.db.ExecContext(ctx, query, releasedBy, time.Now(), id)
+	return err
+}
+
+func queryLegalHolds(ctx context.Context, q queryer, query string, args ...interface{}) ([]*models.LegalHold, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holds []*models.LegalHold
+	for rows.Next() {
+		hold, err := scanLegalHold(rows)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return holds, nil
+}
+
+func scanLegalHold(row rowScanner) (*models.LegalHold, error) {
+	var hold models.LegalHold
+	var idPasien, idKunjungan, releasedBy sql.NullInt64
+	var expiresAt, releasedAt sql.NullTime
+
+	err := row.Scan(
+		&hold.ID,
+		&idPasien,
+		&idKunjungan,
+		&hold.Reason,
+		&hold.PlacedBy,
+		&hold.PlacedAt,
+		&expiresAt,
+		&releasedBy,
+		&releasedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if idPasien.Valid {
+		id := int(idPasien.Int64)
+		hold.IDPasien = &id
+	}
+	if idKunjungan.Valid {
+		id := int(idKunjungan.Int64)
+		hold.IDKunjungan = &id
+	}
+	if releasedBy.Valid {
+		id := int(releasedBy.Int64)
+		hold.ReleasedBy = &id
+	}
+	if expiresAt.Valid {
+		hold.ExpiresAt = &expiresAt.Time
+	}
+	if releasedAt.Valid {
+		hold.ReleasedAt = &releasedAt.Time
+	}
+
+	return &hold, nil
+}
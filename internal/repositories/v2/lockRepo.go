@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+var ErrLockNotAcquired = errors.New("Lock is held by another instance")
+
+type LockRepository interface {
+	AcquireLock(ctx context.Context, name string) (*Lock, error)
+}
+
+type lockRepository struct {
+	db *sql.DB
+}
+
+func NewRepoLock(db *sql.DB) LockRepository {
+	return &lockRepository{
+		db: db,
+	}
+}
+
+// Lock is a MySQL named lock. GET_LOCK is bound to the session that took it,
+// so the connection is kept out of the pool until Release.
+type Lock struct {
+	name string
+	conn *sql.Conn
+}
+
+// AcquireLock takes the named lock without waiting. It returns
+// ErrLockNotAcquired when another session, on any instance, already holds it.
+func (repo *lockRepository) AcquireLock(ctx context.Context, name string) (*Lock, error) {
+	conn, err := repo.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", name).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if !acquired.Valid || acquired.Int64 != 1 {
+		conn.Close()
+		return nil, ErrLockNotAcquired
+	}
+
+	return &Lock{name: name, conn: conn}, nil
+}
+
+func (lock *Lock) Release(ctx context.Context) error {
+	defer lock.conn.Close()
+
+	_, err := lock.conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", lock.name)
+	return err
+}
@@ -0,0 +1,88 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+)
+
+type LoginAttemptRepository interface {
+	Get(ctx context.Context, scope, identifier string) (*models.LoginAttempt, error)
+	RecordFailure(ctx context.Context, scope, identifier string, failedAt, resetBefore time.Time) (*models.LoginAttempt, error)
+	Lock(ctx context.Context, scope, identifier string, until time.Time) error
+	Clear(ctx context.Context, scope, identifier string) (bool, error)
+}
+
+type loginAttemptRepository struct {
+	db *sql.DB
+}
+
+func NewRepoLoginAttempt(db *sql.DB) LoginAttemptRepository {
+	return &loginAttemptRepository{
+		db: db,
+	}
+}
+
+func (repo *loginAttemptRepository) Get(ctx context.Context, scope, identifier string) (*models.LoginAttempt, error) {
+	query := `
+	SELECT Scope, Identifier, Failures, LastFailedAt, LockedUntil
+	FROM login_attempts
+	WHERE Scope = ? AND Identifier = ?
+	`
+
+	var attempt models.LoginAttempt
+	err := repo.db.QueryRowContext(ctx, query, scope, identifier).Scan(
+		&attempt.Scope,
+		&attempt.Identifier,
+		&attempt.Failures,
+		&attempt.LastFailedAt,
+		&attempt.LockedUntil,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &attempt, nil
+}
+
+// RecordFailure adds one failure to the counter and returns the new state.
+// A counter whose last failure is older than resetBefore starts over at one.
+// Failures is assigned before LastFailedAt, so the IF still sees the old value.
+func (repo *loginAttemptRepository) RecordFailure(ctx context.Context, scope, identifier string, failedAt, resetBefore time.Time) (*models.LoginAttempt, error) {
+	query := `
+	INSERT INTO login_attempts (Scope, Identifier, Failures, LastFailedAt)
+	VALUES (?, ?, 1, ?)
+	ON DUPLICATE KEY UPDATE
+		Failures = IF(LastFailedAt < ?, 1, Failures + 1),
+		LastFailedAt = VALUES(LastFailedAt)
+	`
+	if _, err := repo.db.ExecContext(ctx, query, scope, identifier, failedAt, resetBefore); err != nil {
+		return nil, err
+	}
+
+	return repo.Get(ctx, scope, identifier)
+}
+
+func (repo *loginAttemptRepository) Lock(ctx context.Context, scope, identifier string, until time.Time) error {
+	query := `UPDATE login_attempts SET LockedUntil = ? WHERE Scope = ? AND Identifier = ?`
+	_, err := repo.db.ExecContext(ctx, query, until, scope, identifier)
+	return err
+}
+
+// Clear drops the counter and any lock. It reports whether a row existed.
+func (repo *loginAttemptRepository) Clear(ctx context.Context, scope, identifier string) (bool, error) {
+	query := `DELETE FROM login_attempts WHERE Scope = ? AND Identifier = ?`
+	result, err := repo.db.ExecContext(ctx, query, scope, identifier)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+)
+
+type LoginChallengeRepository interface {
+	Create(ctx context.Context, challenge models.LoginChallenge) error
+	IsOpen(ctx context.Context, id string, idUser int, now time.Time) (bool, error)
+	Consume(ctx context.Context, id string, idUser int, now time.Time) (bool, error)
+}
+
+type loginChallengeRepository struct {
+	db *sql.DB
+}
+
+func NewRepoLoginChallenge(db *sql.DB) LoginChallengeRepository {
+	return &loginChallengeRepository{
+		db: db,
+	}
+}
+
+// Create stores a new challenge and drops the ones that have expired, which
+// keeps the table small without a separate cleanup job.
+func (repo *loginChallengeRepository) Create(ctx context.Context, challenge models.LoginChallenge) error {
+	if _, err := repo.db.ExecContext(ctx, `DELETE FROM login_challenges WHERE ExpiresAt < ?`, challenge.CreatedAt); err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO login_challenges (Id, IdUser, CreatedAt, ExpiresAt)
+	VALUES (?, ?, ?, ?)
+	`
+	_, err := repo.db.ExecContext(ctx, query, challenge.ID, challenge.IDUser, challenge.CreatedAt, challenge.ExpiresAt)
+	return err
+}
+
+func (repo *loginChallengeRepository) IsOpen(ctx context.Context, id string, idUser int, now time.Time) (bool, error) {
+	query := `
+	SELECT COUNT(*) FROM login_challenges
+	WHERE Id = ? AND IdUser = ? AND UsedAt IS NULL AND ExpiresAt > ?
+	`
+
+	var count int
+	err := repo.db.QueryRowContext(ctx, query, id, idUser, now).Scan(&count)
+	return count > 0, err
+}
+
+// Consume marks the challenge used. It reports false if it was already used
+// or has expired, so only one login can complete per challenge.
+func (repo *loginChallengeRepository) Consume(ctx context.Context, id string, idUser int, now time.Time) (bool, error) {
+	query := `
+	UPDATE login_challenges SET UsedAt = ?
+	WHERE Id = ? AND IdUser = ? AND UsedAt IS NULL AND ExpiresAt > ?
+	`
+	result, err := repo.db.ExecContext(ctx, query, now, id, idUser, now)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
@@ -0,0 +1,107 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+)
+
+type PasswordResetRepository interface {
+	Create(ctx context.Context, reset models.PasswordReset) (int, error)
+	GetByTokenHash(ctx context.Context, tokenHash string) (*models.PasswordReset, error)
+	MarkUsed(ctx context.Context, id int) (bool, error)
+	MarkUsedTx(ctx context.Context, tx *sql.Tx, id int) (bool, error)
+	InvalidateForUser(ctx context.Context, idUser int) error
+	InvalidateForUserTx(ctx context.Context, tx *sql.Tx, idUser int) error
+}
+
+type passwordResetRepository struct {
+	db *sql.DB
+}
+
+func NewRepoPasswordReset(db *sql.DB) PasswordResetRepository {
+	return &passwordResetRepository{
+		db: db,
+	}
+}
+
+func (repo *passwordResetRepository) Create(ctx context.Context, reset models.PasswordReset) (int, error) {
+	query := `
+	INSERT INTO password_resets (IdUser, TokenHash, Ip, CreatedAt, ExpiresAt)
+	VALUES (?, ?, ?, ?, ?)
+	`
+	result, err := repo.db.ExecContext(ctx, query, reset.IDUser, reset.TokenHash, reset.IP, reset.CreatedAt, reset.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+func (repo *passwordResetRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	query := `
+	SELECT Id, IdUser, TokenHash, COALESCE(Ip, ''), CreatedAt, ExpiresAt, UsedAt
+	FROM password_resets
+	WHERE TokenHash = ?
+	`
+
+	var reset models.PasswordReset
+	err := repo.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&reset.ID,
+		&reset.IDUser,
+		&reset.TokenHash,
+		&reset.IP,
+		&reset.CreatedAt,
+		&reset.ExpiresAt,
+		&reset.UsedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &reset, nil
+}
+
+// MarkUsed spends the token. It returns false if the token was already used,
+// so two requests with the same token cannot both reset the password.
+func (repo *passwordResetRepository) MarkUsed(ctx context.Context, id int) (bool, error) {
+	return markPasswordResetUsed(ctx, repo.db, id)
+}
+
+func (repo *passwordResetRepository) MarkUsedTx(ctx context.Context, tx *sql.Tx, id int) (bool, error) {
+	return markPasswordResetUsed(ctx, tx, id)
+}
+
+func markPasswordResetUsed(ctx context.Context, q queryer, id int) (bool, error) {
+	result, err := q.ExecContext(ctx, `UPDATE password_resets SET UsedAt = ? WHERE Id = ? AND UsedAt IS NULL`, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// InvalidateForUser spends every outstanding token of a user.
+func (repo *passwordResetRepository) InvalidateForUser(ctx context.Context, idUser int) error {
+	_, err := repo.db.ExecContext(ctx, invalidatePasswordResetsQuery, time.Now(), idUser)
+	return err
+}
+
+func (repo *passwordResetRepository) InvalidateForUserTx(ctx context.Context, tx *sql.Tx, idUser int) error {
+	_, err := tx.ExecContext(ctx, invalidatePasswordResetsQuery, time.Now(), idUser)
+	return err
+}
+
+const invalidatePasswordResetsQuery = `UPDATE password_resets SET UsedAt = ? WHERE IdUser = ? AND UsedAt IS NULL`
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/lifecycle"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
 )
 
@@ -17,8 +18,11 @@ type PemusnahanRepository interface {
 	GetTotalPemusnahan(ctx context.Context) (int, error)
 	CreatePemusnahan(ctx context.Context, pemusnahan *models.Pemusnahan) (*models.Pemusnahan, error)
 	UpdatePemusnahan(ctx context.Context, pemusnahan models.Pemusnahan) (*models.Pemusnahan, error)
+	UpdatePemusnahanTx(ctx context.Context, tx *sql.Tx, pemusnahan models.Pemusnahan) error
 	DeletePemusnahan(ctx context.Context, id int) error
+	DeletePemusnahanTx(ctx context.Context, tx *sql.Tx, id int) error
 	GetAllPemusnahanForExport(ctx context.Context) ([]*models.PemusnahanJoin, error)
+	GetPemusnahanByBatch(ctx context.Context, idBatch int) ([]*models.PemusnahanJoin, error)
 }
 
 type pemusnahanRepository struct {
@@ -38,11 +42,11 @@ func (repo *pemusnahanRepository) GetStatistikPemusnahan(ctx context.Context) (i
 		return 0, 0, 0, err
 	}
 
-	if err := repo.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pemusnahan WHERE Status = 'Sudah dimusnahkan'`).Scan(&sudah); err != nil {
+	if err := repo.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pemusnahan WHERE Status = ?`, lifecycle.PemusnahanSudah).Scan(&sudah); err != nil {
 		return 0, 0, 0, err
 	}
 
-	if err := repo.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pemusnahan WHERE Status = 'Belum dimusnahkan'`).Scan(&belum); err != nil {
+	if err := repo.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pemusnahan WHERE Status = ?`, lifecycle.PemusnahanBelum).Scan(&belum); err != nil {
 		return 0, 0, 0, err
 	}
 
@@ -341,6 +345,22 @@ func (repo *pemusnahanRepository) UpdatePemusnahan(ctx context.Context, pemusnah
 	return &pemusnahan, nil
 }
 
+func (repo *pemusnahanRepository) UpdatePemusnahanTx(ctx context.Context, tx *sql.Tx, pemusnahan models.Pemusnahan) error {
+	query := `
+	UPDATE pemusnahan
+	SET TglLaporan = ?, Status = ?
+	WHERE Id = ?
+	`
+
+	_, err := tx.ExecContext(ctx, query, pemusnahan.TglLaporan, pemusnahan.Status, pemusnahan.ID)
+	return err
+}
+
+func (repo *pemusnahanRepository) DeletePemusnahanTx(ctx context.Context, tx *sql.Tx, id int) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM pemusnahan WHERE Id = ?`, id)
+	return err
+}
+
 func (repo *pemusnahanRepository) DeletePemusnahan(ctx context.Context, id int) error {
 	query := `
 	DELETE FROM pemusnahan
@@ -425,3 +445,80 @@ func (repo *pemusnahanRepository) GetAllPemusnahanForExport(ctx context.Context)
 
 	return result, nil
 }
+
+func (repo *pemusnahanRepository) GetPemusnahanByBatch(ctx context.Context, idBatch int) ([]*models.PemusnahanJoin, error) {
+	query := `
+		SELECT
+			pemusnahan.Id AS Id,
+			pemusnahan.TglLaporan,
+			pemusnahan.Status,
+			kunjungan.TglMasuk,
+			kunjungan.JenisKunjungan,
+			pasien.NoRM,
+			pasien.NamaPasien,
+			pasien.JenisKelamin,
+			pasien.TglLahir,
+			pasien.Alamat,
+			pasien.Status AS StatusPasien,
+			kasus.JenisKasus,
+			kasus.MasaAktifRi,
+			kasus.MasaInaktifRi,
+			kasus.MasaAktifRj,
+			kasus.MasaInaktifRj,
+			kasus.InfoLain
+		FROM destruction_batch_items
+		INNER JOIN pemusnahan ON pemusnahan.Id = destruction_batch_items.IdKunjungan
+		INNER JOIN kunjungan ON kunjungan.Id = pemusnahan.Id
+		INNER JOIN pasien ON pasien.Id = kunjungan.IdPasien
+		INNER JOIN kasus ON kasus.Id = kunjungan.IdKasus
+		WHERE destruction_batch_items.IdBatch = ?
+		ORDER BY pasien.NoRM ASC, kunjungan.TglMasuk ASC
+	`
+
+	rows, err := repo.db.QueryContext(ctx, query, idBatch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*models.PemusnahanJoin
+	for rows.Next() {
+		var pm models.PemusnahanJoin
+		var tglLaporan sql.NullTime
+
+		err := rows.Scan(
+			&pm.ID,
+			&tglLaporan,
+			&pm.Status,
+			&pm.TglMasuk,
+			&pm.JenisKunjungan,
+			&pm.NoRM,
+			&pm.NamaPasien,
+			&pm.JenisKelamin,
+			&pm.TglLahir,
+			&pm.Alamat,
+			&pm.StatusPasien,
+			&pm.JenisKasus,
+			&pm.MasaAktifRi,
+			&pm.MasaInaktifRi,
+			&pm.MasaAktifRj,
+			&pm.MasaInaktifRj,
+			&pm.InfoLain,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if tglLaporan.Valid {
+			pm.TglLaporan = &tglLaporan.Time
+		}
+
+		result = append(result, &pm)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
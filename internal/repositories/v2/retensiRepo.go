@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/lifecycle"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
 )
 
@@ -37,11 +38,11 @@ func (repo *retensiRepository) GetStatistikRetensi(ctx context.Context) (int, in
 		return 0, 0, 0, err
 	}
 
-	if err := repo.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM retensi WHERE Status = 'Sudah diretensi'`).Scan(&sudah); err != nil {
+	if err := repo.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM retensi WHERE Status = ?`, lifecycle.RetensiSudah).Scan(&sudah); err != nil {
 		return 0, 0, 0, err
 	}
 
-	if err := repo.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM retensi WHERE Status = 'Belum diretensi'`).Scan(&belum); err != nil {
+	if err := repo.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM retensi WHERE Status = ?`, lifecycle.RetensiBelum).Scan(&belum); err != nil {
 		return 0, 0, 0, err
 	}
 
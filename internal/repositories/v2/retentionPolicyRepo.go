@@ -0,0 +1,84 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+)
+
+type RetentionPolicyRepository interface {
+	GetPolicyByKasus(ctx context.Context, idKasus int) (*models.RetentionPolicy, error)
+	UpsertPolicy(ctx context.Context, policy models.RetentionPolicy) (*models.RetentionPolicy, error)
+	DeletePolicy(ctx context.Context, idKasus int) error
+}
+
+type retentionPolicyRepository struct {
+	db *sql.DB
+}
+
+func NewRepoRetentionPolicy(db *sql.DB) RetentionPolicyRepository {
+	return &retentionPolicyRepository{
+		db: db,
+	}
+}
+
+func (repo *retentionPolicyRepository) GetPolicyByKasus(ctx context.Context, idKasus int) (*models.RetentionPolicy, error) {
+	query := `
+	SELECT IdKasus, PeriodUnit, Permanent, AdultAge, MinorRetainYears, UpdatedAt
+	FROM kasus_retention_policy
+	WHERE IdKasus = ?
+	LIMIT 1
+	`
+
+	var policy models.RetentionPolicy
+	err := repo.db.QueryRowContext(ctx, query, idKasus).Scan(
+		&policy.IDKasus,
+		&policy.PeriodUnit,
+		&policy.Permanent,
+		&policy.AdultAge,
+		&policy.MinorRetainYears,
+		&policy.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+func (repo *retentionPolicyRepository) UpsertPolicy(ctx context.Context, policy models.RetentionPolicy) (*models.RetentionPolicy, error) {
+	query := `
+	INSERT INTO kasus_retention_policy(IdKasus, PeriodUnit, Permanent, AdultAge, MinorRetainYears)
+	VALUES (?,?,?,?,?)
+	ON DUPLICATE KEY UPDATE
+		PeriodUnit = VALUES(PeriodUnit),
+		Permanent = VALUES(Permanent),
+		AdultAge = VALUES(AdultAge),
+		MinorRetainYears = VALUES(MinorRetainYears)
+	`
+
+	_, err := repo.db.ExecContext(
+		ctx,
+		query,
+		policy.IDKasus,
+		policy.PeriodUnit,
+		policy.Permanent,
+		policy.AdultAge,
+		policy.MinorRetainYears,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.GetPolicyByKasus(ctx, policy.IDKasus)
+}
+
+func (repo *retentionPolicyRepository) DeletePolicy(ctx context.Context, idKasus int) error {
+	_, err := repo.db.ExecContext(ctx, `DELETE FROM kasus_retention_policy WHERE IdKasus = ?`, idKasus)
+	return err
+}
@@ -0,0 +1,203 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+)
+
+type RoleRepository interface {
+	GetAllRoles(ctx context.Context) ([]*models.Role, error)
+	GetRoleByName(ctx context.Context, name string) (*models.Role, error)
+	GetRolePermissions(ctx context.Context) (map[string][]string, error)
+	CreateRole(ctx context.Context, role models.Role) error
+	UpdateRole(ctx context.Context, role models.Role) error
+	SetRequireTwoFactor(ctx context.Context, name string, required bool) error
+	DeleteRole(ctx context.Context, name string) error
+}
+
+type roleRepository struct {
+	db *sql.DB
+}
+
+func NewRepoRole(db *sql.DB) RoleRepository {
+	return &roleRepository{
+		db: db,
+	}
+}
+
+const roleColumns = `r.Name, r.Description, r.IsSystem, r.RequireTwoFactor, r.CreatedAt, (SELECT COUNT(*) FROM users u WHERE u.Role = r.Name)`
+
+func (repo *roleRepository) GetAllRoles(ctx context.Context) ([]*models.Role, error) {
+	rows, err := repo.db.QueryContext(ctx, `SELECT `+roleColumns+` FROM roles r ORDER BY r.Name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []*models.Role
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	permissions, err := repo.GetRolePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, role := range roles {
+		role.Permissions = permissions[role.Name]
+	}
+
+	return roles, nil
+}
+
+func (repo *roleRepository) GetRoleByName(ctx context.Context, name string) (*models.Role, error) {
+	role, err := scanRole(repo.db.QueryRowContext(ctx, `SELECT `+roleColumns+` FROM roles r WHERE r.Name = ?`, name))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	rows, err := repo.db.QueryContext(ctx, `SELECT Permission FROM role_permissions WHERE Role = ? ORDER BY Permission`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		role.Permissions = append(role.Permissions, permission)
+	}
+
+	return role, rows.Err()
+}
+
+// GetRolePermissions returns the permissions granted to each role. Roles
+// without any permission are included with an empty list.
+func (repo *roleRepository) GetRolePermissions(ctx context.Context) (map[string][]string, error) {
+	query := `
+	SELECT r.Name, rp.Permission
+	FROM roles r
+	LEFT JOIN role_permissions rp ON rp.Role = r.Name
+	ORDER BY r.Name, rp.Permission
+	`
+	rows, err := repo.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := make(map[string][]string)
+	for rows.Next() {
+		var role string
+		var permission sql.NullString
+		if err := rows.Scan(&role, &permission); err != nil {
+			return nil, err
+		}
+
+		if _, ok := permissions[role]; !ok {
+			permissions[role] = []string{}
+		}
+		if permission.Valid {
+			permissions[role] = append(permissions[role], permission.String)
+		}
+	}
+
+	return permissions, rows.Err()
+}
+
+func (repo *roleRepository) CreateRole(ctx context.Context, role models.Role) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO roles (Name, Description, RequireTwoFactor) VALUES (?, ?, ?)`, role.Name, role.Description, role.RequireTwoFactor)
+	if err != nil {
+		return err
+	}
+
+	if err := insertRolePermissions(ctx, tx, role.Name, role.Permissions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateRole replaces the description and the full permission set of a role.
+func (repo *roleRepository) UpdateRole(ctx context.Context, role models.Role) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE roles SET Description = ? WHERE Name = ?`, role.Description, role.Name)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE Role = ?`, role.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := insertRolePermissions(ctx, tx, role.Name, role.Permissions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (repo *roleRepository) SetRequireTwoFactor(ctx context.Context, name string, required bool) error {
+	_, err := repo.db.ExecContext(ctx, `UPDATE roles SET RequireTwoFactor = ? WHERE Name = ?`, required, name)
+	return err
+}
+
+func (repo *roleRepository) DeleteRole(ctx context.Context, name string) error {
+	_, err := repo.db.ExecContext(ctx, `DELETE FROM roles WHERE Name = ?`, name)
+	return err
+}
+
+func insertRolePermissions(ctx context.Context, tx *sql.Tx, role string, permissions []string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, 0, len(permissions))
+	args := make([]interface{}, 0, len(permissions)*2)
+	for _, permission := range permissions {
+		placeholders = append(placeholders, "(?, ?)")
+		args = append(args, role, permission)
+	}
+
+	query := `INSERT INTO role_permissions (Role, Permission) VALUES ` + strings.Join(placeholders, ", ")
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func scanRole(row rowScanner) (*models.Role, error) {
+	var role models.Role
+	err := row.Scan(&role.Name, &role.Description, &role.IsSystem, &role.RequireTwoFactor, &role.CreatedAt, &role.Users)
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
@@ -0,0 +1,151 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+)
+
+type SessionRepository interface {
+	Create(ctx context.Context, session models.UserSession) error
+	GetByID(ctx context.Context, id string) (*models.UserSession, error)
+	Rotate(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) (bool, error)
+	IsActive(ctx context.Context, id string, idUser int, now time.Time) (bool, error)
+	ActiveRole(ctx context.Context, id string, idUser int, now time.Time) (string, error)
+	Revoke(ctx context.Context, id string) error
+	RevokeByUser(ctx context.Context, idUser int) (int64, error)
+}
+
+type sessionRepository struct {
+	db *sql.DB
+}
+
+func NewRepoSession(db *sql.DB) SessionRepository {
+	return &sessionRepository{
+		db: db,
+	}
+}
+
+func (repo *sessionRepository) Create(ctx context.Context, session models.UserSession) error {
+	query := `
+	INSERT INTO user_sessions (Id, IdUser, TokenHash, Ip, CreatedAt, ExpiresAt)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`
+	_, err := repo.db.ExecContext(ctx, query,
+		session.ID,
+		session.IDUser,
+		session.TokenHash,
+		session.IP,
+		session.CreatedAt,
+		session.ExpiresAt,
+	)
+	return err
+}
+
+func (repo *sessionRepository) GetByID(ctx context.Context, id string) (*models.UserSession, error) {
+	query := `
+	SELECT Id, IdUser, TokenHash, COALESCE(Ip, ''), CreatedAt, LastUsedAt, ExpiresAt, RevokedAt
+	FROM user_sessions
+	WHERE Id = ?
+	`
+
+	var session models.UserSession
+	err := repo.db.QueryRowContext(ctx, query, id).Scan(
+		&session.ID,
+		&session.IDUser,
+		&session.TokenHash,
+		&session.IP,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// Rotate swaps the refresh token hash only if oldHash is still the current
+// one, so two requests racing with the same refresh token cannot both win.
+func (repo *sessionRepository) Rotate(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) (bool, error) {
+	query := `
+	UPDATE user_sessions
+	SET TokenHash = ?, LastUsedAt = ?, ExpiresAt = ?
+	WHERE Id = ? AND TokenHash = ? AND RevokedAt IS NULL
+	`
+	result, err := repo.db.ExecContext(ctx, query, newHash, time.Now(), expiresAt, id, oldHash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// IsActive reports whether the session belongs to idUser, has not been
+// revoked or expired, and the user is still active.
+func (repo *sessionRepository) IsActive(ctx context.Context, id string, idUser int, now time.Time) (bool, error) {
+	query := `
+	SELECT COUNT(*)
+	FROM user_sessions s
+	JOIN users u ON u.Id = s.IdUser
+	WHERE s.Id = ? AND s.IdUser = ? AND s.RevokedAt IS NULL AND s.ExpiresAt > ? AND u.Status = 'aktif'
+	`
+
+	var count int
+	if err := repo.db.QueryRowContext(ctx, query, id, idUser, now).Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// ActiveRole returns the current role of idUser if the session passes the
+// same checks as IsActive, and "" otherwise.
+func (repo *sessionRepository) ActiveRole(ctx context.Context, id string, idUser int, now time.Time) (string, error) {
+	query := `
+	SELECT u.Role
+	FROM user_sessions s
+	JOIN users u ON u.Id = s.IdUser
+	WHERE s.Id = ? AND s.IdUser = ? AND s.RevokedAt IS NULL AND s.ExpiresAt > ? AND u.Status = 'aktif'
+	`
+
+	var role string
+	err := repo.db.QueryRowContext(ctx, query, id, idUser, now).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return role, nil
+}
+
+func (repo *sessionRepository) Revoke(ctx context.Context, id string) error {
+	query := `UPDATE user_sessions SET RevokedAt = ? WHERE Id = ? AND RevokedAt IS NULL`
+	_, err := repo.db.ExecContext(ctx, query, time.Now(), id)
+	return err
+}
+
+func (repo *sessionRepository) RevokeByUser(ctx context.Context, idUser int) (int64, error) {
+	query := `UPDATE user_sessions SET RevokedAt = ? WHERE IdUser = ? AND RevokedAt IS NULL`
+	result, err := repo.db.ExecContext(ctx, query, time.Now(), idUser)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,192 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+)
+
+type TwoFactorRepository interface {
+	Get(ctx context.Context, idUser int) (*models.TwoFactor, error)
+	SavePending(ctx context.Context, idUser int, secret string) error
+	Enable(ctx context.Context, idUser int, step int64, codeHashes []string) error
+	UseStep(ctx context.Context, idUser int, step int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, idUser int, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, idUser int, codeHash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, idUser int) (int, error)
+	Delete(ctx context.Context, idUser int) error
+}
+
+type twoFactorRepository struct {
+	db *sql.DB
+}
+
+func NewRepoTwoFactor(db *sql.DB) TwoFactorRepository {
+	return &twoFactorRepository{
+		db: db,
+	}
+}
+
+func (repo *twoFactorRepository) Get(ctx context.Context, idUser int) (*models.TwoFactor, error) {
+	query := `
+	SELECT IdUser, Secret, EnabledAt, LastUsedStep, CreatedAt
+	FROM user_two_factor
+	WHERE IdUser = ?
+	`
+
+	var twoFactor models.TwoFactor
+	err := repo.db.QueryRowContext(ctx, query, idUser).Scan(
+		&twoFactor.IDUser,
+		&twoFactor.Secret,
+		&twoFactor.EnabledAt,
+		&twoFactor.LastUsedStep,
+		&twoFactor.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &twoFactor, nil
+}
+
+// SavePending stores a new secret awaiting confirmation. An enabled second
+// factor is left untouched.
+func (repo *twoFactorRepository) SavePending(ctx context.Context, idUser int, secret string) error {
+	query := `
+	INSERT INTO user_two_factor (IdUser, Secret, CreatedAt)
+	VALUES (?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+		Secret = IF(EnabledAt IS NULL, VALUES(Secret), Secret),
+		CreatedAt = IF(EnabledAt IS NULL, VALUES(CreatedAt), CreatedAt)
+	`
+	_, err := repo.db.ExecContext(ctx, query, idUser, secret, time.Now())
+	return err
+}
+
+// Enable confirms a pending secret, records step as used and stores the
+// first set of recovery codes.
+func (repo *twoFactorRepository) Enable(ctx context.Context, idUser int, step int64, codeHashes []string) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+	UPDATE user_two_factor SET EnabledAt = ?, LastUsedStep = ?
+	WHERE IdUser = ? AND EnabledAt IS NULL
+	`, time.Now(), step, idUser)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("Two-factor authentication is not pending")
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, idUser, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseStep records step as the last accepted code. It reports false when a
+// code from that step or a later one was already used.
+func (repo *twoFactorRepository) UseStep(ctx context.Context, idUser int, step int64) (bool, error) {
+	query := `
+	UPDATE user_two_factor SET LastUsedStep = ?
+	WHERE IdUser = ? AND EnabledAt IS NOT NULL AND LastUsedStep < ?
+	`
+	result, err := repo.db.ExecContext(ctx, query, step, idUser, step)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (repo *twoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, idUser int, codeHashes []string) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, idUser, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (repo *twoFactorRepository) UseRecoveryCode(ctx context.Context, idUser int, codeHash string) (bool, error) {
+	query := `
+	UPDATE recovery_codes SET UsedAt = ?
+	WHERE IdUser = ? AND CodeHash = ? AND UsedAt IS NULL
+	`
+	result, err := repo.db.ExecContext(ctx, query, time.Now(), idUser, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (repo *twoFactorRepository) CountRecoveryCodes(ctx context.Context, idUser int) (int, error) {
+	query := `SELECT COUNT(*) FROM recovery_codes WHERE IdUser = ? AND UsedAt IS NULL`
+
+	var count int
+	err := repo.db.QueryRowContext(ctx, query, idUser).Scan(&count)
+	return count, err
+}
+
+func (repo *twoFactorRepository) Delete(ctx context.Context, idUser int) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE IdUser = ?`, idUser); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_two_factor WHERE IdUser = ?`, idUser); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, idUser int, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE IdUser = ?`, idUser); err != nil {
+		return err
+	}
+	if len(codeHashes) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, 0, len(codeHashes))
+	args := make([]interface{}, 0, len(codeHashes)*2)
+	for _, hash := range codeHashes {
+		placeholders = append(placeholders, "(?, ?)")
+		args = append(args, idUser, hash)
+	}
+
+	query := `INSERT INTO recovery_codes (IdUser, CodeHash) VALUES ` + strings.Join(placeholders, ", ")
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,47 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Transactor runs a group of repository writes in one database transaction.
+// Repository methods with a Tx suffix take the *sql.Tx handed to fn.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(tx *sql.Tx) error) error
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx, so a query can be shared
+// between a repository method and its Tx variant.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type transactor struct {
+	db *sql.DB
+}
+
+func NewTransactor(db *sql.DB) Transactor {
+	return &transactor{
+		db: db,
+	}
+}
+
+func (t *transactor) WithinTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
 )
@@ -18,6 +19,14 @@ type UserRepository interface {
 	UpdateStatus(ctx context.Context, user models.User) (*models.User, error)
 	UpdateProfile(ctx context.Context, user models.User) (*models.User, error)
 	UpdatePassword(ctx context.Context, id int, hashedPassword string) error
+	UpdatePasswordTx(ctx context.Context, tx *sql.Tx, id int, hashedPassword string) error
+	GetPendingUsers(ctx context.Context) ([]*models.User, error)
+	GetUnverifiedUsers(ctx context.Context, createdBefore time.Time) ([]*models.User, error)
+	GetActiveUsersWithPermission(ctx context.Context, permission string) ([]*models.User, error)
+	MarkEmailVerified(ctx context.Context, id int) error
+	Approve(ctx context.Context, id, approvedBy int) (*models.User, error)
+	DeletePending(ctx context.Context, id int) (bool, error)
+	DeleteUnverified(ctx context.Context, id int) (bool, error)
 }
 
 type userrepository struct {
@@ -33,7 +42,7 @@ func NewRepoUser(db *sql.DB) UserRepository {
 func (repo *userrepository) GetAllUsers(ctx context.Context, limit, offset int) ([]*models.User, error) {
 	query := `
 	SELECT
-		Id, Name, Email, Role, Status, CreatedAt
+		Id, Name, Email, Role, Status, SelfRegistered, EmailVerifiedAt, ApprovedAt, CreatedAt
 	FROM
 		users
 	LIMIT ?
@@ -58,6 +67,9 @@ func (repo *userrepository) GetAllUsers(ctx context.Context, limit, offset int)
 			&user.Email,
 			&user.Role,
 			&user.Status,
+			&user.SelfRegistered,
+			&user.EmailVerifiedAt,
+			&user.ApprovedAt,
 			&user.CreatedAt,
 		)
 		if err != nil {
@@ -87,7 +99,7 @@ func (repo *userrepository) GetTotalUsers(ctx context.Context) (int, error) {
 
 func (repo *userrepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
 	query := `
-	SELECT id, name, email, password, role, status
+	SELECT id, name, email, password, role, status, SelfRegistered, EmailVerifiedAt, ApprovedAt
 	FROM users
 	WHERE email = ?
 	LIMIT 1
@@ -95,7 +107,7 @@ func (repo *userrepository) GetByUsername(ctx context.Context, username string)
 	row := repo.db.QueryRowContext(ctx, query, username)
 
 	var user models.User
-	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Role, &user.Status)
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Role, &user.Status, &user.SelfRegistered, &user.EmailVerifiedAt, &user.ApprovedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -107,12 +119,12 @@ func (repo *userrepository) GetByUsername(ctx context.Context, username string)
 
 func (repo *userrepository) Create(ctx context.Context, user models.User) (*models.User, error) {
 	query := `
-	INSERT INTO users(name, email, password, role, status)
-	VALUES (?, ?, ?, ?, ?)
+	INSERT INTO users(name, email, password, role, status, SelfRegistered, EmailVerifiedAt, ApprovedAt)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	user.Status = "tidak aktif"
-	result, err := repo.db.ExecContext(ctx, query, user.Name, user.Email, user.Password, user.Role, user.Status)
+	result, err := repo.db.ExecContext(ctx, query, user.Name, user.Email, user.Password, user.Role, user.Status, user.SelfRegistered, user.EmailVerifiedAt, user.ApprovedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -200,11 +212,11 @@ func (repo *userrepository) UpdateStatus(ctx context.Context, user models.User)
 // }
 
 func (repo *userrepository) GetByID(ctx context.Context, id int) (*models.User, error) {
-	query := `SELECT id, name, email, password, role, status FROM users WHERE id = ? LIMIT 1`
+	query := `SELECT id, name, email, password, role, status, SelfRegistered, EmailVerifiedAt, ApprovedAt FROM users WHERE id = ? LIMIT 1`
 	row := repo.db.QueryRowContext(ctx, query, id)
 
 	var user models.User
-	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Role, &user.Status)
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Role, &user.Status, &user.SelfRegistered, &user.EmailVerifiedAt, &user.ApprovedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -236,3 +248,133 @@ func (repo *userrepository) UpdatePassword(ctx context.Context, id int, hashedPa
 	_, err := repo.db.ExecContext(ctx, query, hashedPassword, id)
 	return err
 }
+
+func (repo *userrepository) UpdatePasswordTx(ctx context.Context, tx *sql.Tx, id int, hashedPassword string) error {
+	_, err := tx.ExecContext(ctx, `UPDATE users SET password = ? WHERE id = ?`, hashedPassword, id)
+	return err
+}
+
+// GetPendingUsers returns self-registrations that have verified their email
+// and are waiting for an admin, oldest first.
+func (repo *userrepository) GetPendingUsers(ctx context.Context) ([]*models.User, error) {
+	query := `
+	SELECT Id, Name, Email, Role, Status, SelfRegistered, EmailVerifiedAt, ApprovedAt, CreatedAt
+	FROM users
+	WHERE SelfRegistered = 1 AND EmailVerifiedAt IS NOT NULL AND ApprovedAt IS NULL
+	ORDER BY EmailVerifiedAt ASC
+	`
+	return repo.queryUsers(ctx, query)
+}
+
+// GetUnverifiedUsers returns registrations created before createdBefore that
+// never verified their email.
+func (repo *userrepository) GetUnverifiedUsers(ctx context.Context, createdBefore time.Time) ([]*models.User, error) {
+	query := `
+	SELECT Id, Name, Email, Role, Status, SelfRegistered, EmailVerifiedAt, ApprovedAt, CreatedAt
+	FROM users
+	WHERE SelfRegistered = 1 AND EmailVerifiedAt IS NULL AND ApprovedAt IS NULL AND CreatedAt < ?
+	ORDER BY Id ASC
+	`
+	return repo.queryUsers(ctx, query, createdBefore)
+}
+
+// GetActiveUsersWithPermission returns active users whose role grants
+// permission. Admins have every permission.
+func (repo *userrepository) GetActiveUsersWithPermission(ctx context.Context, permission string) ([]*models.User, error) {
+	query := `
+	SELECT u.Id, u.Name, u.Email, u.Role, u.Status, u.SelfRegistered, u.EmailVerifiedAt, u.ApprovedAt, u.CreatedAt
+	FROM users u
+	WHERE u.Status = 'aktif'
+	AND (u.Role = 'admin' OR EXISTS (
+		SELECT 1 FROM role_permissions rp WHERE rp.Role = u.Role AND rp.Permission = ?
+	))
+	ORDER BY u.Id ASC
+	`
+	return repo.queryUsers(ctx, query, permission)
+}
+
+func (repo *userrepository) MarkEmailVerified(ctx context.Context, id int) error {
+	_, err := repo.db.ExecContext(ctx, `UPDATE users SET EmailVerifiedAt = ? WHERE Id = ? AND EmailVerifiedAt IS NULL`, time.Now(), id)
+	return err
+}
+
+func (repo *userrepository) Approve(ctx context.Context, id, approvedBy int) (*models.User, error) {
+	query := `
+	UPDATE users
+	SET Status = 'aktif', ApprovedAt = ?, ApprovedBy = ?
+	WHERE Id = ?
+	LIMIT 1
+	`
+	_, err := repo.db.ExecContext(ctx, query, time.Now(), approvedBy, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(ctx, id)
+}
+
+// DeletePending removes a verified self-registration that was never
+// approved. Any other user is left alone and false is returned.
+func (repo *userrepository) DeletePending(ctx context.Context, id int) (bool, error) {
+	query := `
+	DELETE FROM users
+	WHERE Id = ? AND SelfRegistered = 1 AND EmailVerifiedAt IS NOT NULL AND ApprovedAt IS NULL
+	`
+	result, err := repo.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// DeleteUnverified removes the user only if it is still an unverified
+// registration, so a user who verifies while the purge runs is kept.
+func (repo *userrepository) DeleteUnverified(ctx context.Context, id int) (bool, error) {
+	result, err := repo.db.ExecContext(ctx, `DELETE FROM users WHERE Id = ? AND SelfRegistered = 1 AND EmailVerifiedAt IS NULL AND ApprovedAt IS NULL`, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func (repo *userrepository) queryUsers(ctx context.Context, query string, args ...interface{}) ([]*models.User, error) {
+	rows, err := repo.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		var user models.User
+		err := rows.Scan(
+			&user.ID,
+			&user.Name,
+			&user.Email,
+			&user.Role,
+			&user.Status,
+			&user.SelfRegistered,
+			&user.EmailVerifiedAt,
+			&user.ApprovedAt,
+			&user.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+
+	return users, rows.Err()
+}
@@ -0,0 +1,107 @@
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type Unit string
+
+const (
+	UnitYear  Unit = "year"
+	UnitMonth Unit = "month"
+)
+
+const DefaultAdultAge = 18
+
+var ErrInvalidPolicy = errors.New("Invalid retention policy")
+
+// Policy refines how the masa aktif / masa inaktif of a kasus are applied.
+// The zero value is not valid; use Default for kasus without a policy.
+type Policy struct {
+	// Unit is the unit of the kasus masa aktif and masa inaktif.
+	Unit Unit
+	// Permanent records are archived as usual but never destroyed.
+	Permanent bool
+	// When MinorRetainYears is set, a visit made before the patient turned
+	// AdultAge is kept until AdultAge + MinorRetainYears, even if the kasus
+	// periods end earlier.
+	AdultAge         int
+	MinorRetainYears int
+}
+
+func Default() Policy {
+	return Policy{Unit: UnitYear, AdultAge: DefaultAdultAge}
+}
+
+func (p Policy) Validate() error {
+	if p.Unit != UnitYear && p.Unit != UnitMonth {
+		return fmt.Errorf("%w: unit must be %q or %q", ErrInvalidPolicy, UnitYear, UnitMonth)
+	}
+	if p.AdultAge < 0 || p.AdultAge > 25 {
+		return fmt.Errorf("%w: adult age must be between 0 and 25", ErrInvalidPolicy)
+	}
+	if p.MinorRetainYears < 0 {
+		return fmt.Errorf("%w: minor retain years cannot be negative", ErrInvalidPolicy)
+	}
+	return nil
+}
+
+// Schedule holds the dates at which a visit becomes due for each stage. A
+// record is inactivated when masa inaktif has passed since tglMasuk, as it
+// always has been, and is due for retensi when masa aktif has passed, but
+// never before it is inactivated: RetensiAt is the later of the two dates.
+// Pemusnahan is due after masa aktif + masa inaktif, which is never earlier
+// than either. PemusnahanAt is zero when the record is kept permanently.
+type Schedule struct {
+	InactiveAt   time.Time
+	RetensiAt    time.Time
+	PemusnahanAt time.Time
+	Permanent    bool
+}
+
+// Evaluate computes the schedule of a visit that started on tglMasuk, for a
+// patient born on tglLahir (zero if unknown), with the kasus periods masaAktif
+// and masaInaktif expressed in p.Unit.
+func (p Policy) Evaluate(tglMasuk, tglLahir time.Time, masaAktif, masaInaktif int) Schedule {
+	schedule := Schedule{
+		InactiveAt: p.add(tglMasuk, masaInaktif),
+		RetensiAt:  p.add(tglMasuk, masaAktif),
+		Permanent:  p.Permanent,
+	}
+
+	if schedule.RetensiAt.Before(schedule.InactiveAt) {
+		schedule.RetensiAt = schedule.InactiveAt
+	}
+
+	if p.Permanent {
+		return schedule
+	}
+
+	schedule.PemusnahanAt = p.add(tglMasuk, masaAktif+masaInaktif)
+
+	if p.MinorRetainYears > 0 && !tglLahir.IsZero() {
+		adulthood := tglLahir.AddDate(p.AdultAge, 0, 0)
+		if tglMasuk.Before(adulthood) {
+			keepUntil := adulthood.AddDate(p.MinorRetainYears, 0, 0)
+			if keepUntil.After(schedule.PemusnahanAt) {
+				schedule.PemusnahanAt = keepUntil
+			}
+		}
+	}
+
+	return schedule
+}
+
+// NeedsBirthDate reports whether Evaluate looks at the patient's birth date.
+func (p Policy) NeedsBirthDate() bool {
+	return !p.Permanent && p.MinorRetainYears > 0
+}
+
+func (p Policy) add(t time.Time, n int) time.Time {
+	if p.Unit == UnitMonth {
+		return t.AddDate(0, n, 0)
+	}
+	return t.AddDate(n, 0, 0)
+}
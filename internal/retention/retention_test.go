@@ -0,0 +1,152 @@
+package retention
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	tglMasuk := date(2015, time.March, 10)
+
+	tests := []struct {
+		name        string
+		policy      Policy
+		tglLahir    time.Time
+		masaAktif   int
+		masaInaktif int
+		want        Schedule
+	}{
+		{
+			name:        "default policy",
+			policy:      Default(),
+			masaAktif:   5,
+			masaInaktif: 2,
+			want: Schedule{
+				InactiveAt:   date(2017, time.March, 10),
+				RetensiAt:    date(2020, time.March, 10),
+				PemusnahanAt: date(2022, time.March, 10),
+			},
+		},
+		{
+			name:        "retensi waits for inactivation",
+			policy:      Default(),
+			masaAktif:   2,
+			masaInaktif: 5,
+			want: Schedule{
+				InactiveAt:   date(2020, time.March, 10),
+				RetensiAt:    date(2020, time.March, 10),
+				PemusnahanAt: date(2022, time.March, 10),
+			},
+		},
+		{
+			name:        "periods in months",
+			policy:      Policy{Unit: UnitMonth, AdultAge: DefaultAdultAge},
+			masaAktif:   18,
+			masaInaktif: 6,
+			want: Schedule{
+				InactiveAt:   date(2015, time.September, 10),
+				RetensiAt:    date(2016, time.September, 10),
+				PemusnahanAt: date(2017, time.March, 10),
+			},
+		},
+		{
+			name:        "minor kept until adult age plus retain years",
+			policy:      Policy{Unit: UnitYear, AdultAge: 18, MinorRetainYears: 2},
+			tglLahir:    date(2005, time.June, 1),
+			masaAktif:   5,
+			masaInaktif: 2,
+			want: Schedule{
+				InactiveAt:   date(2017, time.March, 10),
+				RetensiAt:    date(2020, time.March, 10),
+				PemusnahanAt: date(2025, time.June, 1),
+			},
+		},
+		{
+			name:        "minor extension shorter than the kasus periods",
+			policy:      Policy{Unit: UnitYear, AdultAge: 18, MinorRetainYears: 1},
+			tglLahir:    date(1998, time.June, 1),
+			masaAktif:   5,
+			masaInaktif: 2,
+			want: Schedule{
+				InactiveAt:   date(2017, time.March, 10),
+				RetensiAt:    date(2020, time.March, 10),
+				PemusnahanAt: date(2022, time.March, 10),
+			},
+		},
+		{
+			name:        "adult at the visit",
+			policy:      Policy{Unit: UnitYear, AdultAge: 18, MinorRetainYears: 20},
+			tglLahir:    date(1990, time.June, 1),
+			masaAktif:   5,
+			masaInaktif: 2,
+			want: Schedule{
+				InactiveAt:   date(2017, time.March, 10),
+				RetensiAt:    date(2020, time.March, 10),
+				PemusnahanAt: date(2022, time.March, 10),
+			},
+		},
+		{
+			name:        "unknown birth date",
+			policy:      Policy{Unit: UnitYear, AdultAge: 18, MinorRetainYears: 20},
+			masaAktif:   5,
+			masaInaktif: 2,
+			want: Schedule{
+				InactiveAt:   date(2017, time.March, 10),
+				RetensiAt:    date(2020, time.March, 10),
+				PemusnahanAt: date(2022, time.March, 10),
+			},
+		},
+		{
+			name:        "permanent",
+			policy:      Policy{Unit: UnitYear, AdultAge: 18, MinorRetainYears: 2, Permanent: true},
+			tglLahir:    date(2005, time.June, 1),
+			masaAktif:   5,
+			masaInaktif: 2,
+			want: Schedule{
+				InactiveAt: date(2017, time.March, 10),
+				RetensiAt:  date(2020, time.March, 10),
+				Permanent:  true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.Evaluate(tglMasuk, tt.tglLahir, tt.masaAktif, tt.masaInaktif)
+
+			if !got.InactiveAt.Equal(tt.want.InactiveAt) {
+				t.Errorf("InactiveAt = %s, want %s", got.InactiveAt.Format(time.DateOnly), tt.want.InactiveAt.Format(time.DateOnly))
+			}
+			if !got.RetensiAt.Equal(tt.want.RetensiAt) {
+				t.Errorf("RetensiAt = %s, want %s", got.RetensiAt.Format(time.DateOnly), tt.want.RetensiAt.Format(time.DateOnly))
+			}
+			if !got.PemusnahanAt.Equal(tt.want.PemusnahanAt) {
+				t.Errorf("PemusnahanAt = %s, want %s", got.PemusnahanAt.Format(time.DateOnly), tt.want.PemusnahanAt.Format(time.DateOnly))
+			}
+			if got.Permanent != tt.want.Permanent {
+				t.Errorf("Permanent = %v, want %v", got.Permanent, tt.want.Permanent)
+			}
+		})
+	}
+}
+
+func TestPolicyNeedsBirthDate(t *testing.T) {
+	tests := []struct {
+		policy Policy
+		want   bool
+	}{
+		{Default(), false},
+		{Policy{Unit: UnitYear, AdultAge: 18, MinorRetainYears: 2}, true},
+		{Policy{Unit: UnitYear, AdultAge: 18, MinorRetainYears: 2, Permanent: true}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.NeedsBirthDate(); got != tt.want {
+			t.Errorf("%+v.NeedsBirthDate() = %v, want %v", tt.policy, got, tt.want)
+		}
+	}
+}
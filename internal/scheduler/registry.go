@@ -0,0 +1,244 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/go-co-op/gocron/v2"
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+// Triggers passed to a Task and recorded with each run.
+const (
+	TriggerScheduled = "scheduled"
+	TriggerManual    = "manual"
+	TriggerInitial   = "initial"
+)
+
+type Task func(ctx context.Context, trigger string) error
+
+type registeredJob struct {
+	id     uuid.UUID
+	config models.CronJob
+}
+
+// Registry keeps the gocron jobs in line with the cron_jobs table. Tasks are
+// registered by name in code; their schedule, timezone and enabled flag come
+// from the database and are re-read on every Sync.
+type Registry struct {
+	mu        sync.Mutex
+	scheduler gocron.Scheduler
+	repo      repositories.CronJobRepository
+	tasks     map[string]Task
+	jobs      map[string]registeredJob
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+func NewRegistry(repo repositories.CronJobRepository) (*Registry, error) {
+	s, err := gocron.NewScheduler(gocron.WithLocation(time.UTC))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Registry{
+		ctx:       ctx,
+		cancel:    cancel,
+		scheduler: s,
+		repo:      repo,
+		tasks:     make(map[string]Task),
+		jobs:      make(map[string]registeredJob),
+	}, nil
+}
+
+func (reg *Registry) Register(name string, task Task) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	reg.tasks[name] = task
+}
+
+func (reg *Registry) Start() {
+	reg.scheduler.Start()
+}
+
+// Shutdown cancels the context of running tasks and waits for them to return.
+func (reg *Registry) Shutdown() error {
+	reg.cancel()
+	return reg.scheduler.Shutdown()
+}
+
+// Sync loads every job configuration and adds, reschedules or removes the
+// matching gocron job. Unchanged jobs are left alone so their next run is kept.
+func (reg *Registry) Sync(ctx context.Context) error {
+	configs, err := reg.repo.GetAllCronJobs(ctx)
+	if err != nil {
+		return err
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	seen := make(map[string]bool)
+	for _, cfg := range configs {
+		seen[cfg.Name] = true
+
+		if _, ok := reg.tasks[cfg.Name]; !ok {
+			log.Printf("Cron job %q is configured but has no registered task", cfg.Name)
+			continue
+		}
+
+		current, exists := reg.jobs[cfg.Name]
+
+		if !cfg.Enabled {
+			if exists {
+				reg.remove(cfg.Name, current.id)
+			}
+			continue
+		}
+
+		if exists && current.config.Expression == cfg.Expression && current.config.Timezone == cfg.Timezone {
+			continue
+		}
+
+		if err := Validate(cfg.Expression, cfg.Timezone); err != nil {
+			log.Printf("Cron job %q has an invalid schedule: %v", cfg.Name, err)
+			continue
+		}
+
+		definition := gocron.CronJob(crontab(cfg.Expression, cfg.Timezone), false)
+		task := gocron.NewTask(reg.run, cfg.Name)
+		options := []gocron.JobOption{
+			gocron.WithName(cfg.Name),
+			gocron.WithSingletonMode(gocron.LimitModeReschedule),
+		}
+
+		var job gocron.Job
+		if exists {
+			job, err = reg.scheduler.Update(current.id, definition, task, options...)
+		} else {
+			job, err = reg.scheduler.NewJob(definition, task, options...)
+		}
+		if err != nil {
+			log.Printf("Failed to schedule cron job %q: %v", cfg.Name, err)
+			continue
+		}
+
+		reg.jobs[cfg.Name] = registeredJob{id: job.ID(), config: *cfg}
+
+		if nextRun, err := job.NextRun(); err == nil {
+			log.Printf("Cron job %q scheduled (%s %s). Next run at: %v", cfg.Name, cfg.Expression, cfg.Timezone, nextRun.Format("2006-01-02 15:04:05"))
+		}
+	}
+
+	for name, job := range reg.jobs {
+		if !seen[name] {
+			reg.remove(name, job.id)
+		}
+	}
+
+	return nil
+}
+
+// RunNow executes a registered task immediately, outside of its schedule.
+func (reg *Registry) RunNow(ctx context.Context, name, trigger string) error {
+	reg.mu.Lock()
+	task, ok := reg.tasks[name]
+	reg.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("unknown cron job: %s", name)
+	}
+
+	return task(ctx, trigger)
+}
+
+func (reg *Registry) NextRun(name string) *time.Time {
+	reg.mu.Lock()
+	registered, ok := reg.jobs[name]
+	reg.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	for _, job := range reg.scheduler.Jobs() {
+		if job.ID() != registered.id {
+			continue
+		}
+		nextRun, err := job.NextRun()
+		if err != nil {
+			return nil
+		}
+		return &nextRun
+	}
+
+	return nil
+}
+
+func (reg *Registry) Names() []string {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	names := make([]string, 0, len(reg.jobs))
+	for name := range reg.jobs {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (reg *Registry) remove(name string, id uuid.UUID) {
+	if err := reg.scheduler.RemoveJob(id); err != nil {
+		log.Printf("Failed to remove cron job %q: %v", name, err)
+	}
+	delete(reg.jobs, name)
+	log.Printf("Cron job %q unscheduled", name)
+}
+
+func (reg *Registry) run(name string) {
+	reg.mu.Lock()
+	task := reg.tasks[name]
+	reg.mu.Unlock()
+
+	log.Printf("Starting scheduled cron job %q...", name)
+	startTime := time.Now()
+
+	if err := task(reg.ctx, TriggerScheduled); err != nil {
+		if errors.Is(err, repositories.ErrLockNotAcquired) {
+			log.Printf("Cron job %q skipped: another instance is running it", name)
+			return
+		}
+		log.Printf("Cron job %q failed: %v", name, err)
+		return
+	}
+
+	log.Printf("Cron job %q completed successfully in %v", name, time.Since(startTime))
+}
+
+func Validate(expression, timezone string) error {
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+
+	if _, err := cron.ParseStandard(crontab(expression, timezone)); err != nil {
+		return fmt.Errorf("invalid cron expression %q: %w", expression, err)
+	}
+
+	return nil
+}
+
+func crontab(expression, timezone string) string {
+	if timezone == "" {
+		return expression
+	}
+	return "CRON_TZ=" + timezone + " " + expression
+}
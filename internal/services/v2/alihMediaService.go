@@ -2,13 +2,14 @@ package services
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log"
-	"strings"
-	"sync"
 	"time"
 
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/lifecycle"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
@@ -23,7 +24,6 @@ type AlihMediaService interface {
 	Update(ctx context.Context, alihMedia models.AlihMedia) (*models.AlihMedia, error)
 	Delete(ctx context.Context, id int) error
 	CreateAndCheckAlihMedia(ctx context.Context, kunjunganID int) error
-	CheckAllExpiredKunjungan(ctx context.Context) error
 	Export(ctx context.Context) ([]byte, error)
 }
 
@@ -31,17 +31,30 @@ type alihMediaService struct {
 	repo          repositories.AlihMediaRepository
 	kunjunganRepo repositories.KunjunganRepository
 	kasusRepo     repositories.KasusRepository
+	legalHoldRepo repositories.LegalHoldRepository
+	transactor    repositories.Transactor
+	audit         audit.Recorder
+	evaluator     *expiryEvaluator
 }
 
 func NewServiceAlihMedia(
 	repo repositories.AlihMediaRepository,
 	kunjunganRepo repositories.KunjunganRepository,
 	kasusRepo repositories.KasusRepository,
+	policyRepo repositories.RetentionPolicyRepository,
+	pasienRepo repositories.PasienRepository,
+	legalHoldRepo repositories.LegalHoldRepository,
+	transactor repositories.Transactor,
+	auditRecorder audit.Recorder,
 ) AlihMediaService {
 	return &alihMediaService{
 		repo:          repo,
 		kunjunganRepo: kunjunganRepo,
 		kasusRepo:     kasusRepo,
+		legalHoldRepo: legalHoldRepo,
+		transactor:    transactor,
+		audit:         auditRecorder,
+		evaluator:     newExpiryEvaluator(kasusRepo, policyRepo, pasienRepo),
 	}
 }
 
@@ -181,11 +194,27 @@ func (svc *alihMediaService) GetByID(ctx context.Context, id int) (*models.AlihM
 }
 
 func (svc *alihMediaService) Create(ctx context.Context, alihMedia models.AlihMedia) (*models.AlihMedia, error) {
+	record, err := loadLifecycle(ctx, svc.kunjunganRepo, alihMedia.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := parseStatus(record, lifecycle.StageAlihMedia, alihMedia.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := record.CanCreate(lifecycle.StageAlihMedia, status); err != nil {
+		return nil, err
+	}
+	alihMedia.Status = string(status)
+
 	newAlihMedia, err := svc.repo.CreateAlihMedia(ctx, &alihMedia)
 	if err != nil {
 		return nil, err
 	}
 
+	svc.audit.Record(ctx, audit.Create, "alih_media", newAlihMedia.ID, nil, newAlihMedia)
 	return newAlihMedia, nil
 }
 
@@ -199,12 +228,28 @@ func (svc *alihMediaService) Update(ctx context.Context, alihMedia models.AlihMe
 		return nil, errors.New("Alih Media not found")
 	}
 
+	record, err := loadLifecycle(ctx, svc.kunjunganRepo, alihMedia.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := parseStatus(record, lifecycle.StageAlihMedia, alihMedia.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := record.CanTransition(lifecycle.StageAlihMedia, status); err != nil {
+		return nil, err
+	}
+	alihMedia.Status = string(status)
+
 	newAlihMedia, err := svc.repo.UpdateAlihMedia(ctx, alihMedia)
 
 	if err != nil {
 		return nil, err
 	}
 
+	svc.audit.Record(ctx, audit.Update, "alih_media", alihMedia.ID, existing, newAlihMedia)
 	return newAlihMedia, nil
 }
 
@@ -218,157 +263,59 @@ func (svc *alihMediaService) Delete(ctx context.Context, id int) error {
 		return errors.New("Alih Media not found")
 	}
 
-	return svc.repo.DeleteAlihMedia(ctx, id)
-}
-
-func (svc *alihMediaService) CreateAndCheckAlihMedia(ctx context.Context, kunjunganID int) error {
-	kunjungan, err := svc.kunjunganRepo.GetKunjunganByID(ctx, kunjunganID)
-
-	log.Println(kunjungan)
-
-	if err != nil {
-		log.Printf("Error getting kunjungan: %v", err)
+	if err := checkLegalHold(ctx, svc.legalHoldRepo, id, "Alih media deletion"); err != nil {
 		return err
 	}
-	if kunjungan == nil {
-		return nil
-	}
-
-	kasus, err := svc.kasusRepo.GetKasusByID(ctx, kunjungan.IDKasus)
 
-	log.Println(kasus)
-
-	if err != nil {
-		log.Printf("Error getting kasus: %v", err)
+	if err := svc.repo.DeleteAlihMedia(ctx, id); err != nil {
 		return err
 	}
-	if kasus == nil {
-		return errors.New("Kasus not found")
-	}
-
-	var masaInaktif int
-	var expirationDate time.Time
-
-	switch kunjungan.JenisKunjungan {
-	case "RI":
-		masaInaktif = kasus.MasaInaktifRI
-		expirationDate = kunjungan.TglMasuk.AddDate(masaInaktif, 0, 0)
-	case "RJ":
-		masaInaktif = kasus.MasaInaktifRJ
-		expirationDate = kunjungan.TglMasuk.AddDate(masaInaktif, 0, 0)
-	default:
-		return errors.New("Jenis kunjungan invalid")
-	}
-
-	now := time.Now()
-	if now.After(expirationDate) {
-
-		existing, err := svc.repo.GetAlihMediaByID(ctx, kunjunganID)
-		if err != nil {
-			log.Printf("Error checking existing alih media: %v", err)
-			return err
-		}
-
-		if existing == nil {
-			alihMedia := models.AlihMedia{
-				ID:         kunjunganID,
-				TglLaporan: nil,
-				Status:     "belum di alih media",
-				CreatedAt:  time.Now(),
-				UpdatedAt:  time.Now(),
-			}
-
-			_, err = svc.repo.CreateAlihMedia(ctx, &alihMedia)
-			if err != nil {
-				log.Printf("Error creating alih media: %v", err)
-				return err
-			}
-			log.Printf("Created alih media for kunjungan ID: %d", kunjunganID)
-		} else {
-			log.Printf("Alih media already exists for kunjungan ID: %d", kunjunganID)
-		}
-	} else {
-		log.Printf("Kunjungan ID %d not expired yet (expires: %s)", kunjunganID, expirationDate.Format("2006-01-02"))
-	}
 
+	svc.audit.Record(ctx, audit.Delete, "alih_media", id, existing, nil)
 	return nil
 }
 
-func (svc *alihMediaService) CheckAllExpiredKunjungan(ctx context.Context) error {
-	monthsThreshold := 3
-
-	total, err := svc.kunjunganRepo.GetTotalKunjungan(ctx)
+// CreateAndCheckAlihMedia inactivates the kunjungan and queues it for alih
+// media if it is already past its inactivation date, using the same rule as
+// the inactivation cron job.
+func (svc *alihMediaService) CreateAndCheckAlihMedia(ctx context.Context, kunjunganID int) error {
+	kunjungan, err := svc.kunjunganRepo.GetKunjunganBasicByID(ctx, kunjunganID)
 	if err != nil {
-		return fmt.Errorf("Failed to get total count: %v", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		log.Printf("Error getting kunjungan: %v", err)
+		return err
 	}
 
-	if total == 0 {
-		log.Println("No potentially expired kunjungan found")
-		return nil
+	decisions, err := svc.evaluator.Evaluate(ctx, []*models.Kunjungan{kunjungan}, time.Now())
+	if err != nil {
+		return err
 	}
 
-	workerCount := 10
-	pageSize := 100
-	totalPages := (total + pageSize - 1) / pageSize
-
-	log.Printf("Processing %d potentially expired kunjungan across %d pages", total, totalPages)
-
-	jobs := make(chan []*models.Kunjungan, workerCount)
-	errorChan := make(chan error, totalPages)
-	var wg sync.WaitGroup
-
-	for i := 0; i < workerCount; i++ {
-		wg.Add(1)
-		go svc.worker(ctx, jobs, errorChan, &wg)
+	decision := decisions[0]
+	if decision.Err != nil {
+		log.Printf("Error getting kasus: %v", decision.Err)
+		return decision.Err
 	}
-
-	for page := 0; page < totalPages; page++ {
-		offset := page * pageSize
-		kunjunganList, err := svc.kunjunganRepo.GetPotentiallyExpiredKunjungan(ctx, monthsThreshold, pageSize, offset)
-		if err != nil {
-			errorChan <- fmt.Errorf("error getting page %d: %v", page, err)
-			continue
-		}
-		jobs <- kunjunganList
+	if decision.Skip != "" {
+		return errors.New("Jenis kunjungan invalid")
 	}
 
-	close(jobs)
-	wg.Wait()
-	close(errorChan)
-
-	var errorList []string
-	for err := range errorChan {
-		if err != nil {
-			errorList = append(errorList, err.Error())
-		}
+	if !decision.Expired {
+		log.Printf("Kunjungan ID %d not expired yet (expires: %s)", kunjunganID, decision.ExpiredAt.Format("2006-01-02"))
+		return nil
 	}
 
-	if len(errorList) > 0 {
-		return fmt.Errorf("errors during processing: %s", strings.Join(errorList, "; "))
+	if _, err := inactivateKunjungan(ctx, svc.transactor, svc.kunjunganRepo, svc.repo, svc.audit, kunjungan); err != nil {
+		log.Printf("Error creating alih media: %v", err)
+		return err
 	}
 
+	log.Printf("Created alih media for kunjungan ID: %d", kunjunganID)
 	return nil
 }
 
-func (svc *alihMediaService) worker(ctx context.Context, jobs <-chan []*models.Kunjungan, errors chan<- error, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	for kunjunganList := range jobs {
-		for _, kunjungan := range kunjunganList {
-			select {
-			case <-ctx.Done():
-				errors <- ctx.Err()
-				return
-			default:
-				err := svc.CreateAndCheckAlihMedia(ctx, kunjungan.ID)
-				if err != nil {
-					errors <- fmt.Errorf("Kunjungan ID %d: %v", kunjungan.ID, err.Error())
-				}
-			}
-		}
-	}
-}
-
 func (svc *alihMediaService) Export(ctx context.Context) ([]byte, error) {
 	data, err := svc.repo.GetAllAlihMediaForExport(ctx)
 	if err != nil {
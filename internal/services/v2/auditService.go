@@ -0,0 +1,440 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	AuditExportXLSX = "xlsx"
+	AuditExportCSV  = "csv"
+
+	auditDateLayout      = "2006-01-02"
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+	auditExportPageSize  = 1000
+	maxAuditExportRows   = 50000
+	auditVerifyPageSize  = 1000
+)
+
+var ErrInvalidAuditFilter = errors.New("Invalid audit filter")
+
+type AuditService interface {
+	Search(ctx context.Context, filter AuditFilter) (*AuditPage, error)
+	Export(ctx context.Context, filter AuditFilter, format string) ([]byte, error)
+	Verify(ctx context.Context) (*AuditChainReport, error)
+	GetViewers(ctx context.Context, idPasien int, cursor string, limit int) (*PasienViewerPage, error)
+}
+
+type auditService struct {
+	repo          repositories.AuditRepository
+	accessLogRepo repositories.AccessLogRepository
+}
+
+func NewServiceAudit(repo repositories.AuditRepository, accessLogRepo repositories.AccessLogRepository) AuditService {
+	return &auditService{repo: repo, accessLogRepo: accessLogRepo}
+}
+
+// AuditFilter is an audit query as it arrives from the API. From and To are
+// inclusive YYYY-MM-DD dates; Cursor is the NextCursor of the previous page.
+type AuditFilter struct {
+	UserID   string
+	Entity   string
+	EntityID string
+	Action   string
+	From     string
+	To       string
+	IDPasien int
+	Cursor   string
+	Limit    int
+}
+
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	ActorID   *int            `json:"actor_id"`
+	ActorName string          `json:"actor_name"`
+	ActorRole string          `json:"actor_role"`
+	Action    string          `json:"action"`
+	Entity    string          `json:"entity"`
+	EntityID  string          `json:"entity_id"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	Diff      json.RawMessage `json:"diff"`
+	IP        string          `json:"ip"`
+	RequestID string          `json:"request_id"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// AuditPage is one page of entries, newest first. NextCursor is empty on the
+// last page.
+type AuditPage struct {
+	Data       []*AuditEntry `json:"data"`
+	NextCursor string        `json:"next_cursor"`
+}
+
+func (svc *auditService) Search(ctx context.Context, filter AuditFilter) (*AuditPage, error) {
+	query, err := parseAuditFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := filter.Limit
+	if limit < 1 || limit > maxAuditPageSize {
+		limit = defaultAuditPageSize
+	}
+
+	// One extra row tells whether there is another page.
+	rows, err := svc.repo.FindAuditLogs(ctx, query, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &AuditPage{Data: []*AuditEntry{}}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		page.NextCursor = strconv.FormatInt(rows[limit-1].ID, 10)
+	}
+
+	for _, row := range rows {
+		page.Data = append(page.Data, newAuditEntry(row))
+	}
+
+	return page, nil
+}
+
+func (svc *auditService) Export(ctx context.Context, filter AuditFilter, format string) ([]byte, error) {
+	if format == "" {
+		format = AuditExportXLSX
+	}
+	if format != AuditExportXLSX && format != AuditExportCSV {
+		return nil, fmt.Errorf("%w: format must be xlsx or csv", ErrInvalidAuditFilter)
+	}
+
+	query, err := parseAuditFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []*models.AuditLog
+	for {
+		batch, err := svc.repo.FindAuditLogs(ctx, query, auditExportPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		rows = append(rows, batch...)
+		if len(batch) < auditExportPageSize {
+			break
+		}
+		if len(rows) >= maxAuditExportRows {
+			return nil, fmt.Errorf("%w: export is limited to %d rows, narrow the filter", ErrInvalidAuditFilter, maxAuditExportRows)
+		}
+		query.BeforeID = batch[len(batch)-1].ID
+	}
+
+	headers := []string{"Waktu", "User", "Role", "Aksi", "Entitas", "ID Entitas", "Perubahan", "IP", "Request ID"}
+	values := func(row *models.AuditLog) []string {
+		return []string{
+			row.CreatedAt.Format("2006-01-02 15:04:05"),
+			auditActorName(row),
+			row.ActorRole,
+			row.Action,
+			row.Entity,
+			row.EntityID,
+			row.Diff,
+			row.IP,
+			row.RequestID,
+		}
+	}
+
+	if format == AuditExportCSV {
+		var buf bytes.Buffer
+		writer := csv.NewWriter(&buf)
+		writer.Write(headers)
+		for _, row := range rows {
+			writer.Write(values(row))
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheet := "Audit"
+	f.SetSheetName("Sheet1", sheet)
+
+	headerStyle := pkg.GetHeaderStyle(f)
+	for i, header := range headers {
+		f.SetCellValue(sheet, pkg.GetCell(i+1, 1), header)
+		f.SetCellStyle(sheet, pkg.GetCell(i+1, 1), pkg.GetCell(i+1, 1), headerStyle)
+	}
+
+	for i, row := range rows {
+		for c, value := range values(row) {
+			f.SetCellValue(sheet, pkg.GetCell(c+1, i+2), value)
+		}
+	}
+	f.SetColWidth(sheet, "A", pkg.GetColumnName(len(headers)), 20)
+	f.SetColWidth(sheet, "G", "G", 60)
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type PasienViewer struct {
+	ID       int       `json:"id"`
+	UserID   int       `json:"user_id"`
+	UserName string    `json:"user_name"`
+	Endpoint string    `json:"endpoint"`
+	IP       string    `json:"ip"`
+	ViewedAt time.Time `json:"viewed_at"`
+}
+
+type PasienViewerPage struct {
+	Data       []*PasienViewer `json:"data"`
+	NextCursor string          `json:"next_cursor"`
+}
+
+// GetViewers lists who read a pasien's record, newest first.
+func (svc *auditService) GetViewers(ctx context.Context, idPasien int, cursor string, limit int) (*PasienViewerPage, error) {
+	if limit < 1 || limit > maxAuditPageSize {
+		limit = defaultAuditPageSize
+	}
+
+	var beforeID int
+	if cursor != "" {
+		id, err := strconv.Atoi(cursor)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidAuditFilter)
+		}
+		beforeID = id
+	}
+
+	rows, err := svc.accessLogRepo.GetPasienAccessLogs(ctx, idPasien, beforeID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &PasienViewerPage{Data: []*PasienViewer{}}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		page.NextCursor = strconv.Itoa(rows[limit-1].ID)
+	}
+
+	for _, row := range rows {
+		name := row.UserName
+		if name == "" {
+			name = fmt.Sprintf("User #%d", row.UserID)
+		}
+
+		page.Data = append(page.Data, &PasienViewer{
+			ID:       row.ID,
+			UserID:   row.UserID,
+			UserName: name,
+			Endpoint: row.Endpoint,
+			IP:       row.IP,
+			ViewedAt: row.CreatedAt,
+		})
+	}
+
+	return page, nil
+}
+
+// AuditChainReport is the result of walking the audit hash chain. Unchained
+// counts rows written before the chain existed. When Valid is false,
+// BrokenAt is the first row that does not fit and Reason says why.
+type AuditChainReport struct {
+	Valid     bool   `json:"valid"`
+	Checked   int    `json:"checked"`
+	Unchained int    `json:"unchained"`
+	BrokenAt  *int64 `json:"broken_at"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Verify recomputes every hash in the chain up to the current head. Editing a
+// row changes its hash, deleting one breaks the next row's link and deleting
+// the newest rows leaves the head pointing past the end.
+func (svc *auditService) Verify(ctx context.Context) (*AuditChainReport, error) {
+	head, err := svc.repo.GetAuditChainHead(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &AuditChainReport{Valid: true}
+	if head.LastID == nil {
+		return report, nil
+	}
+
+	walk := &auditChainWalk{report: report}
+	var afterID int64
+	for {
+		rows, err := svc.repo.GetAuditChainRows(ctx, afterID, *head.LastID, auditVerifyPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range rows {
+			afterID = row.ID
+			if !walk.next(row) {
+				return report, nil
+			}
+		}
+
+		if len(rows) < auditVerifyPageSize {
+			break
+		}
+	}
+
+	walk.end(head)
+	return report, nil
+}
+
+// auditChainWalk checks audit rows one at a time, in Id order, against the
+// rows before them, and records the outcome in report.
+type auditChainWalk struct {
+	report  *AuditChainReport
+	prev    string
+	lastID  int64
+	chained bool
+}
+
+// next checks row and reports whether the chain is still intact.
+func (walk *auditChainWalk) next(row *models.AuditLog) bool {
+	if row.Hash == "" {
+		if walk.chained {
+			return walk.broken(row.ID, "row has no hash")
+		}
+		walk.report.Unchained++
+		return true
+	}
+	walk.chained = true
+
+	if row.PrevHash != walk.prev {
+		return walk.broken(row.ID, "previous hash does not match the row before it; a row was removed or altered")
+	}
+	if repositories.AuditHash(walk.prev, row) != row.Hash {
+		return walk.broken(row.ID, "content does not match its hash; the row was edited")
+	}
+
+	walk.prev = row.Hash
+	walk.lastID = row.ID
+	walk.report.Checked++
+	return true
+}
+
+// end checks that the last row walked is the one the chain head points at.
+// head.LastID must be set.
+func (walk *auditChainWalk) end(head *models.AuditChainHead) bool {
+	if walk.lastID != *head.LastID || walk.prev != head.Hash {
+		return walk.broken(*head.LastID, "chain head does not match the newest row; rows were removed from the end")
+	}
+	return true
+}
+
+func (walk *auditChainWalk) broken(id int64, reason string) bool {
+	walk.report.Valid = false
+	walk.report.BrokenAt = &id
+	walk.report.Reason = reason
+	return false
+}
+
+func parseAuditFilter(filter AuditFilter) (models.AuditLogFilter, error) {
+	query := models.AuditLogFilter{
+		Entity:   filter.Entity,
+		EntityID: filter.EntityID,
+		Action:   filter.Action,
+		IDPasien: filter.IDPasien,
+	}
+
+	if filter.UserID != "" {
+		id, err := strconv.Atoi(filter.UserID)
+		if err != nil {
+			return query, fmt.Errorf("%w: user must be a number", ErrInvalidAuditFilter)
+		}
+		query.ActorID = &id
+	}
+
+	if filter.From != "" {
+		from, err := time.ParseInLocation(auditDateLayout, filter.From, time.Local)
+		if err != nil {
+			return query, fmt.Errorf("%w: from must be formatted as YYYY-MM-DD", ErrInvalidAuditFilter)
+		}
+		query.From = &from
+	}
+
+	if filter.To != "" {
+		to, err := time.ParseInLocation(auditDateLayout, filter.To, time.Local)
+		if err != nil {
+			return query, fmt.Errorf("%w: to must be formatted as YYYY-MM-DD", ErrInvalidAuditFilter)
+		}
+		to = to.AddDate(0, 0, 1)
+		query.To = &to
+	}
+
+	if query.From != nil && query.To != nil && !query.To.After(*query.From) {
+		return query, fmt.Errorf("%w: to must not be before from", ErrInvalidAuditFilter)
+	}
+
+	if filter.Cursor != "" {
+		cursor, err := strconv.ParseInt(filter.Cursor, 10, 64)
+		if err != nil || cursor < 1 {
+			return query, fmt.Errorf("%w: invalid cursor", ErrInvalidAuditFilter)
+		}
+		query.BeforeID = cursor
+	}
+
+	return query, nil
+}
+
+func newAuditEntry(row *models.AuditLog) *AuditEntry {
+	return &AuditEntry{
+		ID:        row.ID,
+		ActorID:   row.ActorID,
+		ActorName: auditActorName(row),
+		ActorRole: row.ActorRole,
+		Action:    row.Action,
+		Entity:    row.Entity,
+		EntityID:  row.EntityID,
+		Before:    rawJSON(row.Before),
+		After:     rawJSON(row.After),
+		Diff:      rawJSON(row.Diff),
+		IP:        row.IP,
+		RequestID: row.RequestID,
+		CreatedAt: row.CreatedAt,
+	}
+}
+
+func auditActorName(row *models.AuditLog) string {
+	switch {
+	case row.ActorID == nil:
+		return "System"
+	case row.ActorName == "":
+		return fmt.Sprintf("User #%d", *row.ActorID)
+	}
+	return row.ActorName
+}
+
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	return json.RawMessage(s)
+}
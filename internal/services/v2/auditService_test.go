@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+)
+
+// memoryAuditRepo serves audit_log rows and the chain head from memory.
+type memoryAuditRepo struct {
+	repositories.AuditRepository
+	rows []*models.AuditLog
+	head models.AuditChainHead
+}
+
+func (repo *memoryAuditRepo) GetAuditChainHead(ctx context.Context) (*models.AuditChainHead, error) {
+	head := repo.head
+	return &head, nil
+}
+
+func (repo *memoryAuditRepo) GetAuditChainRows(ctx context.Context, afterID, maxID int64, limit int) ([]*models.AuditLog, error) {
+	var rows []*models.AuditLog
+	for _, row := range repo.rows {
+		if row.ID > afterID && row.ID <= maxID && len(rows) < limit {
+			copied := *row
+			rows = append(rows, &copied)
+		}
+	}
+	return rows, nil
+}
+
+// chainedAuditRepo holds unchained legacy rows followed by chained ones, as
+// InsertAuditLogs writes them.
+func chainedAuditRepo(unchained, chained int) *memoryAuditRepo {
+	repo := &memoryAuditRepo{}
+	createdAt := time.Date(2025, time.May, 1, 8, 0, 0, 0, time.UTC)
+
+	var id int64
+	for i := 0; i < unchained; i++ {
+		id++
+		repo.rows = append(repo.rows, &models.AuditLog{ID: id, Action: "create", Entity: "pasien", EntityID: fmt.Sprint(id), CreatedAt: createdAt})
+	}
+
+	var entries []*models.AuditLog
+	for i := 0; i < chained; i++ {
+		id++
+		entries = append(entries, &models.AuditLog{
+			ID:        id,
+			Action:    "update",
+			Entity:    "kunjungan",
+			EntityID:  fmt.Sprint(id),
+			After:     fmt.Sprintf(`{"n":%d}`, i),
+			CreatedAt: createdAt.Add(time.Duration(i) * time.Second),
+		})
+	}
+	repo.head.Hash = repositories.ChainAuditLogs("", entries)
+	repo.rows = append(repo.rows, entries...)
+	repo.head.LastID = &id
+
+	return repo
+}
+
+func (repo *memoryAuditRepo) remove(id int64) {
+	for i, row := range repo.rows {
+		if row.ID == id {
+			repo.rows = append(repo.rows[:i], repo.rows[i+1:]...)
+			return
+		}
+	}
+}
+
+func (repo *memoryAuditRepo) row(id int64) *models.AuditLog {
+	for _, row := range repo.rows {
+		if row.ID == id {
+			return row
+		}
+	}
+	return nil
+}
+
+func TestAuditVerify(t *testing.T) {
+	tests := []struct {
+		name          string
+		tamper        func(repo *memoryAuditRepo)
+		wantBrokenAt  int64
+		wantChecked   int
+		wantUnchained int
+	}{
+		{
+			name:          "intact chain",
+			tamper:        func(repo *memoryAuditRepo) {},
+			wantChecked:   5,
+			wantUnchained: 2,
+		},
+		{
+			name:         "edited row",
+			tamper:       func(repo *memoryAuditRepo) { repo.row(5).After = `{"n":"forged"}` },
+			wantBrokenAt: 5,
+		},
+		{
+			name: "edited row with its hash recomputed",
+			tamper: func(repo *memoryAuditRepo) {
+				row := repo.row(4)
+				row.Before = `{"n":"forged"}`
+				row.Hash = repositories.AuditHash(row.PrevHash, row)
+			},
+			wantBrokenAt: 5,
+		},
+		{
+			name:         "removed row",
+			tamper:       func(repo *memoryAuditRepo) { repo.remove(4) },
+			wantBrokenAt: 5,
+		},
+		{
+			name:         "removed newest row",
+			tamper:       func(repo *memoryAuditRepo) { repo.remove(7) },
+			wantBrokenAt: 7,
+		},
+		{
+			name:         "hash cleared after the chain started",
+			tamper:       func(repo *memoryAuditRepo) { repo.row(6).Hash = "" },
+			wantBrokenAt: 6,
+		},
+		{
+			name: "rows swapped",
+			tamper: func(repo *memoryAuditRepo) {
+				a, b := repo.row(4), repo.row(5)
+				a.ID, b.ID = b.ID, a.ID
+				repo.rows[3], repo.rows[4] = repo.rows[4], repo.rows[3]
+			},
+			wantBrokenAt: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := chainedAuditRepo(2, 5)
+			tt.tamper(repo)
+
+			report, err := NewServiceAudit(repo, nil).Verify(context.Background())
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+
+			if tt.wantBrokenAt == 0 {
+				if !report.Valid {
+					t.Fatalf("report = %+v (%s), want a valid chain", report, report.Reason)
+				}
+				if report.Checked != tt.wantChecked || report.Unchained != tt.wantUnchained {
+					t.Errorf("checked %d, unchained %d, want %d and %d", report.Checked, report.Unchained, tt.wantChecked, tt.wantUnchained)
+				}
+				return
+			}
+
+			if report.Valid {
+				t.Fatalf("report is valid, want the chain broken at row %d", tt.wantBrokenAt)
+			}
+			if report.BrokenAt == nil || *report.BrokenAt != tt.wantBrokenAt {
+				t.Errorf("broken at %v (%s), want row %d", report.BrokenAt, report.Reason, tt.wantBrokenAt)
+			}
+		})
+	}
+}
+
+func TestAuditVerifyEmptyChain(t *testing.T) {
+	report, err := NewServiceAudit(&memoryAuditRepo{}, nil).Verify(context.Background())
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !report.Valid || report.Checked != 0 {
+		t.Errorf("report = %+v, want a valid, empty chain", report)
+	}
+}
+
+func TestAuditVerifyPages(t *testing.T) {
+	repo := chainedAuditRepo(0, auditVerifyPageSize+10)
+
+	report, err := NewServiceAudit(repo, nil).Verify(context.Background())
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !report.Valid || report.Checked != auditVerifyPageSize+10 {
+		t.Errorf("report = %+v (%s), want every row of both pages checked", report, report.Reason)
+	}
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"strings"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/jung-kurt/gofpdf"
+)
+
+type beritaAcaraSigner struct {
+	Name     string
+	SignedAt time.Time
+}
+
+type signatureBlock struct {
+	Role string
+	Name string
+	Note string
+}
+
+type beritaAcaraData struct {
+	BeritaAcara *models.BeritaAcara
+	Batch       *models.DestructionBatch
+	Records     []*models.PemusnahanJoin
+	Info        *models.InfoSistem
+	Proposer    string
+	Approvers   []beritaAcaraSigner
+	Executor    string
+}
+
+var (
+	namaHari    = []string{"Minggu", "Senin", "Selasa", "Rabu", "Kamis", "Jumat", "Sabtu"}
+	namaBulan   = []string{"Januari", "Februari", "Maret", "April", "Mei", "Juni", "Juli", "Agustus", "September", "Oktober", "November", "Desember"}
+	romanMonths = []string{"I", "II", "III", "IV", "V", "VI", "VII", "VIII", "IX", "X", "XI", "XII"}
+)
+
+func tanggalIndonesia(t time.Time) string {
+	return fmt.Sprintf("%d %s %d", t.Day(), namaBulan[t.Month()-1], t.Year())
+}
+
+const (
+	baMarginLeft  = 20.0
+	baMarginRight = 20.0
+	baLineHeight  = 6.0
+)
+
+var baColumns = []struct {
+	title string
+	width float64
+	align string
+}{
+	{"No", 10, "C"},
+	{"No. RM", 28, "C"},
+	{"Nama Pasien", 62, "L"},
+	{"Tgl Kunjungan", 30, "C"},
+	{"Kasus", 40, "L"},
+}
+
+func renderBeritaAcara(data *beritaAcaraData) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetMargins(baMarginLeft, 20, baMarginRight)
+	pdf.SetAutoPageBreak(true, 20)
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.CellFormat(0, 10, tr(fmt.Sprintf("%s - Halaman %d dari {nb}", data.BeritaAcara.Nomor, pdf.PageNo())), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	pageWidth, _ := pdf.GetPageSize()
+	contentWidth := pageWidth - baMarginLeft - baMarginRight
+
+	// Letterhead
+	hospital := "Rumah Sakit"
+	textX := baMarginLeft
+	if data.Info != nil {
+		if strings.TrimSpace(data.Info.NamaAplikasi) != "" {
+			hospital = data.Info.NamaAplikasi
+		}
+		if registerLogo(pdf, data.Info.Logo) {
+			pdf.ImageOptions("logo", baMarginLeft, 15, 0, 20, false, gofpdf.ImageOptions{}, 0, "")
+			textX = baMarginLeft + 30
+		}
+	}
+
+	pdf.SetXY(textX, 18)
+	pdf.SetFont("Helvetica", "B", 15)
+	pdf.CellFormat(0, 8, tr(strings.ToUpper(hospital)), "", 1, "L", false, 0, "")
+	pdf.SetX(textX)
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(0, 6, "Instalasi Rekam Medis", "", 1, "L", false, 0, "")
+
+	pdf.SetLineWidth(0.6)
+	pdf.Line(baMarginLeft, 38, pageWidth-baMarginRight, 38)
+	pdf.SetLineWidth(0.2)
+
+	// Title
+	pdf.SetY(44)
+	pdf.SetFont("Helvetica", "B", 13)
+	pdf.CellFormat(0, 7, "BERITA ACARA PEMUSNAHAN ARSIP REKAM MEDIS", "", 1, "C", false, 0, "")
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.CellFormat(0, 6, tr("Nomor: "+data.BeritaAcara.Nomor), "", 1, "C", false, 0, "")
+	pdf.Ln(6)
+
+	executedAt := *data.Batch.ExecutedAt
+	opening := fmt.Sprintf(
+		"Pada hari ini %s, tanggal %s, telah dilaksanakan pemusnahan arsip rekam medis inaktif "+
+			"berdasarkan usulan pemusnahan \"%s\" (batch #%d) yang telah disetujui oleh tim pemusnahan, "+
+			"dengan rincian sebagai berikut:",
+		namaHari[executedAt.Weekday()], tanggalIndonesia(executedAt), data.Batch.Nama, data.Batch.ID,
+	)
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.MultiCell(0, baLineHeight, tr(opening), "", "J", false)
+	pdf.Ln(3)
+
+	// Records
+	drawHeader := func() {
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.SetFillColor(230, 230, 230)
+		for _, col := range baColumns {
+			pdf.CellFormat(col.width, 8, col.title, "1", 0, "C", true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont("Helvetica", "", 10)
+	}
+
+	_, pageHeight := pdf.GetPageSize()
+	drawHeader()
+	for i, row := range data.Records {
+		if pdf.GetY()+7 > pageHeight-25 {
+			pdf.AddPage()
+			drawHeader()
+		}
+
+		values := []string{
+			fmt.Sprintf("%d", i+1),
+			row.NoRM,
+			row.NamaPasien,
+			row.TglMasuk.Format("02-01-2006"),
+			row.JenisKasus,
+		}
+		for c, col := range baColumns {
+			pdf.CellFormat(col.width, 7, fitText(pdf, tr(values[c]), col.width-2), "1", 0, col.align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.Ln(3)
+
+	pdf.MultiCell(0, baLineHeight, tr(fmt.Sprintf("Jumlah berkas rekam medis yang dimusnahkan: %d berkas.", len(data.Records))), "", "L", false)
+	if strings.TrimSpace(data.Batch.Keterangan) != "" {
+		pdf.MultiCell(0, baLineHeight, tr("Keterangan: "+data.Batch.Keterangan), "", "J", false)
+	}
+	pdf.Ln(2)
+	pdf.MultiCell(0, baLineHeight, "Demikian berita acara ini dibuat dengan sebenarnya untuk dapat dipergunakan sebagaimana mestinya.", "", "J", false)
+	pdf.Ln(6)
+
+	// Committee signatures, three to a row.
+	signers := []signatureBlock{{Role: "Pengusul", Name: data.Proposer}}
+	for i, approver := range data.Approvers {
+		signers = append(signers, signatureBlock{
+			Role: fmt.Sprintf("Penyetuju %d", i+1),
+			Name: approver.Name,
+			Note: "Disetujui " + tanggalIndonesia(approver.SignedAt),
+		})
+	}
+	if data.Executor != "" {
+		signers = append(signers, signatureBlock{Role: "Pelaksana", Name: data.Executor, Note: tanggalIndonesia(executedAt)})
+	}
+
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(0, 7, "Tim Pemusnahan", "", 1, "L", false, 0, "")
+
+	blockWidth := contentWidth / 3
+	const blockHeight = 42.0
+	for i := 0; i < len(signers); i += 3 {
+		if pdf.GetY()+blockHeight > pageHeight-25 {
+			pdf.AddPage()
+		}
+
+		top := pdf.GetY()
+		for j := i; j < i+3 && j < len(signers); j++ {
+			x := baMarginLeft + float64(j-i)*blockWidth
+			signer := signers[j]
+
+			pdf.SetXY(x, top)
+			pdf.SetFont("Helvetica", "", 10)
+			pdf.CellFormat(blockWidth, 6, signer.Role, "", 2, "C", false, 0, "")
+
+			pdf.SetXY(x, top+26)
+			pdf.SetFont("Helvetica", "BU", 10)
+			pdf.CellFormat(blockWidth, 6, fitText(pdf, tr(signer.Name), blockWidth-4), "", 2, "C", false, 0, "")
+
+			if signer.Note != "" {
+				pdf.SetFont("Helvetica", "I", 8)
+				pdf.CellFormat(blockWidth, 5, tr(signer.Note), "", 2, "C", false, 0, "")
+			}
+		}
+		pdf.SetY(top + blockHeight)
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// registerLogo decodes the base64 logo stored in info_sistem. An invalid logo
+// is skipped rather than failing the whole document.
+func registerLogo(pdf *gofpdf.Fpdf, logo string) bool {
+	logo = strings.TrimSpace(logo)
+	if i := strings.Index(logo, ","); strings.HasPrefix(logo, "data:") && i >= 0 {
+		logo = logo[i+1:]
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(logo)
+	if err != nil || len(raw) == 0 {
+		return false
+	}
+
+	_, format, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return false
+	}
+
+	var imageType string
+	switch format {
+	case "png":
+		imageType = "PNG"
+	case "jpeg":
+		imageType = "JPG"
+	default:
+		return false
+	}
+
+	// gofpdf rejects some valid images (interlaced PNGs, for one) by putting
+	// the whole document into an error state, so try a scratch document first.
+	options := gofpdf.ImageOptions{ImageType: imageType}
+	probe := gofpdf.New("P", "mm", "A4", "")
+	probe.RegisterImageOptionsReader("logo", options, bytes.NewReader(raw))
+	if probe.Err() {
+		return false
+	}
+
+	pdf.RegisterImageOptionsReader("logo", options, bytes.NewReader(raw))
+	return !pdf.Err()
+}
+
+func fitText(pdf *gofpdf.Fpdf, text string, width float64) string {
+	if pdf.GetStringWidth(text) <= width {
+		return text
+	}
+
+	for len(text) > 0 && pdf.GetStringWidth(text+"...") > width {
+		text = text[:len(text)-1]
+	}
+
+	return text + "..."
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+)
+
+const beritaAcaraDir = "reports/berita-acara"
+
+type BeritaAcaraService interface {
+	Generate(ctx context.Context, idBatch int) (*models.BeritaAcara, error)
+	Download(ctx context.Context, idBatch int) (*models.BeritaAcara, []byte, error)
+}
+
+type beritaAcaraService struct {
+	repo           repositories.BeritaAcaraRepository
+	batchRepo      repositories.DestructionBatchRepository
+	pemusnahanRepo repositories.PemusnahanRepository
+	userRepo       repositories.UserRepository
+	infoSistemRepo repositories.InfoSistemRepository
+	transactor     repositories.Transactor
+	audit          audit.Recorder
+}
+
+func NewServiceBeritaAcara(
+	repo repositories.BeritaAcaraRepository,
+	batchRepo repositories.DestructionBatchRepository,
+	pemusnahanRepo repositories.PemusnahanRepository,
+	userRepo repositories.UserRepository,
+	infoSistemRepo repositories.InfoSistemRepository,
+	transactor repositories.Transactor,
+	auditRecorder audit.Recorder,
+) BeritaAcaraService {
+	return &beritaAcaraService{
+		repo:           repo,
+		batchRepo:      batchRepo,
+		pemusnahanRepo: pemusnahanRepo,
+		userRepo:       userRepo,
+		infoSistemRepo: infoSistemRepo,
+		transactor:     transactor,
+		audit:          auditRecorder,
+	}
+}
+
+// Generate writes the berita acara for an executed batch. The first call
+// assigns the next document number of the year; later calls render the
+// document again under the number it already has.
+func (svc *beritaAcaraService) Generate(ctx context.Context, idBatch int) (*models.BeritaAcara, error) {
+	data, err := svc.loadData(ctx, idBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := svc.repo.GetBeritaAcaraByBatch(ctx, idBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		data.BeritaAcara = existing
+		if err := writeBeritaAcara(data); err != nil {
+			return nil, err
+		}
+		return existing, nil
+	}
+
+	executedAt := *data.Batch.ExecutedAt
+	beritaAcara := &models.BeritaAcara{
+		IDBatch:   idBatch,
+		Tahun:     executedAt.Year(),
+		CreatedBy: pkg.GetUserIDFromCtx(ctx),
+	}
+	data.BeritaAcara = beritaAcara
+
+	// The document is rendered to a temporary file inside the transaction
+	// and only moved to its numbered path once the number is committed, so a
+	// rollback never leaves a file behind under a number that was not kept.
+	var tmpPath string
+	err = svc.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		urutan, err := svc.repo.NextBeritaAcaraUrutanTx(ctx, tx, beritaAcara.Tahun)
+		if err != nil {
+			return err
+		}
+
+		beritaAcara.Urutan = urutan
+		beritaAcara.Nomor = fmt.Sprintf("%03d/BA-PMS/RM/%s/%d", urutan, romanMonths[executedAt.Month()-1], beritaAcara.Tahun)
+		beritaAcara.FilePath = filepath.Join(beritaAcaraDir, fmt.Sprintf("berita-acara-%d-%03d.pdf", beritaAcara.Tahun, urutan))
+
+		if tmpPath, err = renderBeritaAcaraTemp(data); err != nil {
+			return err
+		}
+
+		_, err = svc.repo.CreateBeritaAcaraTx(ctx, tx, beritaAcara)
+		return err
+	})
+	if err != nil {
+		if tmpPath != "" {
+			os.Remove(tmpPath)
+		}
+		return nil, err
+	}
+
+	// Download renders the file again if it is missing, so a failed rename
+	// only costs this response.
+	if err := os.Rename(tmpPath, beritaAcara.FilePath); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("Failed to write berita acara: %w", err)
+	}
+
+	svc.audit.Record(ctx, audit.Create, "berita_acara", beritaAcara.ID, nil, beritaAcara)
+	return beritaAcara, nil
+}
+
+func (svc *beritaAcaraService) Download(ctx context.Context, idBatch int) (*models.BeritaAcara, []byte, error) {
+	beritaAcara, err := svc.repo.GetBeritaAcaraByBatch(ctx, idBatch)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if beritaAcara != nil {
+		content, err := os.ReadFile(beritaAcara.FilePath)
+		if err == nil {
+			return beritaAcara, content, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, nil, err
+		}
+	}
+
+	// Not generated yet, or the file was lost: render it now.
+	beritaAcara, err = svc.Generate(ctx, idBatch)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, err := os.ReadFile(beritaAcara.FilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return beritaAcara, content, nil
+}
+
+func (svc *beritaAcaraService) loadData(ctx context.Context, idBatch int) (*beritaAcaraData, error) {
+	batch, err := svc.batchRepo.GetBatchByID(ctx, idBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	if batch == nil {
+		return nil, errors.New("Destruction batch not found")
+	}
+
+	if batch.State != BatchExecuted || batch.ExecutedAt == nil {
+		return nil, fmt.Errorf("%w: berita acara is only available for an executed batch", ErrBatchState)
+	}
+
+	if batch.Approvals, err = svc.batchRepo.GetBatchApprovals(ctx, idBatch); err != nil {
+		return nil, err
+	}
+
+	records, err := svc.pemusnahanRepo.GetPemusnahanByBatch(ctx, idBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &beritaAcaraData{
+		Batch:   batch,
+		Records: records,
+	}
+
+	// A missing info_sistem row only costs the letterhead.
+	if info, err := svc.infoSistemRepo.GetAllInfoSistem(ctx, models.InfoSistem{}); err == nil {
+		data.Info = info
+	}
+
+	if data.Proposer, err = svc.userName(ctx, batch.ProposedBy); err != nil {
+		return nil, err
+	}
+
+	for _, approval := range batch.Approvals {
+		name, err := svc.userName(ctx, approval.IDUser)
+		if err != nil {
+			return nil, err
+		}
+		data.Approvers = append(data.Approvers, beritaAcaraSigner{Name: name, SignedAt: approval.CreatedAt})
+	}
+
+	if batch.ExecutedBy != nil {
+		if data.Executor, err = svc.userName(ctx, *batch.ExecutedBy); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+func (svc *beritaAcaraService) userName(ctx context.Context, id int) (string, error) {
+	user, err := svc.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	if user == nil {
+		return fmt.Sprintf("User #%d", id), nil
+	}
+
+	return user.Name, nil
+}
+
+// writeBeritaAcara renders data to data.BeritaAcara.FilePath, replacing any
+// earlier copy in one step.
+func writeBeritaAcara(data *beritaAcaraData) error {
+	tmpPath, err := renderBeritaAcaraTemp(data)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, data.BeritaAcara.FilePath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("Failed to write berita acara: %w", err)
+	}
+
+	return nil
+}
+
+// renderBeritaAcaraTemp renders data to a new temporary file next to the
+// berita acara, so it can be renamed into place, and returns its path.
+func renderBeritaAcaraTemp(data *beritaAcaraData) (string, error) {
+	content, err := renderBeritaAcara(data)
+	if err != nil {
+		return "", fmt.Errorf("Failed to render berita acara: %w", err)
+	}
+
+	if err := os.MkdirAll(beritaAcaraDir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("Failed to create berita acara dir: %w", err)
+	}
+
+	file, err := os.CreateTemp(beritaAcaraDir, ".berita-acara-*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("Failed to write berita acara: %w", err)
+	}
+
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0o644)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("Failed to write berita acara: %w", err)
+	}
+
+	return file.Name(), nil
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+)
+
+type memoryBeritaAcaraRepo struct {
+	repositories.BeritaAcaraRepository
+	existing  *models.BeritaAcara
+	createErr error
+}
+
+func (repo *memoryBeritaAcaraRepo) GetBeritaAcaraByBatch(ctx context.Context, idBatch int) (*models.BeritaAcara, error) {
+	return repo.existing, nil
+}
+
+func (repo *memoryBeritaAcaraRepo) NextBeritaAcaraUrutanTx(ctx context.Context, tx *sql.Tx, tahun int) (int, error) {
+	return 4, nil
+}
+
+func (repo *memoryBeritaAcaraRepo) CreateBeritaAcaraTx(ctx context.Context, tx *sql.Tx, beritaAcara *models.BeritaAcara) (*models.BeritaAcara, error) {
+	if repo.createErr != nil {
+		return nil, repo.createErr
+	}
+	beritaAcara.ID = 1
+	return beritaAcara, nil
+}
+
+type memoryBatchRepo struct {
+	repositories.DestructionBatchRepository
+	batch *models.DestructionBatch
+}
+
+func (repo memoryBatchRepo) GetBatchByID(ctx context.Context, id int) (*models.DestructionBatch, error) {
+	return repo.batch, nil
+}
+
+func (repo memoryBatchRepo) GetBatchApprovals(ctx context.Context, id int) ([]*models.DestructionBatchApproval, error) {
+	return nil, nil
+}
+
+type memoryInfoSistemRepo struct {
+	repositories.InfoSistemRepository
+}
+
+func (repo memoryInfoSistemRepo) GetAllInfoSistem(ctx context.Context, infoSistem models.InfoSistem) (*models.InfoSistem, error) {
+	return nil, sql.ErrNoRows
+}
+
+// failingCommit runs fn and then fails as a lost connection at COMMIT would.
+type failingCommit struct {
+	err error
+}
+
+func (tx failingCommit) WithinTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if err := fn(nil); err != nil {
+		return err
+	}
+	return tx.err
+}
+
+func newBeritaAcaraTestService(t *testing.T, repo *memoryBeritaAcaraRepo, transactor repositories.Transactor) BeritaAcaraService {
+	t.Chdir(t.TempDir())
+
+	executedAt := time.Date(2025, time.May, 20, 10, 0, 0, 0, time.UTC)
+	batch := &models.DestructionBatch{ID: 3, Nama: "Batch Mei", State: BatchExecuted, ExecutedAt: &executedAt}
+
+	return NewServiceBeritaAcara(repo, memoryBatchRepo{batch: batch}, &memoryPemusnahanRepo{}, memoryUserRepo{}, memoryInfoSistemRepo{}, transactor, &memoryRecorder{})
+}
+
+// beritaAcaraFiles lists every file under the berita acara dir, temporary
+// ones included.
+func beritaAcaraFiles(t *testing.T) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(beritaAcaraDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("read %s: %v", beritaAcaraDir, err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestBeritaAcaraGenerate(t *testing.T) {
+	svc := newBeritaAcaraTestService(t, &memoryBeritaAcaraRepo{}, newMemoryStore())
+
+	beritaAcara, err := svc.Generate(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	if want := "004/BA-PMS/RM/V/2025"; beritaAcara.Nomor != want {
+		t.Errorf("Nomor = %q, want %q", beritaAcara.Nomor, want)
+	}
+	if want := filepath.Join(beritaAcaraDir, "berita-acara-2025-004.pdf"); beritaAcara.FilePath != want {
+		t.Errorf("FilePath = %q, want %q", beritaAcara.FilePath, want)
+	}
+
+	files := beritaAcaraFiles(t)
+	if len(files) != 1 || files[0] != "berita-acara-2025-004.pdf" {
+		t.Errorf("files = %v, want only the numbered berita acara", files)
+	}
+}
+
+func TestBeritaAcaraGenerateRollbackLeavesNoFile(t *testing.T) {
+	insertErr := errors.New("insert failed")
+	commitErr := errors.New("commit failed")
+
+	tests := []struct {
+		name       string
+		repo       *memoryBeritaAcaraRepo
+		transactor repositories.Transactor
+		wantErr    error
+	}{
+		{"insert fails", &memoryBeritaAcaraRepo{createErr: insertErr}, newMemoryStore(), insertErr},
+		{"commit fails", &memoryBeritaAcaraRepo{}, failingCommit{err: commitErr}, commitErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newBeritaAcaraTestService(t, tt.repo, tt.transactor)
+
+			if _, err := svc.Generate(context.Background(), 3); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Generate err = %v, want %v", err, tt.wantErr)
+			}
+
+			if files := beritaAcaraFiles(t); len(files) != 0 {
+				t.Errorf("files = %v, want none after the rollback", files)
+			}
+		})
+	}
+}
+
+func TestBeritaAcaraGenerateExistingReplacesFile(t *testing.T) {
+	existing := &models.BeritaAcara{
+		ID:       1,
+		IDBatch:  3,
+		Tahun:    2025,
+		Urutan:   2,
+		Nomor:    "002/BA-PMS/RM/V/2025",
+		FilePath: filepath.Join(beritaAcaraDir, "berita-acara-2025-002.pdf"),
+	}
+	svc := newBeritaAcaraTestService(t, &memoryBeritaAcaraRepo{existing: existing}, newMemoryStore())
+
+	if err := os.MkdirAll(beritaAcaraDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(existing.FilePath, []byte("stale"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.Generate(context.Background(), 3); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	content, err := os.ReadFile(existing.FilePath)
+	if err != nil {
+		t.Fatalf("read berita acara: %v", err)
+	}
+	if string(content[:4]) != "%PDF" {
+		t.Errorf("berita acara starts with %q, want a rendered PDF", content[:4])
+	}
+	if files := beritaAcaraFiles(t); len(files) != 1 {
+		t.Errorf("files = %v, want only the berita acara", files)
+	}
+}
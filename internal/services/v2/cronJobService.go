@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/scheduler"
+)
+
+// CronJobScheduler is the part of the running scheduler the API needs: it is
+// told to re-read cron_jobs after an edit and asked for upcoming run times.
+type CronJobScheduler interface {
+	Sync(ctx context.Context) error
+	NextRun(name string) *time.Time
+}
+
+type CronJobService interface {
+	GetAll(ctx context.Context) ([]*models.CronJob, error)
+	GetByName(ctx context.Context, name string) (*models.CronJob, error)
+	Update(ctx context.Context, job models.CronJob) (*models.CronJob, error)
+}
+
+type cronJobService struct {
+	repo      repositories.CronJobRepository
+	scheduler CronJobScheduler
+	audit     audit.Recorder
+}
+
+func NewServiceCronJob(repo repositories.CronJobRepository, scheduler CronJobScheduler, auditRecorder audit.Recorder) CronJobService {
+	return &cronJobService{repo: repo, scheduler: scheduler, audit: auditRecorder}
+}
+
+func (svc *cronJobService) GetAll(ctx context.Context) ([]*models.CronJob, error) {
+	jobs, err := svc.repo.GetAllCronJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, job := range jobs {
+		svc.fillNextRun(job)
+	}
+
+	return jobs, nil
+}
+
+func (svc *cronJobService) GetByName(ctx context.Context, name string) (*models.CronJob, error) {
+	job, err := svc.repo.GetCronJobByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, errors.New("Cron job not found")
+	}
+
+	svc.fillNextRun(job)
+	return job, nil
+}
+
+func (svc *cronJobService) Update(ctx context.Context, job models.CronJob) (*models.CronJob, error) {
+	existing, err := svc.repo.GetCronJobByName(ctx, job.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, errors.New("Cron job not found")
+	}
+
+	job.Expression = strings.TrimSpace(job.Expression)
+	job.Timezone = strings.TrimSpace(job.Timezone)
+	if job.Expression == "" {
+		job.Expression = existing.Expression
+	}
+	if job.Timezone == "" {
+		job.Timezone = existing.Timezone
+	}
+
+	if err := scheduler.Validate(job.Expression, job.Timezone); err != nil {
+		return nil, errors.New("Invalid schedule: " + err.Error())
+	}
+
+	updated, err := svc.repo.UpdateCronJob(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.audit.Record(ctx, audit.Update, "cron_job", job.Name, existing, updated)
+
+	if svc.scheduler != nil {
+		if err := svc.scheduler.Sync(ctx); err != nil {
+			log.Printf("Failed to reload scheduler after updating %s: %v", job.Name, err)
+		}
+	}
+
+	svc.fillNextRun(updated)
+	return updated, nil
+}
+
+func (svc *cronJobService) fillNextRun(job *models.CronJob) {
+	if svc.scheduler == nil || job == nil || !job.Enabled {
+		return
+	}
+	job.NextRun = svc.scheduler.NextRun(job.Name)
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+)
+
+const (
+	cronReportDir = "reports"
+	cronUploadDir = "uploads"
+
+	// Files younger than this may belong to an upload whose dokumen row has
+	// not been written yet.
+	uploadCleanupGrace = 24 * time.Hour
+
+	// Registrations whose email is still unverified after this long are
+	// deleted so the address can be registered again.
+	unverifiedUserRetention = 7 * 24 * time.Hour
+)
+
+// GenerateReport writes the current cron preview to reports/ so the pending
+// inactivations and lifecycle changes are archived on a schedule.
+func (svc *cronService) GenerateReport(ctx context.Context, trigger string) (*models.CronRun, error) {
+	unlock, err := svc.lockJob(ctx, CronJobReport)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	rec := svc.startRun(ctx, CronJobReport, trigger)
+
+	path, err := svc.writeReport(ctx)
+	if err == nil {
+		rec.run.Processed = 1
+		rec.run.Message = "Report written to " + path
+	}
+
+	rec.finish(ctx, err)
+	return rec.run, err
+}
+
+func (svc *cronService) writeReport(ctx context.Context) (string, error) {
+	data, err := svc.ExportPreview(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(cronReportDir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("Failed to create report dir: %w", err)
+	}
+
+	path := filepath.Join(cronReportDir, fmt.Sprintf("cron-report-%s.xlsx", time.Now().Format("2006-01-02-150405")))
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", fmt.Errorf("Failed to write report: %w", err)
+	}
+
+	return path, nil
+}
+
+// CleanupUploads removes files under uploads/ that no dokumen row points to,
+// then drops the upload directories left empty.
+func (svc *cronService) CleanupUploads(ctx context.Context, trigger string) (*models.CronRun, error) {
+	unlock, err := svc.lockJob(ctx, CronJobUploadCleanup)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	rec := svc.startRun(ctx, CronJobUploadCleanup, trigger)
+
+	err = svc.cleanupUploads(ctx, rec)
+	if err == nil {
+		rec.run.Message = fmt.Sprintf("Removed %d orphaned file(s), kept %d", rec.run.Processed, rec.run.Skipped)
+	}
+
+	rec.finish(ctx, err)
+	return rec.run, err
+}
+
+func (svc *cronService) cleanupUploads(ctx context.Context, rec *cronRunRecorder) error {
+	paths, err := svc.dokumenRepo.GetAllDokumenPaths(ctx)
+	if err != nil {
+		return err
+	}
+
+	referenced := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		referenced[filepath.Clean(path)] = true
+	}
+
+	cutoff := time.Now().Add(-uploadCleanupGrace)
+	var dirs []string
+
+	err = filepath.WalkDir(cronUploadDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == cronUploadDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		if d.IsDir() {
+			if path != cronUploadDir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if referenced[filepath.Clean(path)] || info.ModTime().After(cutoff) {
+			rec.run.Skipped++
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil {
+			log.Printf("Failed to remove orphaned upload %s: %v", path, err)
+			rec.run.Failed++
+			return nil
+		}
+
+		log.Printf("Removed orphaned upload %s", path)
+		rec.run.Processed++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Deepest directories first so parents become empty before they are checked.
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err == nil && len(entries) == 0 {
+			os.Remove(dir)
+		}
+	}
+
+	return nil
+}
+
+// PurgeUnverifiedUsers deletes registrations that never verified their email
+// within unverifiedUserRetention.
+func (svc *cronService) PurgeUnverifiedUsers(ctx context.Context, trigger string) (*models.CronRun, error) {
+	unlock, err := svc.lockJob(ctx, CronJobRegistrationPurge)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	rec := svc.startRun(ctx, CronJobRegistrationPurge, trigger)
+
+	err = svc.purgeUnverifiedUsers(ctx, rec)
+	if err == nil {
+		rec.run.Message = fmt.Sprintf("Removed %d unverified registration(s)", rec.run.Processed)
+	}
+
+	rec.finish(ctx, err)
+	return rec.run, err
+}
+
+func (svc *cronService) purgeUnverifiedUsers(ctx context.Context, rec *cronRunRecorder) error {
+	users, err := svc.userRepo.GetUnverifiedUsers(ctx, time.Now().Add(-unverifiedUserRetention))
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		deleted, err := svc.userRepo.DeleteUnverified(ctx, user.ID)
+		if err != nil {
+			log.Printf("Failed to remove unverified user %d: %v", user.ID, err)
+			rec.run.Failed++
+			continue
+		}
+		if !deleted {
+			rec.run.Skipped++
+			continue
+		}
+
+		svc.audit.Record(ctx, audit.Delete, "user", user.ID, user, nil)
+		rec.run.Processed++
+	}
+
+	return nil
+}
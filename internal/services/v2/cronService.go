@@ -2,78 +2,144 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/lifecycle"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/scheduler"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	CronTriggerScheduled = scheduler.TriggerScheduled
+	CronTriggerManual    = scheduler.TriggerManual
+	CronTriggerInitial   = scheduler.TriggerInitial
+)
+
+const cronLockPrefix = "alih_media_retensi:cron:"
+
+const (
+	CronJobInactivation      = "inactivation"
+	CronJobLifecycle         = "lifecycle"
+	CronJobReport            = "report"
+	CronJobUploadCleanup     = "upload_cleanup"
+	CronJobRegistrationPurge = "registration_purge"
 )
 
 type CronService interface {
-	CheckAndProcessKunjungan(ctx context.Context) error
+	CheckAndProcessKunjungan(ctx context.Context, trigger string) (*models.CronRun, error)
 	ProcessKunjungan(ctx context.Context, id int) error
+	AdvanceLifecycle(ctx context.Context, trigger string) (*models.CronRun, error)
+	Preview(ctx context.Context) (*CronPreview, error)
+	ExportPreview(ctx context.Context) ([]byte, error)
+	GetRuns(ctx context.Context, page, perPage int) (*CronRunPagination, error)
+	GetRunByID(ctx context.Context, id int) (*CronRunDetail, error)
+	GetRunItemsByKunjungan(ctx context.Context, idKunjungan int) ([]*models.CronRunItem, error)
+	GenerateReport(ctx context.Context, trigger string) (*models.CronRun, error)
+	CleanupUploads(ctx context.Context, trigger string) (*models.CronRun, error)
+	PurgeUnverifiedUsers(ctx context.Context, trigger string) (*models.CronRun, error)
 }
 
 type cronService struct {
-	kunjunganRepo repositories.KunjunganRepository
-	kasusRepo     repositories.KasusRepository
-	alihMediaRepo repositories.AlihMediaRepository
+	kunjunganRepo  repositories.KunjunganRepository
+	kasusRepo      repositories.KasusRepository
+	alihMediaRepo  repositories.AlihMediaRepository
+	retensiRepo    repositories.RetensiRepository
+	pemusnahanRepo repositories.PemusnahanRepository
+	cronRunRepo    repositories.CronRunRepository
+	dokumenRepo    repositories.DokumenRepository
+	lockRepo       repositories.LockRepository
+	transactor     repositories.Transactor
+	legalHoldRepo  repositories.LegalHoldRepository
+	userRepo       repositories.UserRepository
+	audit          audit.Recorder
+	evaluator      *expiryEvaluator
 }
 
 func NewCronService(
 	kunjunganRepo repositories.KunjunganRepository,
 	kasusRepo repositories.KasusRepository,
+	policyRepo repositories.RetentionPolicyRepository,
+	pasienRepo repositories.PasienRepository,
 	alihMediaRepo repositories.AlihMediaRepository,
+	retensiRepo repositories.RetensiRepository,
+	pemusnahanRepo repositories.PemusnahanRepository,
+	cronRunRepo repositories.CronRunRepository,
+	dokumenRepo repositories.DokumenRepository,
+	lockRepo repositories.LockRepository,
+	transactor repositories.Transactor,
+	legalHoldRepo repositories.LegalHoldRepository,
+	userRepo repositories.UserRepository,
+	auditRecorder audit.Recorder,
 ) CronService {
 	return &cronService{
-		kunjunganRepo: kunjunganRepo,
-		kasusRepo:     kasusRepo,
-		alihMediaRepo: alihMediaRepo,
+		kunjunganRepo:  kunjunganRepo,
+		kasusRepo:      kasusRepo,
+		alihMediaRepo:  alihMediaRepo,
+		retensiRepo:    retensiRepo,
+		pemusnahanRepo: pemusnahanRepo,
+		cronRunRepo:    cronRunRepo,
+		dokumenRepo:    dokumenRepo,
+		lockRepo:       lockRepo,
+		transactor:     transactor,
+		legalHoldRepo:  legalHoldRepo,
+		userRepo:       userRepo,
+		audit:          auditRecorder,
+		evaluator:      newExpiryEvaluator(kasusRepo, policyRepo, pasienRepo),
 	}
 }
 
-func (svc *cronService) CheckAndProcessKunjungan(ctx context.Context) error {
-	log.Println("Starting cron job: Checking for kunjungan tidak aktif")
+type CronRunPagination struct {
+	Data       []*models.CronRun `json:"data"`
+	Total      int               `json:"total"`
+	Page       int               `json:"page"`
+	PerPage    int               `json:"per_page"`
+	TotalPages int               `json:"total_pages"`
+}
 
-	activeKunjungan, err := svc.kunjunganRepo.GetActiveKunjungan(ctx)
+type CronRunDetail struct {
+	Run   *models.CronRun       `json:"run"`
+	Items []*models.CronRunItem `json:"items"`
+}
+
+func (svc *cronService) CheckAndProcessKunjungan(ctx context.Context, trigger string) (*models.CronRun, error) {
+	unlock, err := svc.lockJob(ctx, CronJobInactivation)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer unlock()
 
-	now := time.Now()
-	processedCount := 0
-
-	for _, kunjungan := range activeKunjungan {
-		kasus, err := svc.kasusRepo.GetKasusByID(ctx, kunjungan.IDKasus)
-		if err != nil {
-			log.Printf("Error getting kasus for kunjungan %d: %v", kunjungan.ID, err)
-			continue
-		}
+	log.Println("Starting cron job: Checking for kunjungan tidak aktif")
 
-		var masaInaktif int
-		if kunjungan.JenisKunjungan == "RI" {
-			masaInaktif = kasus.MasaInaktifRI
-		} else if kunjungan.JenisKunjungan == "RJ" {
-			masaInaktif = kasus.MasaInaktifRJ
-		} else {
-			continue
-		}
+	rec := svc.startRun(ctx, CronJobInactivation, trigger)
 
-		expired := kunjungan.TanggalMasuk.AddDate(masaInaktif, 0, 0)
+	changes, err := svc.planInactivation(ctx, time.Now(), rec)
+	if err != nil {
+		rec.finish(ctx, err)
+		return rec.run, err
+	}
 
-		if now.After(expired) {
-			_, err := svc.processInactiveKunjungan(ctx, kunjungan)
-			if err != nil {
-				log.Printf("Error processing kunjungan %d: %v", kunjungan.ID, err)
-				continue
-			}
-			processedCount++
+	err = runConcurrently(ctx, expiryWorkerCount, len(changes), func(i int) {
+		change := changes[i]
+		_, err := inactivateKunjungan(ctx, svc.transactor, svc.kunjunganRepo, svc.alihMediaRepo, svc.audit, change.Kunjungan)
+		if err != nil {
+			log.Printf("Error processing kunjungan %d: %v", change.IDKunjungan, err)
+			rec.fail(ctx, change.IDKunjungan, change.Action, err)
+			return
 		}
-	}
+		rec.process(ctx, change)
+	})
 
-	log.Printf("Cron job completed. Processed %d kunjungen", processedCount)
-	return nil
+	log.Printf("Cron job completed. Processed %d kunjungen", rec.run.Processed)
+	rec.finish(ctx, err)
+	return rec.run, err
 }
 
 func (svc *cronService) ProcessKunjungan(ctx context.Context, id int) error {
@@ -90,28 +156,37 @@ func (svc *cronService) ProcessKunjungan(ctx context.Context, id int) error {
 		return nil
 	}
 
-	kasus, err := svc.kasusRepo.GetKasusByID(ctx, kunjungan.IDKasus)
+	decisions, err := svc.evaluator.Evaluate(ctx, []*models.Kunjungan{kunjungan}, time.Now())
 	if err != nil {
 		return err
 	}
-
-	var masaInaktif int
-	if kunjungan.JenisKunjungan == "RI" {
-		masaInaktif = kasus.MasaInaktifRI
-	} else if kunjungan.JenisKunjungan == "RJ" {
-		masaInaktif = kasus.MasaInaktifRJ
-	} else {
-		return fmt.Errorf("unknown jenis kunjungan: %s", kunjungan.JenisKunjungan)
+	decision := decisions[0]
+	if decision.Err != nil {
+		return decision.Err
+	}
+	if decision.Skip != "" {
+		return errors.New(decision.Skip)
 	}
+	kasus, expired := decision.Kasus, decision.ExpiredAt
 
-	expired := kunjungan.TanggalMasuk.AddDate(masaInaktif, 0, 0)
-	now := time.Now()
+	if decision.Expired {
+		unlock, err := svc.lockJob(ctx, CronJobInactivation)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		rec := svc.startRun(ctx, CronJobInactivation, CronTriggerManual)
 
-	if now.After(expired) {
-		_, err := svc.processInactiveKunjungan(ctx, kunjungan)
+		_, err = inactivateKunjungan(ctx, svc.transactor, svc.kunjunganRepo, svc.alihMediaRepo, svc.audit, kunjungan)
 		if err != nil {
+			rec.fail(ctx, kunjungan.ID, CronActionInactivate, err)
+			rec.finish(ctx, nil)
 			return err
 		}
+
+		rec.process(ctx, newPlannedChange(kunjungan, kasus, CronActionInactivate, expired))
+		rec.finish(ctx, nil)
 		log.Printf("Successfully processed kunjungan %d as inactive", id)
 	} else {
 		log.Printf("Kunjungan %d is not yet expired (expires on %v)", id, expired)
@@ -120,24 +195,485 @@ func (svc *cronService) ProcessKunjungan(ctx context.Context, id int) error {
 	return nil
 }
 
-func (svc *cronService) processInactiveKunjungan(ctx context.Context, kunjungan *models.Kunjungan) (*models.AlihMedia, error) {
-	err := svc.kunjunganRepo.UpdateKunjunganStatus(ctx, kunjungan.ID, "tidak aktif")
+// Rows that already have a next-stage row are filtered out by the repository,
+// so running this more than once never creates duplicates.
+func (svc *cronService) AdvanceLifecycle(ctx context.Context, trigger string) (*models.CronRun, error) {
+	unlock, err := svc.lockJob(ctx, CronJobLifecycle)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	log.Println("Starting cron job: Advancing alih media / retensi / pemusnahan lifecycle")
+
+	rec := svc.startRun(ctx, CronJobLifecycle, trigger)
+
+	changes, err := svc.planLifecycle(ctx, time.Now(), rec)
+	if err != nil {
+		rec.finish(ctx, err)
+		return rec.run, err
+	}
+
+	for _, change := range changes {
+		if err := svc.applyLifecycleChange(ctx, change); err != nil {
+			log.Printf("Error applying %s for kunjungan %d: %v", change.Action, change.IDKunjungan, err)
+			rec.fail(ctx, change.IDKunjungan, change.Action, err)
+			continue
+		}
+
+		switch change.Action {
+		case CronActionCreateRetensi:
+			log.Printf("Kunjungan %d: alih media -> retensi (due %s)", change.IDKunjungan, change.ExpiredAt.Format("2006-01-02"))
+		case CronActionCreatePemusnahan:
+			log.Printf("Kunjungan %d: retensi -> pemusnahan (due %s)", change.IDKunjungan, change.ExpiredAt.Format("2006-01-02"))
+		}
+		rec.process(ctx, change)
+	}
+
+	log.Printf("Lifecycle job completed. Processed %d, failed %d", rec.run.Processed, rec.run.Failed)
+	rec.finish(ctx, nil)
+	return rec.run, nil
+}
+
+func (svc *cronService) applyLifecycleChange(ctx context.Context, change *CronPlannedChange) error {
+	now := time.Now()
+
+	switch change.Action {
+	case CronActionCreateRetensi:
+		retensi, err := svc.retensiRepo.CreateRetensi(ctx, &models.Retensi{
+			ID:        change.IDKunjungan,
+			Status:    string(lifecycle.RetensiBelum),
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+
+		svc.audit.Record(ctx, audit.Create, "retensi", change.IDKunjungan, nil, retensi)
+		return nil
+	case CronActionCreatePemusnahan:
+		pemusnahan, err := svc.pemusnahanRepo.CreatePemusnahan(ctx, &models.Pemusnahan{
+			ID:        change.IDKunjungan,
+			Status:    string(lifecycle.PemusnahanBelum),
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+
+		svc.audit.Record(ctx, audit.Create, "pemusnahan", change.IDKunjungan, nil, pemusnahan)
+		return nil
+	}
+
+	return fmt.Errorf("unknown lifecycle action: %s", change.Action)
+}
+
+var errUnknownJenisKunjungan = errors.New("unknown jenis kunjungan")
+
+func masaKasus(kasus *models.Kasus, jenisKunjungan string) (int, int, error) {
+	switch jenisKunjungan {
+	case "RI":
+		return kasus.MasaAktifRI, kasus.MasaInaktifRI, nil
+	case "RJ":
+		return kasus.MasaAktifRJ, kasus.MasaInaktifRJ, nil
+	default:
+		return 0, 0, fmt.Errorf("%w: %s", errUnknownJenisKunjungan, jenisKunjungan)
+	}
+}
+
+type CronAction string
+
+const (
+	CronActionInactivate       CronAction = "inactivate"
+	CronActionCreateRetensi    CronAction = "create_retensi"
+	CronActionCreatePemusnahan CronAction = "create_pemusnahan"
+)
+
+type CronPlannedChange struct {
+	IDKunjungan    int               `json:"id_kunjungan"`
+	IDPasien       int               `json:"id_pasien"`
+	JenisKunjungan string            `json:"jenis_kunjungan"`
+	JenisKasus     string            `json:"jenis_kasus"`
+	TglMasuk       time.Time         `json:"tgl_masuk"`
+	Action         CronAction        `json:"action"`
+	ExpiredAt      time.Time         `json:"expired_at"`
+	Kunjungan      *models.Kunjungan `json:"-"`
+}
+
+type CronPreview struct {
+	GeneratedAt     time.Time            `json:"generated_at"`
+	TotalInactivate int                  `json:"total_inactivate"`
+	TotalRetensi    int                  `json:"total_retensi"`
+	TotalPemusnahan int                  `json:"total_pemusnahan"`
+	Changes         []*CronPlannedChange `json:"changes"`
+}
+
+func (svc *cronService) Preview(ctx context.Context) (*CronPreview, error) {
+	now := time.Now()
+
+	inactivation, err := svc.planInactivation(ctx, now, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	alihMedia := &models.AlihMedia{
-		ID:         kunjungan.ID,
-		TglLaporan: nil,
-		Status:     "belum di alih media",
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
+	lifecycleChanges, err := svc.planLifecycle(ctx, now, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &CronPreview{
+		GeneratedAt: now,
+		Changes:     append(inactivation, lifecycleChanges...),
 	}
 
-	createdAlihMedia, err := svc.alihMediaRepo.CreateAlihMedia(ctx, alihMedia)
+	for _, change := range preview.Changes {
+		switch change.Action {
+		case CronActionInactivate:
+			preview.TotalInactivate++
+		case CronActionCreateRetensi:
+			preview.TotalRetensi++
+		case CronActionCreatePemusnahan:
+			preview.TotalPemusnahan++
+		}
+	}
+
+	return preview, nil
+}
+
+func (svc *cronService) ExportPreview(ctx context.Context) ([]byte, error) {
+	preview, err := svc.Preview(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return createdAlihMedia, nil
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheetName := "Preview"
+	f.SetSheetName("Sheet1", sheetName)
+
+	headers := []string{"ID Kunjungan", "ID Pasien", "Jenis Kunjungan", "Jenis Kasus", "Tgl Masuk", "Aksi", "Tgl Kedaluwarsa"}
+	headerStyle := pkg.GetHeaderStyle(f)
+	for i, header := range headers {
+		f.SetCellValue(sheetName, pkg.GetCell(i+1, 1), header)
+		f.SetCellStyle(sheetName, pkg.GetCell(i+1, 1), pkg.GetCell(i+1, 1), headerStyle)
+	}
+
+	for i, change := range preview.Changes {
+		rowNum := i + 2
+
+		f.SetCellValue(sheetName, pkg.GetCell(1, rowNum), change.IDKunjungan)
+		f.SetCellValue(sheetName, pkg.GetCell(2, rowNum), change.IDPasien)
+		f.SetCellValue(sheetName, pkg.GetCell(3, rowNum), change.JenisKunjungan)
+		f.SetCellValue(sheetName, pkg.GetCell(4, rowNum), change.JenisKasus)
+		f.SetCellValue(sheetName, pkg.GetCell(5, rowNum), change.TglMasuk.Format("2006-01-02"))
+		f.SetCellValue(sheetName, pkg.GetCell(6, rowNum), string(change.Action))
+		f.SetCellValue(sheetName, pkg.GetCell(7, rowNum), change.ExpiredAt.Format("2006-01-02"))
+	}
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (svc *cronService) planInactivation(ctx context.Context, now time.Time, rec *cronRunRecorder) ([]*CronPlannedChange, error) {
+	activeKunjungan, err := svc.kunjunganRepo.GetActiveKunjungan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	decisions, err := svc.evaluator.Evaluate(ctx, activeKunjungan, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*CronPlannedChange
+	for _, decision := range decisions {
+		kunjungan := decision.Kunjungan
+
+		switch {
+		case decision.Err != nil:
+			log.Printf("Error getting kasus for kunjungan %d: %v", kunjungan.ID, decision.Err)
+			rec.fail(ctx, kunjungan.ID, CronActionInactivate, decision.Err)
+		case decision.Skip != "":
+			rec.skip(ctx, kunjungan.ID, CronActionInactivate, decision.Skip)
+		case decision.Expired:
+			changes = append(changes, newPlannedChange(kunjungan, decision.Kasus, CronActionInactivate, decision.ExpiredAt))
+		default:
+			rec.skip(ctx, kunjungan.ID, CronActionInactivate, "")
+		}
+	}
+
+	return changes, nil
+}
+
+func (svc *cronService) planLifecycle(ctx context.Context, now time.Time, rec *cronRunRecorder) ([]*CronPlannedChange, error) {
+	cache := svc.evaluator.newCache()
+	var changes []*CronPlannedChange
+
+	held, err := svc.legalHoldRepo.GetHeldKunjunganIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	readyRetensi, err := svc.kunjunganRepo.GetKunjunganReadyForRetensi(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, kunjungan := range readyRetensi {
+		if held[kunjungan.ID] {
+			rec.skip(ctx, kunjungan.ID, CronActionCreateRetensi, "under legal hold")
+			continue
+		}
+
+		kasus, schedule, err := cache.schedule(ctx, kunjungan)
+		if err != nil {
+			recordScheduleError(ctx, rec, kunjungan, CronActionCreateRetensi, err)
+			continue
+		}
+
+		if now.After(schedule.RetensiAt) {
+			changes = append(changes, newPlannedChange(kunjungan, kasus, CronActionCreateRetensi, schedule.RetensiAt))
+		} else {
+			rec.skip(ctx, kunjungan.ID, CronActionCreateRetensi, "")
+		}
+	}
+
+	readyPemusnahan, err := svc.kunjunganRepo.GetKunjunganReadyForPemusnahan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, kunjungan := range readyPemusnahan {
+		if held[kunjungan.ID] {
+			rec.skip(ctx, kunjungan.ID, CronActionCreatePemusnahan, "under legal hold")
+			continue
+		}
+
+		kasus, schedule, err := cache.schedule(ctx, kunjungan)
+		if err != nil {
+			recordScheduleError(ctx, rec, kunjungan, CronActionCreatePemusnahan, err)
+			continue
+		}
+
+		if schedule.Permanent {
+			rec.skip(ctx, kunjungan.ID, CronActionCreatePemusnahan, "kept permanently by retention policy")
+			continue
+		}
+
+		if now.After(schedule.PemusnahanAt) {
+			changes = append(changes, newPlannedChange(kunjungan, kasus, CronActionCreatePemusnahan, schedule.PemusnahanAt))
+		} else {
+			rec.skip(ctx, kunjungan.ID, CronActionCreatePemusnahan, "")
+		}
+	}
+
+	return changes, nil
+}
+
+func recordScheduleError(ctx context.Context, rec *cronRunRecorder, kunjungan *models.Kunjungan, action CronAction, err error) {
+	if errors.Is(err, errUnknownJenisKunjungan) {
+		log.Printf("Skipping kunjungan %d: %v", kunjungan.ID, err)
+		rec.skip(ctx, kunjungan.ID, action, err.Error())
+		return
+	}
+
+	log.Printf("Error getting kasus for kunjungan %d: %v", kunjungan.ID, err)
+	rec.fail(ctx, kunjungan.ID, action, err)
+}
+
+func newPlannedChange(kunjungan *models.Kunjungan, kasus *models.Kasus, action CronAction, expiredAt time.Time) *CronPlannedChange {
+	return &CronPlannedChange{
+		IDKunjungan:    kunjungan.ID,
+		IDPasien:       kunjungan.IDPasien,
+		JenisKunjungan: kunjungan.JenisKunjungan,
+		JenisKasus:     kasus.JenisKasus,
+		TglMasuk:       kunjungan.TanggalMasuk,
+		Action:         action,
+		ExpiredAt:      expiredAt,
+		Kunjungan:      kunjungan,
+	}
+}
+
+func (svc *cronService) GetRuns(ctx context.Context, page, perPage int) (*CronRunPagination, error) {
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 10
+	}
+
+	offset := (page - 1) * perPage
+
+	runs, err := svc.cronRunRepo.GetAllCronRuns(ctx, perPage, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := svc.cronRunRepo.GetTotalCronRuns(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	totalPages := total / perPage
+	if total%perPage > 0 {
+		totalPages++
+	}
+
+	return &CronRunPagination{
+		Data:       runs,
+		Total:      total,
+		Page:       page,
+		PerPage:    perPage,
+		TotalPages: totalPages,
+	}, nil
+}
+
+func (svc *cronService) GetRunByID(ctx context.Context, id int) (*CronRunDetail, error) {
+	if id <= 0 {
+		return nil, errors.New("ID must can't be negative")
+	}
+
+	run, err := svc.cronRunRepo.GetCronRunByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if run == nil {
+		return nil, errors.New("Cron run not found")
+	}
+
+	items, err := svc.cronRunRepo.GetCronRunItems(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CronRunDetail{Run: run, Items: items}, nil
+}
+
+func (svc *cronService) GetRunItemsByKunjungan(ctx context.Context, idKunjungan int) ([]*models.CronRunItem, error) {
+	if idKunjungan <= 0 {
+		return nil, errors.New("ID must can't be negative")
+	}
+
+	return svc.cronRunRepo.GetCronRunItemsByKunjungan(ctx, idKunjungan)
+}
+
+// lockJob takes the cluster-wide lock for job so that only one replica runs it
+// at a time, whether it was started by the scheduler or through the API.
+func (svc *cronService) lockJob(ctx context.Context, job string) (func(), error) {
+	lock, err := svc.lockRepo.AcquireLock(ctx, cronLockPrefix+job)
+	if err != nil {
+		if errors.Is(err, repositories.ErrLockNotAcquired) {
+			log.Printf("Cron job %s is already running on another instance, skipping", job)
+		}
+		return nil, err
+	}
+
+	return func() {
+		if err := lock.Release(context.WithoutCancel(ctx)); err != nil {
+			log.Printf("Failed to release lock for cron job %s: %v", job, err)
+		}
+	}, nil
+}
+
+// cronRunRecorder persists the outcome of one job run. Recording is best
+// effort: a failure to write history is logged but never stops the job. A nil
+// recorder (used by Preview) records nothing.
+type cronRunRecorder struct {
+	mu        sync.Mutex
+	repo      repositories.CronRunRepository
+	run       *models.CronRun
+	persisted bool
+}
+
+func (svc *cronService) startRun(ctx context.Context, job, trigger string) *cronRunRecorder {
+	rec := &cronRunRecorder{
+		repo: svc.cronRunRepo,
+		run: &models.CronRun{
+			Job:         job,
+			TriggeredBy: trigger,
+			Status:      "running",
+			StartedAt:   time.Now(),
+		},
+	}
+
+	if _, err := svc.cronRunRepo.CreateCronRun(context.WithoutCancel(ctx), rec.run); err != nil {
+		log.Printf("Failed to record %s cron run: %v", job, err)
+		return rec
+	}
+
+	rec.persisted = true
+	return rec
+}
+
+func (rec *cronRunRecorder) process(ctx context.Context, change *CronPlannedChange) {
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	rec.run.Processed++
+	rec.mu.Unlock()
+	rec.item(ctx, change.IDKunjungan, change.Action, "processed", "expired at "+change.ExpiredAt.Format("2006-01-02"))
+}
+
+func (rec *cronRunRecorder) skip(ctx context.Context, idKunjungan int, action CronAction, reason string) {
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	rec.run.Skipped++
+	rec.mu.Unlock()
+	if reason != "" {
+		rec.item(ctx, idKunjungan, action, "skipped", reason)
+	}
+}
+
+func (rec *cronRunRecorder) fail(ctx context.Context, idKunjungan int, action CronAction, err error) {
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	rec.run.Failed++
+	rec.mu.Unlock()
+	rec.item(ctx, idKunjungan, action, "failed", err.Error())
+}
+
+func (rec *cronRunRecorder) item(ctx context.Context, idKunjungan int, action CronAction, outcome, message string) {
+	if !rec.persisted {
+		return
+	}
+
+	err := rec.repo.CreateCronRunItem(context.WithoutCancel(ctx), &models.CronRunItem{
+		IDRun:       rec.run.ID,
+		IDKunjungan: idKunjungan,
+		Action:      string(action),
+		Outcome:     outcome,
+		Message:     message,
+	})
+	if err != nil {
+		log.Printf("Failed to record cron run item for kunjungan %d: %v", idKunjungan, err)
+	}
+}
+
+func (rec *cronRunRecorder) finish(ctx context.Context, runErr error) {
+	now := time.Now()
+	rec.run.FinishedAt = &now
+	rec.run.Status = "completed"
+	if runErr != nil {
+		rec.run.Status = "failed"
+		rec.run.Message = runErr.Error()
+	}
+
+	if !rec.persisted {
+		return
+	}
+
+	if err := rec.repo.FinishCronRun(context.WithoutCancel(ctx), *rec.run); err != nil {
+		log.Printf("Failed to finish cron run %d: %v", rec.run.ID, err)
+	}
 }
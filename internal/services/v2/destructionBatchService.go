@@ -0,0 +1,506 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/lifecycle"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+)
+
+const (
+	BatchDraft     = "draft"
+	BatchSubmitted = "submitted"
+	BatchApproved  = "approved"
+	BatchExecuted  = "executed"
+)
+
+const DefaultMinApprovals = 2
+
+// ErrBatchState is returned when an action does not fit the batch's current
+// state or the caller's part in it (for example the proposer approving).
+var ErrBatchState = errors.New("Destruction batch cannot be changed")
+
+var errPemusnahanBatchOnly = fmt.Errorf("%w: pemusnahan can only be completed by executing an approved destruction batch", lifecycle.ErrInvalidTransition)
+
+type DestructionBatchService interface {
+	GetAll(ctx context.Context, page, perPage int) (*DestructionBatchPagination, error)
+	GetByID(ctx context.Context, id int) (*models.DestructionBatch, error)
+	Create(ctx context.Context, batch models.DestructionBatch) (*models.DestructionBatch, error)
+	AddItems(ctx context.Context, id int, idKunjungan []int) (*models.DestructionBatch, error)
+	RemoveItem(ctx context.Context, id, idKunjungan int) (*models.DestructionBatch, error)
+	Submit(ctx context.Context, id int) (*models.DestructionBatch, error)
+	Approve(ctx context.Context, id int, catatan string) (*models.DestructionBatch, error)
+	Reject(ctx context.Context, id int) (*models.DestructionBatch, error)
+	Execute(ctx context.Context, id int) (*models.DestructionBatch, error)
+}
+
+type destructionBatchService struct {
+	repo           repositories.DestructionBatchRepository
+	pemusnahanRepo repositories.PemusnahanRepository
+	kunjunganRepo  repositories.KunjunganRepository
+	legalHoldRepo  repositories.LegalHoldRepository
+	transactor     repositories.Transactor
+	beritaAcara    BeritaAcaraService
+	audit          audit.Recorder
+	minApprovals   int
+}
+
+func NewServiceDestructionBatch(
+	repo repositories.DestructionBatchRepository,
+	pemusnahanRepo repositories.PemusnahanRepository,
+	kunjunganRepo repositories.KunjunganRepository,
+	legalHoldRepo repositories.LegalHoldRepository,
+	transactor repositories.Transactor,
+	beritaAcara BeritaAcaraService,
+	auditRecorder audit.Recorder,
+	minApprovals int,
+) DestructionBatchService {
+	if minApprovals < 1 {
+		minApprovals = DefaultMinApprovals
+	}
+
+	return &destructionBatchService{
+		repo:           repo,
+		pemusnahanRepo: pemusnahanRepo,
+		kunjunganRepo:  kunjunganRepo,
+		legalHoldRepo:  legalHoldRepo,
+		transactor:     transactor,
+		beritaAcara:    beritaAcara,
+		audit:          auditRecorder,
+		minApprovals:   minApprovals,
+	}
+}
+
+type DestructionBatchPagination struct {
+	Data       []*models.DestructionBatch `json:"data"`
+	Total      int                        `json:"total"`
+	Page       int                        `json:"page"`
+	PerPage    int                        `json:"per_page"`
+	TotalPages int                        `json:"total_pages"`
+}
+
+func (svc *destructionBatchService) GetAll(ctx context.Context, page, perPage int) (*DestructionBatchPagination, error) {
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 10
+	}
+
+	offset := (page - 1) * perPage
+
+	batches, err := svc.repo.GetAllBatches(ctx, perPage, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := svc.repo.GetTotalBatches(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	totalPages := total / perPage
+	if total%perPage > 0 {
+		totalPages++
+	}
+
+	return &DestructionBatchPagination{
+		Data:       batches,
+		Total:      total,
+		Page:       page,
+		PerPage:    perPage,
+		TotalPages: totalPages,
+	}, nil
+}
+
+func (svc *destructionBatchService) GetByID(ctx context.Context, id int) (*models.DestructionBatch, error) {
+	batch, err := svc.repo.GetBatchByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if batch == nil {
+		return nil, errors.New("Destruction batch not found")
+	}
+
+	if batch.Items, err = svc.repo.GetBatchItems(ctx, id); err != nil {
+		return nil, err
+	}
+
+	if batch.Approvals, err = svc.repo.GetBatchApprovals(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+func (svc *destructionBatchService) Create(ctx context.Context, batch models.DestructionBatch) (*models.DestructionBatch, error) {
+	batch.Nama = strings.TrimSpace(batch.Nama)
+	if batch.Nama == "" {
+		return nil, errors.New("Nama is required")
+	}
+
+	batch.State = BatchDraft
+	batch.ProposedBy = pkg.GetUserIDFromCtx(ctx)
+	batch.RequiredApprovals = svc.minApprovals
+
+	newBatch, err := svc.repo.CreateBatch(ctx, &batch)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.audit.Record(ctx, audit.Create, "destruction_batch", newBatch.ID, nil, newBatch)
+	return newBatch, nil
+}
+
+func (svc *destructionBatchService) AddItems(ctx context.Context, id int, idKunjungan []int) (*models.DestructionBatch, error) {
+	if len(idKunjungan) == 0 {
+		return nil, errors.New("At least one kunjungan is required")
+	}
+
+	var before models.DestructionBatch
+	err := svc.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		batch, err := svc.lockDraft(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		before = *batch
+
+		for _, idK := range idKunjungan {
+			if err := svc.checkItem(ctx, tx, batch.ID, idK); err != nil {
+				return err
+			}
+
+			if err := svc.repo.AddBatchItemTx(ctx, tx, batch.ID, idK); err != nil {
+				return err
+			}
+		}
+
+		return svc.recordTx(ctx, tx, &before)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.GetByID(ctx, before.ID)
+}
+
+func (svc *destructionBatchService) RemoveItem(ctx context.Context, id, idKunjungan int) (*models.DestructionBatch, error) {
+	var before models.DestructionBatch
+	err := svc.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		batch, err := svc.lockDraft(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		before = *batch
+
+		if err := svc.repo.RemoveBatchItemTx(ctx, tx, id, idKunjungan); err != nil {
+			return err
+		}
+
+		return svc.recordTx(ctx, tx, &before)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.GetByID(ctx, before.ID)
+}
+
+func (svc *destructionBatchService) Submit(ctx context.Context, id int) (*models.DestructionBatch, error) {
+	var before models.DestructionBatch
+	err := svc.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		batch, err := svc.lockDraft(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if len(batch.Items) == 0 {
+			return fmt.Errorf("%w: batch has no records", ErrBatchState)
+		}
+
+		// The approval threshold is fixed when the batch goes up for review so
+		// a later configuration change does not affect batches in flight.
+		before = *batch
+		now := time.Now()
+		batch.State = BatchSubmitted
+		batch.SubmittedAt = &now
+		batch.RequiredApprovals = svc.minApprovals
+
+		if err := svc.repo.UpdateBatchStateTx(ctx, tx, *batch, BatchDraft); err != nil {
+			return err
+		}
+
+		return svc.recordTx(ctx, tx, &before)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.GetByID(ctx, before.ID)
+}
+
+// Approve records the caller's approval and, once enough approvals are in,
+// moves the batch to approved. The approval, the count and the transition run
+// in one transaction holding the batch row, so concurrent approvals are
+// counted one after the other.
+func (svc *destructionBatchService) Approve(ctx context.Context, id int, catatan string) (*models.DestructionBatch, error) {
+	userID := pkg.GetUserIDFromCtx(ctx)
+
+	var before models.DestructionBatch
+	err := svc.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		batch, err := svc.lockBatch(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if batch.State != BatchSubmitted {
+			return fmt.Errorf("%w: only a submitted batch can be approved", ErrBatchState)
+		}
+
+		before = *batch
+		if userID == batch.ProposedBy {
+			return fmt.Errorf("%w: the proposer cannot approve their own batch", ErrBatchState)
+		}
+
+		for _, approval := range batch.Approvals {
+			if approval.IDUser == userID {
+				return fmt.Errorf("%w: batch already approved by this user", ErrBatchState)
+			}
+		}
+
+		err = svc.repo.AddBatchApprovalTx(ctx, tx, models.DestructionBatchApproval{
+			IDBatch: id,
+			IDUser:  userID,
+			Catatan: strings.TrimSpace(catatan),
+		})
+		if err != nil {
+			return err
+		}
+
+		approvals, err := svc.repo.GetBatchApprovalsTx(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if len(approvals) >= batch.RequiredApprovals {
+			now := time.Now()
+			batch.State = BatchApproved
+			batch.ApprovedAt = &now
+
+			if err := svc.repo.UpdateBatchStateTx(ctx, tx, *batch, BatchSubmitted); err != nil {
+				return err
+			}
+		}
+
+		return svc.recordTx(ctx, tx, &before)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.GetByID(ctx, before.ID)
+}
+
+// Reject sends a submitted or approved batch back to draft and discards its
+// approvals, so it has to be reviewed again after it is changed.
+func (svc *destructionBatchService) Reject(ctx context.Context, id int) (*models.DestructionBatch, error) {
+	var before models.DestructionBatch
+	err := svc.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		batch, err := svc.lockBatch(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if batch.State != BatchSubmitted && batch.State != BatchApproved {
+			return fmt.Errorf("%w: only a submitted or approved batch can be rejected", ErrBatchState)
+		}
+
+		if err := svc.repo.ClearBatchApprovalsTx(ctx, tx, id); err != nil {
+			return err
+		}
+
+		before = *batch
+		batch.State = BatchDraft
+		batch.SubmittedAt = nil
+		batch.ApprovedAt = nil
+
+		if err := svc.repo.UpdateBatchStateTx(ctx, tx, *batch, before.State); err != nil {
+			return err
+		}
+
+		return svc.recordTx(ctx, tx, &before)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.GetByID(ctx, before.ID)
+}
+
+// Execute marks every record in an approved batch as destroyed in one
+// transaction and then generates the batch's berita acara. The batch row, the
+// records' statuses and their legal holds are checked under lock inside that
+// transaction, so nothing is written if any record is under legal hold or is
+// no longer eligible. The audit rows are part of the same transaction.
+func (svc *destructionBatchService) Execute(ctx context.Context, id int) (*models.DestructionBatch, error) {
+	var before models.DestructionBatch
+	now := time.Now()
+	executedBy := pkg.GetUserIDFromCtx(ctx)
+
+	err := svc.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		locked, err := svc.lockBatch(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if locked.State != BatchApproved {
+			return fmt.Errorf("%w: only an approved batch can be executed", ErrBatchState)
+		}
+
+		action := fmt.Sprintf("Pemusnahan batch #%d", locked.ID)
+		for _, idKunjungan := range locked.Items {
+			if err := checkLegalHoldTx(ctx, svc.legalHoldRepo, tx, idKunjungan, action); err != nil {
+				return err
+			}
+
+			record, err := loadLifecycleTx(ctx, svc.kunjunganRepo, tx, idKunjungan)
+			if err != nil {
+				return err
+			}
+
+			if record.Pemusnahan != lifecycle.PemusnahanBelum {
+				return fmt.Errorf("%w: kunjungan %d is not waiting for pemusnahan", lifecycle.ErrInvalidTransition, idKunjungan)
+			}
+
+			if err := record.CanTransition(lifecycle.StagePemusnahan, lifecycle.PemusnahanSudah); err != nil {
+				return fmt.Errorf("kunjungan %d: %w", idKunjungan, err)
+			}
+
+			err = svc.pemusnahanRepo.UpdatePemusnahanTx(ctx, tx, models.Pemusnahan{
+				ID:         idKunjungan,
+				TglLaporan: &now,
+				Status:     string(lifecycle.PemusnahanSudah),
+			})
+			if err != nil {
+				return err
+			}
+
+			err = svc.audit.RecordTx(ctx, tx, audit.Update, "pemusnahan", idKunjungan,
+				map[string]string{"Status": string(lifecycle.PemusnahanBelum)},
+				map[string]interface{}{"Status": string(lifecycle.PemusnahanSudah), "TglLaporan": now, "IDBatch": locked.ID})
+			if err != nil {
+				return err
+			}
+		}
+
+		before = *locked
+		batch := *locked
+		batch.State = BatchExecuted
+		batch.ExecutedAt = &now
+		batch.ExecutedBy = &executedBy
+
+		if err := svc.repo.UpdateBatchStateTx(ctx, tx, batch, BatchApproved); err != nil {
+			return err
+		}
+
+		return svc.recordTx(ctx, tx, &before)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The destruction already happened, so a failed document is only logged;
+	// it is generated again when it is first downloaded.
+	if _, err := svc.beritaAcara.Generate(ctx, id); err != nil {
+		log.Printf("Failed to generate berita acara for batch #%d: %v", id, err)
+	}
+
+	return svc.GetByID(ctx, before.ID)
+}
+
+// recordTx adds the batch's change from before to the audit trail inside tx,
+// so a batch change is not committed without its audit row.
+func (svc *destructionBatchService) recordTx(ctx context.Context, tx *sql.Tx, before *models.DestructionBatch) error {
+	after, err := svc.lockBatch(ctx, tx, before.ID)
+	if err != nil {
+		return err
+	}
+
+	return svc.audit.RecordTx(ctx, tx, audit.Update, "destruction_batch", after.ID, before, after)
+}
+
+// lockBatch reads the batch with its items and approvals inside tx and keeps
+// the batch row locked until tx ends.
+func (svc *destructionBatchService) lockBatch(ctx context.Context, tx *sql.Tx, id int) (*models.DestructionBatch, error) {
+	batch, err := svc.repo.LockBatchTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if batch == nil {
+		return nil, errors.New("Destruction batch not found")
+	}
+
+	if batch.Items, err = svc.repo.GetBatchItemsTx(ctx, tx, id); err != nil {
+		return nil, err
+	}
+
+	if batch.Approvals, err = svc.repo.GetBatchApprovalsTx(ctx, tx, id); err != nil {
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+func (svc *destructionBatchService) lockDraft(ctx context.Context, tx *sql.Tx, id int) (*models.DestructionBatch, error) {
+	batch, err := svc.lockBatch(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if batch.State != BatchDraft {
+		return nil, fmt.Errorf("%w: only a draft batch can be changed", ErrBatchState)
+	}
+
+	return batch, nil
+}
+
+// checkItem reports whether a kunjungan may be proposed for destruction: its
+// pemusnahan row must still be pending, it must not be under legal hold and it
+// must not already belong to another open batch. The reads lock what they
+// check until tx ends.
+func (svc *destructionBatchService) checkItem(ctx context.Context, tx *sql.Tx, idBatch, idKunjungan int) error {
+	record, err := loadLifecycleTx(ctx, svc.kunjunganRepo, tx, idKunjungan)
+	if err != nil {
+		return fmt.Errorf("kunjungan %d: %w", idKunjungan, err)
+	}
+
+	if record.Pemusnahan != lifecycle.PemusnahanBelum {
+		return fmt.Errorf("%w: kunjungan %d is not waiting for pemusnahan", lifecycle.ErrInvalidTransition, idKunjungan)
+	}
+
+	if err := checkLegalHoldTx(ctx, svc.legalHoldRepo, tx, idKunjungan, "Pemusnahan proposal"); err != nil {
+		return err
+	}
+
+	openBatch, err := svc.repo.GetOpenBatchIDForKunjunganTx(ctx, tx, idKunjungan)
+	if err != nil {
+		return err
+	}
+
+	if openBatch != 0 && openBatch != idBatch {
+		return fmt.Errorf("%w: kunjungan %d is already in batch #%d", ErrBatchState, idKunjungan, openBatch)
+	}
+
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
 )
@@ -18,14 +19,16 @@ type DokumenService interface {
 	UploadDokumen(ctx context.Context, idKunjungan int, file multipart.File, header *multipart.FileHeader) (*models.Dokumen, error)
 	UpdateDokumen(ctx context.Context, id int, file multipart.File, header *multipart.FileHeader) (*models.Dokumen, error)
 	DeleteDokumen(ctx context.Context, id int) error
+	GetPasienIDByPath(ctx context.Context, path string) (int, error)
 }
 
 type dokumenService struct {
-	repo repositories.DokumenRepository
+	repo  repositories.DokumenRepository
+	audit audit.Recorder
 }
 
-func NewServiceDokumen(repo repositories.DokumenRepository) DokumenService {
-	return &dokumenService{repo: repo}
+func NewServiceDokumen(repo repositories.DokumenRepository, auditRecorder audit.Recorder) DokumenService {
+	return &dokumenService{repo: repo, audit: auditRecorder}
 }
 
 func (svc *dokumenService) UploadDokumen(ctx context.Context, idKunjungan int, file multipart.File, header *multipart.FileHeader) (*models.Dokumen, error) {
@@ -64,7 +67,13 @@ func (svc *dokumenService) UploadDokumen(ctx context.Context, idKunjungan int, f
 		CreatedAt:   time.Now(),
 	}
 
-	return svc.repo.CreateDokumen(ctx, dokumen)
+	newDokumen, err := svc.repo.CreateDokumen(ctx, dokumen)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.audit.Record(ctx, audit.Create, "dokumen", newDokumen.ID, nil, newDokumen)
+	return newDokumen, nil
 }
 
 func (svc *dokumenService) UpdateDokumen(ctx context.Context, id int, file multipart.File, header *multipart.FileHeader) (*models.Dokumen, error) {
@@ -103,10 +112,17 @@ func (svc *dokumenService) UpdateDokumen(ctx context.Context, id int, file multi
 		return nil, fmt.Errorf("Failed to save file: %w", err)
 	}
 
+	before := *existing
 	existing.Nama = header.Filename
 	existing.Path = filePath
 
-	return svc.repo.UpdateDokumen(ctx, *existing)
+	updated, err := svc.repo.UpdateDokumen(ctx, *existing)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.audit.Record(ctx, audit.Update, "dokumen", id, before, updated)
+	return updated, nil
 }
 
 func (svc *dokumenService) DeleteDokumen(ctx context.Context, id int) error {
@@ -122,5 +138,14 @@ func (svc *dokumenService) DeleteDokumen(ctx context.Context, id int) error {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
 
-	return svc.repo.DeleteDokumen(ctx, id)
+	if err := svc.repo.DeleteDokumen(ctx, id); err != nil {
+		return err
+	}
+
+	svc.audit.Record(ctx, audit.Delete, "dokumen", id, existing, nil)
+	return nil
+}
+
+func (svc *dokumenService) GetPasienIDByPath(ctx context.Context, path string) (int, error) {
+	return svc.repo.GetPasienIDByDokumenPath(ctx, path)
 }
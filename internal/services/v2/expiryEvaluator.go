@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/lifecycle"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/retention"
+)
+
+const expiryWorkerCount = 10
+
+// expiryDecision is the verdict for one kunjungan. Err is set when the
+// kunjungan could not be evaluated at all; Skip explains why a kunjungan with
+// usable data was left out (for example an unknown jenis kunjungan).
+type expiryDecision struct {
+	Kunjungan *models.Kunjungan
+	Kasus     *models.Kasus
+	ExpiredAt time.Time
+	Expired   bool
+	Skip      string
+	Err       error
+}
+
+// expiryEvaluator is the single place that decides whether a kunjungan has
+// passed its inactivation date. The cron job and the alih media service both
+// go through it so they can never disagree.
+type expiryEvaluator struct {
+	kasusRepo  repositories.KasusRepository
+	policyRepo repositories.RetentionPolicyRepository
+	pasienRepo repositories.PasienRepository
+	workers    int
+}
+
+func newExpiryEvaluator(
+	kasusRepo repositories.KasusRepository,
+	policyRepo repositories.RetentionPolicyRepository,
+	pasienRepo repositories.PasienRepository,
+) *expiryEvaluator {
+	return &expiryEvaluator{
+		kasusRepo:  kasusRepo,
+		policyRepo: policyRepo,
+		pasienRepo: pasienRepo,
+		workers:    expiryWorkerCount,
+	}
+}
+
+func (ev *expiryEvaluator) newCache() *retentionCache {
+	return &retentionCache{
+		ev:        ev,
+		kasus:     make(map[int]*kasusPolicy),
+		birthDate: make(map[int]time.Time),
+	}
+}
+
+// Evaluate returns one decision per kunjungan, in the same order. If ctx is
+// cancelled the remaining kunjungan are not evaluated and ctx.Err() is
+// returned alongside the decisions made so far (the rest are nil).
+func (ev *expiryEvaluator) Evaluate(ctx context.Context, kunjunganList []*models.Kunjungan, now time.Time) ([]*expiryDecision, error) {
+	cache := ev.newCache()
+	decisions := make([]*expiryDecision, len(kunjunganList))
+
+	err := runConcurrently(ctx, ev.workers, len(kunjunganList), func(i int) {
+		decisions[i] = ev.decide(ctx, cache, kunjunganList[i], now)
+	})
+
+	return decisions, err
+}
+
+func (ev *expiryEvaluator) decide(ctx context.Context, cache *retentionCache, kunjungan *models.Kunjungan, now time.Time) *expiryDecision {
+	decision := &expiryDecision{Kunjungan: kunjungan}
+
+	kasus, schedule, err := cache.schedule(ctx, kunjungan)
+	decision.Kasus = kasus
+	if err != nil {
+		if errors.Is(err, errUnknownJenisKunjungan) {
+			decision.Skip = err.Error()
+		} else {
+			decision.Err = err
+		}
+		return decision
+	}
+
+	decision.ExpiredAt = schedule.InactiveAt
+	decision.Expired = now.After(schedule.InactiveAt)
+	return decision
+}
+
+// inactivateKunjungan marks the kunjungan inactive and queues it for alih
+// media in one transaction. If either write fails neither is kept, so the
+// kunjungan stays active and is picked up again on the next run.
+func inactivateKunjungan(
+	ctx context.Context,
+	transactor repositories.Transactor,
+	kunjunganRepo repositories.KunjunganRepository,
+	alihMediaRepo repositories.AlihMediaRepository,
+	auditRecorder audit.Recorder,
+	kunjungan *models.Kunjungan,
+) (*models.AlihMedia, error) {
+	alihMedia := &models.AlihMedia{
+		ID:         kunjungan.ID,
+		TglLaporan: nil,
+		Status:     string(lifecycle.AlihMediaBelum),
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+
+	err := transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		if err := kunjunganRepo.UpdateKunjunganStatusTx(ctx, tx, kunjungan.ID, "tidak aktif"); err != nil {
+			return err
+		}
+
+		_, err := alihMediaRepo.UpsertAlihMediaTx(ctx, tx, alihMedia)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	auditRecorder.Record(ctx, audit.Update, "kunjungan", kunjungan.ID,
+		map[string]string{"Status": kunjungan.Status}, map[string]string{"Status": "tidak aktif"})
+	auditRecorder.Record(ctx, audit.Create, "alih_media", alihMedia.ID, nil, alihMedia)
+	return alihMedia, nil
+}
+
+// runConcurrently calls fn(0..n-1) from a pool of workers. It stops handing
+// out work as soon as ctx is cancelled and waits for in-flight calls.
+func runConcurrently(ctx context.Context, workers, n int, fn func(i int)) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		case jobs <- i:
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+	return err
+}
+
+type kasusPolicy struct {
+	kasus  *models.Kasus
+	policy retention.Policy
+}
+
+// retentionCache loads each kasus, its retention policy and, when the policy
+// needs it, the patient's birth date once per evaluation. It is safe for use
+// by the worker pool.
+type retentionCache struct {
+	ev        *expiryEvaluator
+	mu        sync.Mutex
+	kasus     map[int]*kasusPolicy
+	birthDate map[int]time.Time
+}
+
+func (cache *retentionCache) schedule(ctx context.Context, kunjungan *models.Kunjungan) (*models.Kasus, retention.Schedule, error) {
+	kp, err := cache.getKasus(ctx, kunjungan.IDKasus)
+	if err != nil {
+		return nil, retention.Schedule{}, err
+	}
+
+	masaAktif, masaInaktif, err := masaKasus(kp.kasus, kunjungan.JenisKunjungan)
+	if err != nil {
+		return kp.kasus, retention.Schedule{}, err
+	}
+
+	var tglLahir time.Time
+	if kp.policy.NeedsBirthDate() {
+		if tglLahir, err = cache.getBirthDate(ctx, kunjungan.IDPasien); err != nil {
+			return kp.kasus, retention.Schedule{}, err
+		}
+	}
+
+	return kp.kasus, kp.policy.Evaluate(kunjungan.TanggalMasuk, tglLahir, masaAktif, masaInaktif), nil
+}
+
+func (cache *retentionCache) getKasus(ctx context.Context, id int) (*kasusPolicy, error) {
+	cache.mu.Lock()
+	kp, ok := cache.kasus[id]
+	cache.mu.Unlock()
+	if ok {
+		return kp, nil
+	}
+
+	kasus, err := cache.ev.kasusRepo.GetKasusByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := cache.ev.policyRepo.GetPolicyByKasus(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	kp = &kasusPolicy{kasus: kasus, policy: policyFromModel(stored)}
+
+	cache.mu.Lock()
+	cache.kasus[id] = kp
+	cache.mu.Unlock()
+	return kp, nil
+}
+
+func (cache *retentionCache) getBirthDate(ctx context.Context, idPasien int) (time.Time, error) {
+	cache.mu.Lock()
+	tglLahir, ok := cache.birthDate[idPasien]
+	cache.mu.Unlock()
+	if ok {
+		return tglLahir, nil
+	}
+
+	pasien, err := cache.ev.pasienRepo.GetPasienByID(ctx, idPasien)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	cache.mu.Lock()
+	cache.birthDate[idPasien] = pasien.TanggalLahir
+	cache.mu.Unlock()
+	return pasien.TanggalLahir, nil
+}
+
+func policyFromModel(policy *models.RetentionPolicy) retention.Policy {
+	if policy == nil {
+		return retention.Default()
+	}
+
+	return retention.Policy{
+		Unit:             retention.Unit(policy.PeriodUnit),
+		Permanent:        policy.Permanent,
+		AdultAge:         policy.AdultAge,
+		MinorRetainYears: policy.MinorRetainYears,
+	}
+}
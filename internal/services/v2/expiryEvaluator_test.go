@@ -0,0 +1,364 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/lifecycle"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+)
+
+// memoryStore stands in for the kunjungan and alih_media tables. Writes made
+// inside WithinTx are staged and only applied when fn returns nil, as a
+// transaction would.
+type memoryStore struct {
+	kunjunganStatus map[int]string
+	alihMedia       map[int]models.AlihMedia
+	staged          []func()
+	commits         int
+	rollbacks       int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		kunjunganStatus: make(map[int]string),
+		alihMedia:       make(map[int]models.AlihMedia),
+	}
+}
+
+func (store *memoryStore) WithinTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	store.staged = nil
+	if err := fn(nil); err != nil {
+		store.staged = nil
+		store.rollbacks++
+		return err
+	}
+
+	for _, apply := range store.staged {
+		apply()
+	}
+	store.staged = nil
+	store.commits++
+	return nil
+}
+
+type memoryKunjunganRepo struct {
+	repositories.KunjunganRepository
+	store *memoryStore
+	err   error
+}
+
+func (repo memoryKunjunganRepo) UpdateKunjunganStatusTx(ctx context.Context, tx *sql.Tx, id int, status string) error {
+	if repo.err != nil {
+		return repo.err
+	}
+	repo.store.staged = append(repo.store.staged, func() { repo.store.kunjunganStatus[id] = status })
+	return nil
+}
+
+// memoryAlihMediaRepo keeps an existing row, like the ON DUPLICATE KEY upsert.
+type memoryAlihMediaRepo struct {
+	repositories.AlihMediaRepository
+	store *memoryStore
+	err   error
+}
+
+func (repo memoryAlihMediaRepo) UpsertAlihMediaTx(ctx context.Context, tx *sql.Tx, alihMedia *models.AlihMedia) (*models.AlihMedia, error) {
+	if repo.err != nil {
+		return nil, repo.err
+	}
+	row := *alihMedia
+	repo.store.staged = append(repo.store.staged, func() {
+		if _, ok := repo.store.alihMedia[row.ID]; !ok {
+			repo.store.alihMedia[row.ID] = row
+		}
+	})
+	return alihMedia, nil
+}
+
+type memoryRecorder struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (rec *memoryRecorder) Record(ctx context.Context, action audit.Action, entity string, entityID interface{}, before, after interface{}) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.entries = append(rec.entries, fmt.Sprintf("%s %s %v", action, entity, entityID))
+}
+
+func (rec *memoryRecorder) RecordTx(ctx context.Context, tx *sql.Tx, action audit.Action, entity string, entityID interface{}, before, after interface{}) error {
+	rec.Record(ctx, action, entity, entityID, before, after)
+	return nil
+}
+
+func inactivateInMemory(store *memoryStore, kunjunganErr, upsertErr error, recorder audit.Recorder) error {
+	_, err := inactivateKunjungan(context.Background(),
+		store,
+		memoryKunjunganRepo{store: store, err: kunjunganErr},
+		memoryAlihMediaRepo{store: store, err: upsertErr},
+		recorder,
+		&models.Kunjungan{ID: 1, Status: "aktif"},
+	)
+	return err
+}
+
+func TestInactivateKunjunganWritesBothRows(t *testing.T) {
+	store := newMemoryStore()
+	store.kunjunganStatus[1] = "aktif"
+	recorder := &memoryRecorder{}
+
+	if err := inactivateInMemory(store, nil, nil, recorder); err != nil {
+		t.Fatalf("inactivateKunjungan: %v", err)
+	}
+
+	if got := store.kunjunganStatus[1]; got != "tidak aktif" {
+		t.Errorf("kunjungan status = %q, want tidak aktif", got)
+	}
+	if got := store.alihMedia[1].Status; got != string(lifecycle.AlihMediaBelum) {
+		t.Errorf("alih media status = %q, want %q", got, lifecycle.AlihMediaBelum)
+	}
+	if store.commits != 1 {
+		t.Errorf("commits = %d, want 1", store.commits)
+	}
+	if len(recorder.entries) != 2 {
+		t.Errorf("audit entries = %q, want the kunjungan update and the alih media create", recorder.entries)
+	}
+}
+
+func TestInactivateKunjunganKeepsNothingWhenAWriteFails(t *testing.T) {
+	errWrite := errors.New("write failed")
+
+	tests := []struct {
+		name         string
+		kunjunganErr error
+		upsertErr    error
+	}{
+		{name: "alih media upsert fails", upsertErr: errWrite},
+		{name: "status update fails", kunjunganErr: errWrite},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore()
+			store.kunjunganStatus[1] = "aktif"
+			recorder := &memoryRecorder{}
+
+			err := inactivateInMemory(store, tt.kunjunganErr, tt.upsertErr, recorder)
+			if !errors.Is(err, errWrite) {
+				t.Fatalf("inactivateKunjungan err = %v, want %v", err, errWrite)
+			}
+
+			if got := store.kunjunganStatus[1]; got != "aktif" {
+				t.Errorf("kunjungan status = %q, want it still aktif", got)
+			}
+			if len(store.alihMedia) != 0 {
+				t.Errorf("alih media rows = %v, want none", store.alihMedia)
+			}
+			if store.rollbacks != 1 || store.commits != 0 {
+				t.Errorf("commits = %d, rollbacks = %d, want one rollback", store.commits, store.rollbacks)
+			}
+			if len(recorder.entries) != 0 {
+				t.Errorf("audit entries = %q, want none for a rolled back change", recorder.entries)
+			}
+		})
+	}
+}
+
+func TestInactivateKunjunganRerunKeepsAlihMediaProgress(t *testing.T) {
+	store := newMemoryStore()
+	store.kunjunganStatus[1] = "aktif"
+
+	if err := inactivateInMemory(store, nil, nil, &memoryRecorder{}); err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+
+	row := store.alihMedia[1]
+	row.Status = string(lifecycle.AlihMediaSudah)
+	store.alihMedia[1] = row
+
+	if err := inactivateInMemory(store, nil, nil, &memoryRecorder{}); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+
+	if len(store.alihMedia) != 1 {
+		t.Errorf("alih media rows = %d, want 1", len(store.alihMedia))
+	}
+	if got := store.alihMedia[1].Status; got != string(lifecycle.AlihMediaSudah) {
+		t.Errorf("alih media status = %q after rerun, want %q", got, lifecycle.AlihMediaSudah)
+	}
+}
+
+type memoryKasusRepo struct {
+	repositories.KasusRepository
+	mu    sync.Mutex
+	kasus map[int]*models.Kasus
+	loads int
+}
+
+func (repo *memoryKasusRepo) GetKasusByID(ctx context.Context, id int) (*models.Kasus, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.loads++
+
+	kasus, ok := repo.kasus[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return kasus, nil
+}
+
+type memoryPolicyRepo struct {
+	repositories.RetentionPolicyRepository
+	policies map[int]*models.RetentionPolicy
+}
+
+func (repo memoryPolicyRepo) GetPolicyByKasus(ctx context.Context, idKasus int) (*models.RetentionPolicy, error) {
+	return repo.policies[idKasus], nil
+}
+
+type memoryPasienRepo struct {
+	repositories.PasienRepository
+	pasien map[int]*models.Pasien
+}
+
+func (repo memoryPasienRepo) GetPasienByID(ctx context.Context, id int) (*models.Pasien, error) {
+	pasien, ok := repo.pasien[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return pasien, nil
+}
+
+func TestExpiryEvaluatorEvaluate(t *testing.T) {
+	kasusRepo := &memoryKasusRepo{kasus: map[int]*models.Kasus{
+		1: {ID: 1, MasaAktifRJ: 2, MasaInaktifRJ: 5, MasaAktifRI: 3, MasaInaktifRI: 10},
+		2: {ID: 2, MasaAktifRJ: 1, MasaInaktifRJ: 1},
+	}}
+	policyRepo := memoryPolicyRepo{policies: map[int]*models.RetentionPolicy{
+		2: {IDKasus: 2, PeriodUnit: "month", AdultAge: 18},
+	}}
+	ev := newExpiryEvaluator(kasusRepo, policyRepo, memoryPasienRepo{})
+
+	tglMasuk := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2022, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		kunjungan   *models.Kunjungan
+		wantExpired bool
+		wantAt      time.Time
+		wantSkip    bool
+		wantErr     bool
+	}{
+		{
+			name:        "rawat jalan past masa inaktif",
+			kunjungan:   &models.Kunjungan{ID: 1, IDKasus: 1, JenisKunjungan: "RJ", TanggalMasuk: tglMasuk},
+			wantExpired: true,
+			wantAt:      time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "rawat inap still within masa inaktif",
+			kunjungan: &models.Kunjungan{ID: 2, IDKasus: 1, JenisKunjungan: "RI", TanggalMasuk: tglMasuk},
+			wantAt:    time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:        "policy in months",
+			kunjungan:   &models.Kunjungan{ID: 3, IDKasus: 2, JenisKunjungan: "RJ", TanggalMasuk: tglMasuk},
+			wantExpired: true,
+			wantAt:      time.Date(2015, time.February, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "unknown jenis kunjungan",
+			kunjungan: &models.Kunjungan{ID: 4, IDKasus: 1, JenisKunjungan: "IGD", TanggalMasuk: tglMasuk},
+			wantSkip:  true,
+		},
+		{
+			name:      "missing kasus",
+			kunjungan: &models.Kunjungan{ID: 5, IDKasus: 9, JenisKunjungan: "RJ", TanggalMasuk: tglMasuk},
+			wantErr:   true,
+		},
+	}
+
+	kunjunganList := make([]*models.Kunjungan, len(tests))
+	for i, tt := range tests {
+		kunjunganList[i] = tt.kunjungan
+	}
+
+	decisions, err := ev.Evaluate(context.Background(), kunjunganList, now)
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := decisions[i]
+			if decision.Kunjungan != tt.kunjungan {
+				t.Fatalf("decision %d is for kunjungan %d, want %d", i, decision.Kunjungan.ID, tt.kunjungan.ID)
+			}
+			if (decision.Err != nil) != tt.wantErr {
+				t.Errorf("Err = %v, want error: %v", decision.Err, tt.wantErr)
+			}
+			if (decision.Skip != "") != tt.wantSkip {
+				t.Errorf("Skip = %q, want skip: %v", decision.Skip, tt.wantSkip)
+			}
+			if tt.wantErr || tt.wantSkip {
+				return
+			}
+			if decision.Expired != tt.wantExpired {
+				t.Errorf("Expired = %v, want %v", decision.Expired, tt.wantExpired)
+			}
+			if !decision.ExpiredAt.Equal(tt.wantAt) {
+				t.Errorf("ExpiredAt = %s, want %s", decision.ExpiredAt.Format(time.DateOnly), tt.wantAt.Format(time.DateOnly))
+			}
+		})
+	}
+}
+
+func TestExpiryEvaluatorLoadsEachKasusOnce(t *testing.T) {
+	kasusRepo := &memoryKasusRepo{kasus: map[int]*models.Kasus{
+		1: {ID: 1, MasaAktifRJ: 2, MasaInaktifRJ: 5},
+	}}
+	ev := newExpiryEvaluator(kasusRepo, memoryPolicyRepo{}, memoryPasienRepo{})
+	ev.workers = 1
+
+	kunjunganList := make([]*models.Kunjungan, 20)
+	for i := range kunjunganList {
+		kunjunganList[i] = &models.Kunjungan{ID: i + 1, IDKasus: 1, JenisKunjungan: "RJ"}
+	}
+
+	if _, err := ev.Evaluate(context.Background(), kunjunganList, time.Now()); err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+
+	if kasusRepo.loads != 1 {
+		t.Errorf("kasus loads = %d, want 1", kasusRepo.loads)
+	}
+}
+
+func TestRunConcurrentlyStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var mu sync.Mutex
+	calls := 0
+	err := runConcurrently(ctx, 4, 100, func(i int) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+	if calls == 100 {
+		t.Errorf("all 100 calls ran after cancellation")
+	}
+}
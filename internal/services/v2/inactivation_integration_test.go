@@ -0,0 +1,263 @@
+//go:build integration
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/lifecycle"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/go-sql-driver/mysql"
+)
+
+// These tests run inactivateKunjungan and migration 004 against a disposable
+// MySQL or MariaDB server. They are built only with the integration tag, and
+// TEST_MYSQL_DSN must name a user that may create databases, for example
+//
+//	TEST_MYSQL_DSN='root:secret@tcp(127.0.0.1:3306)/' go test -tags integration ./internal/services/v2/
+//
+// Every test works in a database of its own that is dropped afterwards.
+
+// alih_media and kunjungan as they are before migration 004, without the
+// foreign keys to tables these tests do not use.
+var preMigration004Schema = []string{"CREATE TABLE `kunjungan` (" +
+	" `Id` int(11) NOT NULL AUTO_INCREMENT," +
+	" `IdPasien` int(11) NOT NULL," +
+	" `IdKasus` int(11) NOT NULL," +
+	" `TglMasuk` date NOT NULL," +
+	" `JenisKunjungan` char(2) NOT NULL," +
+	" `Status` varchar(100) NOT NULL DEFAULT 'aktif'," +
+	" PRIMARY KEY (`Id`)" +
+	") ENGINE=InnoDB",
+	"CREATE TABLE `alih_media` (" +
+		" `Id` int(11) NOT NULL," +
+		" `TglLaporan` date DEFAULT NULL," +
+		" `Status` varchar(50) NOT NULL DEFAULT 'Belum dialih media'," +
+		" `CreatedAt` datetime NOT NULL DEFAULT current_timestamp()," +
+		" `UpdatedAt` datetime NOT NULL DEFAULT current_timestamp()," +
+		" KEY `alih_media_kunjungan_FK` (`Id`)," +
+		" CONSTRAINT `alih_media_kunjungan_FK` FOREIGN KEY (`Id`) REFERENCES `kunjungan` (`Id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+		") ENGINE=InnoDB",
+}
+
+// openTestDB creates an empty database with the pre-004 schema.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Fatal("TEST_MYSQL_DSN is not set")
+	}
+
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("parse TEST_MYSQL_DSN: %v", err)
+	}
+	cfg.MultiStatements = true
+	cfg.ParseTime = true
+
+	admin, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	name := fmt.Sprintf("alih_media_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE DATABASE " + name); err != nil {
+		t.Fatalf("create test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP DATABASE " + name); err != nil {
+			t.Logf("drop test database %s: %v", name, err)
+		}
+	})
+
+	cfg.DBName = name
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, statement := range preMigration004Schema {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("create schema: %v", err)
+		}
+	}
+
+	return db
+}
+
+func applyMigration(t *testing.T, db *sql.DB, file string) {
+	t.Helper()
+
+	script, err := os.ReadFile(filepath.Join("..", "..", "..", "migrations", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec(string(script)); err != nil {
+		t.Fatalf("apply %s: %v", file, err)
+	}
+}
+
+func insertKunjungan(t *testing.T, db *sql.DB, id int) *models.Kunjungan {
+	t.Helper()
+
+	_, err := db.Exec("INSERT INTO kunjungan (Id, IdPasien, IdKasus, TglMasuk, JenisKunjungan, Status) VALUES (?, 1, 1, '2015-01-01', 'RJ', 'aktif')", id)
+	if err != nil {
+		t.Fatalf("insert kunjungan %d: %v", id, err)
+	}
+
+	return &models.Kunjungan{ID: id, Status: "aktif"}
+}
+
+func kunjunganStatus(t *testing.T, db *sql.DB, id int) string {
+	t.Helper()
+
+	var status string
+	if err := db.QueryRow("SELECT Status FROM kunjungan WHERE Id = ?", id).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func alihMediaRows(t *testing.T, db *sql.DB, id int) []string {
+	t.Helper()
+
+	rows, err := db.Query("SELECT Status FROM alih_media WHERE Id = ?", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var statuses []string
+	for rows.Next() {
+		var status string
+		if err := rows.Scan(&status); err != nil {
+			t.Fatal(err)
+		}
+		statuses = append(statuses, status)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return statuses
+}
+
+type discardRecorder struct{}
+
+func (discardRecorder) Record(ctx context.Context, action audit.Action, entity string, entityID interface{}, before, after interface{}) {
+}
+
+func (discardRecorder) RecordTx(ctx context.Context, tx *sql.Tx, action audit.Action, entity string, entityID interface{}, before, after interface{}) error {
+	return nil
+}
+
+// failingUpsertRepo writes the alih media row and then fails, as a lost
+// connection after the insert would.
+type failingUpsertRepo struct {
+	repositories.AlihMediaRepository
+}
+
+var errUpsertFailed = errors.New("upsert failed")
+
+func (repo failingUpsertRepo) UpsertAlihMediaTx(ctx context.Context, tx *sql.Tx, alihMedia *models.AlihMedia) (*models.AlihMedia, error) {
+	if _, err := repo.AlihMediaRepository.UpsertAlihMediaTx(ctx, tx, alihMedia); err != nil {
+		return nil, err
+	}
+	return nil, errUpsertFailed
+}
+
+func TestMySQLMigration004CollapsesDuplicatesAndAddsPrimaryKey(t *testing.T) {
+	db := openTestDB(t)
+	insertKunjungan(t, db, 1)
+	insertKunjungan(t, db, 2)
+
+	_, err := db.Exec("INSERT INTO alih_media (Id, Status) VALUES (1, ?), (1, ?), (2, ?)",
+		lifecycle.AlihMediaBelum, lifecycle.AlihMediaSudah, lifecycle.AlihMediaBelum)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applyMigration(t, db, "004_alih_media_primary_key.sql")
+
+	if got := alihMediaRows(t, db, 1); len(got) != 1 || got[0] != string(lifecycle.AlihMediaSudah) {
+		t.Errorf("kunjungan 1 alih_media rows = %q, want one %q", got, lifecycle.AlihMediaSudah)
+	}
+	if got := alihMediaRows(t, db, 2); len(got) != 1 {
+		t.Errorf("kunjungan 2 alih_media rows = %q, want one", got)
+	}
+
+	_, err = db.Exec("INSERT INTO alih_media (Id, Status) VALUES (1, ?)", lifecycle.AlihMediaBelum)
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != 1062 {
+		t.Fatalf("second alih_media row for kunjungan 1: err = %v, want duplicate key (1062)", err)
+	}
+}
+
+func TestMySQLInactivateKunjunganRollsBackWhenUpsertFails(t *testing.T) {
+	db := openTestDB(t)
+	applyMigration(t, db, "004_alih_media_primary_key.sql")
+	kunjungan := insertKunjungan(t, db, 1)
+
+	_, err := inactivateKunjungan(context.Background(),
+		repositories.NewTransactor(db),
+		repositories.NewRepoKunjungan(db),
+		failingUpsertRepo{repositories.NewRepoAlihMedia(db)},
+		discardRecorder{},
+		kunjungan,
+	)
+	if !errors.Is(err, errUpsertFailed) {
+		t.Fatalf("inactivateKunjungan err = %v, want %v", err, errUpsertFailed)
+	}
+
+	if got := kunjunganStatus(t, db, 1); got != "aktif" {
+		t.Errorf("kunjungan status = %q after a failed upsert, want it still aktif", got)
+	}
+	if got := alihMediaRows(t, db, 1); len(got) != 0 {
+		t.Errorf("alih_media rows = %q after a failed upsert, want none", got)
+	}
+}
+
+func TestMySQLInactivateKunjunganRerunDoesNotDuplicate(t *testing.T) {
+	db := openTestDB(t)
+	applyMigration(t, db, "004_alih_media_primary_key.sql")
+	kunjungan := insertKunjungan(t, db, 1)
+
+	transactor := repositories.NewTransactor(db)
+	kunjunganRepo := repositories.NewRepoKunjungan(db)
+	alihMediaRepo := repositories.NewRepoAlihMedia(db)
+
+	run := func() {
+		t.Helper()
+		_, err := inactivateKunjungan(context.Background(), transactor, kunjunganRepo, alihMediaRepo, discardRecorder{}, kunjungan)
+		if err != nil {
+			t.Fatalf("inactivateKunjungan: %v", err)
+		}
+	}
+
+	run()
+
+	// A rerun must not duplicate the row, nor reset progress made since.
+	if _, err := db.Exec("UPDATE alih_media SET Status = ? WHERE Id = 1", lifecycle.AlihMediaSudah); err != nil {
+		t.Fatal(err)
+	}
+	run()
+
+	if got := kunjunganStatus(t, db, 1); got != "tidak aktif" {
+		t.Errorf("kunjungan status = %q, want tidak aktif", got)
+	}
+	if got := alihMediaRows(t, db, 1); len(got) != 1 || got[0] != string(lifecycle.AlihMediaSudah) {
+		t.Errorf("alih_media rows = %q after rerun, want one %q", got, lifecycle.AlihMediaSudah)
+	}
+}
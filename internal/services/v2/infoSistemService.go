@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
 )
@@ -16,11 +17,12 @@ type InfoSistemService interface {
 }
 
 type infoSistemService struct {
-	repo repositories.InfoSistemRepository
+	repo  repositories.InfoSistemRepository
+	audit audit.Recorder
 }
 
-func NewServiceInfoSistem(repo repositories.InfoSistemRepository) InfoSistemService {
-	return &infoSistemService{repo: repo}
+func NewServiceInfoSistem(repo repositories.InfoSistemRepository, auditRecorder audit.Recorder) InfoSistemService {
+	return &infoSistemService{repo: repo, audit: auditRecorder}
 }
 
 func (svc *infoSistemService) GetAllInfoSistem(ctx context.Context, infoSistem models.InfoSistem) (*models.InfoSistem, error) {
@@ -51,6 +53,7 @@ func (svc *infoSistemService) CreateInfoSistem(ctx context.Context, infoSistem m
 		return nil, err
 	}
 
+	svc.audit.Record(ctx, audit.Create, "info_sistem", newInfo.ID, nil, newInfo)
 	return newInfo, nil
 }
 
@@ -69,5 +72,6 @@ func (svc *infoSistemService) UpdateInfoSistem(ctx context.Context, infoSistem m
 		return nil, err
 	}
 
+	svc.audit.Record(ctx, audit.Update, "info_sistem", infoSistem.ID, existing, newInfo)
 	return newInfo, nil
 }
@@ -8,8 +8,10 @@ import (
 	"log"
 	"strconv"
 
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/retention"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
 	"github.com/xuri/excelize/v2"
 )
@@ -23,6 +25,8 @@ type KasusService interface {
 	Delete(ctx context.Context, id int) error
 	Import(ctx context.Context, filepath string) error
 	Export(ctx context.Context, filter KasusFilter) ([]byte, error)
+	GetPolicy(ctx context.Context, idKasus int) (*models.RetentionPolicy, error)
+	UpdatePolicy(ctx context.Context, policy models.RetentionPolicy) (*models.RetentionPolicy, error)
 }
 
 type KasusFilter struct {
@@ -31,11 +35,13 @@ type KasusFilter struct {
 }
 
 type kasusService struct {
-	repo repositories.KasusRepository
+	repo       repositories.KasusRepository
+	policyRepo repositories.RetentionPolicyRepository
+	audit      audit.Recorder
 }
 
-func NewServiceKasus(repo repositories.KasusRepository) KasusService {
-	return &kasusService{repo: repo}
+func NewServiceKasus(repo repositories.KasusRepository, policyRepo repositories.RetentionPolicyRepository, auditRecorder audit.Recorder) KasusService {
+	return &kasusService{repo: repo, policyRepo: policyRepo, audit: auditRecorder}
 }
 
 type KasusPagination struct {
@@ -174,6 +180,7 @@ func (svc *kasusService) Create(ctx context.Context, kasus models.Kasus) (*model
 		return nil, err
 	}
 
+	svc.audit.Record(ctx, audit.Create, "kasus", newKasus.ID, nil, newKasus)
 	return newKasus, nil
 }
 
@@ -192,6 +199,7 @@ func (svc *kasusService) Update(ctx context.Context, kasus models.Kasus) (*model
 		return nil, err
 	}
 
+	svc.audit.Record(ctx, audit.Update, "kasus", kasus.ID, existing, newKasus)
 	return newKasus, nil
 }
 
@@ -205,7 +213,12 @@ func (svc *kasusService) Delete(ctx context.Context, id int) error {
 		return errors.New("Kasus not found")
 	}
 
-	return svc.repo.DeleteKasus(ctx, id)
+	if err := svc.repo.DeleteKasus(ctx, id); err != nil {
+		return err
+	}
+
+	svc.audit.Record(ctx, audit.Delete, "kasus", id, existing, nil)
+	return nil
 }
 
 func (svc *kasusService) Import(ctx context.Context, filepath string) error {
@@ -240,15 +253,19 @@ func (svc *kasusService) Import(ctx context.Context, filepath string) error {
 
 		existing, err := svc.repo.FindKasus(ctx, map[string]string{"JenisKasus": kasus.JenisKasus})
 		if err != nil || existing == nil {
-			_, err := svc.repo.CreateKasus(ctx, kasus)
+			created, err := svc.repo.CreateKasus(ctx, kasus)
 			if err != nil {
 				log.Printf("Failed to create pasien %s: %v", kasus.JenisKasus, err)
+			} else {
+				svc.audit.Record(ctx, audit.Create, "kasus", created.ID, nil, created)
 			}
 		} else {
 			kasus.ID = existing[0].ID
-			_, err := svc.repo.UpdateKasus(ctx, kasus)
+			updated, err := svc.repo.UpdateKasus(ctx, kasus)
 			if err != nil {
 				log.Printf("Failed to update pasien %s: %v", kasus.JenisKasus, err)
+			} else {
+				svc.audit.Record(ctx, audit.Update, "kasus", kasus.ID, existing[0], updated)
 			}
 		}
 	}
@@ -319,3 +336,58 @@ func (svc *kasusService) Export(ctx context.Context, filter KasusFilter) ([]byte
 
 	return buf.Bytes(), nil
 }
+
+// GetPolicy returns the retention policy of a kasus, or the default policy if
+// none has been set.
+func (svc *kasusService) GetPolicy(ctx context.Context, idKasus int) (*models.RetentionPolicy, error) {
+	if _, err := svc.GetByID(ctx, idKasus); err != nil {
+		return nil, err
+	}
+
+	policy, err := svc.policyRepo.GetPolicyByKasus(ctx, idKasus)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy == nil {
+		def := retention.Default()
+		policy = &models.RetentionPolicy{
+			IDKasus:    idKasus,
+			PeriodUnit: string(def.Unit),
+			AdultAge:   def.AdultAge,
+		}
+	}
+
+	return policy, nil
+}
+
+func (svc *kasusService) UpdatePolicy(ctx context.Context, policy models.RetentionPolicy) (*models.RetentionPolicy, error) {
+	if _, err := svc.GetByID(ctx, policy.IDKasus); err != nil {
+		return nil, err
+	}
+
+	if policy.PeriodUnit == "" {
+		policy.PeriodUnit = string(retention.UnitYear)
+	}
+
+	if err := policyFromModel(&policy).Validate(); err != nil {
+		return nil, err
+	}
+
+	existing, err := svc.policyRepo.GetPolicyByKasus(ctx, policy.IDKasus)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := svc.policyRepo.UpsertPolicy(ctx, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing == nil {
+		svc.audit.Record(ctx, audit.Create, "kasus_retention_policy", policy.IDKasus, nil, updated)
+	} else {
+		svc.audit.Record(ctx, audit.Update, "kasus_retention_policy", policy.IDKasus, existing, updated)
+	}
+	return updated, nil
+}
@@ -2,10 +2,14 @@ package services
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log"
+	"os"
 
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/lifecycle"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
@@ -23,20 +27,35 @@ type KunjunganService interface {
 }
 
 type kunjunganService struct {
-	repo       repositories.KunjunganRepository
-	pasienRepo repositories.PasienRepository
-	kasusRepo  repositories.KasusRepository
+	repo          repositories.KunjunganRepository
+	pasienRepo    repositories.PasienRepository
+	kasusRepo     repositories.KasusRepository
+	dokumenRepo   repositories.DokumenRepository
+	legalHoldRepo repositories.LegalHoldRepository
+	batchRepo     repositories.DestructionBatchRepository
+	transactor    repositories.Transactor
+	audit         audit.Recorder
 }
 
 func NewServiceKunjungan(
 	repo repositories.KunjunganRepository,
 	pasienRepo repositories.PasienRepository,
 	kasusRepo repositories.KasusRepository,
+	dokumenRepo repositories.DokumenRepository,
+	legalHoldRepo repositories.LegalHoldRepository,
+	batchRepo repositories.DestructionBatchRepository,
+	transactor repositories.Transactor,
+	auditRecorder audit.Recorder,
 ) KunjunganService {
 	return &kunjunganService{
-		repo:       repo,
-		pasienRepo: pasienRepo,
-		kasusRepo:  kasusRepo,
+		repo:          repo,
+		pasienRepo:    pasienRepo,
+		kasusRepo:     kasusRepo,
+		dokumenRepo:   dokumenRepo,
+		legalHoldRepo: legalHoldRepo,
+		batchRepo:     batchRepo,
+		transactor:    transactor,
+		audit:         auditRecorder,
 	}
 }
 
@@ -137,6 +156,7 @@ func (svc *kunjunganService) Create(ctx context.Context, kunjungan models.Kunjun
 		return nil, err
 	}
 
+	svc.audit.Record(ctx, audit.Create, "kunjungan", newKunjungan.ID, nil, newKunjungan)
 	return newKunjungan, nil
 }
 
@@ -156,9 +176,14 @@ func (svc *kunjunganService) Update(ctx context.Context, kunjungan models.Kunjun
 		return nil, err
 	}
 
+	svc.audit.Record(ctx, audit.Update, "kunjungan", kunjungan.ID, existing, newKunjungan)
 	return newKunjungan, nil
 }
 
+// Delete removes the kunjungan together with its dokumen file. A kunjungan
+// under legal hold, already destroyed, or in a destruction batch past draft is
+// kept; draft batches simply lose it. The checks and the delete run under lock
+// in one transaction.
 func (svc *kunjunganService) Delete(ctx context.Context, id int) error {
 	existing, err := svc.repo.GetKunjunganByID(ctx, id)
 	if err != nil {
@@ -166,10 +191,67 @@ func (svc *kunjunganService) Delete(ctx context.Context, id int) error {
 	}
 
 	if existing == nil {
-		return errors.New("Pasien not found")
+		return errors.New("Kunjungan not found")
 	}
 
-	return svc.repo.DeleteKunjungan(ctx, id)
+	dokumen, err := svc.dokumenRepo.GetDokumenByID(ctx, id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	err = svc.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		// Batches are locked before the kunjungan, in the order the batch
+		// service takes them.
+		batches, err := svc.batchRepo.LockBatchesForKunjunganTx(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		for _, batch := range batches {
+			if batch.State != BatchDraft {
+				return fmt.Errorf("%w: kunjungan %d belongs to destruction batch #%d", lifecycle.ErrInvalidTransition, id, batch.ID)
+			}
+		}
+
+		record, err := loadLifecycleTx(ctx, svc.repo, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if record.Pemusnahan == lifecycle.PemusnahanSudah {
+			return fmt.Errorf("%w: a destroyed record cannot be deleted", lifecycle.ErrInvalidTransition)
+		}
+
+		if err := checkLegalHoldTx(ctx, svc.legalHoldRepo, tx, id, "Kunjungan deletion"); err != nil {
+			return err
+		}
+
+		for _, batch := range batches {
+			if err := svc.batchRepo.RemoveBatchItemTx(ctx, tx, batch.ID, id); err != nil {
+				return err
+			}
+		}
+
+		if err := svc.repo.DeleteKunjunganTx(ctx, tx, id); err != nil {
+			return err
+		}
+
+		return svc.audit.RecordTx(ctx, tx, audit.Delete, "kunjungan", id, existing, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	// The dokumen row went with the kunjungan; a file that cannot be removed
+	// now is picked up by the upload_cleanup job.
+	if dokumen != nil {
+		if err := os.Remove(dokumen.Path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete dokumen file %s: %v", dokumen.Path, err)
+		}
+		svc.audit.Record(ctx, audit.Delete, "dokumen", dokumen.ID, dokumen, nil)
+	}
+
+	return nil
 }
 
 func (svc *kunjunganService) Import(ctx context.Context, filePath string) error {
@@ -211,10 +293,12 @@ func (svc *kunjunganService) Import(ctx context.Context, filePath string) error
 			JenisKunjungan: rows[i][9],
 		}
 
-		_, err = svc.repo.CreateKunjungan(ctx, &kunjungan)
+		created, err := svc.repo.CreateKunjungan(ctx, &kunjungan)
 		if err != nil {
 			continue
 		}
+
+		svc.audit.Record(ctx, audit.Create, "kunjungan", created.ID, nil, created)
 	}
 
 	return nil
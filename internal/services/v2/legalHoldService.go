@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg/logs"
+)
+
+var ErrLegalHold = errors.New("Record is under legal hold")
+
+type LegalHoldService interface {
+	GetAll(ctx context.Context, activeOnly bool) ([]*models.LegalHold, error)
+	GetByID(ctx context.Context, id int) (*models.LegalHold, error)
+	GetByKunjungan(ctx context.Context, idKunjungan int) ([]*models.LegalHold, error)
+	Create(ctx context.Context, hold models.LegalHold) (*models.LegalHold, error)
+	Release(ctx context.Context, id int) (*models.LegalHold, error)
+}
+
+type legalHoldService struct {
+	repo          repositories.LegalHoldRepository
+	pasienRepo    repositories.PasienRepository
+	kunjunganRepo repositories.KunjunganRepository
+	audit         audit.Recorder
+}
+
+func NewServiceLegalHold(
+	repo repositories.LegalHoldRepository,
+	pasienRepo repositories.PasienRepository,
+	kunjunganRepo repositories.KunjunganRepository,
+	auditRecorder audit.Recorder,
+) LegalHoldService {
+	return &legalHoldService{
+		repo:          repo,
+		pasienRepo:    pasienRepo,
+		kunjunganRepo: kunjunganRepo,
+		audit:         auditRecorder,
+	}
+}
+
+func (svc *legalHoldService) GetAll(ctx context.Context, activeOnly bool) ([]*models.LegalHold, error) {
+	return svc.repo.GetAllLegalHolds(ctx, activeOnly)
+}
+
+func (svc *legalHoldService) GetByID(ctx context.Context, id int) (*models.LegalHold, error) {
+	hold, err := svc.repo.GetLegalHoldByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if hold == nil {
+		return nil, errors.New("Legal hold not found")
+	}
+
+	return hold, nil
+}
+
+func (svc *legalHoldService) GetByKunjungan(ctx context.Context, idKunjungan int) ([]*models.LegalHold, error) {
+	return svc.repo.GetActiveHoldsForKunjungan(ctx, idKunjungan)
+}
+
+func (svc *legalHoldService) Create(ctx context.Context, hold models.LegalHold) (*models.LegalHold, error) {
+	if (hold.IDPasien == nil) == (hold.IDKunjungan == nil) {
+		return nil, errors.New("Legal hold must target either a pasien or a kunjungan")
+	}
+
+	hold.Reason = strings.TrimSpace(hold.Reason)
+	if hold.Reason == "" {
+		return nil, errors.New("Reason is required")
+	}
+
+	if hold.ExpiresAt != nil && !hold.ExpiresAt.After(time.Now()) {
+		return nil, errors.New("Expiry must be in the future")
+	}
+
+	if hold.IDPasien != nil {
+		if _, err := svc.pasienRepo.GetPasienByID(ctx, *hold.IDPasien); err != nil {
+			return nil, errors.New("Pasien not found")
+		}
+	} else {
+		if _, err := svc.kunjunganRepo.GetKunjunganBasicByID(ctx, *hold.IDKunjungan); err != nil {
+			return nil, errors.New("Kunjungan not found")
+		}
+	}
+
+	hold.PlacedBy = pkg.GetUserIDFromCtx(ctx)
+
+	newHold, err := svc.repo.CreateLegalHold(ctx, &hold)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.audit.Record(ctx, audit.Create, "legal_hold", newHold.ID, nil, newHold)
+	return newHold, nil
+}
+
+func (svc *legalHoldService) Release(ctx context.Context, id int) (*models.LegalHold, error) {
+	hold, err := svc.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if hold.ReleasedAt != nil {
+		return nil, errors.New("Legal hold already released")
+	}
+
+	if err := svc.repo.ReleaseLegalHold(ctx, id, pkg.GetUserIDFromCtx(ctx)); err != nil {
+		return nil, err
+	}
+
+	released, err := svc.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.audit.Record(ctx, audit.Update, "legal_hold", id, hold, released)
+	return released, nil
+}
+
+// checkLegalHold returns ErrLegalHold when the kunjungan or its pasien has an
+// active hold. The rejected action is written to the activity log.
+func checkLegalHold(ctx context.Context, repo repositories.LegalHoldRepository, idKunjungan int, action string) error {
+	holds, err := repo.GetActiveHoldsForKunjungan(ctx, idKunjungan)
+	if err != nil {
+		return err
+	}
+
+	return rejectHeld(ctx, holds, fmt.Sprintf("kunjungan %d", idKunjungan), action)
+}
+
+// checkLegalHoldTx is checkLegalHold inside tx; no hold can be placed on the
+// kunjungan until tx ends.
+func checkLegalHoldTx(ctx context.Context, repo repositories.LegalHoldRepository, tx *sql.Tx, idKunjungan int, action string) error {
+	holds, err := repo.GetActiveHoldsForKunjunganTx(ctx, tx, idKunjungan)
+	if err != nil {
+		return err
+	}
+
+	return rejectHeld(ctx, holds, fmt.Sprintf("kunjungan %d", idKunjungan), action)
+}
+
+// checkPasienLegalHold returns ErrLegalHold when the pasien or any of its
+// kunjungan has an active hold.
+func checkPasienLegalHold(ctx context.Context, repo repositories.LegalHoldRepository, idPasien int, action string) error {
+	holds, err := repo.GetActiveHoldsForPasien(ctx, idPasien)
+	if err != nil {
+		return err
+	}
+
+	return rejectHeld(ctx, holds, fmt.Sprintf("pasien %d", idPasien), action)
+}
+
+func rejectHeld(ctx context.Context, holds []*models.LegalHold, target, action string) error {
+	if len(holds) == 0 {
+		return nil
+	}
+
+	hold := holds[0]
+	message := fmt.Sprintf("%s of %s rejected: legal hold #%d (%s)", action, target, hold.ID, hold.Reason)
+	log.Println(message)
+
+	userID := strconv.Itoa(pkg.GetUserIDFromCtx(ctx))
+	if err := logs.LogActivity(userID, message, "error"); err != nil {
+		log.Printf("Failed to write activity log: %v", err)
+	}
+
+	return fmt.Errorf("%w #%d: %s", ErrLegalHold, hold.ID, hold.Reason)
+}
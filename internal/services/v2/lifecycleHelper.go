@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/lifecycle"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+)
+
+func loadLifecycle(ctx context.Context, kunjunganRepo repositories.KunjunganRepository, id int) (lifecycle.Record, error) {
+	lc, err := kunjunganRepo.GetKunjunganLifecycle(ctx, id)
+	if err != nil {
+		return lifecycle.Record{}, err
+	}
+	if lc == nil {
+		return lifecycle.Record{}, errors.New("Kunjungan not found")
+	}
+
+	return lifecycle.NewRecord(lc.AlihMedia, lc.Retensi, lc.Pemusnahan)
+}
+
+// loadLifecycleTx is loadLifecycle with the statuses locked until tx ends.
+func loadLifecycleTx(ctx context.Context, kunjunganRepo repositories.KunjunganRepository, tx *sql.Tx, id int) (lifecycle.Record, error) {
+	lc, err := kunjunganRepo.GetKunjunganLifecycleTx(ctx, tx, id)
+	if err != nil {
+		return lifecycle.Record{}, err
+	}
+	if lc == nil {
+		return lifecycle.Record{}, errors.New("Kunjungan not found")
+	}
+
+	return lifecycle.NewRecord(lc.AlihMedia, lc.Retensi, lc.Pemusnahan)
+}
+
+// parseStatus treats an empty status as "unchanged" for an existing row and as
+// the initial state for a new one.
+func parseStatus(record lifecycle.Record, stage lifecycle.Stage, status string) (lifecycle.State, error) {
+	if status == "" {
+		if current := record.State(stage); current != lifecycle.None {
+			return current, nil
+		}
+		return lifecycle.Initial(stage), nil
+	}
+
+	return lifecycle.Parse(stage, status)
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg/logs"
+)
+
+const (
+	LoginScopeAccount = "account"
+	LoginScopeIP      = "ip"
+
+	DefaultLoginAccountLimit = 5
+	DefaultLoginIPLimit      = 20
+	DefaultLoginLockout      = 15 * time.Minute
+
+	// Each lockout past the first doubles, up to loginMaxLockout. Counters
+	// with no failure for loginFailureWindow start over.
+	loginMaxLockout    = 24 * time.Hour
+	loginFailureWindow = 24 * time.Hour
+)
+
+var ErrLoginLocked = errors.New("Too many failed login attempts")
+
+// LoginLockedError is returned while an account or client IP is locked out.
+type LoginLockedError struct {
+	Until time.Time
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("%s, try again after %s", ErrLoginLocked, e.Until.Format("02-01-2006 15:04:05"))
+}
+
+func (e *LoginLockedError) Is(target error) bool {
+	return target == ErrLoginLocked
+}
+
+// RetryAfter is how long the client has to wait, rounded up to a second.
+func (e *LoginLockedError) RetryAfter() time.Duration {
+	wait := time.Until(e.Until)
+	if wait < time.Second {
+		return time.Second
+	}
+	return (wait + time.Second - 1).Truncate(time.Second)
+}
+
+// LoginThrottleService counts failed logins per account and per client IP and
+// locks either out once it crosses its limit.
+type LoginThrottleService interface {
+	Check(ctx context.Context, email, ip string) error
+	Failed(ctx context.Context, email, ip string) error
+	Succeeded(ctx context.Context, email string) error
+	Unlock(ctx context.Context, userID int) error
+}
+
+type loginThrottleService struct {
+	repo         repositories.LoginAttemptRepository
+	userRepo     repositories.UserRepository
+	audit        audit.Recorder
+	accountLimit int
+	ipLimit      int
+	lockout      time.Duration
+}
+
+func NewServiceLoginThrottle(
+	repo repositories.LoginAttemptRepository,
+	userRepo repositories.UserRepository,
+	auditRecorder audit.Recorder,
+	accountLimit, ipLimit int,
+	lockout time.Duration,
+) LoginThrottleService {
+	if accountLimit <= 0 {
+		accountLimit = DefaultLoginAccountLimit
+	}
+	if ipLimit <= 0 {
+		ipLimit = DefaultLoginIPLimit
+	}
+	if lockout <= 0 {
+		lockout = DefaultLoginLockout
+	}
+
+	return &loginThrottleService{
+		repo:         repo,
+		userRepo:     userRepo,
+		audit:        auditRecorder,
+		accountLimit: accountLimit,
+		ipLimit:      ipLimit,
+		lockout:      lockout,
+	}
+}
+
+func (svc *loginThrottleService) Check(ctx context.Context, email, ip string) error {
+	now := time.Now()
+	for _, key := range svc.keys(email, ip) {
+		attempt, err := svc.repo.Get(ctx, key.scope, key.identifier)
+		if err != nil {
+			return err
+		}
+		if attempt != nil && attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil) {
+			return &LoginLockedError{Until: *attempt.LockedUntil}
+		}
+	}
+	return nil
+}
+
+// Failed counts a failed attempt against the account and the IP. Unknown
+// emails are counted too, so a lockout does not reveal whether one exists.
+func (svc *loginThrottleService) Failed(ctx context.Context, email, ip string) error {
+	now := time.Now()
+	for _, key := range svc.keys(email, ip) {
+		attempt, err := svc.repo.RecordFailure(ctx, key.scope, key.identifier, now, now.Add(-loginFailureWindow))
+		if err != nil {
+			return err
+		}
+		if attempt == nil || attempt.Failures < key.limit {
+			continue
+		}
+
+		until := now.Add(svc.lockoutFor(attempt.Failures - key.limit))
+		if err := svc.repo.Lock(ctx, key.scope, key.identifier, until); err != nil {
+			return err
+		}
+
+		message := fmt.Sprintf("Login locked for %s %s until %s after %d failed attempts (last from %s)",
+			key.scope, key.identifier, until.Format("2006-01-02 15:04:05"), attempt.Failures, ip)
+		if err := logs.LogAccess(key.identifier, message, "locked"); err != nil {
+			log.Printf("Failed to log login lockout: %v", err)
+		}
+	}
+	return nil
+}
+
+// Succeeded resets the account counter. The IP counter is left alone so one
+// working password cannot be used to keep guessing others from the same IP.
+func (svc *loginThrottleService) Succeeded(ctx context.Context, email string) error {
+	_, err := svc.repo.Clear(ctx, LoginScopeAccount, normalizeLoginEmail(email))
+	return err
+}
+
+func (svc *loginThrottleService) Unlock(ctx context.Context, userID int) error {
+	user, err := svc.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return errors.New("User not found")
+	}
+
+	identifier := normalizeLoginEmail(user.Email)
+	existing, err := svc.repo.Get(ctx, LoginScopeAccount, identifier)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return nil
+	}
+
+	if _, err := svc.repo.Clear(ctx, LoginScopeAccount, identifier); err != nil {
+		return err
+	}
+
+	svc.audit.Record(ctx, audit.Delete, "login_attempt", identifier, existing, nil)
+
+	message := fmt.Sprintf("Login unlocked for account %s by user %d", identifier, pkg.GetUserIDFromCtx(ctx))
+	if err := logs.LogAccess(strconv.Itoa(pkg.GetUserIDFromCtx(ctx)), message, "unlocked"); err != nil {
+		log.Printf("Failed to log login unlock: %v", err)
+	}
+	return nil
+}
+
+type loginKey struct {
+	scope      string
+	identifier string
+	limit      int
+}
+
+// keys returns the counters an attempt is checked against. ip is the address
+// set by the ClientIP middleware, which only takes a forwarded address from a
+// trusted proxy, so a client cannot move to a fresh counter with a header.
+func (svc *loginThrottleService) keys(email, ip string) []loginKey {
+	keys := []loginKey{{LoginScopeAccount, normalizeLoginEmail(email), svc.accountLimit}}
+	if ip = loginIPIdentifier(ip); ip != "" {
+		keys = append(keys, loginKey{LoginScopeIP, ip, svc.ipLimit})
+	}
+	return keys
+}
+
+// loginIPIdentifier counts an IPv6 client by its /64, since a single host is
+// usually handed the whole prefix and could otherwise rotate addresses.
+func loginIPIdentifier(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.To4() != nil {
+		return ip
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
+
+// lockoutFor returns the lock for the nth failure past the limit, starting
+// at zero: the base lockout, then doubling each time.
+func (svc *loginThrottleService) lockoutFor(n int) time.Duration {
+	lockout := svc.lockout
+	for i := 0; i < n && lockout < loginMaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > loginMaxLockout {
+		lockout = loginMaxLockout
+	}
+	return lockout
+}
+
+func normalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
@@ -36,11 +37,13 @@ type PasienFilter struct {
 }
 
 type pasienService struct {
-	repo repositories.PasienRepository
+	repo          repositories.PasienRepository
+	legalHoldRepo repositories.LegalHoldRepository
+	audit         audit.Recorder
 }
 
-func NewServicePasien(repo repositories.PasienRepository) PasienService {
-	return &pasienService{repo: repo}
+func NewServicePasien(repo repositories.PasienRepository, legalHoldRepo repositories.LegalHoldRepository, auditRecorder audit.Recorder) PasienService {
+	return &pasienService{repo: repo, legalHoldRepo: legalHoldRepo, audit: auditRecorder}
 }
 
 type PasienPagination struct {
@@ -229,6 +232,7 @@ func (svc *pasienService) Create(ctx context.Context, pasien models.Pasien) (*mo
 		return nil, err
 	}
 
+	svc.audit.Record(ctx, audit.Create, "pasien", newPasien.ID, nil, newPasien)
 	return newPasien, nil
 }
 
@@ -247,6 +251,8 @@ func (svc *pasienService) Update(ctx context.Context, pasien models.Pasien) (*mo
 	if err != nil {
 		return nil, err
 	}
+
+	svc.audit.Record(ctx, audit.Update, "pasien", pasien.ID, existing, newPasien)
 	return newPasien, nil
 }
 
@@ -260,7 +266,16 @@ func (svc *pasienService) Delete(ctx context.Context, id int) error {
 		return errors.New("Pasien not found")
 	}
 
-	return svc.repo.DeletePasien(ctx, id)
+	if err := checkPasienLegalHold(ctx, svc.legalHoldRepo, id, "Pasien deletion"); err != nil {
+		return err
+	}
+
+	if err := svc.repo.DeletePasien(ctx, id); err != nil {
+		return err
+	}
+
+	svc.audit.Record(ctx, audit.Delete, "pasien", id, existing, nil)
+	return nil
 }
 
 func (svc *pasienService) Import(ctx context.Context, filepath string) error {
@@ -293,15 +308,19 @@ func (svc *pasienService) Import(ctx context.Context, filepath string) error {
 
 		existing, err := svc.repo.GetPasienByNoRM(ctx, pasien.NoRM)
 		if err != nil || existing == nil {
-			_, err := svc.repo.CreatePasien(ctx, pasien)
+			created, err := svc.repo.CreatePasien(ctx, pasien)
 			if err != nil {
 				log.Printf("Failed to create pasien %s: %v", pasien.NoRM, err)
+			} else {
+				svc.audit.Record(ctx, audit.Create, "pasien", created.ID, nil, created)
 			}
 		} else {
 			pasien.ID = existing.ID
-			_, err := svc.repo.UpdatePasien(ctx, pasien)
+			updated, err := svc.repo.UpdatePasien(ctx, pasien)
 			if err != nil {
 				log.Printf("Failed to update pasien %s: %v", pasien.NoRM, err)
+			} else {
+				svc.audit.Record(ctx, audit.Update, "pasien", pasien.ID, existing, updated)
 			}
 		}
 	}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/mailer"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+)
+
+const (
+	DefaultPasswordResetTTL = time.Hour
+	DefaultPasswordResetURL = "http://localhost:5173/reset-password"
+
+	passwordResetMailTimeout = 30 * time.Second
+)
+
+var ErrInvalidResetToken = errors.New("Invalid or expired reset token")
+
+type PasswordResetService interface {
+	Forgot(ctx context.Context, email string) error
+	SendReset(ctx context.Context, userID int) error
+	Reset(ctx context.Context, token, newPassword string) error
+}
+
+type passwordResetService struct {
+	repo       repositories.PasswordResetRepository
+	userRepo   repositories.UserRepository
+	sessions   SessionService
+	mail       mailer.Mailer
+	transactor repositories.Transactor
+	audit      audit.Recorder
+	ttl        time.Duration
+	resetURL   string
+}
+
+// resetURL is the frontend page that reads the token from its query string
+// and posts it to /password/reset.
+func NewServicePasswordReset(
+	repo repositories.PasswordResetRepository,
+	userRepo repositories.UserRepository,
+	sessions SessionService,
+	mail mailer.Mailer,
+	transactor repositories.Transactor,
+	auditRecorder audit.Recorder,
+	ttl time.Duration,
+	resetURL string,
+) PasswordResetService {
+	if ttl <= 0 {
+		ttl = DefaultPasswordResetTTL
+	}
+	if resetURL == "" {
+		resetURL = DefaultPasswordResetURL
+	}
+
+	return &passwordResetService{
+		repo:       repo,
+		userRepo:   userRepo,
+		sessions:   sessions,
+		mail:       mail,
+		transactor: transactor,
+		audit:      auditRecorder,
+		ttl:        ttl,
+		resetURL:   resetURL,
+	}
+}
+
+// Forgot mails a reset link if email belongs to an active user. It reports
+// success either way so the endpoint cannot be used to find accounts, and the
+// mail is sent in the background for the same reason.
+func (svc *passwordResetService) Forgot(ctx context.Context, email string) error {
+	user, err := svc.userRepo.GetByUsername(ctx, strings.TrimSpace(email))
+	if err != nil {
+		return err
+	}
+	if user == nil || user.Status != "aktif" {
+		return nil
+	}
+
+	msg, err := svc.issue(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), passwordResetMailTimeout)
+		defer cancel()
+
+		if err := svc.mail.Send(ctx, *msg); err != nil {
+			log.Printf("Failed to send password reset mail to user %d: %v", user.ID, err)
+		}
+	}()
+
+	return nil
+}
+
+// SendReset lets an admin send a reset link to any user.
+func (svc *passwordResetService) SendReset(ctx context.Context, userID int) error {
+	user, err := svc.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return errors.New("User not found")
+	}
+
+	msg, err := svc.issue(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	return svc.mail.Send(ctx, *msg)
+}
+
+func (svc *passwordResetService) Reset(ctx context.Context, token, newPassword string) error {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return ErrInvalidResetToken
+	}
+	if newPassword == "" {
+		return errors.New("New password is required")
+	}
+
+	reset, err := svc.repo.GetByTokenHash(ctx, pkg.HashToken(token))
+	if err != nil {
+		return err
+	}
+	if reset == nil || reset.UsedAt != nil || !time.Now().Before(reset.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	user, err := svc.userRepo.GetByID(ctx, reset.IDUser)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrInvalidResetToken
+	}
+
+	hashed, err := pkg.HashPassword(newPassword)
+	if err != nil {
+		return errors.New("Failed to hash password")
+	}
+
+	// The token is spent only together with the password change, so a
+	// failed write leaves it usable for another try.
+	err = svc.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		used, err := svc.repo.MarkUsedTx(ctx, tx, reset.ID)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidResetToken
+		}
+
+		if err := svc.userRepo.UpdatePasswordTx(ctx, tx, user.ID, hashed); err != nil {
+			return err
+		}
+
+		if err := svc.repo.InvalidateForUserTx(ctx, tx, user.ID); err != nil {
+			return err
+		}
+
+		return svc.audit.RecordTx(ctx, tx, audit.Update, "user", user.ID, map[string]string{"Password": user.Password}, map[string]string{"Password": hashed})
+	})
+	if err != nil {
+		return err
+	}
+
+	return svc.sessions.RevokeAll(ctx, user.ID)
+}
+
+// issue replaces any outstanding token of user with a new one and returns
+// the mail carrying it.
+func (svc *passwordResetService) issue(ctx context.Context, user *models.User) (*mailer.Message, error) {
+	if err := svc.repo.InvalidateForUser(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	token, err := pkg.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	reset := models.PasswordReset{
+		IDUser:    user.ID,
+		TokenHash: pkg.HashToken(token),
+		IP:        pkg.GetClientIPFromCtx(ctx),
+		CreatedAt: now,
+		ExpiresAt: now.Add(svc.ttl),
+	}
+
+	if reset.ID, err = svc.repo.Create(ctx, reset); err != nil {
+		return nil, err
+	}
+
+	svc.audit.Record(ctx, audit.Create, "password_reset", reset.ID, nil, reset)
+
+	link := svc.resetURL + "?token=" + url.QueryEscape(token)
+	if strings.Contains(svc.resetURL, "?") {
+		link = svc.resetURL + "&token=" + url.QueryEscape(token)
+	}
+
+	return &mailer.Message{
+		To:      user.Email,
+		Subject: "Reset kata sandi",
+		Body: fmt.Sprintf(
+			"Halo %s,\n\nKami menerima permintaan untuk mengatur ulang kata sandi akun Anda. "+
+				"Buka tautan berikut untuk membuat kata sandi baru:\n\n%s\n\n"+
+				"Tautan ini hanya dapat digunakan sekali dan berlaku sampai %s.\n"+
+				"Jika Anda tidak meminta reset kata sandi, abaikan email ini.\n",
+			user.Name, link, reset.ExpiresAt.Format("02-01-2006 15:04"),
+		),
+	}, nil
+}
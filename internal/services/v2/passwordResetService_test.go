@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+)
+
+// memoryUserRepo holds at most one user. Password writes are staged on store.
+type memoryUserRepo struct {
+	repositories.UserRepository
+	user        *models.User
+	store       *memoryStore
+	passwordErr error
+}
+
+func (repo memoryUserRepo) GetByID(ctx context.Context, id int) (*models.User, error) {
+	if repo.user == nil || repo.user.ID != id {
+		return nil, nil
+	}
+	copied := *repo.user
+	return &copied, nil
+}
+
+func (repo memoryUserRepo) UpdatePasswordTx(ctx context.Context, tx *sql.Tx, id int, hashedPassword string) error {
+	if repo.passwordErr != nil {
+		return repo.passwordErr
+	}
+	repo.store.staged = append(repo.store.staged, func() { repo.user.Password = hashedPassword })
+	return nil
+}
+
+// memoryPasswordResetRepo holds one reset token. Writes are staged on store.
+type memoryPasswordResetRepo struct {
+	repositories.PasswordResetRepository
+	reset *models.PasswordReset
+	store *memoryStore
+}
+
+func (repo *memoryPasswordResetRepo) GetByTokenHash(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	if repo.reset.TokenHash != tokenHash {
+		return nil, nil
+	}
+	copied := *repo.reset
+	return &copied, nil
+}
+
+func (repo *memoryPasswordResetRepo) MarkUsedTx(ctx context.Context, tx *sql.Tx, id int) (bool, error) {
+	if repo.reset.UsedAt != nil {
+		return false, nil
+	}
+	repo.store.staged = append(repo.store.staged, func() {
+		now := time.Now()
+		repo.reset.UsedAt = &now
+	})
+	return true, nil
+}
+
+func (repo *memoryPasswordResetRepo) InvalidateForUserTx(ctx context.Context, tx *sql.Tx, idUser int) error {
+	return nil
+}
+
+type memorySessionService struct {
+	SessionService
+	revoked []int
+}
+
+func (svc *memorySessionService) RevokeAll(ctx context.Context, userID int) error {
+	svc.revoked = append(svc.revoked, userID)
+	return nil
+}
+
+func TestPasswordResetReset(t *testing.T) {
+	writeErr := errors.New("write failed")
+
+	tests := []struct {
+		name        string
+		used        bool
+		passwordErr error
+		wantErr     error
+	}{
+		{"valid token", false, nil, nil},
+		{"password write fails", false, writeErr, writeErr},
+		{"token already used", true, nil, ErrInvalidResetToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore()
+			user := &models.User{ID: 3, Password: "old-hash"}
+			reset := &models.PasswordReset{ID: 1, IDUser: 3, TokenHash: pkg.HashToken("token"), ExpiresAt: time.Now().Add(time.Hour)}
+			if tt.used {
+				usedAt := time.Now().Add(-time.Minute)
+				reset.UsedAt = &usedAt
+			}
+			sessions := &memorySessionService{}
+
+			svc := NewServicePasswordReset(
+				&memoryPasswordResetRepo{reset: reset, store: store},
+				memoryUserRepo{user: user, store: store, passwordErr: tt.passwordErr},
+				sessions, nil, store, &memoryRecorder{}, 0, "",
+			)
+
+			err := svc.Reset(context.Background(), "token", "new password")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reset err = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil {
+				if reset.UsedAt == nil || user.Password == "old-hash" || len(sessions.revoked) != 1 {
+					t.Errorf("token used %v, password %q, revoked %v; want the token spent, the password changed and sessions revoked", reset.UsedAt != nil, user.Password, sessions.revoked)
+				}
+				return
+			}
+
+			if user.Password != "old-hash" || len(sessions.revoked) != 0 {
+				t.Errorf("failed reset changed the password to %q or revoked %v", user.Password, sessions.revoked)
+			}
+			if !tt.used && reset.UsedAt != nil {
+				t.Error("failed reset spent the token, want it left usable")
+			}
+		})
+	}
+}
@@ -2,10 +2,13 @@ package services
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log"
 
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/lifecycle"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
@@ -23,11 +26,16 @@ type PemusnahanService interface {
 }
 
 type pemusnahanService struct {
-	repo repositories.PemusnahanRepository
+	repo          repositories.PemusnahanRepository
+	kunjunganRepo repositories.KunjunganRepository
+	legalHoldRepo repositories.LegalHoldRepository
+	batchRepo     repositories.DestructionBatchRepository
+	transactor    repositories.Transactor
+	audit         audit.Recorder
 }
 
-func NewServicePemusnahan(repo repositories.PemusnahanRepository) PemusnahanService {
-	return &pemusnahanService{repo: repo}
+func NewServicePemusnahan(repo repositories.PemusnahanRepository, kunjunganRepo repositories.KunjunganRepository, legalHoldRepo repositories.LegalHoldRepository, batchRepo repositories.DestructionBatchRepository, transactor repositories.Transactor, auditRecorder audit.Recorder) PemusnahanService {
+	return &pemusnahanService{repo: repo, kunjunganRepo: kunjunganRepo, legalHoldRepo: legalHoldRepo, batchRepo: batchRepo, transactor: transactor, audit: auditRecorder}
 }
 
 type PemusnahanPagination struct {
@@ -166,14 +174,41 @@ func (svc *pemusnahanService) GetByID(ctx context.Context, id int) (*models.Pemu
 }
 
 func (svc *pemusnahanService) Create(ctx context.Context, pemusnahan models.Pemusnahan) (*models.Pemusnahan, error) {
+	if err := checkLegalHold(ctx, svc.legalHoldRepo, pemusnahan.ID, "Pemusnahan"); err != nil {
+		return nil, err
+	}
+
+	record, err := loadLifecycle(ctx, svc.kunjunganRepo, pemusnahan.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := parseStatus(record, lifecycle.StagePemusnahan, pemusnahan.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	if status == lifecycle.PemusnahanSudah && record.Pemusnahan != lifecycle.PemusnahanSudah {
+		return nil, errPemusnahanBatchOnly
+	}
+
+	if err := record.CanCreate(lifecycle.StagePemusnahan, status); err != nil {
+		return nil, err
+	}
+	pemusnahan.Status = string(status)
+
 	newPemusnahan, err := svc.repo.CreatePemusnahan(ctx, &pemusnahan)
 	if err != nil {
 		return nil, err
 	}
 
+	svc.audit.Record(ctx, audit.Create, "pemusnahan", newPemusnahan.ID, nil, newPemusnahan)
 	return newPemusnahan, nil
 }
 
+// Update changes a pemusnahan row that is still pending. A destroyed record
+// is final, so it is refused like a delete; the checks, the update and its
+// audit row run under lock in one transaction.
 func (svc *pemusnahanService) Update(ctx context.Context, pemusnahan models.Pemusnahan) (*models.Pemusnahan, error) {
 	existing, err := svc.repo.GetPemusnahanByID(ctx, pemusnahan.ID)
 	if err != nil {
@@ -181,18 +216,54 @@ func (svc *pemusnahanService) Update(ctx context.Context, pemusnahan models.Pemu
 	}
 
 	if existing == nil {
-		return nil, errors.New("Alih Media not found")
+		return nil, errors.New("Pemusnahan not found")
 	}
 
-	newPemusnahan, err := svc.repo.UpdatePemusnahan(ctx, pemusnahan)
+	err = svc.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		if err := checkLegalHoldTx(ctx, svc.legalHoldRepo, tx, pemusnahan.ID, "Pemusnahan"); err != nil {
+			return err
+		}
+
+		record, err := loadLifecycleTx(ctx, svc.kunjunganRepo, tx, pemusnahan.ID)
+		if err != nil {
+			return err
+		}
+
+		if record.Pemusnahan == lifecycle.PemusnahanSudah {
+			return fmt.Errorf("%w: a destroyed record cannot be changed", lifecycle.ErrInvalidTransition)
+		}
+
+		status, err := parseStatus(record, lifecycle.StagePemusnahan, pemusnahan.Status)
+		if err != nil {
+			return err
+		}
+
+		if status == lifecycle.PemusnahanSudah {
+			return errPemusnahanBatchOnly
+		}
+
+		if err := record.CanTransition(lifecycle.StagePemusnahan, status); err != nil {
+			return err
+		}
+		pemusnahan.Status = string(status)
 
+		if err := svc.repo.UpdatePemusnahanTx(ctx, tx, pemusnahan); err != nil {
+			return err
+		}
+
+		return svc.audit.RecordTx(ctx, tx, audit.Update, "pemusnahan", pemusnahan.ID, existing, pemusnahan)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return newPemusnahan, nil
+	return &pemusnahan, nil
 }
 
+// Delete removes a pemusnahan row that is still pending. A record under legal
+// hold, one already destroyed, or one in an approved or executed destruction
+// batch is kept; the checks, the delete and its audit row run under lock in
+// one transaction.
 func (svc *pemusnahanService) Delete(ctx context.Context, id int) error {
 	existing, err := svc.repo.GetPemusnahanByID(ctx, id)
 	if err != nil {
@@ -200,10 +271,38 @@ func (svc *pemusnahanService) Delete(ctx context.Context, id int) error {
 	}
 
 	if existing == nil {
-		return errors.New("Alih Media not found")
+		return errors.New("Pemusnahan not found")
 	}
 
-	return svc.repo.DeletePemusnahan(ctx, id)
+	return svc.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		if err := checkLegalHoldTx(ctx, svc.legalHoldRepo, tx, id, "Pemusnahan deletion"); err != nil {
+			return err
+		}
+
+		record, err := loadLifecycleTx(ctx, svc.kunjunganRepo, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if record.Pemusnahan == lifecycle.PemusnahanSudah {
+			return fmt.Errorf("%w: a destroyed record cannot be deleted", lifecycle.ErrInvalidTransition)
+		}
+
+		idBatch, err := svc.batchRepo.GetClosedBatchIDForKunjunganTx(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if idBatch != 0 {
+			return fmt.Errorf("%w: kunjungan %d belongs to destruction batch #%d", lifecycle.ErrInvalidTransition, id, idBatch)
+		}
+
+		if err := svc.repo.DeletePemusnahanTx(ctx, tx, id); err != nil {
+			return err
+		}
+
+		return svc.audit.RecordTx(ctx, tx, audit.Delete, "pemusnahan", id, existing, nil)
+	})
 }
 
 func (svc *pemusnahanService) Export(ctx context.Context) ([]byte, error) {
@@ -212,6 +311,20 @@ func (svc *pemusnahanService) Export(ctx context.Context) ([]byte, error) {
 		return nil, err
 	}
 
+	held, err := svc.legalHoldRepo.GetHeldKunjunganIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Records under legal hold must not appear on a pemusnahan list.
+	exportable := data[:0]
+	for _, row := range data {
+		if !held[row.ID] {
+			exportable = append(exportable, row)
+		}
+	}
+	data = exportable
+
 	if len(data) == 0 {
 		log.Println("[Export] Tidak ada data pemusnahan")
 	}
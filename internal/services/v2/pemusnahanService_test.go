@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/lifecycle"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+)
+
+type memoryPemusnahanRepo struct {
+	repositories.PemusnahanRepository
+	row     *models.PemusnahanJoin
+	updates []models.Pemusnahan
+}
+
+func (repo *memoryPemusnahanRepo) GetPemusnahanByID(ctx context.Context, id int) (*models.PemusnahanJoin, error) {
+	return repo.row, nil
+}
+
+func (repo *memoryPemusnahanRepo) UpdatePemusnahanTx(ctx context.Context, tx *sql.Tx, pemusnahan models.Pemusnahan) error {
+	repo.updates = append(repo.updates, pemusnahan)
+	return nil
+}
+
+func (repo *memoryPemusnahanRepo) GetPemusnahanByBatch(ctx context.Context, idBatch int) ([]*models.PemusnahanJoin, error) {
+	return nil, nil
+}
+
+type memoryLifecycleRepo struct {
+	repositories.KunjunganRepository
+	lc *models.KunjunganLifecycle
+}
+
+func (repo memoryLifecycleRepo) GetKunjunganLifecycleTx(ctx context.Context, tx *sql.Tx, id int) (*models.KunjunganLifecycle, error) {
+	return repo.lc, nil
+}
+
+type memoryLegalHoldRepo struct {
+	repositories.LegalHoldRepository
+}
+
+func (repo memoryLegalHoldRepo) GetActiveHoldsForKunjunganTx(ctx context.Context, tx *sql.Tx, idKunjungan int) ([]*models.LegalHold, error) {
+	return nil, nil
+}
+
+func TestPemusnahanUpdate(t *testing.T) {
+	tests := []struct {
+		name       string
+		current    lifecycle.State
+		status     string
+		wantErr    error
+		wantStatus string
+	}{
+		{"pending stays pending", lifecycle.PemusnahanBelum, string(lifecycle.PemusnahanBelum), nil, string(lifecycle.PemusnahanBelum)},
+		{"empty status keeps pending", lifecycle.PemusnahanBelum, "", nil, string(lifecycle.PemusnahanBelum)},
+		{"pending completed outside a batch", lifecycle.PemusnahanBelum, string(lifecycle.PemusnahanSudah), lifecycle.ErrInvalidTransition, ""},
+		{"destroyed row given the same status", lifecycle.PemusnahanSudah, string(lifecycle.PemusnahanSudah), lifecycle.ErrInvalidTransition, ""},
+		{"destroyed row with an empty status", lifecycle.PemusnahanSudah, "", lifecycle.ErrInvalidTransition, ""},
+		{"destroyed row back to pending", lifecycle.PemusnahanSudah, string(lifecycle.PemusnahanBelum), lifecycle.ErrInvalidTransition, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &memoryPemusnahanRepo{row: &models.PemusnahanJoin{ID: 5, Status: string(tt.current)}}
+			kunjunganRepo := memoryLifecycleRepo{lc: &models.KunjunganLifecycle{
+				ID:         5,
+				AlihMedia:  string(lifecycle.AlihMediaSudah),
+				Retensi:    string(lifecycle.RetensiSudah),
+				Pemusnahan: string(tt.current),
+			}}
+			store := newMemoryStore()
+			svc := NewServicePemusnahan(repo, kunjunganRepo, memoryLegalHoldRepo{}, nil, store, &memoryRecorder{})
+
+			got, err := svc.Update(context.Background(), models.Pemusnahan{ID: 5, Status: tt.status})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Update err = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				if len(repo.updates) != 0 || store.commits != 0 {
+					t.Errorf("rejected update wrote %v (%d commits), want nothing", repo.updates, store.commits)
+				}
+				return
+			}
+
+			if got.Status != tt.wantStatus || len(repo.updates) != 1 || repo.updates[0].Status != tt.wantStatus {
+				t.Errorf("Update = %+v, writes %v, want one write with status %q", got, repo.updates, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/mailer"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+)
+
+const (
+	DefaultEmailVerificationTTL = 48 * time.Hour
+	DefaultEmailVerificationURL = "http://localhost:5173/verify-email"
+
+	registrationMailTimeout = 30 * time.Second
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("Invalid or expired verification token")
+	ErrNotPendingApproval       = errors.New("User is not awaiting approval")
+)
+
+// RegistrationService covers self-registration: the email check, the admin
+// approval queue and the mails sent along the way.
+type RegistrationService interface {
+	Register(ctx context.Context, user models.User) (*models.User, error)
+	Verify(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, email string) error
+	GetPending(ctx context.Context) ([]*models.User, error)
+	Approve(ctx context.Context, id int) (*models.User, error)
+	Reject(ctx context.Context, id int, reason string) error
+}
+
+type registrationService struct {
+	userRepo         repositories.UserRepository
+	verificationRepo repositories.EmailVerificationRepository
+	mail             mailer.Mailer
+	audit            audit.Recorder
+	ttl              time.Duration
+	verifyURL        string
+}
+
+// verifyURL is the frontend page that reads the token from its query string
+// and posts it to /register/verify.
+func NewServiceRegistration(
+	userRepo repositories.UserRepository,
+	verificationRepo repositories.EmailVerificationRepository,
+	mail mailer.Mailer,
+	auditRecorder audit.Recorder,
+	ttl time.Duration,
+	verifyURL string,
+) RegistrationService {
+	if ttl <= 0 {
+		ttl = DefaultEmailVerificationTTL
+	}
+	if verifyURL == "" {
+		verifyURL = DefaultEmailVerificationURL
+	}
+
+	return &registrationService{
+		userRepo:         userRepo,
+		verificationRepo: verificationRepo,
+		mail:             mail,
+		audit:            auditRecorder,
+		ttl:              ttl,
+		verifyURL:        verifyURL,
+	}
+}
+
+func (svc *registrationService) Register(ctx context.Context, user models.User) (*models.User, error) {
+	user.Name = strings.TrimSpace(user.Name)
+	user.Email = strings.TrimSpace(user.Email)
+	if user.Name == "" || user.Email == "" || user.Password == "" {
+		return nil, errors.New("Name, email and password are required")
+	}
+
+	existing, err := svc.userRepo.GetByUsername(ctx, user.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		return nil, errors.New("Email already used")
+	}
+
+	hashed, err := pkg.HashPassword(user.Password)
+	if err != nil {
+		return nil, errors.New("Failed to hash password")
+	}
+	user.Password = hashed
+	user.SelfRegistered = true
+	user.EmailVerifiedAt = nil
+	user.ApprovedAt = nil
+
+	newUser, err := svc.userRepo.Create(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.audit.Record(ctx, audit.Create, "user", newUser.ID, nil, newUser)
+
+	msg, err := svc.issue(ctx, newUser)
+	if err != nil {
+		return nil, err
+	}
+	svc.send(*msg)
+
+	return newUser, nil
+}
+
+// Verify confirms the email address and puts the user in the approval
+// queue. Everyone who can manage users is told about it.
+func (svc *registrationService) Verify(ctx context.Context, token string) error {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return ErrInvalidVerificationToken
+	}
+
+	verification, err := svc.verificationRepo.GetByTokenHash(ctx, pkg.HashToken(token))
+	if err != nil {
+		return err
+	}
+	if verification == nil || verification.UsedAt != nil || !time.Now().Before(verification.ExpiresAt) {
+		return ErrInvalidVerificationToken
+	}
+
+	used, err := svc.verificationRepo.MarkUsed(ctx, verification.ID)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidVerificationToken
+	}
+
+	user, err := svc.userRepo.GetByID(ctx, verification.IDUser)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrInvalidVerificationToken
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	if err := svc.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
+		return err
+	}
+
+	verified, err := svc.userRepo.GetByID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	svc.audit.Record(ctx, audit.Update, "user", user.ID, user, verified)
+
+	approvers, err := svc.userRepo.GetActiveUsersWithPermission(ctx, rbac.UserManage)
+	if err != nil {
+		log.Printf("Failed to find approvers for user %d: %v", user.ID, err)
+		return nil
+	}
+
+	for _, approver := range approvers {
+		svc.send(mailer.Message{
+			To:      approver.Email,
+			Subject: "Pendaftaran baru menunggu persetujuan",
+			Body: fmt.Sprintf(
+				"Halo %s,\n\n%s (%s) telah mendaftar dan memverifikasi emailnya. "+
+					"Pendaftaran ini menunggu persetujuan Anda di menu pengguna.\n",
+				approver.Name, user.Name, user.Email,
+			),
+		})
+	}
+
+	return nil
+}
+
+// ResendVerification sends a new link to an unverified registration. Like
+// the password reset, it answers the same way whether or not email exists.
+func (svc *registrationService) ResendVerification(ctx context.Context, email string) error {
+	user, err := svc.userRepo.GetByUsername(ctx, strings.TrimSpace(email))
+	if err != nil {
+		return err
+	}
+	if user == nil || user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	msg, err := svc.issue(ctx, user)
+	if err != nil {
+		return err
+	}
+	svc.send(*msg)
+
+	return nil
+}
+
+func (svc *registrationService) GetPending(ctx context.Context) ([]*models.User, error) {
+	return svc.userRepo.GetPendingUsers(ctx)
+}
+
+func (svc *registrationService) Approve(ctx context.Context, id int) (*models.User, error) {
+	existing, err := svc.pending(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	approved, err := svc.userRepo.Approve(ctx, id, pkg.GetUserIDFromCtx(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	svc.audit.Record(ctx, audit.Update, "user", id, existing, approved)
+
+	svc.send(mailer.Message{
+		To:      approved.Email,
+		Subject: "Pendaftaran akun disetujui",
+		Body: fmt.Sprintf(
+			"Halo %s,\n\nPendaftaran akun Anda telah disetujui. Anda sekarang dapat masuk ke aplikasi.\n",
+			approved.Name,
+		),
+	})
+
+	return approved, nil
+}
+
+// Reject deletes the registration so the email can be used again, and tells
+// the registrant why. Only verified self-registrations that were never
+// approved can be rejected; staff accounts are deactivated instead.
+func (svc *registrationService) Reject(ctx context.Context, id int, reason string) error {
+	existing, err := svc.pending(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := svc.userRepo.DeletePending(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrNotPendingApproval
+	}
+
+	svc.audit.Record(ctx, audit.Delete, "user", id, existing, nil)
+
+	body := fmt.Sprintf("Halo %s,\n\nMohon maaf, pendaftaran akun Anda tidak disetujui.\n", existing.Name)
+	if reason = strings.TrimSpace(reason); reason != "" {
+		body += "\nAlasan: " + reason + "\n"
+	}
+
+	svc.send(mailer.Message{
+		To:      existing.Email,
+		Subject: "Pendaftaran akun ditolak",
+		Body:    body,
+	})
+
+	return nil
+}
+
+func (svc *registrationService) pending(ctx context.Context, id int) (*models.User, error) {
+	user, err := svc.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("User not found")
+	}
+	if !user.SelfRegistered || user.EmailVerifiedAt == nil || user.ApprovedAt != nil {
+		return nil, ErrNotPendingApproval
+	}
+	return user, nil
+}
+
+// issue replaces any outstanding verification token of user and returns the
+// mail carrying the new one.
+func (svc *registrationService) issue(ctx context.Context, user *models.User) (*mailer.Message, error) {
+	if err := svc.verificationRepo.InvalidateForUser(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	token, err := pkg.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	verification := models.EmailVerification{
+		IDUser:    user.ID,
+		TokenHash: pkg.HashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(svc.ttl),
+	}
+
+	if verification.ID, err = svc.verificationRepo.Create(ctx, verification); err != nil {
+		return nil, err
+	}
+
+	separator := "?"
+	if strings.Contains(svc.verifyURL, "?") {
+		separator = "&"
+	}
+	link := svc.verifyURL + separator + "token=" + url.QueryEscape(token)
+
+	return &mailer.Message{
+		To:      user.Email,
+		Subject: "Verifikasi email pendaftaran",
+		Body: fmt.Sprintf(
+			"Halo %s,\n\nTerima kasih telah mendaftar. Buka tautan berikut untuk memverifikasi email Anda:\n\n%s\n\n"+
+				"Tautan ini berlaku sampai %s. Setelah email terverifikasi, pendaftaran Anda akan ditinjau oleh admin.\n"+
+				"Jika Anda tidak merasa mendaftar, abaikan email ini.\n",
+			user.Name, link, verification.ExpiresAt.Format("02-01-2006 15:04"),
+		),
+	}, nil
+}
+
+// send delivers msg in the background so the request does not wait on the
+// mail server. Failures are only logged.
+func (svc *registrationService) send(msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), registrationMailTimeout)
+		defer cancel()
+
+		if err := svc.mail.Send(ctx, msg); err != nil {
+			log.Printf("Failed to send %q mail to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
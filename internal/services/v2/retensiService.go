@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/lifecycle"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
@@ -23,11 +25,14 @@ type RetensiService interface {
 }
 
 type retensiService struct {
-	repo repositories.RetensiRepository
+	repo          repositories.RetensiRepository
+	kunjunganRepo repositories.KunjunganRepository
+	legalHoldRepo repositories.LegalHoldRepository
+	audit         audit.Recorder
 }
 
-func NewServiceRetensi(repo repositories.RetensiRepository) RetensiService {
-	return &retensiService{repo: repo}
+func NewServiceRetensi(repo repositories.RetensiRepository, kunjunganRepo repositories.KunjunganRepository, legalHoldRepo repositories.LegalHoldRepository, auditRecorder audit.Recorder) RetensiService {
+	return &retensiService{repo: repo, kunjunganRepo: kunjunganRepo, legalHoldRepo: legalHoldRepo, audit: auditRecorder}
 }
 
 type RetensiPagination struct {
@@ -166,11 +171,31 @@ func (svc *retensiService) GetByID(ctx context.Context, id int) (*models.Retensi
 }
 
 func (svc *retensiService) Create(ctx context.Context, retensi models.Retensi) (*models.Retensi, error) {
+	if err := checkLegalHold(ctx, svc.legalHoldRepo, retensi.ID, "Retensi"); err != nil {
+		return nil, err
+	}
+
+	record, err := loadLifecycle(ctx, svc.kunjunganRepo, retensi.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := parseStatus(record, lifecycle.StageRetensi, retensi.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := record.CanCreate(lifecycle.StageRetensi, status); err != nil {
+		return nil, err
+	}
+	retensi.Status = string(status)
+
 	newRetensi, err := svc.repo.CreateRetensi(ctx, &retensi)
 	if err != nil {
 		return nil, err
 	}
 
+	svc.audit.Record(ctx, audit.Create, "retensi", newRetensi.ID, nil, newRetensi)
 	return newRetensi, nil
 }
 
@@ -181,15 +206,35 @@ func (svc *retensiService) Update(ctx context.Context, retensi models.Retensi) (
 	}
 
 	if existing == nil {
-		return nil, errors.New("Alih Media not found")
+		return nil, errors.New("Retensi not found")
+	}
+
+	if err := checkLegalHold(ctx, svc.legalHoldRepo, retensi.ID, "Retensi"); err != nil {
+		return nil, err
+	}
+
+	record, err := loadLifecycle(ctx, svc.kunjunganRepo, retensi.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := parseStatus(record, lifecycle.StageRetensi, retensi.Status)
+	if err != nil {
+		return nil, err
 	}
 
+	if err := record.CanTransition(lifecycle.StageRetensi, status); err != nil {
+		return nil, err
+	}
+	retensi.Status = string(status)
+
 	newRetensi, err := svc.repo.UpdateRetensi(ctx, retensi)
 
 	if err != nil {
 		return nil, err
 	}
 
+	svc.audit.Record(ctx, audit.Update, "retensi", retensi.ID, existing, newRetensi)
 	return newRetensi, nil
 }
 
@@ -203,7 +248,16 @@ func (svc *retensiService) Delete(ctx context.Context, id int) error {
 		return errors.New("Alih Media not found")
 	}
 
-	return svc.repo.DeleteRetensi(ctx, id)
+	if err := checkLegalHold(ctx, svc.legalHoldRepo, id, "Retensi deletion"); err != nil {
+		return err
+	}
+
+	if err := svc.repo.DeleteRetensi(ctx, id); err != nil {
+		return err
+	}
+
+	svc.audit.Record(ctx, audit.Delete, "retensi", id, existing, nil)
+	return nil
 }
 
 func (svc *retensiService) Export(ctx context.Context) ([]byte, error) {
@@ -212,6 +266,20 @@ func (svc *retensiService) Export(ctx context.Context) ([]byte, error) {
 		return nil, err
 	}
 
+	held, err := svc.legalHoldRepo.GetHeldKunjunganIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Records under legal hold must not appear on a retensi list.
+	exportable := data[:0]
+	for _, row := range data {
+		if !held[row.ID] {
+			exportable = append(exportable, row)
+		}
+	}
+	data = exportable
+
 	if len(data) == 0 {
 		log.Println("[Export] Tidak ada data retensi")
 	}
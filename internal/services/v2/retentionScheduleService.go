@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/lifecycle"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/retention"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	ScheduleMonthLayout = "2006-01"
+
+	defaultScheduleMonths = 12
+	maxScheduleMonths     = 60
+)
+
+var ErrInvalidScheduleRange = errors.New("Invalid schedule range")
+
+type RetentionScheduleService interface {
+	Project(ctx context.Context, from, to string) (*RetentionSchedule, error)
+	Export(ctx context.Context, from, to string) ([]byte, error)
+}
+
+type retentionScheduleService struct {
+	kunjunganRepo repositories.KunjunganRepository
+	evaluator     *expiryEvaluator
+}
+
+func NewServiceRetentionSchedule(
+	kunjunganRepo repositories.KunjunganRepository,
+	kasusRepo repositories.KasusRepository,
+	policyRepo repositories.RetentionPolicyRepository,
+	pasienRepo repositories.PasienRepository,
+) RetentionScheduleService {
+	return &retentionScheduleService{
+		kunjunganRepo: kunjunganRepo,
+		evaluator:     newExpiryEvaluator(kasusRepo, policyRepo, pasienRepo),
+	}
+}
+
+type RetentionScheduleCounts struct {
+	Inactive   int `json:"inactive"`
+	Retensi    int `json:"retensi"`
+	Pemusnahan int `json:"pemusnahan"`
+}
+
+type RetentionScheduleRow struct {
+	IDKasus        int    `json:"id_kasus"`
+	JenisKasus     string `json:"jenis_kasus"`
+	JenisKunjungan string `json:"jenis_kunjungan"`
+	RetentionScheduleCounts
+}
+
+type RetentionScheduleMonth struct {
+	Month string `json:"month"`
+	RetentionScheduleCounts
+	Breakdown []*RetentionScheduleRow `json:"breakdown"`
+}
+
+// RetentionSchedule projects, per month, how many records will go inactive
+// and become due for retensi and pemusnahan. Records that have already
+// completed a stage are not counted for it again; Skipped counts records whose
+// schedule could not be computed.
+type RetentionSchedule struct {
+	From    string                    `json:"from"`
+	To      string                    `json:"to"`
+	Months  []*RetentionScheduleMonth `json:"months"`
+	Total   RetentionScheduleCounts   `json:"total"`
+	Skipped int                       `json:"skipped"`
+}
+
+func (svc *retentionScheduleService) Project(ctx context.Context, from, to string) (*RetentionSchedule, error) {
+	start, end, err := parseScheduleRange(from, to, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := svc.kunjunganRepo.GetUndestroyedKunjungan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type projected struct {
+		kasus    *models.Kasus
+		schedule retention.Schedule
+		err      error
+	}
+
+	cache := svc.evaluator.newCache()
+	results := make([]projected, len(list))
+	err = runConcurrently(ctx, svc.evaluator.workers, len(list), func(i int) {
+		kasus, schedule, err := cache.schedule(ctx, &list[i].Kunjungan)
+		results[i] = projected{kasus: kasus, schedule: schedule, err: err}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RetentionSchedule{
+		From: start.Format(ScheduleMonthLayout),
+		To:   end.AddDate(0, -1, 0).Format(ScheduleMonthLayout),
+	}
+
+	months := make(map[string]*RetentionScheduleMonth)
+	rows := make(map[string]*RetentionScheduleRow)
+	for m := start; m.Before(end); m = m.AddDate(0, 1, 0) {
+		month := &RetentionScheduleMonth{Month: m.Format(ScheduleMonthLayout)}
+		months[month.Month] = month
+		report.Months = append(report.Months, month)
+	}
+
+	// count adds one record to the month its stage falls due in, if that month
+	// is part of the range.
+	count := func(at time.Time, item *models.KunjunganSchedule, kasus *models.Kasus, field func(*RetentionScheduleCounts) *int) {
+		if at.IsZero() || at.Before(start) || !at.Before(end) {
+			return
+		}
+
+		month := months[at.In(start.Location()).Format(ScheduleMonthLayout)]
+		key := fmt.Sprintf("%s|%d|%s", month.Month, kasus.ID, item.Kunjungan.JenisKunjungan)
+		row, ok := rows[key]
+		if !ok {
+			row = &RetentionScheduleRow{
+				IDKasus:        kasus.ID,
+				JenisKasus:     kasus.JenisKasus,
+				JenisKunjungan: item.Kunjungan.JenisKunjungan,
+			}
+			rows[key] = row
+			month.Breakdown = append(month.Breakdown, row)
+		}
+
+		*field(&month.RetentionScheduleCounts)++
+		*field(&row.RetentionScheduleCounts)++
+		*field(&report.Total)++
+	}
+
+	for i, item := range list {
+		result := results[i]
+		if result.err != nil {
+			if !errors.Is(result.err, errUnknownJenisKunjungan) {
+				log.Printf("Error projecting schedule for kunjungan %d: %v", item.Kunjungan.ID, result.err)
+			}
+			report.Skipped++
+			continue
+		}
+
+		record, err := lifecycle.NewRecord(item.Lifecycle.AlihMedia, item.Lifecycle.Retensi, item.Lifecycle.Pemusnahan)
+		if err != nil {
+			log.Printf("Error projecting schedule for kunjungan %d: %v", item.Kunjungan.ID, err)
+			report.Skipped++
+			continue
+		}
+
+		// An alih media row is created when the kunjungan is inactivated.
+		if record.AlihMedia == lifecycle.None {
+			count(result.schedule.InactiveAt, item, result.kasus, func(c *RetentionScheduleCounts) *int { return &c.Inactive })
+		}
+		if record.Retensi != lifecycle.RetensiSudah {
+			count(result.schedule.RetensiAt, item, result.kasus, func(c *RetentionScheduleCounts) *int { return &c.Retensi })
+		}
+		if !result.schedule.Permanent {
+			count(result.schedule.PemusnahanAt, item, result.kasus, func(c *RetentionScheduleCounts) *int { return &c.Pemusnahan })
+		}
+	}
+
+	for _, month := range report.Months {
+		sort.Slice(month.Breakdown, func(a, b int) bool {
+			ra, rb := month.Breakdown[a], month.Breakdown[b]
+			if ra.JenisKasus != rb.JenisKasus {
+				return ra.JenisKasus < rb.JenisKasus
+			}
+			return ra.JenisKunjungan < rb.JenisKunjungan
+		})
+	}
+
+	return report, nil
+}
+
+func (svc *retentionScheduleService) Export(ctx context.Context, from, to string) ([]byte, error) {
+	report, err := svc.Project(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	headerStyle := pkg.GetHeaderStyle(f)
+
+	summarySheet := "Ringkasan"
+	f.SetSheetName("Sheet1", summarySheet)
+	f.SetCellValue(summarySheet, "A1", fmt.Sprintf("Jadwal Retensi Arsip %s s/d %s", report.From, report.To))
+
+	headers := []string{"Bulan", "Inaktif", "Jatuh Tempo Retensi", "Jatuh Tempo Pemusnahan"}
+	for i, header := range headers {
+		f.SetCellValue(summarySheet, pkg.GetCell(i+1, 3), header)
+		f.SetCellStyle(summarySheet, pkg.GetCell(i+1, 3), pkg.GetCell(i+1, 3), headerStyle)
+	}
+
+	rowNum := 4
+	for _, month := range report.Months {
+		f.SetCellValue(summarySheet, pkg.GetCell(1, rowNum), month.Month)
+		f.SetCellValue(summarySheet, pkg.GetCell(2, rowNum), month.Inactive)
+		f.SetCellValue(summarySheet, pkg.GetCell(3, rowNum), month.Retensi)
+		f.SetCellValue(summarySheet, pkg.GetCell(4, rowNum), month.Pemusnahan)
+		rowNum++
+	}
+
+	f.SetCellValue(summarySheet, pkg.GetCell(1, rowNum), "Total")
+	f.SetCellValue(summarySheet, pkg.GetCell(2, rowNum), report.Total.Inactive)
+	f.SetCellValue(summarySheet, pkg.GetCell(3, rowNum), report.Total.Retensi)
+	f.SetCellValue(summarySheet, pkg.GetCell(4, rowNum), report.Total.Pemusnahan)
+	pkg.SetRowStyle(f, summarySheet, rowNum, len(headers), "E2EFDA")
+	f.SetColWidth(summarySheet, "A", pkg.GetColumnName(len(headers)), 24)
+
+	detailSheet := "Rincian"
+	f.NewSheet(detailSheet)
+
+	headers = []string{"Bulan", "Jenis Kasus", "Jenis Kunjungan", "Inaktif", "Jatuh Tempo Retensi", "Jatuh Tempo Pemusnahan"}
+	for i, header := range headers {
+		f.SetCellValue(detailSheet, pkg.GetCell(i+1, 1), header)
+		f.SetCellStyle(detailSheet, pkg.GetCell(i+1, 1), pkg.GetCell(i+1, 1), headerStyle)
+	}
+
+	rowNum = 2
+	for _, month := range report.Months {
+		for _, row := range month.Breakdown {
+			f.SetCellValue(detailSheet, pkg.GetCell(1, rowNum), month.Month)
+			f.SetCellValue(detailSheet, pkg.GetCell(2, rowNum), row.JenisKasus)
+			f.SetCellValue(detailSheet, pkg.GetCell(3, rowNum), row.JenisKunjungan)
+			f.SetCellValue(detailSheet, pkg.GetCell(4, rowNum), row.Inactive)
+			f.SetCellValue(detailSheet, pkg.GetCell(5, rowNum), row.Retensi)
+			f.SetCellValue(detailSheet, pkg.GetCell(6, rowNum), row.Pemusnahan)
+			rowNum++
+		}
+	}
+	f.SetColWidth(detailSheet, "A", pkg.GetColumnName(len(headers)), 24)
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// parseScheduleRange turns the inclusive YYYY-MM months from and to into the
+// half-open range [start, end). Without from the range starts this month;
+// without to it covers defaultScheduleMonths months.
+func parseScheduleRange(from, to string, now time.Time) (time.Time, time.Time, error) {
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	if from != "" {
+		parsed, err := time.ParseInLocation(ScheduleMonthLayout, from, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: from must be formatted as YYYY-MM", ErrInvalidScheduleRange)
+		}
+		start = parsed
+	}
+
+	end := start.AddDate(0, defaultScheduleMonths, 0)
+	if to != "" {
+		parsed, err := time.ParseInLocation(ScheduleMonthLayout, to, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: to must be formatted as YYYY-MM", ErrInvalidScheduleRange)
+		}
+		end = parsed.AddDate(0, 1, 0)
+	}
+
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: to must not be before from", ErrInvalidScheduleRange)
+	}
+
+	if end.After(start.AddDate(0, maxScheduleMonths, 0)) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: range cannot exceed %d months", ErrInvalidScheduleRange, maxScheduleMonths)
+	}
+
+	return start, end, nil
+}
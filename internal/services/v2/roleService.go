@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/rbac"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+)
+
+// Permissions are read on every request, so they are cached for a short
+// while. Changes made through this service clear the cache immediately.
+const rolePermissionCacheTTL = 30 * time.Second
+
+var (
+	ErrRoleNotFound = errors.New("Role not found")
+	ErrInvalidRole  = errors.New("Invalid role")
+	ErrRoleInUse    = errors.New("Role is still assigned to users")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,49}$`)
+
+type RoleService interface {
+	GetPermissions() []rbac.Permission
+	GetAll(ctx context.Context) ([]*models.Role, error)
+	GetByName(ctx context.Context, name string) (*models.Role, error)
+	Create(ctx context.Context, role models.Role) (*models.Role, error)
+	Update(ctx context.Context, role models.Role) (*models.Role, error)
+	SetRequireTwoFactor(ctx context.Context, name string, required bool) (*models.Role, error)
+	Delete(ctx context.Context, name string) error
+	Exists(ctx context.Context, name string) (bool, error)
+	HasPermission(ctx context.Context, role, permission string) (bool, error)
+	RequiresTwoFactor(ctx context.Context, role string) (bool, error)
+}
+
+type roleService struct {
+	repo  repositories.RoleRepository
+	audit audit.Recorder
+
+	mu       sync.RWMutex
+	cache    map[string]map[string]bool
+	cachedAt time.Time
+}
+
+func NewServiceRole(repo repositories.RoleRepository, auditRecorder audit.Recorder) RoleService {
+	return &roleService{repo: repo, audit: auditRecorder}
+}
+
+func (svc *roleService) GetPermissions() []rbac.Permission {
+	return rbac.Permissions
+}
+
+func (svc *roleService) GetAll(ctx context.Context) ([]*models.Role, error) {
+	roles, err := svc.repo.GetAllRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, role := range roles {
+		withAdminPermissions(role)
+	}
+	return roles, nil
+}
+
+func (svc *roleService) GetByName(ctx context.Context, name string) (*models.Role, error) {
+	role, err := svc.repo.GetRoleByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, ErrRoleNotFound
+	}
+
+	return withAdminPermissions(role), nil
+}
+
+func (svc *roleService) Create(ctx context.Context, role models.Role) (*models.Role, error) {
+	role.Name = strings.TrimSpace(role.Name)
+	if !roleNamePattern.MatchString(role.Name) {
+		return nil, fmt.Errorf("%w: name must be lowercase letters, digits or underscores", ErrInvalidRole)
+	}
+
+	existing, err := svc.repo.GetRoleByName(ctx, role.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: %s already exists", ErrInvalidRole, role.Name)
+	}
+
+	if role.Permissions, err = normalizePermissions(role.Permissions); err != nil {
+		return nil, err
+	}
+
+	if err := svc.repo.CreateRole(ctx, role); err != nil {
+		return nil, err
+	}
+	svc.invalidate()
+
+	created, err := svc.GetByName(ctx, role.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.audit.Record(ctx, audit.Create, "role", created.Name, nil, created)
+	return created, nil
+}
+
+func (svc *roleService) Update(ctx context.Context, role models.Role) (*models.Role, error) {
+	existing, err := svc.GetByName(ctx, role.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing.IsSystem {
+		return nil, fmt.Errorf("%w: %s cannot be changed", ErrInvalidRole, role.Name)
+	}
+
+	if role.Permissions, err = normalizePermissions(role.Permissions); err != nil {
+		return nil, err
+	}
+
+	if err := svc.repo.UpdateRole(ctx, role); err != nil {
+		return nil, err
+	}
+	svc.invalidate()
+
+	updated, err := svc.GetByName(ctx, role.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.audit.Record(ctx, audit.Update, "role", updated.Name, existing, updated)
+	return updated, nil
+}
+
+// SetRequireTwoFactor is the one change allowed on system roles too.
+func (svc *roleService) SetRequireTwoFactor(ctx context.Context, name string, required bool) (*models.Role, error) {
+	existing, err := svc.GetByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := svc.repo.SetRequireTwoFactor(ctx, name, required); err != nil {
+		return nil, err
+	}
+
+	updated, err := svc.GetByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.audit.Record(ctx, audit.Update, "role", name, existing, updated)
+	return updated, nil
+}
+
+func (svc *roleService) Delete(ctx context.Context, name string) error {
+	existing, err := svc.GetByName(ctx, name)
+	if err != nil {
+		return err
+	}
+	if existing.IsSystem || name == rbac.DefaultRole {
+		return fmt.Errorf("%w: %s cannot be deleted", ErrInvalidRole, name)
+	}
+	if existing.Users > 0 {
+		return ErrRoleInUse
+	}
+
+	if err := svc.repo.DeleteRole(ctx, name); err != nil {
+		return err
+	}
+	svc.invalidate()
+
+	svc.audit.Record(ctx, audit.Delete, "role", name, existing, nil)
+	return nil
+}
+
+func (svc *roleService) Exists(ctx context.Context, name string) (bool, error) {
+	permissions, err := svc.permissions(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := permissions[name]
+	return ok, nil
+}
+
+func (svc *roleService) HasPermission(ctx context.Context, role, permission string) (bool, error) {
+	if role == rbac.AdminRole {
+		return true, nil
+	}
+
+	permissions, err := svc.permissions(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return permissions[role][permission], nil
+}
+
+// RequiresTwoFactor is only asked at login, so it reads the role directly
+// instead of going through the permission cache.
+func (svc *roleService) RequiresTwoFactor(ctx context.Context, role string) (bool, error) {
+	existing, err := svc.repo.GetRoleByName(ctx, role)
+	if err != nil || existing == nil {
+		return false, err
+	}
+	return existing.RequireTwoFactor, nil
+}
+
+func (svc *roleService) permissions(ctx context.Context) (map[string]map[string]bool, error) {
+	svc.mu.RLock()
+	cache, cachedAt := svc.cache, svc.cachedAt
+	svc.mu.RUnlock()
+
+	if cache != nil && time.Since(cachedAt) < rolePermissionCacheTTL {
+		return cache, nil
+	}
+
+	rolePermissions, err := svc.repo.GetRolePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cache = make(map[string]map[string]bool, len(rolePermissions))
+	for role, permissions := range rolePermissions {
+		cache[role] = make(map[string]bool, len(permissions))
+		for _, permission := range permissions {
+			cache[role][permission] = true
+		}
+	}
+
+	svc.mu.Lock()
+	svc.cache, svc.cachedAt = cache, time.Now()
+	svc.mu.Unlock()
+
+	return cache, nil
+}
+
+func (svc *roleService) invalidate() {
+	svc.mu.Lock()
+	svc.cache = nil
+	svc.mu.Unlock()
+}
+
+func normalizePermissions(permissions []string) ([]string, error) {
+	seen := make(map[string]bool, len(permissions))
+	out := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		permission = strings.TrimSpace(permission)
+		if !rbac.IsPermission(permission) {
+			return nil, fmt.Errorf("%w: unknown permission %q", ErrInvalidRole, permission)
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			out = append(out, permission)
+		}
+	}
+
+	sort.Strings(out)
+	return out, nil
+}
+
+// The admin role has no rows in role_permissions; list everything for it.
+func withAdminPermissions(role *models.Role) *models.Role {
+	if role.Name != rbac.AdminRole {
+		return role
+	}
+
+	role.Permissions = make([]string, 0, len(rbac.Permissions))
+	for _, permission := range rbac.Permissions {
+		role.Permissions = append(role.Permissions, permission.Name)
+	}
+	return role
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+)
+
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+var ErrInvalidRefreshToken = errors.New("Invalid refresh token")
+
+// AuthTokens is returned by login and refresh. The refresh token is opaque:
+// "<session id>.<secret>".
+type AuthTokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type SessionService interface {
+	Start(ctx context.Context, user *models.User) (*AuthTokens, error)
+	Refresh(ctx context.Context, refreshToken string) (*AuthTokens, error)
+	IsActive(ctx context.Context, sessionID string, userID int) (bool, error)
+	ActiveRole(ctx context.Context, sessionID string, userID int) (string, error)
+	Revoke(ctx context.Context, sessionID string) error
+	RevokeAll(ctx context.Context, userID int) error
+}
+
+type sessionService struct {
+	repo       repositories.SessionRepository
+	userRepo   repositories.UserRepository
+	audit      audit.Recorder
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func NewServiceSession(
+	repo repositories.SessionRepository,
+	userRepo repositories.UserRepository,
+	auditRecorder audit.Recorder,
+	accessTTL, refreshTTL time.Duration,
+) SessionService {
+	if accessTTL <= 0 {
+		accessTTL = DefaultAccessTokenTTL
+	}
+	if refreshTTL <= 0 {
+		refreshTTL = DefaultRefreshTokenTTL
+	}
+
+	return &sessionService{
+		repo:       repo,
+		userRepo:   userRepo,
+		audit:      auditRecorder,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+	}
+}
+
+func (svc *sessionService) Start(ctx context.Context, user *models.User) (*AuthTokens, error) {
+	id, err := pkg.RandomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := pkg.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := models.UserSession{
+		ID:        id,
+		IDUser:    user.ID,
+		TokenHash: pkg.HashToken(secret),
+		IP:        pkg.GetClientIPFromCtx(ctx),
+		CreatedAt: now,
+		ExpiresAt: now.Add(svc.refreshTTL),
+	}
+
+	if err := svc.repo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	svc.audit.Record(ctx, audit.Create, "user_session", session.ID, nil, session)
+	return svc.tokens(user, session.ID, secret)
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token. A
+// refresh token that has already been used revokes the whole session, since
+// it means the token was copied.
+func (svc *sessionService) Refresh(ctx context.Context, refreshToken string) (*AuthTokens, error) {
+	id, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || id == "" || secret == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session, err := svc.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.RevokedAt != nil || !time.Now().Before(session.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	hash := pkg.HashToken(secret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(session.TokenHash)) != 1 {
+		log.Printf("Refresh token reuse on session %s of user %d, revoking", session.ID, session.IDUser)
+		if err := svc.revoke(ctx, session.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := svc.userRepo.GetByID(ctx, session.IDUser)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.Status != "aktif" {
+		if err := svc.revoke(ctx, session.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	newSecret, err := pkg.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	rotated, err := svc.repo.Rotate(ctx, session.ID, hash, pkg.HashToken(newSecret), time.Now().Add(svc.refreshTTL))
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// Another request used the same token first.
+		log.Printf("Concurrent refresh on session %s of user %d, revoking", session.ID, session.IDUser)
+		if err := svc.revoke(ctx, session.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return svc.tokens(user, session.ID, newSecret)
+}
+
+func (svc *sessionService) IsActive(ctx context.Context, sessionID string, userID int) (bool, error) {
+	if sessionID == "" {
+		return false, nil
+	}
+	return svc.repo.IsActive(ctx, sessionID, userID, time.Now())
+}
+
+// ActiveRole returns the user's current role, or "" if the session is no
+// longer active.
+func (svc *sessionService) ActiveRole(ctx context.Context, sessionID string, userID int) (string, error) {
+	if sessionID == "" {
+		return "", nil
+	}
+	return svc.repo.ActiveRole(ctx, sessionID, userID, time.Now())
+}
+
+func (svc *sessionService) Revoke(ctx context.Context, sessionID string) error {
+	return svc.revoke(ctx, sessionID)
+}
+
+// RevokeAll signs the user out everywhere.
+func (svc *sessionService) RevokeAll(ctx context.Context, userID int) error {
+	revoked, err := svc.repo.RevokeByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if revoked > 0 {
+		svc.audit.Record(ctx, audit.Delete, "user_session", userID, map[string]int64{"Sessions": revoked}, nil)
+	}
+	return nil
+}
+
+func (svc *sessionService) revoke(ctx context.Context, sessionID string) error {
+	if err := svc.repo.Revoke(ctx, sessionID); err != nil {
+		return err
+	}
+
+	svc.audit.Record(ctx, audit.Delete, "user_session", sessionID, map[string]string{"ID": sessionID}, nil)
+	return nil
+}
+
+func (svc *sessionService) tokens(user *models.User, sessionID, secret string) (*AuthTokens, error) {
+	accessToken, err := pkg.CreateToken(user.ID, user.Email, user.Status, user.Role, sessionID, svc.accessTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: sessionID + "." + secret,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(svc.accessTTL.Seconds()),
+	}, nil
+}
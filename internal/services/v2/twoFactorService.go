@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
+	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
+)
+
+const (
+	DefaultTOTPIssuer = "Sistem Alih Media Retensi"
+
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrInvalidTwoFactorCode    = errors.New("Invalid two-factor code")
+	ErrTwoFactorNotEnabled     = errors.New("Two-factor authentication is not enabled")
+	ErrTwoFactorNotEnrolled    = errors.New("Start two-factor enrollment first")
+	ErrTwoFactorAlreadyEnabled = errors.New("Two-factor authentication is already enabled")
+	ErrTwoFactorRequired       = errors.New("Two-factor authentication is required for this role")
+)
+
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// TwoFactorEnrollment is shown once so the user can add the secret to an
+// authenticator app, usually by scanning URI as a QR code.
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TwoFactorService interface {
+	Status(ctx context.Context, user *models.User) (*TwoFactorStatus, error)
+	Required(ctx context.Context, user *models.User) (bool, error)
+	Enroll(ctx context.Context, user *models.User) (*TwoFactorEnrollment, error)
+	Enable(ctx context.Context, userID int, code string) ([]string, error)
+	Verify(ctx context.Context, userID int, code string) error
+	Disable(ctx context.Context, user *models.User, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID int, code string) ([]string, error)
+	Reset(ctx context.Context, userID int) error
+}
+
+type twoFactorService struct {
+	repo     repositories.TwoFactorRepository
+	userRepo repositories.UserRepository
+	roles    RoleService
+	sessions SessionService
+	audit    audit.Recorder
+	issuer   string
+}
+
+func NewServiceTwoFactor(
+	repo repositories.TwoFactorRepository,
+	userRepo repositories.UserRepository,
+	roles RoleService,
+	sessions SessionService,
+	auditRecorder audit.Recorder,
+	issuer string,
+) TwoFactorService {
+	if issuer == "" {
+		issuer = DefaultTOTPIssuer
+	}
+
+	return &twoFactorService{
+		repo:     repo,
+		userRepo: userRepo,
+		roles:    roles,
+		sessions: sessions,
+		audit:    auditRecorder,
+		issuer:   issuer,
+	}
+}
+
+func (svc *twoFactorService) Status(ctx context.Context, user *models.User) (*TwoFactorStatus, error) {
+	required, err := svc.Required(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactor, err := svc.repo.Get(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &TwoFactorStatus{Required: required}
+	if twoFactor != nil && twoFactor.EnabledAt != nil {
+		status.Enabled = true
+		if status.RecoveryCodesLeft, err = svc.repo.CountRecoveryCodes(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return status, nil
+}
+
+func (svc *twoFactorService) Required(ctx context.Context, user *models.User) (bool, error) {
+	return svc.roles.RequiresTwoFactor(ctx, user.Role)
+}
+
+// Enroll starts over with a new secret until it is confirmed by Enable.
+func (svc *twoFactorService) Enroll(ctx context.Context, user *models.User) (*TwoFactorEnrollment, error) {
+	twoFactor, err := svc.repo.Get(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor != nil && twoFactor.EnabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := pkg.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := svc.repo.SavePending(ctx, user.ID, secret); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorEnrollment{
+		Secret: secret,
+		URI:    pkg.TOTPURI(svc.issuer, user.Email, secret),
+	}, nil
+}
+
+// Enable confirms the pending secret with a code from the app and returns the
+// recovery codes, which are not shown again.
+func (svc *twoFactorService) Enable(ctx context.Context, userID int, code string) ([]string, error) {
+	twoFactor, err := svc.repo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor == nil {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if twoFactor.EnabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	step, ok := pkg.ValidateTOTP(twoFactor.Secret, normalizeTwoFactorCode(code), time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := svc.repo.Enable(ctx, userID, step, hashes); err != nil {
+		return nil, err
+	}
+
+	svc.audit.Record(ctx, audit.Update, "user_two_factor", userID, map[string]bool{"Enabled": false}, map[string]bool{"Enabled": true})
+	return codes, nil
+}
+
+// Verify accepts a current TOTP code or an unused recovery code.
+func (svc *twoFactorService) Verify(ctx context.Context, userID int, code string) error {
+	twoFactor, err := svc.repo.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if twoFactor == nil || twoFactor.EnabledAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+
+	code = normalizeTwoFactorCode(code)
+	if step, ok := pkg.ValidateTOTP(twoFactor.Secret, code, time.Now()); ok {
+		used, err := svc.repo.UseStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		if used {
+			return nil
+		}
+		return ErrInvalidTwoFactorCode
+	}
+
+	used, err := svc.repo.UseRecoveryCode(ctx, userID, pkg.HashToken(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+
+	svc.audit.Record(ctx, audit.Update, "user_two_factor", userID, nil, map[string]string{"RecoveryCode": "used"})
+	return nil
+}
+
+// Disable turns the second factor off for a user whose role does not need it.
+func (svc *twoFactorService) Disable(ctx context.Context, user *models.User, code string) error {
+	required, err := svc.Required(ctx, user)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrTwoFactorRequired
+	}
+
+	if err := svc.Verify(ctx, user.ID, code); err != nil {
+		return err
+	}
+
+	if err := svc.repo.Delete(ctx, user.ID); err != nil {
+		return err
+	}
+
+	svc.audit.Record(ctx, audit.Update, "user_two_factor", user.ID, map[string]bool{"Enabled": true}, map[string]bool{"Enabled": false})
+	return nil
+}
+
+func (svc *twoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID int, code string) ([]string, error) {
+	if err := svc.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := svc.repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	svc.audit.Record(ctx, audit.Update, "user_two_factor", userID, nil, map[string]string{"RecoveryCode": "regenerated"})
+	return codes, nil
+}
+
+// Reset is the admin way out for a lost device: the second factor is removed
+// and the user's sessions end. If the role requires it, the user enrolls again
+// at the next login.
+func (svc *twoFactorService) Reset(ctx context.Context, userID int) error {
+	user, err := svc.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return errors.New("User not found")
+	}
+
+	twoFactor, err := svc.repo.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if twoFactor == nil {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if err := svc.repo.Delete(ctx, userID); err != nil {
+		return err
+	}
+
+	svc.audit.Record(ctx, audit.Delete, "user_two_factor", userID, map[string]bool{"Enabled": twoFactor.EnabledAt != nil}, nil)
+	return svc.sessions.RevokeAll(ctx, userID)
+}
+
+// Recovery codes look like "1a2b3-c4d5e"; the dash and case are ignored when
+// one is entered.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := pkg.RandomHex(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, pkg.HashToken(raw))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeTwoFactorCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -3,7 +3,10 @@ package services
 import (
 	"context"
 	"errors"
+	"log"
+	"time"
 
+	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/audit"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/models/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/internal/repositories/v2"
 	"github.com/cukiprit/api-sistem-alih-media-retensi/pkg"
@@ -19,8 +22,9 @@ type UserService interface {
 	DeleteUser(ctx context.Context, id int) (*models.User, error)
 	// Update(ctx context.Context, name, email, password, role, status string) (*models.User, error)
 	// UpdateStatus(ctx context.Context, user models.User) (*models.User, error)
-	Login(ctx context.Context, email, password string) (string, error)
-	Register(ctx context.Context, user models.User) (*models.User, error)
+	Login(ctx context.Context, email, password string) (*LoginResult, error)
+	LoginTwoFactor(ctx context.Context, challengeToken, code string) (*LoginResult, error)
+	EnrollTwoFactor(ctx context.Context, challengeToken string) (*TwoFactorEnrollment, error)
 	// Activation(ctx context.Context, email string) (*models.User, error)
 	GetProfile(ctx context.Context, id int) (*models.User, error)
 	UpdateProfile(ctx context.Context, user models.User) (*models.User, error)
@@ -28,11 +32,37 @@ type UserService interface {
 }
 
 type userService struct {
-	repo repositories.UserRepository
+	repo       repositories.UserRepository
+	challenges repositories.LoginChallengeRepository
+	sessions   SessionService
+	roles      RoleService
+	throttle   LoginThrottleService
+	twoFactor  TwoFactorService
+	audit      audit.Recorder
 }
 
-func NewServiceUser(repo repositories.UserRepository) UserService {
-	return &userService{repo: repo}
+func NewServiceUser(repo repositories.UserRepository, challenges repositories.LoginChallengeRepository, sessions SessionService, roles RoleService, throttle LoginThrottleService, twoFactor TwoFactorService, auditRecorder audit.Recorder) UserService {
+	return &userService{repo: repo, challenges: challenges, sessions: sessions, roles: roles, throttle: throttle, twoFactor: twoFactor, audit: auditRecorder}
+}
+
+// The second login step has to follow the password within this time.
+const twoFactorChallengeTTL = 5 * time.Minute
+
+var ErrInvalidLoginChallenge = errors.New("Invalid or expired login challenge")
+
+// LoginResult holds either the tokens of a finished login or, when a second
+// factor is still needed, the challenge for POST /login/2fa. RecoveryCodes is
+// only set when the login also completed 2FA enrollment.
+type LoginResult struct {
+	Tokens        *AuthTokens
+	Challenge     *TwoFactorChallenge
+	RecoveryCodes []string
+}
+
+type TwoFactorChallenge struct {
+	ChallengeToken     string `json:"challenge_token"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+	ExpiresIn          int    `json:"expires_in"`
 }
 
 type UserPagination struct {
@@ -77,62 +107,168 @@ func (svc *userService) GetAll(ctx context.Context, page, perPage int) (*UserPag
 	}, nil
 }
 
-func (svc *userService) Login(ctx context.Context, email, password string) (string, error) {
+func (svc *userService) Login(ctx context.Context, email, password string) (*LoginResult, error) {
+	ip := pkg.GetClientIPFromCtx(ctx)
+	if err := svc.throttle.Check(ctx, email, ip); err != nil {
+		return nil, err
+	}
+
 	user, err := svc.repo.GetByUsername(ctx, email)
-	if err != nil || user == nil {
-		return "", errors.New("Invalid credentials")
+	if err != nil {
+		return nil, errors.New("Invalid credentials")
+	}
+
+	if user == nil || !pkg.CheckPassword(user.Password, password) {
+		if err := svc.throttle.Failed(ctx, email, ip); err != nil {
+			log.Printf("Failed to record failed login: %v", err)
+		}
+		return nil, errors.New("Invalid credentials")
 	}
 
-	if !pkg.CheckPassword(user.Password, password) {
-		return "", errors.New("Invalid credentials")
+	if user.Status != "aktif" {
+		switch {
+		case user.EmailVerifiedAt == nil:
+			return nil, errors.New("Email is not verified")
+		case user.ApprovedAt == nil:
+			return nil, errors.New("Registration is waiting for approval")
+		}
+		return nil, errors.New("User is not active")
 	}
 
-	token, err := pkg.CreateToken(user.ID, user.Email, user.Status, user.Role)
+	status, err := svc.twoFactor.Status(ctx, user)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return token, nil
+	// The account counter is only cleared once the second factor is in too,
+	// otherwise a known password would allow unlimited code guesses.
+	if status.Enabled || status.Required {
+		cid, err := pkg.RandomHex(16)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		if err := svc.challenges.Create(ctx, models.LoginChallenge{
+			ID:        cid,
+			IDUser:    user.ID,
+			CreatedAt: now,
+			ExpiresAt: now.Add(twoFactorChallengeTTL),
+		}); err != nil {
+			return nil, err
+		}
+
+		token, err := pkg.CreateChallengeToken(user.ID, cid, twoFactorChallengeTTL)
+		if err != nil {
+			return nil, err
+		}
+
+		return &LoginResult{Challenge: &TwoFactorChallenge{
+			ChallengeToken:     token,
+			EnrollmentRequired: !status.Enabled,
+			ExpiresIn:          int(twoFactorChallengeTTL.Seconds()),
+		}}, nil
+	}
+
+	return svc.finishLogin(ctx, user, nil)
 }
 
-func (svc *userService) Create(ctx context.Context, user models.User) (*models.User, error) {
-	existing, err := svc.repo.GetByUsername(ctx, user.Email)
+// LoginTwoFactor completes a login with a TOTP or recovery code. For a user
+// who still has to enroll, the code confirms the secret from EnrollTwoFactor.
+// A wrong code leaves the challenge open; a correct one consumes it, so a
+// replayed challenge token cannot start a second session.
+func (svc *userService) LoginTwoFactor(ctx context.Context, challengeToken, code string) (*LoginResult, error) {
+	user, cid, err := svc.challengeUser(ctx, challengeToken)
 	if err != nil {
 		return nil, err
 	}
 
-	if existing != nil {
-		return nil, errors.New("Email already used")
+	ip := pkg.GetClientIPFromCtx(ctx)
+	if err := svc.throttle.Check(ctx, user.Email, ip); err != nil {
+		return nil, err
 	}
 
-	hashed, err := pkg.HashPassword(user.Password)
+	status, err := svc.twoFactor.Status(ctx, user)
 	if err != nil {
-		return nil, errors.New("Failed to hash password")
+		return nil, err
 	}
-	user.Password = hashed
 
-	newUser, err := svc.repo.Create(ctx, user)
+	var recoveryCodes []string
+	if status.Enabled {
+		err = svc.twoFactor.Verify(ctx, user.ID, code)
+	} else {
+		recoveryCodes, err = svc.twoFactor.Enable(ctx, user.ID, code)
+	}
 	if err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			if err := svc.throttle.Failed(ctx, user.Email, ip); err != nil {
+				log.Printf("Failed to record failed login: %v", err)
+			}
+		}
 		return nil, err
 	}
 
-	return newUser, nil
+	consumed, err := svc.challenges.Consume(ctx, cid, user.ID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, ErrInvalidLoginChallenge
+	}
+
+	return svc.finishLogin(ctx, user, recoveryCodes)
 }
 
-func (svc *userService) GetDetail(ctx context.Context, email string) (*models.User, error) {
-	user, err := svc.repo.GetByUsername(ctx, email)
+func (svc *userService) EnrollTwoFactor(ctx context.Context, challengeToken string) (*TwoFactorEnrollment, error) {
+	user, _, err := svc.challengeUser(ctx, challengeToken)
 	if err != nil {
 		return nil, err
 	}
 
-	if user == nil {
-		return nil, errors.New("Pasien not found")
+	return svc.twoFactor.Enroll(ctx, user)
+}
+
+// challengeUser resolves a challenge token to its user and challenge id. The
+// stored challenge has to be unused and unexpired.
+func (svc *userService) challengeUser(ctx context.Context, challengeToken string) (*models.User, string, error) {
+	id, cid, err := pkg.VerifyChallengeToken(challengeToken)
+	if err != nil {
+		return nil, "", ErrInvalidLoginChallenge
 	}
 
-	return user, nil
+	open, err := svc.challenges.IsOpen(ctx, cid, id, time.Now())
+	if err != nil {
+		return nil, "", err
+	}
+	if !open {
+		return nil, "", ErrInvalidLoginChallenge
+	}
+
+	user, err := svc.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if user == nil || user.Status != "aktif" {
+		return nil, "", ErrInvalidLoginChallenge
+	}
+
+	return user, cid, nil
+}
+
+func (svc *userService) finishLogin(ctx context.Context, user *models.User, recoveryCodes []string) (*LoginResult, error) {
+	if err := svc.throttle.Succeeded(ctx, user.Email); err != nil {
+		log.Printf("Failed to reset login attempts: %v", err)
+	}
+
+	tokens, err := svc.sessions.Start(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResult{Tokens: tokens, RecoveryCodes: recoveryCodes}, nil
 }
 
-func (svc *userService) Register(ctx context.Context, user models.User) (*models.User, error) {
+func (svc *userService) Create(ctx context.Context, user models.User) (*models.User, error) {
 	existing, err := svc.repo.GetByUsername(ctx, user.Email)
 	if err != nil {
 		return nil, err
@@ -148,14 +284,35 @@ func (svc *userService) Register(ctx context.Context, user models.User) (*models
 	}
 	user.Password = hashed
 
+	// An account made by an admin needs no email check or approval; it only
+	// has to be activated.
+	now := time.Now()
+	user.SelfRegistered = false
+	user.EmailVerifiedAt = &now
+	user.ApprovedAt = &now
+
 	newUser, err := svc.repo.Create(ctx, user)
 	if err != nil {
 		return nil, err
 	}
 
+	svc.audit.Record(ctx, audit.Create, "user", newUser.ID, nil, newUser)
 	return newUser, nil
 }
 
+func (svc *userService) GetDetail(ctx context.Context, email string) (*models.User, error) {
+	user, err := svc.repo.GetByUsername(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, errors.New("Pasien not found")
+	}
+
+	return user, nil
+}
+
 func (svc *userService) Update(ctx context.Context, user models.User) (*models.User, error) {
 	existing, err := svc.repo.GetByID(ctx, user.ID)
 	if err != nil {
@@ -165,11 +322,30 @@ func (svc *userService) Update(ctx context.Context, user models.User) (*models.U
 		return nil, errors.New("User not found")
 	}
 
+	if user.Role == "" {
+		user.Role = existing.Role
+	}
+	roleExists, err := svc.roles.Exists(ctx, user.Role)
+	if err != nil {
+		return nil, err
+	}
+	if !roleExists {
+		return nil, ErrRoleNotFound
+	}
+
 	updatedUser, err := svc.repo.UpdateData(ctx, user)
 	if err != nil {
 		return nil, err
 	}
 
+	svc.audit.Record(ctx, audit.Update, "user", user.ID, existing, updatedUser)
+
+	// Access tokens carry the role, so a role change also signs the user out.
+	if updatedUser.Status != "aktif" || updatedUser.Role != existing.Role {
+		if err := svc.sessions.RevokeAll(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
 	return updatedUser, nil
 }
 
@@ -190,6 +366,13 @@ func (svc *userService) UpdateStatus(ctx context.Context, id int, status string)
 		return nil, err
 	}
 
+	svc.audit.Record(ctx, audit.Update, "user", id, existing, updatedUser)
+
+	if status != "aktif" {
+		if err := svc.sessions.RevokeAll(ctx, id); err != nil {
+			return nil, err
+		}
+	}
 	return updatedUser, nil
 }
 
@@ -204,6 +387,9 @@ func (svc *userService) Activation(ctx context.Context, id int) (*models.User, e
 	if existing.Status == "aktif" {
 		return nil, errors.New("User is already active")
 	}
+	if existing.ApprovedAt == nil {
+		return nil, errors.New("User is awaiting approval, approve the registration instead")
+	}
 
 	return svc.UpdateStatus(ctx, id, "aktif")
 }
@@ -321,6 +507,8 @@ func (svc *userService) UpdateProfile(ctx context.Context, user models.User) (*m
 	if err != nil {
 		return nil, err
 	}
+
+	svc.audit.Record(ctx, audit.Update, "user", user.ID, existing, updatedUser)
 	return updatedUser, nil
 }
 
@@ -342,7 +530,14 @@ func (svc *userService) ChangePassword(ctx context.Context, id int, oldPassword,
 		return errors.New("Failed to hash password")
 	}
 
-	return svc.repo.UpdatePassword(ctx, id, hashed)
+	if err := svc.repo.UpdatePassword(ctx, id, hashed); err != nil {
+		return err
+	}
+
+	svc.audit.Record(ctx, audit.Update, "user", id, map[string]string{"Password": user.Password}, map[string]string{"Password": hashed})
+
+	// Every session, including the caller's, has to log in again.
+	return svc.sessions.RevokeAll(ctx, id)
 }
 
 // func (svc *userService) UpdateStatus(ctx context.Context, user models.User) (*models.User, error) {
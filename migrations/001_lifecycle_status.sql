@@ -0,0 +1,13 @@
+-- Normalise lifecycle statuses to the spellings in internal/lifecycle.
+
+UPDATE alih_media SET Status = 'Belum dialih media' WHERE Status IN ('belum di alih media', 'belum dialih media');
+UPDATE alih_media SET Status = 'Sudah dialih media' WHERE Status IN ('sudah di alih media', 'sudah dialih media');
+ALTER TABLE alih_media ALTER COLUMN Status SET DEFAULT 'Belum dialih media';
+
+UPDATE retensi SET Status = 'Belum diretensi' WHERE Status IN ('belum di retensi', 'belum diretensi');
+UPDATE retensi SET Status = 'Sudah diretensi' WHERE Status IN ('sudah di retensi', 'sudah diretensi');
+ALTER TABLE retensi ALTER COLUMN Status SET DEFAULT 'Belum diretensi';
+
+UPDATE pemusnahan SET Status = 'Belum dimusnahkan' WHERE Status IN ('belum di musnahkan', 'belum dimusnahkan');
+UPDATE pemusnahan SET Status = 'Sudah dimusnahkan' WHERE Status IN ('sudah di musnahkan', 'sudah dimusnahkan');
+ALTER TABLE pemusnahan ALTER COLUMN Status SET DEFAULT 'Belum dimusnahkan';
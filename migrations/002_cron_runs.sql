@@ -0,0 +1,28 @@
+CREATE TABLE `cron_runs` (
+  `Id` int(11) NOT NULL AUTO_INCREMENT,
+  `Job` varchar(50) NOT NULL,
+  `TriggeredBy` varchar(20) NOT NULL,
+  `Status` varchar(20) NOT NULL DEFAULT 'running',
+  `StartedAt` datetime NOT NULL DEFAULT current_timestamp(),
+  `FinishedAt` datetime DEFAULT NULL,
+  `Processed` int(11) NOT NULL DEFAULT 0,
+  `Skipped` int(11) NOT NULL DEFAULT 0,
+  `Failed` int(11) NOT NULL DEFAULT 0,
+  `Message` text DEFAULT NULL,
+  PRIMARY KEY (`Id`),
+  KEY `cron_runs_StartedAt_IDX` (`StartedAt`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+CREATE TABLE `cron_run_items` (
+  `Id` int(11) NOT NULL AUTO_INCREMENT,
+  `IdRun` int(11) NOT NULL,
+  `IdKunjungan` int(11) NOT NULL,
+  `Action` varchar(50) NOT NULL,
+  `Outcome` varchar(20) NOT NULL,
+  `Message` text DEFAULT NULL,
+  `CreatedAt` datetime NOT NULL DEFAULT current_timestamp(),
+  PRIMARY KEY (`Id`),
+  KEY `cron_run_items_cron_runs_FK` (`IdRun`),
+  KEY `cron_run_items_IdKunjungan_IDX` (`IdKunjungan`),
+  CONSTRAINT `cron_run_items_cron_runs_FK` FOREIGN KEY (`IdRun`) REFERENCES `cron_runs` (`Id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
@@ -0,0 +1,14 @@
+CREATE TABLE `cron_jobs` (
+  `Name` varchar(50) NOT NULL,
+  `Expression` varchar(100) NOT NULL,
+  `Timezone` varchar(64) NOT NULL DEFAULT 'UTC',
+  `Enabled` tinyint(1) NOT NULL DEFAULT 1,
+  `UpdatedAt` datetime NOT NULL DEFAULT current_timestamp() ON UPDATE current_timestamp(),
+  PRIMARY KEY (`Name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+INSERT INTO `cron_jobs` (`Name`, `Expression`, `Timezone`, `Enabled`) VALUES
+('inactivation', '0 8 * * *', 'UTC', 1),
+('lifecycle', '15 8 * * *', 'UTC', 1),
+('report', '0 1 1 * *', 'Asia/Jakarta', 1),
+('upload_cleanup', '0 3 * * 0', 'Asia/Jakarta', 1);
@@ -0,0 +1,25 @@
+-- alih_media only had a plain KEY on Id, so a retried or concurrent
+-- inactivation could insert a second row for the same kunjungan. Collapse
+-- existing duplicates (keeping the most advanced status) and make Id the
+-- primary key so the cron upsert can rely on it.
+
+CREATE TEMPORARY TABLE `alih_media_dedup` AS
+SELECT
+  `Id`,
+  MAX(`TglLaporan`) AS `TglLaporan`,
+  MAX(`Status`) AS `Status`,
+  MIN(`CreatedAt`) AS `CreatedAt`,
+  MAX(`UpdatedAt`) AS `UpdatedAt`
+FROM `alih_media`
+GROUP BY `Id`
+HAVING COUNT(*) > 1;
+
+DELETE `alih_media` FROM `alih_media`
+JOIN `alih_media_dedup` ON `alih_media_dedup`.`Id` = `alih_media`.`Id`;
+
+INSERT INTO `alih_media` (`Id`, `TglLaporan`, `Status`, `CreatedAt`, `UpdatedAt`)
+SELECT `Id`, `TglLaporan`, `Status`, `CreatedAt`, `UpdatedAt` FROM `alih_media_dedup`;
+
+DROP TEMPORARY TABLE `alih_media_dedup`;
+
+ALTER TABLE `alih_media` ADD PRIMARY KEY (`Id`);
@@ -0,0 +1,9 @@
+-- New kunjungan were created as 'tidak aktif' by the column default, so the
+-- inactivation job (which only looks at 'aktif' rows) never saw them while the
+-- alih media check did. Make new rows active.
+--
+-- Existing rows are left as they are: a 'tidak aktif' row without alih_media
+-- may have been deactivated by hand. Any backfill belongs in a separate,
+-- reviewed data fix.
+
+ALTER TABLE `kunjungan` MODIFY `Status` varchar(100) NOT NULL DEFAULT 'aktif';
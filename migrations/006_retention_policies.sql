@@ -0,0 +1,13 @@
+-- Optional per-kasus refinements of the retention periods. A kasus without a
+-- row keeps the old behaviour: MasaAktif/MasaInaktif in years, no exceptions.
+
+CREATE TABLE `kasus_retention_policy` (
+  `IdKasus` int(11) NOT NULL,
+  `PeriodUnit` enum('year','month') NOT NULL DEFAULT 'year',
+  `Permanent` tinyint(1) NOT NULL DEFAULT 0,
+  `AdultAge` int(11) NOT NULL DEFAULT 18,
+  `MinorRetainYears` int(11) NOT NULL DEFAULT 0,
+  `UpdatedAt` datetime NOT NULL DEFAULT current_timestamp() ON UPDATE current_timestamp(),
+  PRIMARY KEY (`IdKasus`),
+  CONSTRAINT `kasus_retention_policy_kasus_FK` FOREIGN KEY (`IdKasus`) REFERENCES `kasus` (`Id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
@@ -0,0 +1,23 @@
+-- A legal hold freezes a pasien or a single kunjungan. Deleting a held
+-- pasien or kunjungan is refused (ON DELETE RESTRICT) so the hold cannot be
+-- removed along with the record it protects.
+
+CREATE TABLE `legal_holds` (
+  `Id` int(11) NOT NULL AUTO_INCREMENT,
+  `IdPasien` int(11) DEFAULT NULL,
+  `IdKunjungan` int(11) DEFAULT NULL,
+  `Reason` text NOT NULL,
+  `PlacedBy` int(11) NOT NULL,
+  `PlacedAt` datetime NOT NULL DEFAULT current_timestamp(),
+  `ExpiresAt` datetime DEFAULT NULL,
+  `ReleasedBy` int(11) DEFAULT NULL,
+  `ReleasedAt` datetime DEFAULT NULL,
+  PRIMARY KEY (`Id`),
+  KEY `legal_holds_IdPasien_IDX` (`IdPasien`),
+  KEY `legal_holds_IdKunjungan_IDX` (`IdKunjungan`),
+  CONSTRAINT `legal_holds_pasien_FK` FOREIGN KEY (`IdPasien`) REFERENCES `pasien` (`Id`) ON DELETE RESTRICT ON UPDATE CASCADE,
+  CONSTRAINT `legal_holds_kunjungan_FK` FOREIGN KEY (`IdKunjungan`) REFERENCES `kunjungan` (`Id`) ON DELETE RESTRICT ON UPDATE CASCADE,
+  CONSTRAINT `legal_holds_placed_by_FK` FOREIGN KEY (`PlacedBy`) REFERENCES `users` (`Id`),
+  CONSTRAINT `legal_holds_released_by_FK` FOREIGN KEY (`ReleasedBy`) REFERENCES `users` (`Id`),
+  CONSTRAINT `legal_holds_target_CHK` CHECK ((`IdPasien` IS NULL) <> (`IdKunjungan` IS NULL))
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
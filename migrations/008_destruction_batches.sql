@@ -0,0 +1,42 @@
+-- Pemusnahan is now carried out in batches: a batch is proposed (draft),
+-- submitted for review, approved by enough committee members other than the
+-- proposer, and only then executed, which marks its records destroyed. A
+-- kunjungan in a batch cannot be deleted (ON DELETE RESTRICT), so the records
+-- behind a berita acara stay as they were signed.
+
+CREATE TABLE `destruction_batches` (
+  `Id` int(11) NOT NULL AUTO_INCREMENT,
+  `Nama` varchar(150) NOT NULL,
+  `Keterangan` text DEFAULT NULL,
+  `State` enum('draft','submitted','approved','executed') NOT NULL DEFAULT 'draft',
+  `ProposedBy` int(11) NOT NULL,
+  `RequiredApprovals` int(11) NOT NULL DEFAULT 2,
+  `CreatedAt` datetime NOT NULL DEFAULT current_timestamp(),
+  `SubmittedAt` datetime DEFAULT NULL,
+  `ApprovedAt` datetime DEFAULT NULL,
+  `ExecutedAt` datetime DEFAULT NULL,
+  `ExecutedBy` int(11) DEFAULT NULL,
+  PRIMARY KEY (`Id`),
+  KEY `destruction_batches_State_IDX` (`State`),
+  CONSTRAINT `destruction_batches_proposed_by_FK` FOREIGN KEY (`ProposedBy`) REFERENCES `users` (`Id`),
+  CONSTRAINT `destruction_batches_executed_by_FK` FOREIGN KEY (`ExecutedBy`) REFERENCES `users` (`Id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+CREATE TABLE `destruction_batch_items` (
+  `IdBatch` int(11) NOT NULL,
+  `IdKunjungan` int(11) NOT NULL,
+  PRIMARY KEY (`IdBatch`, `IdKunjungan`),
+  KEY `destruction_batch_items_IdKunjungan_IDX` (`IdKunjungan`),
+  CONSTRAINT `destruction_batch_items_batch_FK` FOREIGN KEY (`IdBatch`) REFERENCES `destruction_batches` (`Id`) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT `destruction_batch_items_kunjungan_FK` FOREIGN KEY (`IdKunjungan`) REFERENCES `kunjungan` (`Id`) ON DELETE RESTRICT ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+CREATE TABLE `destruction_batch_approvals` (
+  `IdBatch` int(11) NOT NULL,
+  `IdUser` int(11) NOT NULL,
+  `Catatan` text DEFAULT NULL,
+  `CreatedAt` datetime NOT NULL DEFAULT current_timestamp(),
+  PRIMARY KEY (`IdBatch`, `IdUser`),
+  CONSTRAINT `destruction_batch_approvals_batch_FK` FOREIGN KEY (`IdBatch`) REFERENCES `destruction_batches` (`Id`) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT `destruction_batch_approvals_user_FK` FOREIGN KEY (`IdUser`) REFERENCES `users` (`Id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
@@ -0,0 +1,18 @@
+-- Berita acara pemusnahan: the signed-off minutes generated for an executed
+-- destruction batch. Documents are numbered sequentially within a year.
+
+CREATE TABLE `berita_acara` (
+  `Id` int(11) NOT NULL AUTO_INCREMENT,
+  `IdBatch` int(11) NOT NULL,
+  `Tahun` int(11) NOT NULL,
+  `Urutan` int(11) NOT NULL,
+  `Nomor` varchar(100) NOT NULL,
+  `FilePath` varchar(255) NOT NULL,
+  `CreatedBy` int(11) NOT NULL,
+  `CreatedAt` datetime NOT NULL DEFAULT current_timestamp(),
+  PRIMARY KEY (`Id`),
+  UNIQUE KEY `berita_acara_IdBatch_UN` (`IdBatch`),
+  UNIQUE KEY `berita_acara_Tahun_Urutan_UN` (`Tahun`, `Urutan`),
+  CONSTRAINT `berita_acara_batch_FK` FOREIGN KEY (`IdBatch`) REFERENCES `destruction_batches` (`Id`) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT `berita_acara_created_by_FK` FOREIGN KEY (`CreatedBy`) REFERENCES `users` (`Id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
@@ -0,0 +1,21 @@
+-- Audit trail of every create, update and delete made through the API or by
+-- the cron jobs. Rows are append-only; ActorId is NULL for system changes.
+
+CREATE TABLE `audit_log` (
+  `Id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `ActorId` int(11) DEFAULT NULL,
+  `ActorRole` varchar(50) DEFAULT NULL,
+  `Action` varchar(20) NOT NULL,
+  `Entity` varchar(50) NOT NULL,
+  `EntityId` varchar(64) NOT NULL,
+  `Before` longtext DEFAULT NULL,
+  `After` longtext DEFAULT NULL,
+  `Diff` longtext DEFAULT NULL,
+  `Ip` varchar(64) DEFAULT NULL,
+  `RequestId` varchar(128) DEFAULT NULL,
+  `CreatedAt` datetime(6) NOT NULL,
+  PRIMARY KEY (`Id`),
+  KEY `audit_log_Entity_IDX` (`Entity`, `EntityId`),
+  KEY `audit_log_ActorId_IDX` (`ActorId`),
+  KEY `audit_log_CreatedAt_IDX` (`CreatedAt`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
@@ -0,0 +1,19 @@
+-- Tamper evidence for audit_log. Every row stores the SHA-256 of its content
+-- chained to the previous row's hash, so editing or deleting a row breaks the
+-- chain from that point on. audit_chain holds the hash of the newest row and
+-- is locked while a batch is appended, which keeps the chain in Id order when
+-- several instances write at once. Rows written before this migration have no
+-- hash and are reported as unchained by the verification.
+
+ALTER TABLE `audit_log`
+  ADD COLUMN `PrevHash` char(64) DEFAULT NULL,
+  ADD COLUMN `Hash` char(64) DEFAULT NULL;
+
+CREATE TABLE `audit_chain` (
+  `Name` varchar(50) NOT NULL,
+  `LastId` bigint(20) DEFAULT NULL,
+  `Hash` char(64) NOT NULL DEFAULT '',
+  PRIMARY KEY (`Name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+INSERT INTO `audit_chain` (`Name`, `LastId`, `Hash`) VALUES ('audit_log', NULL, '');
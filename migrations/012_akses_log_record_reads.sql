@@ -0,0 +1,9 @@
+-- Reads of patient records are logged to akses_log. IdPasien and Endpoint
+-- identify what was viewed; there is deliberately no foreign key on IdPasien
+-- so the trail outlives a deleted pasien.
+
+ALTER TABLE `akses_log`
+  ADD COLUMN `IdPasien` int(11) DEFAULT NULL,
+  ADD COLUMN `Endpoint` varchar(255) DEFAULT NULL,
+  ADD COLUMN `Ip` varchar(64) DEFAULT NULL,
+  ADD KEY `akses_log_IdPasien_IDX` (`IdPasien`, `Id`);
@@ -0,0 +1,17 @@
+-- One row per login. The refresh token is only stored as a SHA-256 hash and
+-- is replaced on every refresh; access tokens carry the session Id so a
+-- revoked session stops working immediately.
+
+CREATE TABLE `user_sessions` (
+  `Id` char(32) NOT NULL,
+  `IdUser` int(11) NOT NULL,
+  `TokenHash` char(64) NOT NULL,
+  `Ip` varchar(64) DEFAULT NULL,
+  `CreatedAt` datetime NOT NULL DEFAULT current_timestamp(),
+  `LastUsedAt` datetime DEFAULT NULL,
+  `ExpiresAt` datetime NOT NULL,
+  `RevokedAt` datetime DEFAULT NULL,
+  PRIMARY KEY (`Id`),
+  KEY `user_sessions_IdUser_IDX` (`IdUser`, `RevokedAt`),
+  CONSTRAINT `user_sessions_user_FK` FOREIGN KEY (`IdUser`) REFERENCES `users` (`Id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
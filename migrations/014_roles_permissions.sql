@@ -0,0 +1,67 @@
+-- Roles and the permissions they grant. Permission names are defined in
+-- internal/rbac; admin is a system role that implicitly has all of them.
+-- Existing non-admin accounts become viewers and have to be given a role
+-- with write access by an admin.
+
+CREATE TABLE `roles` (
+  `Name` varchar(50) NOT NULL,
+  `Description` varchar(255) NOT NULL DEFAULT '',
+  `IsSystem` tinyint(1) NOT NULL DEFAULT 0,
+  `CreatedAt` datetime NOT NULL DEFAULT current_timestamp(),
+  PRIMARY KEY (`Name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+CREATE TABLE `role_permissions` (
+  `Role` varchar(50) NOT NULL,
+  `Permission` varchar(64) NOT NULL,
+  PRIMARY KEY (`Role`, `Permission`),
+  CONSTRAINT `role_permissions_role_FK` FOREIGN KEY (`Role`) REFERENCES `roles` (`Name`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+INSERT INTO `roles` (`Name`, `Description`, `IsSystem`) VALUES
+  ('admin', 'Full access', 1),
+  ('records_officer', 'Maintains patient records and proposes destruction', 0),
+  ('viewer', 'Read-only access to records', 0),
+  ('destruction_committee', 'Reviews and approves destruction batches', 0);
+
+INSERT INTO `role_permissions` (`Role`, `Permission`) VALUES
+  ('records_officer', 'pasien:read'),
+  ('records_officer', 'pasien:write'),
+  ('records_officer', 'kunjungan:read'),
+  ('records_officer', 'kunjungan:write'),
+  ('records_officer', 'kasus:read'),
+  ('records_officer', 'kasus:write'),
+  ('records_officer', 'dokumen:read'),
+  ('records_officer', 'info_sistem:read'),
+  ('records_officer', 'alih_media:read'),
+  ('records_officer', 'alih_media:write'),
+  ('records_officer', 'retensi:read'),
+  ('records_officer', 'retensi:write'),
+  ('records_officer', 'pemusnahan:read'),
+  ('records_officer', 'pemusnahan:write'),
+  ('records_officer', 'legal_hold:read'),
+  ('records_officer', 'report:read'),
+  ('viewer', 'pasien:read'),
+  ('viewer', 'kunjungan:read'),
+  ('viewer', 'kasus:read'),
+  ('viewer', 'dokumen:read'),
+  ('viewer', 'info_sistem:read'),
+  ('viewer', 'alih_media:read'),
+  ('viewer', 'retensi:read'),
+  ('viewer', 'pemusnahan:read'),
+  ('viewer', 'legal_hold:read'),
+  ('viewer', 'report:read'),
+  ('destruction_committee', 'pasien:read'),
+  ('destruction_committee', 'kunjungan:read'),
+  ('destruction_committee', 'kasus:read'),
+  ('destruction_committee', 'retensi:read'),
+  ('destruction_committee', 'pemusnahan:read'),
+  ('destruction_committee', 'pemusnahan:approve'),
+  ('destruction_committee', 'legal_hold:read'),
+  ('destruction_committee', 'report:read');
+
+UPDATE `users` SET `Role` = 'viewer' WHERE `Role` NOT IN (SELECT `Name` FROM `roles`);
+
+ALTER TABLE `users`
+  MODIFY `Role` varchar(50) NOT NULL DEFAULT 'viewer',
+  ADD CONSTRAINT `users_role_FK` FOREIGN KEY (`Role`) REFERENCES `roles` (`Name`) ON UPDATE CASCADE;
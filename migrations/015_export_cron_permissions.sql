@@ -0,0 +1,7 @@
+-- Exports and the /cron routes now need permissions. Records officers keep
+-- being able to export and to see what the scheduled jobs will do;
+-- triggering jobs by hand is left to admins.
+
+INSERT INTO `role_permissions` (`Role`, `Permission`) VALUES
+  ('records_officer', 'data:export'),
+  ('records_officer', 'cron:read');
@@ -0,0 +1,16 @@
+-- One-time tokens for POST /password/reset. Only the SHA-256 of the token is
+-- stored; a token is spent by setting UsedAt.
+
+CREATE TABLE `password_resets` (
+  `Id` int(11) NOT NULL AUTO_INCREMENT,
+  `IdUser` int(11) NOT NULL,
+  `TokenHash` char(64) NOT NULL,
+  `Ip` varchar(64) DEFAULT NULL,
+  `CreatedAt` datetime NOT NULL DEFAULT current_timestamp(),
+  `ExpiresAt` datetime NOT NULL,
+  `UsedAt` datetime DEFAULT NULL,
+  PRIMARY KEY (`Id`),
+  UNIQUE KEY `password_resets_TokenHash_IDX` (`TokenHash`),
+  KEY `password_resets_IdUser_IDX` (`IdUser`),
+  CONSTRAINT `password_resets_user_FK` FOREIGN KEY (`IdUser`) REFERENCES `users` (`Id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
@@ -0,0 +1,29 @@
+-- Self-registration: a new account has to verify its email, then wait in the
+-- approval queue (SelfRegistered, verified, ApprovedAt NULL) until an admin
+-- approves it. Every account that exists today counts as verified and
+-- approved, whatever its status, so none of them can be rejected or purged.
+
+ALTER TABLE `users`
+  ADD COLUMN `SelfRegistered` tinyint(1) NOT NULL DEFAULT 0,
+  ADD COLUMN `EmailVerifiedAt` datetime DEFAULT NULL,
+  ADD COLUMN `ApprovedAt` datetime DEFAULT NULL,
+  ADD COLUMN `ApprovedBy` int(11) DEFAULT NULL,
+  ADD CONSTRAINT `users_approved_by_FK` FOREIGN KEY (`ApprovedBy`) REFERENCES `users` (`Id`) ON DELETE SET NULL;
+
+UPDATE `users` SET `EmailVerifiedAt` = `CreatedAt`, `ApprovedAt` = `CreatedAt`;
+
+CREATE TABLE `email_verifications` (
+  `Id` int(11) NOT NULL AUTO_INCREMENT,
+  `IdUser` int(11) NOT NULL,
+  `TokenHash` char(64) NOT NULL,
+  `CreatedAt` datetime NOT NULL DEFAULT current_timestamp(),
+  `ExpiresAt` datetime NOT NULL,
+  `UsedAt` datetime DEFAULT NULL,
+  PRIMARY KEY (`Id`),
+  UNIQUE KEY `email_verifications_TokenHash_IDX` (`TokenHash`),
+  KEY `email_verifications_IdUser_IDX` (`IdUser`),
+  CONSTRAINT `email_verifications_user_FK` FOREIGN KEY (`IdUser`) REFERENCES `users` (`Id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+INSERT INTO `cron_jobs` (`Name`, `Expression`, `Timezone`, `Enabled`) VALUES
+('registration_purge', '30 2 * * *', 'Asia/Jakarta', 1);
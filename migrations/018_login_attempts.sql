@@ -0,0 +1,13 @@
+-- Failed login counters for POST /login, one row per account (Scope
+-- 'account', Identifier the lowercased email) and per client IP (Scope 'ip').
+-- A row with LockedUntil in the future blocks further attempts.
+
+CREATE TABLE `login_attempts` (
+  `Scope` varchar(16) NOT NULL,
+  `Identifier` varchar(255) NOT NULL,
+  `Failures` int(11) NOT NULL DEFAULT 0,
+  `LastFailedAt` datetime NOT NULL,
+  `LockedUntil` datetime DEFAULT NULL,
+  PRIMARY KEY (`Scope`, `Identifier`),
+  KEY `login_attempts_LockedUntil_IDX` (`LockedUntil`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
@@ -0,0 +1,30 @@
+-- TOTP second factor. A user_two_factor row with EnabledAt NULL is an
+-- enrollment that has not been confirmed with a code yet. LastUsedStep is the
+-- TOTP time step of the last accepted code, so a code cannot be replayed.
+-- Recovery codes are stored as SHA-256 hashes and spent by setting UsedAt.
+
+ALTER TABLE `roles`
+  ADD COLUMN `RequireTwoFactor` tinyint(1) NOT NULL DEFAULT 0 AFTER `IsSystem`;
+
+UPDATE `roles` SET `RequireTwoFactor` = 1 WHERE `Name` IN ('admin', 'destruction_committee');
+
+CREATE TABLE `user_two_factor` (
+  `IdUser` int(11) NOT NULL,
+  `Secret` varchar(64) NOT NULL,
+  `EnabledAt` datetime DEFAULT NULL,
+  `LastUsedStep` bigint(20) NOT NULL DEFAULT 0,
+  `CreatedAt` datetime NOT NULL DEFAULT current_timestamp(),
+  PRIMARY KEY (`IdUser`),
+  CONSTRAINT `user_two_factor_user_FK` FOREIGN KEY (`IdUser`) REFERENCES `users` (`Id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+CREATE TABLE `recovery_codes` (
+  `Id` int(11) NOT NULL AUTO_INCREMENT,
+  `IdUser` int(11) NOT NULL,
+  `CodeHash` char(64) NOT NULL,
+  `CreatedAt` datetime NOT NULL DEFAULT current_timestamp(),
+  `UsedAt` datetime DEFAULT NULL,
+  PRIMARY KEY (`Id`),
+  UNIQUE KEY `recovery_codes_IdUser_CodeHash_IDX` (`IdUser`, `CodeHash`),
+  CONSTRAINT `recovery_codes_user_FK` FOREIGN KEY (`IdUser`) REFERENCES `users` (`Id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
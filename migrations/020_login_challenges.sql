@@ -0,0 +1,14 @@
+-- Challenges handed out by POST /login when a second factor is needed. The
+-- challenge token carries the Id; POST /login/2fa sets UsedAt so the same
+-- token cannot start a second session.
+
+CREATE TABLE `login_challenges` (
+  `Id` char(32) NOT NULL,
+  `IdUser` int(11) NOT NULL,
+  `CreatedAt` datetime NOT NULL DEFAULT current_timestamp(),
+  `ExpiresAt` datetime NOT NULL,
+  `UsedAt` datetime DEFAULT NULL,
+  PRIMARY KEY (`Id`),
+  KEY `login_challenges_ExpiresAt_IDX` (`ExpiresAt`),
+  CONSTRAINT `login_challenges_user_FK` FOREIGN KEY (`IdUser`) REFERENCES `users` (`Id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
@@ -10,13 +10,16 @@ import (
 
 var secret = []byte(os.Getenv("JWT_SECRET"))
 
-func CreateToken(id int, email, status, role string) (string, error) {
+// CreateToken issues an access token for a login session. It is only valid
+// while the session sid has not been revoked.
+func CreateToken(id int, email, status, role, sid string, ttl time.Duration) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
 		"user_id": id,
 		"email":   email,
 		"role":    role,
 		"status":  status,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+		"sid":     sid,
+		"exp":     time.Now().Add(ttl).Unix(),
 	})
 
 	tokenStr, err := token.SignedString(secret)
@@ -27,6 +30,38 @@ func CreateToken(id int, email, status, role string) (string, error) {
 	return tokenStr, nil
 }
 
+// CreateChallengeToken issues the token handed out after a correct password
+// when a second factor is still needed. cid names the stored challenge that
+// makes the token single-use. It carries no session, so it is not accepted as
+// an access token.
+func CreateChallengeToken(id int, cid string, ttl time.Duration) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
+		"user_id": id,
+		"cid":     cid,
+		"purpose": "2fa",
+		"exp":     time.Now().Add(ttl).Unix(),
+	})
+
+	return token.SignedString(secret)
+}
+
+// VerifyChallengeToken returns the user and challenge id a challenge token
+// was issued for.
+func VerifyChallengeToken(tokenStr string) (int, string, error) {
+	claims, err := VerifyToken(tokenStr)
+	if err != nil {
+		return 0, "", err
+	}
+
+	uid, ok := claims["user_id"].(float64)
+	cid, okCid := claims["cid"].(string)
+	if purpose, _ := claims["purpose"].(string); !ok || !okCid || purpose != "2fa" {
+		return 0, "", jwt.ErrTokenInvalidClaims
+	}
+
+	return int(uid), cid, nil
+}
+
 func VerifyToken(tokenStr string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -65,3 +100,15 @@ func GetUserRoleFromCtx(ctx context.Context) string {
 	}
 	return role
 }
+
+func SetSessionIDToCtx(ctx context.Context, sid string) context.Context {
+	return context.WithValue(ctx, "sessionID", sid)
+}
+
+func GetSessionIDFromCtx(ctx context.Context) string {
+	sid, ok := ctx.Value("sessionID").(string)
+	if !ok {
+		return ""
+	}
+	return sid
+}
@@ -80,3 +80,29 @@ func LogActivity(userID, message, status string) error {
 func LogPasien(userID, message, status string) error {
 	return CreateLog(PasienLog, userID, message, status)
 }
+
+// LogRecordAccess records in akses_log that a user read a patient's record
+// through endpoint.
+func LogRecordAccess(userID, idPasien int, endpoint, ip string) error {
+	if db == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+
+	now := time.Now()
+	query := "INSERT INTO akses_log (Tanggal, Waktu, User, Message, Status, IdPasien, Endpoint, Ip) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err := db.Exec(query,
+		now.Format("2006-01-02"),
+		now.Format("15:04:05"),
+		userID,
+		fmt.Sprintf("Viewed pasien %d via %s", idPasien, endpoint),
+		"success",
+		idPasien,
+		endpoint,
+		ip,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create %s log: %w", AccessLog, err)
+	}
+
+	return nil
+}
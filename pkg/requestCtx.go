@@ -0,0 +1,24 @@
+package pkg
+
+import (
+	"context"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func SetClientIPToCtx(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, "clientIP", ip)
+}
+
+func GetClientIPFromCtx(ctx context.Context) string {
+	ip, ok := ctx.Value("clientIP").(string)
+	if !ok {
+		return ""
+	}
+	return ip
+}
+
+// GetRequestIDFromCtx returns the id assigned by chi's RequestID middleware.
+func GetRequestIDFromCtx(ctx context.Context) string {
+	return middleware.GetReqID(ctx)
+}
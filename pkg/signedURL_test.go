@@ -0,0 +1,124 @@
+package pkg
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signedTestURL(t *testing.T, target string, link SignedLink) *url.URL {
+	t.Helper()
+
+	signed, err := SignURL(target, link)
+	if err != nil {
+		t.Fatalf("SignURL(%q): %v", target, err)
+	}
+
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("parse %q: %v", signed, err)
+	}
+	return u
+}
+
+func TestVerifySignedURL(t *testing.T) {
+	secret = []byte("signed-url-test-secret")
+
+	link := SignedLink{UserID: 7, SessionID: "sess-1", ExpiresAt: time.Now().Add(time.Minute).Truncate(time.Second)}
+	u := signedTestURL(t, "/api/v2/exports/kunjungan?status=aktif&year=2024", link)
+
+	got, err := VerifySignedURL(u)
+	if err != nil {
+		t.Fatalf("VerifySignedURL: %v", err)
+	}
+	if *got != link {
+		t.Errorf("VerifySignedURL = %+v, want %+v", *got, link)
+	}
+
+	// The order the parameters arrive in does not matter.
+	params := strings.Split(u.RawQuery, "&")
+	slices.Reverse(params)
+	reordered := *u
+	reordered.RawQuery = strings.Join(params, "&")
+	if _, err := VerifySignedURL(&reordered); err != nil {
+		t.Errorf("reordered query: %v", err)
+	}
+}
+
+func TestVerifySignedURLTampered(t *testing.T) {
+	secret = []byte("signed-url-test-secret")
+
+	link := SignedLink{UserID: 7, SessionID: "sess-1", ExpiresAt: time.Now().Add(time.Minute)}
+
+	tests := []struct {
+		name   string
+		tamper func(u *url.URL)
+	}{
+		{"other path", func(u *url.URL) { u.Path = "/api/v2/exports/pasien" }},
+		{"other user", func(u *url.URL) { setParam(u, SignedUserParam, "1") }},
+		{"other session", func(u *url.URL) { setParam(u, SignedSessionParam, "sess-2") }},
+		{"later expiry", func(u *url.URL) {
+			setParam(u, SignedExpiresParam, strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		}},
+		{"changed filter", func(u *url.URL) { setParam(u, "year", "2023") }},
+		{"added filter", func(u *url.URL) { setParam(u, "status", "inaktif") }},
+		{"role added", func(u *url.URL) { setParam(u, "dl_role", "admin") }},
+		{"missing signature", func(u *url.URL) { delParam(u, SignedSigParam) }},
+		{"signature of another key", func(u *url.URL) {
+			saved := secret
+			secret = []byte("another-secret")
+			other := signedTestURL(t, "/api/v2/exports/kunjungan?year=2024", link)
+			secret = saved
+			u.RawQuery = other.RawQuery
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := signedTestURL(t, "/api/v2/exports/kunjungan?year=2024", link)
+			tt.tamper(u)
+
+			if _, err := VerifySignedURL(u); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("VerifySignedURL err = %v, want %v", err, ErrInvalidSignature)
+			}
+		})
+	}
+}
+
+func TestVerifySignedURLExpired(t *testing.T) {
+	secret = []byte("signed-url-test-secret")
+
+	for _, expiresAt := range []time.Time{time.Now().Add(-time.Second), time.Now().Add(-24 * time.Hour)} {
+		u := signedTestURL(t, "/api/v2/exports/kunjungan", SignedLink{UserID: 7, SessionID: "sess-1", ExpiresAt: expiresAt})
+
+		if _, err := VerifySignedURL(u); !errors.Is(err, ErrLinkExpired) {
+			t.Errorf("link expired at %s: err = %v, want %v", expiresAt, err, ErrLinkExpired)
+		}
+	}
+}
+
+func TestSignURLRejectsAbsoluteURLs(t *testing.T) {
+	link := SignedLink{UserID: 7, SessionID: "sess-1", ExpiresAt: time.Now().Add(time.Minute)}
+
+	for _, target := range []string{"https://example.com/api/v2/exports/kunjungan", "//example.com/x", "exports/kunjungan", ""} {
+		if _, err := SignURL(target, link); err == nil {
+			t.Errorf("SignURL(%q) succeeded, want an error", target)
+		}
+	}
+}
+
+func setParam(u *url.URL, key, value string) {
+	query := u.Query()
+	query.Set(key, value)
+	u.RawQuery = query.Encode()
+}
+
+func delParam(u *url.URL, key string) {
+	query := u.Query()
+	query.Del(key)
+	u.RawQuery = query.Encode()
+}
@@ -0,0 +1,135 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+// The SHA1 seed of RFC 6238 appendix B, "12345678901234567890", base32
+// encoded.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The SHA1 test vectors of RFC 6238 appendix B. The RFC lists 8 digit codes;
+// a 6 digit code is their last 6 digits.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestValidateTOTPVectors(t *testing.T) {
+	for _, tt := range rfc6238Vectors {
+		at := time.Unix(tt.unix, 0)
+
+		step, ok := ValidateTOTP(rfc6238Secret, tt.code, at)
+		if !ok {
+			t.Errorf("ValidateTOTP(%q) at %d rejected the RFC 6238 code", tt.code, tt.unix)
+			continue
+		}
+		if want := tt.unix / totpPeriod; step != want {
+			t.Errorf("ValidateTOTP(%q) at %d = step %d, want %d", tt.code, tt.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	// 287082 belongs to step 1, the 30 seconds starting at unix time 30.
+	const code = "287082"
+
+	tests := []struct {
+		unix   int64
+		wantOK bool
+	}{
+		{0, true},    // one step early
+		{29, true},   // last second of the step before
+		{30, true},   // first second of its own step
+		{59, true},   // last second of its own step
+		{60, true},   // one step late
+		{89, true},   // last second one step late
+		{90, false},  // two steps late
+		{150, false}, // four steps late
+	}
+
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfc6238Secret, code, time.Unix(tt.unix, 0))
+		if ok != tt.wantOK {
+			t.Errorf("ValidateTOTP(%q) at %d = %v, want %v", code, tt.unix, ok, tt.wantOK)
+			continue
+		}
+		if ok && step != 1 {
+			t.Errorf("ValidateTOTP(%q) at %d = step %d, want the code's own step 1", code, tt.unix, step)
+		}
+	}
+
+	// Two steps early: the code of step 3 at step 1.
+	if _, ok := ValidateTOTP(rfc6238Secret, totpCode(mustDecodeTOTP(t, rfc6238Secret), 3), time.Unix(59, 0)); ok {
+		t.Error("a code two steps ahead was accepted")
+	}
+}
+
+func TestValidateTOTPRejects(t *testing.T) {
+	at := time.Unix(59, 0)
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+	}{
+		{"wrong code", rfc6238Secret, "287083"},
+		{"8 digit code", rfc6238Secret, "94287082"},
+		{"short code", rfc6238Secret, "28708"},
+		{"empty code", rfc6238Secret, ""},
+		{"other secret", "JBSWY3DPEHPK3PXP", "287082"},
+		{"malformed secret", "not base32!", "287082"},
+	}
+
+	for _, tt := range tests {
+		if _, ok := ValidateTOTP(tt.secret, tt.code, at); ok {
+			t.Errorf("%s: ValidateTOTP(%q, %q) accepted the code", tt.name, tt.secret, tt.code)
+		}
+	}
+}
+
+func TestValidateTOTPSecretFormat(t *testing.T) {
+	at := time.Unix(59, 0)
+
+	// Secrets typed in by hand may be lower case or carry base32 padding.
+	for _, secret := range []string{"gezdgnbvgy3tqojqgezdgnbvgy3tqojq", rfc6238Secret + "===="} {
+		if _, ok := ValidateTOTP(secret, "287082", at); !ok {
+			t.Errorf("ValidateTOTP with secret %q rejected the code", secret)
+		}
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+
+	key := mustDecodeTOTP(t, secret)
+	if len(key) != 20 {
+		t.Errorf("secret is %d bytes, want 20", len(key))
+	}
+
+	now := time.Now()
+	if _, ok := ValidateTOTP(secret, totpCode(key, now.Unix()/totpPeriod), now); !ok {
+		t.Error("the current code of a new secret was rejected")
+	}
+}
+
+func mustDecodeTOTP(t *testing.T, secret string) []byte {
+	t.Helper()
+
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decode %q: %v", secret, err)
+	}
+	return key
+}